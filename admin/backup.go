@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Snapshotter is an interface that wraps WriteSnapshot method.
+//
+// WriteSnapshot is used to write a consistent copy of the database into w.
+type Snapshotter interface {
+	WriteSnapshot(w io.Writer) (int64, error)
+}
+
+// BackupHandler streams a database snapshot in response to GET requests.
+type BackupHandler struct {
+	db Snapshotter
+}
+
+// NewBackupHandler returns an instance of *BackupHandler that responds with snapshots of db.
+func NewBackupHandler(db Snapshotter) *BackupHandler {
+	return &BackupHandler{db: db}
+}
+
+func (h *BackupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Only GET requests are supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="michael-`+time.Now().UTC().Format("20060102T150405Z")+`.db"`)
+
+	if n, err := h.db.WriteSnapshot(w); err != nil {
+		// Headers have most likely been sent already, so the best we can do is to abort the response
+		log.Printf("failed to stream deploy DB snapshot after %d bytes: %s", n, err)
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,60 @@
+package admin_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andrewslotin/michael/admin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type snapshotterFunc func(io.Writer) (int64, error)
+
+func (fn snapshotterFunc) WriteSnapshot(w io.Writer) (int64, error) {
+	return fn(w)
+}
+
+func TestBackupHandler(t *testing.T) {
+	db := snapshotterFunc(func(w io.Writer) (int64, error) {
+		n, err := io.WriteString(w, "snapshot data")
+		return int64(n), err
+	})
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/admin/backup", nil)
+	require.NoError(t, err)
+
+	admin.NewBackupHandler(db).ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/octet-stream", recorder.Header().Get("Content-Type"))
+	assert.Regexp(t, `^attachment; filename="michael-\d{8}T\d{6}Z\.db"$`, recorder.Header().Get("Content-Disposition"))
+	assert.Equal(t, "snapshot data", recorder.Body.String())
+}
+
+func TestBackupHandler_SnapshotError(t *testing.T) {
+	db := snapshotterFunc(func(w io.Writer) (int64, error) {
+		return 0, errors.New("disk is on fire")
+	})
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/admin/backup", nil)
+	require.NoError(t, err)
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		admin.NewBackupHandler(db).ServeHTTP(recorder, req)
+	})
+}
+
+func TestBackupHandler_MethodNotAllowed(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/admin/backup", nil)
+	require.NoError(t, err)
+
+	admin.NewBackupHandler(nil).ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
@@ -0,0 +1,52 @@
+package admin
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Revoker is an interface that wraps Revoke method.
+//
+// Revoke is used to add token ID to the revocation list until expiresAt.
+type Revoker interface {
+	Revoke(tokenID string, expiresAt time.Time) error
+}
+
+// RevocationHandler revokes dashboard tokens which IDs (jti claim) are sent in POST requests.
+type RevocationHandler struct {
+	list          Revoker
+	tokenLifetime time.Duration
+}
+
+// NewRevocationHandler returns an instance of *RevocationHandler that adds token IDs to list. Since the
+// expiration time of a revoked token is unknown, token IDs are kept in the list for tokenLifetime.
+func NewRevocationHandler(list Revoker, tokenLifetime time.Duration) *RevocationHandler {
+	return &RevocationHandler{
+		list:          list,
+		tokenLifetime: tokenLifetime,
+	}
+}
+
+func (h *RevocationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Only POST requests are supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tokenID := r.FormValue("jti")
+	if tokenID == "" {
+		http.Error(w, "Missing jti parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.list.Revoke(tokenID, time.Now().Add(h.tokenLifetime)); err != nil {
+		log.Printf("failed to revoke token %s: %s", tokenID, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("token %s has been revoked", tokenID)
+	fmt.Fprintf(w, "Token %s has been revoked\n", tokenID)
+}
@@ -0,0 +1,77 @@
+package admin_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/admin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type revokerFunc func(string, time.Time) error
+
+func (fn revokerFunc) Revoke(tokenID string, expiresAt time.Time) error {
+	return fn(tokenID, expiresAt)
+}
+
+func TestRevocationHandler(t *testing.T) {
+	var revoked []string
+	list := revokerFunc(func(tokenID string, expiresAt time.Time) error {
+		assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Second)
+		revoked = append(revoked, tokenID)
+
+		return nil
+	})
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/admin/revoke", strings.NewReader(url.Values{"jti": {"jti1"}}.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	admin.NewRevocationHandler(list, time.Hour).ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, []string{"jti1"}, revoked)
+}
+
+func TestRevocationHandler_MissingTokenID(t *testing.T) {
+	list := revokerFunc(func(string, time.Time) error {
+		t.Error("unexpected call to Revoke")
+		return nil
+	})
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/admin/revoke", nil)
+	require.NoError(t, err)
+
+	admin.NewRevocationHandler(list, time.Hour).ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestRevocationHandler_MethodNotAllowed(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/admin/revoke?jti=jti1", nil)
+	require.NoError(t, err)
+
+	admin.NewRevocationHandler(revokerFunc(nil), time.Hour).ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestRevocationHandler_StoreError(t *testing.T) {
+	list := revokerFunc(func(string, time.Time) error {
+		return errors.New("store is unavailable")
+	})
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/admin/revoke?jti=jti1", nil)
+	require.NoError(t, err)
+
+	admin.NewRevocationHandler(list, time.Hour).ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
@@ -0,0 +1,69 @@
+// Package audit keeps track of actions performed by deploy bot users.
+package audit
+
+import (
+	"log"
+	"time"
+
+	"github.com/andrewslotin/michael/slack"
+)
+
+// Source tells where an audited action has come from.
+type Source string
+
+const (
+	// SourceSlack marks slash commands.
+	SourceSlack Source = "slack"
+	// SourceDashboard marks dashboard access.
+	SourceDashboard Source = "dashboard"
+	// SourceAPI marks HTTP API calls.
+	SourceAPI Source = "api"
+)
+
+// Outcome describes the result of an audited action.
+type Outcome string
+
+const (
+	// Succeeded means that the action has been performed.
+	Succeeded Outcome = "succeeded"
+	// Failed means that the action could not be performed, e.g. because there was no deploy to finish or
+	// because of an internal error.
+	Failed Outcome = "failed"
+	// Denied means that the user was not permitted to perform an action.
+	Denied Outcome = "denied"
+)
+
+// Entry is a single record in the audit log.
+type Entry struct {
+	Time      time.Time  `json:"time"`
+	Source    Source     `json:"source"`
+	ChannelID string     `json:"channel_id,omitempty"`
+	User      slack.User `json:"user"`
+	// Text is the raw command text sent by user or the HTTP method and path of an API call.
+	Text    string  `json:"text"`
+	Outcome Outcome `json:"outcome"`
+	// Details is a human-readable explanation of the outcome.
+	Details string `json:"details,omitempty"`
+}
+
+// Log is an interface implemented by audit log backends. Implementations are expected to fill in the time
+// of entries that do not have it.
+type Log interface {
+	Append(e Entry) error
+}
+
+// Reader is an interface implemented by audit log backends that can list logged entries.
+type Reader interface {
+	// Entries returns entries logged for channel in chronological order. Entries that are not related to
+	// any channel, such as API calls, are logged with an empty channel ID.
+	Entries(channelID string) ([]Entry, error)
+}
+
+// StdLogger writes audit entries using standard logger.
+type StdLogger struct{}
+
+// Append writes e to the standard logger.
+func (StdLogger) Append(e Entry) error {
+	log.Printf("audit: %s %s (%s) in %s %q: %s, %s", e.Source, e.User.Name, e.User.ID, e.ChannelID, e.Text, e.Outcome, e.Details)
+	return nil
+}
@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// APIMiddleware wraps an http.Handler and logs every request to it as an API call. The outcome of a call
+// is derived from the response status code.
+func APIMiddleware(h http.Handler, l Log) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		defer func() {
+			entry := Entry{
+				Time:    time.Now().UTC(),
+				Source:  SourceAPI,
+				Text:    r.Method + " " + r.URL.Path,
+				Outcome: statusOutcome(rec.status),
+				Details: fmt.Sprintf("%d %s from %s", rec.status, http.StatusText(rec.status), r.RemoteAddr),
+			}
+
+			// The handler may abort the response by panicking after it has been started
+			p := recover()
+			if p != nil {
+				entry.Outcome, entry.Details = Failed, fmt.Sprintf("aborted response to %s", r.RemoteAddr)
+			}
+
+			if err := l.Append(entry); err != nil {
+				log.Printf("failed to write audit entry: %s", err)
+			}
+
+			if p != nil {
+				panic(p)
+			}
+		}()
+
+		h.ServeHTTP(rec, r)
+	})
+}
+
+func statusOutcome(status int) Outcome {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return Denied
+	case status >= http.StatusBadRequest:
+		return Failed
+	default:
+		return Succeeded
+	}
+}
+
+// statusRecorder is an http.ResponseWriter that keeps track of the response status code.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = status, true
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
@@ -0,0 +1,71 @@
+package audit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andrewslotin/michael/audit"
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIMiddleware(t *testing.T) {
+	examples := map[int]audit.Outcome{
+		http.StatusOK:                  audit.Succeeded,
+		http.StatusNoContent:           audit.Succeeded,
+		http.StatusUnauthorized:        audit.Denied,
+		http.StatusForbidden:           audit.Denied,
+		http.StatusBadRequest:          audit.Failed,
+		http.StatusInternalServerError: audit.Failed,
+	}
+
+	for status, outcome := range examples {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			l := audit.NewRecordLog(deploy.NewInMemoryStore())
+			h := audit.APIMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+			}), l)
+
+			req, err := http.NewRequest("POST", "/admin/revoke", nil)
+			require.NoError(t, err)
+
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+
+			assert.Equal(t, status, recorder.Code)
+
+			entries, err := l.Entries("")
+			require.NoError(t, err)
+
+			if assert.Len(t, entries, 1) {
+				assert.Equal(t, audit.SourceAPI, entries[0].Source)
+				assert.Equal(t, "POST /admin/revoke", entries[0].Text)
+				assert.Equal(t, outcome, entries[0].Outcome)
+			}
+		})
+	}
+}
+
+func TestAPIMiddleware_AbortedResponse(t *testing.T) {
+	l := audit.NewRecordLog(deploy.NewInMemoryStore())
+	h := audit.APIMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial response"))
+		panic(http.ErrAbortHandler)
+	}), l)
+
+	req, err := http.NewRequest("GET", "/admin/backup", nil)
+	require.NoError(t, err)
+
+	assert.Panics(t, func() {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	entries, err := l.Entries("")
+	require.NoError(t, err)
+
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, audit.Failed, entries[0].Outcome)
+	}
+}
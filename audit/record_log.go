@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/andrewslotin/michael/deploy"
+)
+
+const (
+	recordLogCollectionPrefix = "audit:"
+	recordLogKeyTimeFormat    = "20060102T150405.000000000Z"
+)
+
+// RecordLog is an append-only audit log kept in a deploy.RecordStore. Entries of each channel are kept in
+// a separate collection and never expire.
+type RecordLog struct {
+	records deploy.RecordStore
+}
+
+// NewRecordLog returns an instance of *RecordLog that keeps entries in records.
+func NewRecordLog(records deploy.RecordStore) *RecordLog {
+	return &RecordLog{records: records}
+}
+
+// Append adds an entry to the log.
+func (l *RecordLog) Append(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %s", err)
+	}
+
+	// The timestamp keeps the records ordered, while the random suffix distinguishes entries written
+	// at the same time on different replicas
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("failed to generate audit entry key: %s", err)
+	}
+
+	added, err := l.records.AddRecord(recordLogCollectionPrefix+e.ChannelID, deploy.Record{
+		Key:   e.Time.Format(recordLogKeyTimeFormat) + "-" + hex.EncodeToString(suffix),
+		Value: data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store audit entry: %s", err)
+	}
+
+	if !added {
+		return fmt.Errorf("failed to store audit entry: duplicate key")
+	}
+
+	return nil
+}
+
+// Entries returns entries logged for channel in chronological order.
+func (l *RecordLog) Entries(channelID string) ([]Entry, error) {
+	records, err := l.records.Records(recordLogCollectionPrefix + channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log of %s: %s", channelID, err)
+	}
+
+	entries := make([]Entry, len(records))
+	for i, rec := range records {
+		if err := json.Unmarshal(rec.Value, &entries[i]); err != nil {
+			return nil, fmt.Errorf("malformed audit entry %s in %s: %s", rec.Key, channelID, err)
+		}
+	}
+
+	return entries, nil
+}
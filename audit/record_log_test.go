@@ -0,0 +1,70 @@
+package audit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/audit"
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordLog(t *testing.T) {
+	l := audit.NewRecordLog(deploy.NewInMemoryStore())
+
+	now := time.Now().UTC().Truncate(time.Second)
+	entries := []audit.Entry{
+		{Time: now, Source: audit.SourceSlack, ChannelID: "C1", User: slack.User{ID: "U1", Name: "user1"}, Text: "done", Outcome: audit.Succeeded},
+		{Time: now, Source: audit.SourceSlack, ChannelID: "C1", User: slack.User{ID: "U2", Name: "user2"}, Text: "abort", Outcome: audit.Denied, Details: "maintainer role is required"},
+		{Time: now.Add(-time.Minute), Source: audit.SourceDashboard, ChannelID: "C2", Text: "redeem history link", Outcome: audit.Succeeded},
+		{Time: now.Add(time.Minute), Source: audit.SourceAPI, Text: "POST /admin/revoke", Outcome: audit.Denied},
+	}
+
+	for _, e := range entries {
+		require.NoError(t, l.Append(e))
+	}
+
+	logged, err := l.Entries("C1")
+	require.NoError(t, err)
+	if assert.Len(t, logged, 2) {
+		assert.ElementsMatch(t, entries[:2], logged)
+	}
+
+	logged, err = l.Entries("C2")
+	require.NoError(t, err)
+	assert.Equal(t, entries[2:3], logged)
+
+	logged, err = l.Entries("")
+	require.NoError(t, err)
+	assert.Equal(t, entries[3:], logged)
+}
+
+func TestRecordLog_Ordering(t *testing.T) {
+	l := audit.NewRecordLog(deploy.NewInMemoryStore())
+
+	now := time.Now().UTC()
+	for _, delta := range []time.Duration{time.Minute, -time.Hour, 0, 10 * time.Hour} {
+		require.NoError(t, l.Append(audit.Entry{Time: now.Add(delta), ChannelID: "C1"}))
+	}
+
+	logged, err := l.Entries("C1")
+	require.NoError(t, err)
+	require.Len(t, logged, 4)
+
+	for i := 1; i < len(logged); i++ {
+		assert.True(t, logged[i-1].Time.Before(logged[i].Time), "expected entries to be ordered by time")
+	}
+}
+
+func TestRecordLog_DefaultTime(t *testing.T) {
+	l := audit.NewRecordLog(deploy.NewInMemoryStore())
+	require.NoError(t, l.Append(audit.Entry{ChannelID: "C1"}))
+
+	logged, err := l.Entries("C1")
+	require.NoError(t, err)
+	if assert.Len(t, logged, 1) {
+		assert.WithinDuration(t, time.Now(), logged[0].Time, time.Second)
+	}
+}
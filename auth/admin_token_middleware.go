@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// AdminTokenMiddleware wraps an http.Handler and only calls it if the request contains
+// Authorization: Bearer <token> header with given admin token. An empty token denies all requests.
+func AdminTokenMiddleware(h http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" || !hasBearerToken(r, token) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="michael"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func hasBearerToken(r *http.Request, token string) bool {
+	const prefix = "Bearer "
+
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, prefix) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, prefix)), []byte(token)) == 1
+}
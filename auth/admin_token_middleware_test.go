@@ -0,0 +1,60 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andrewslotin/michael/auth"
+	"github.com/andrewslotin/michael/auth/authtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminTokenMiddleware_ValidToken(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/admin/backup", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer admin secret")
+
+	handler := new(authtest.HandlerMock)
+	handler.On("ServeHTTP", recorder, req).Return().Once()
+
+	auth.AdminTokenMiddleware(handler, "admin secret").ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	handler.AssertExpectations(t)
+}
+
+func TestAdminTokenMiddleware_InvalidToken(t *testing.T) {
+	examples := map[string]string{
+		"no header":    "",
+		"wrong token":  "Bearer another secret",
+		"wrong scheme": "Basic admin secret",
+	}
+
+	for name, header := range examples {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", "/admin/backup", nil)
+			require.NoError(t, err)
+
+			if header != "" {
+				req.Header.Set("Authorization", header)
+			}
+
+			auth.AdminTokenMiddleware(new(authtest.HandlerMock), "admin secret").ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		})
+	}
+}
+
+func TestAdminTokenMiddleware_EmptyToken(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/admin/backup", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer ")
+
+	auth.AdminTokenMiddleware(new(authtest.HandlerMock), "").ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
@@ -8,6 +8,6 @@ type TokenAuthenticatorMock struct {
 }
 
 // Authenticate is needed to conform auth.TokenAuthenticator interface and returns mocked value.
-func (m TokenAuthenticatorMock) Authenticate(token string) bool {
-	return m.Called(token).Get(0).(bool)
+func (m *TokenAuthenticatorMock) Authenticate(channelID, token string) bool {
+	return m.Called(channelID, token).Get(0).(bool)
 }
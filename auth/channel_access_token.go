@@ -22,49 +22,76 @@ func ChannelAccessTokenFromRequest(r *http.Request) string {
 	return authCookie.Value
 }
 
-// ParseChannelAccessTokenClaims verifies and parses signed JWT string and returns encoded JWTChannelClaims.
+// ParseChannelAccessTokenClaims verifies signed JWT string with a key from keyset and returns encoded JWTChannelClaims.
 // Most of the time the returned error is of type auth.Error.
-func ParseChannelAccessTokenClaims(tokenString string, key interface{}) (claims *JWTChannelClaims, err error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTChannelClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidSigningMethod
-		}
+func ParseChannelAccessTokenClaims(tokenString string, keys *Keyset) (claims *JWTChannelClaims, err error) {
+	claims = &JWTChannelClaims{}
+	if err := parseToken(tokenString, claims, keys); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
 
-		return key, nil
-	})
+// parseToken verifies signed JWT string and decodes its claims into claims.
+func parseToken(tokenString string, claims jwt.Claims, keys *Keyset) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, keys.Keyfunc)
 	if err != nil {
 		if validationErr, ok := err.(*jwt.ValidationError); ok {
 			switch {
+			case validationErr.Errors&jwt.ValidationErrorUnverifiable != 0 && isAuthError(validationErr.Inner):
+				return validationErr.Inner
 			case validationErr.Errors&(jwt.ValidationErrorExpired|jwt.ValidationErrorNotValidYet) != 0:
-				return nil, ErrExpiredToken
+				return ErrExpiredToken
 			case validationErr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
-				return nil, ErrInvalidToken
+				return ErrInvalidToken
 			case validationErr.Errors&jwt.ValidationErrorUnverifiable != 0:
-				return nil, ErrInvalidSigningMethod
+				return ErrInvalidSigningMethod
 			}
 		}
 
-		return nil, err
+		return err
 	}
 	if !token.Valid {
-		return nil, ErrInvalidToken
+		return ErrInvalidToken
 	}
 
-	claims, ok := token.Claims.(*JWTChannelClaims)
-	if !ok {
-		return nil, ErrInvalidTokenFormat
-	}
+	return nil
+}
 
-	return claims, nil
+// StoreChannelAccessToken writes tokenString into Auth= cookie expiring in expTime. Cookie attributes are set
+// according to policy.
+func StoreChannelAccessToken(w http.ResponseWriter, r *http.Request, tokenString string, expTime time.Time, policy CookiePolicy) {
+	policy.SetCookie(w, r, "Auth", tokenString, expTime)
 }
 
-// StoreChannelAccessToken writes tokenString into Auth= cookie expiring in expTime.
-func StoreChannelAccessToken(w http.ResponseWriter, tokenString string, expTime time.Time) {
-	cookie := &http.Cookie{
-		Name:    "Auth",
-		Value:   tokenString,
-		Expires: expTime,
+// reissueChannelAccessToken signs claims with a new token ID and stores them in Auth= cookie expiring in expTime.
+// The ID of previously issued token is added to revocation list, so that the old cookie value can't be used anymore.
+func reissueChannelAccessToken(w http.ResponseWriter, r *http.Request, claims *JWTChannelClaims, expTime time.Time, keys *Keyset, revoked RevocationList, policy CookiePolicy) error {
+	if err := revokeToken(revoked, claims.StandardClaims); err != nil {
+		return err
 	}
 
-	http.SetCookie(w, cookie)
+	claims.Id = newTokenID()
+	claims.IssuedAt = time.Now().Unix()
+	claims.ExpiresAt = expTime.Unix()
+
+	tokenString, err := keys.SignedString(claims)
+	if err != nil {
+		return err
+	}
+
+	StoreChannelAccessToken(w, r, tokenString, expTime, policy)
+
+	return nil
+}
+
+// ClearChannelAccessToken removes Auth= cookie.
+func ClearChannelAccessToken(w http.ResponseWriter, r *http.Request, policy CookiePolicy) {
+	policy.ClearCookie(w, r, "Auth")
+}
+
+func isAuthError(err error) bool {
+	_, ok := err.(Error)
+	return ok
 }
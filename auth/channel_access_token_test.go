@@ -48,7 +48,7 @@ func TestParseChannelAccessTokenClaims(t *testing.T) {
 	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
 	require.NoError(t, err)
 
-	parsedClaims, err := auth.ParseChannelAccessTokenClaims(tokenString, secret)
+	parsedClaims, err := auth.ParseChannelAccessTokenClaims(tokenString, auth.StaticKeyset(secret))
 	require.NoError(t, err)
 
 	assert.Equal(t, claims.IssuedAt, parsedClaims.IssuedAt)
@@ -73,7 +73,7 @@ func TestParseChannelAccessTokenClaims_ExpiredToken(t *testing.T) {
 	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
 	require.NoError(t, err)
 
-	_, err = auth.ParseChannelAccessTokenClaims(tokenString, secret)
+	_, err = auth.ParseChannelAccessTokenClaims(tokenString, auth.StaticKeyset(secret))
 	assert.Equal(t, auth.ErrExpiredToken, err)
 }
 
@@ -92,7 +92,7 @@ func TestParseChannelAccessTokenClaims_SignatureMismatch(t *testing.T) {
 	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("a very secret secret"))
 	require.NoError(t, err)
 
-	_, err = auth.ParseChannelAccessTokenClaims(tokenString, secret)
+	_, err = auth.ParseChannelAccessTokenClaims(tokenString, auth.StaticKeyset(secret))
 	assert.Equal(t, auth.ErrInvalidToken, err)
 }
 
@@ -112,7 +112,7 @@ func TestParseChannelAccessTokenClaims_UnexpectedSigningMethod(t *testing.T) {
 	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(pkey)
 	require.NoError(t, err)
 
-	_, err = auth.ParseChannelAccessTokenClaims(tokenString, pkey)
+	_, err = auth.ParseChannelAccessTokenClaims(tokenString, auth.StaticKeyset([]byte("test secret")))
 	assert.Equal(t, auth.ErrInvalidSigningMethod, err)
 }
 
@@ -120,8 +120,26 @@ func TestStoreChannelAccessToken(t *testing.T) {
 	expirationTime := time.Now().Add(time.Hour)
 	recorder := httptest.NewRecorder()
 
-	auth.StoreChannelAccessToken(recorder, "token1", expirationTime)
+	req, err := http.NewRequest("GET", "/channel1", nil)
+	require.NoError(t, err)
+
+	auth.StoreChannelAccessToken(recorder, req, "token1", expirationTime, auth.DefaultCookiePolicy)
+
+	cookie := &http.Cookie{Name: "Auth", Value: "token1", Path: "/", Expires: expirationTime, HttpOnly: true, SameSite: http.SameSiteLaxMode}
+	assert.Equal(t, cookie.String(), recorder.Header().Get("Set-Cookie"))
+}
+
+func TestClearChannelAccessToken(t *testing.T) {
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("GET", "/logout", nil)
+	require.NoError(t, err)
 
-	cookie := &http.Cookie{Name: "Auth", Value: "token1", Expires: expirationTime}
-	assert.Equal(t, recorder.Header().Get("Set-Cookie"), cookie.String())
+	auth.ClearChannelAccessToken(recorder, req, auth.DefaultCookiePolicy)
+
+	if cookies := recorder.Result().Cookies(); assert.Len(t, cookies, 1) {
+		assert.Equal(t, "Auth", cookies[0].Name)
+		assert.Empty(t, cookies[0].Value)
+		assert.Equal(t, -1, cookies[0].MaxAge)
+	}
 }
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -8,20 +9,47 @@ import (
 	"github.com/andrewslotin/michael/dashboard"
 )
 
+// ChannelMembershipChecker is an interface that wraps IsMember method.
+//
+// IsMember is used to check whether a user is a member of channel.
+type ChannelMembershipChecker interface {
+	IsMember(channelID, userID string) (bool, error)
+}
+
+// errSignInRequired is returned by ChannelAuthorizer when the request has neither channel access token nor
+// a valid session and the user needs to sign in first.
+var errSignInRequired = errors.New("sign in required")
+
 type ChannelAuthorizer struct {
 	handler http.Handler
-	secret  []byte
+	keys    *Keyset
+	revoked RevocationList
+
+	members    ChannelMembershipChecker
+	signInPath string
 }
 
 // ChannelAuthorizerMiddleware calls an undelying http.Handler once and only there is a valid JWT
-// provided in Authorization header.
-func ChannelAuthorizerMiddleware(h http.Handler, jwtSecret []byte) *ChannelAuthorizer {
+// signed with one of keys provided in Authorization header.
+func ChannelAuthorizerMiddleware(h http.Handler, keys *Keyset) *ChannelAuthorizer {
 	return &ChannelAuthorizer{
 		handler: h,
-		secret:  jwtSecret,
+		keys:    keys,
 	}
 }
 
+// SetRevocationList makes ChannelAuthorizer reject tokens which IDs are in revocation list.
+func (h *ChannelAuthorizer) SetRevocationList(revoked RevocationList) {
+	h.revoked = revoked
+}
+
+// AllowSessions makes ChannelAuthorizer grant access to users who have signed in with Slack and are members
+// of requested channel. Requests without channel access token or session are redirected to signInPath.
+func (h *ChannelAuthorizer) AllowSessions(members ChannelMembershipChecker, signInPath string) {
+	h.members = members
+	h.signInPath = signInPath
+}
+
 func (h *ChannelAuthorizer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	channelID := dashboard.ChannelIDFromRequest(r)
 	if channelID == "" {
@@ -29,15 +57,11 @@ func (h *ChannelAuthorizer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenString := ChannelAccessTokenFromRequest(r)
-	if tokenString == "" {
-		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-		return
-	}
-
-	err := h.checkAccess(channelID, tokenString)
+	err := h.authorize(channelID, r)
 	if err != nil {
-		if authError, ok := err.(Error); ok {
+		if err == errSignInRequired {
+			http.Redirect(w, r, SignInURL(h.signInPath, r.URL.RequestURI()), http.StatusFound)
+		} else if authError, ok := err.(Error); ok {
 			http.Error(w, authError.Message, authError.Code)
 		} else {
 			log.Printf("failed to check channel access: %s", err)
@@ -54,12 +78,74 @@ func (h *ChannelAuthorizer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// CanAccess reports whether the request grants access to channel either with channel access token or with
+// a session. It is used by pages that list deploys from multiple channels to leave out the ones the user has
+// no access to.
+func (h *ChannelAuthorizer) CanAccess(r *http.Request, channelID string) (bool, error) {
+	err := h.authorize(channelID, r)
+	if _, ok := err.(Error); ok || err == errSignInRequired {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// RequireCredentials wraps a handler of a page that lists deploys from multiple channels, so that it is only
+// served to requests with either channel access token or a session. The handler is expected to check access
+// to each channel with CanAccess. Requests without credentials are redirected to sign in if sessions are allowed
+// and rejected otherwise.
+func (h *ChannelAuthorizer) RequireCredentials(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case ChannelAccessTokenFromRequest(r) != "" || (h.members != nil && SessionTokenFromRequest(r) != ""):
+			handler.ServeHTTP(w, r)
+		case h.members != nil:
+			http.Redirect(w, r, SignInURL(h.signInPath, r.URL.RequestURI()), http.StatusFound)
+		default:
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		}
+	})
+}
+
+// authorize checks whether request grants access to channel either with channel access token or with a session.
+func (h *ChannelAuthorizer) authorize(channelID string, r *http.Request) error {
+	err := error(Error{Message: http.StatusText(http.StatusUnauthorized), Code: http.StatusUnauthorized})
+	if tokenString := ChannelAccessTokenFromRequest(r); tokenString != "" {
+		if err = h.checkAccess(channelID, tokenString); err == nil {
+			return nil
+		}
+	}
+
+	if h.members == nil {
+		return err
+	}
+
+	claims, sessionErr := ParseSessionClaims(SessionTokenFromRequest(r), h.keys)
+	if sessionErr != nil {
+		return errSignInRequired
+	}
+
+	if err := checkRevoked(h.revoked, claims.Id); err != nil {
+		if err == ErrRevokedToken {
+			return errSignInRequired
+		}
+
+		return err
+	}
+
+	return h.checkMembership(channelID, claims.Subject)
+}
+
 func (h *ChannelAuthorizer) checkAccess(channelID, signedToken string) error {
-	claims, err := ParseChannelAccessTokenClaims(signedToken, h.secret)
+	claims, err := ParseChannelAccessTokenClaims(signedToken, h.keys)
 	if err != nil {
 		return err
 	}
 
+	if err := checkRevoked(h.revoked, claims.Id); err != nil {
+		return err
+	}
+
 	expiresAt, ok := claims.Channels[channelID]
 	switch {
 	case !ok:
@@ -70,3 +156,16 @@ func (h *ChannelAuthorizer) checkAccess(channelID, signedToken string) error {
 		return nil
 	}
 }
+
+func (h *ChannelAuthorizer) checkMembership(channelID, userID string) error {
+	ok, err := h.members.IsMember(channelID, userID)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrNoChannelAccess
+	}
+
+	return nil
+}
@@ -3,6 +3,7 @@ package auth_test
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -11,8 +12,10 @@ import (
 
 	"github.com/andrewslotin/michael/auth"
 	"github.com/andrewslotin/michael/auth/authtest"
+	"github.com/andrewslotin/michael/deploy"
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -45,7 +48,7 @@ func TestChannelAuthorizerMiddleware_ValidToken_WithChannelAccess(t *testing.T)
 
 	handler.On("ServeHTTP", recorder, req).Return().Once()
 
-	auth.ChannelAuthorizerMiddleware(handler, jwtSecret).ServeHTTP(recorder, req)
+	auth.ChannelAuthorizerMiddleware(handler, auth.StaticKeyset(jwtSecret)).ServeHTTP(recorder, req)
 	assert.Equal(t, http.StatusOK, recorder.Code)
 
 	if !handler.AssertExpectations(t) {
@@ -80,7 +83,7 @@ func TestChannelAuthorizerMiddleware_ValidToken_NoChannelAccess(t *testing.T) {
 		Value: signedToken,
 	})
 
-	auth.ChannelAuthorizerMiddleware(handler, jwtSecret).ServeHTTP(recorder, req)
+	auth.ChannelAuthorizerMiddleware(handler, auth.StaticKeyset(jwtSecret)).ServeHTTP(recorder, req)
 	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
 	assert.Equal(t, "No channel access", strings.TrimSpace(recorder.Body.String()))
 }
@@ -112,7 +115,7 @@ func TestChannelAuthorizerMiddleware_ValidToken_ExpiredChannelAccess(t *testing.
 		Value: signedToken,
 	})
 
-	auth.ChannelAuthorizerMiddleware(handler, jwtSecret).ServeHTTP(recorder, req)
+	auth.ChannelAuthorizerMiddleware(handler, auth.StaticKeyset(jwtSecret)).ServeHTTP(recorder, req)
 	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
 	assert.Equal(t, "Channel access expired", strings.TrimSpace(recorder.Body.String()))
 }
@@ -143,7 +146,7 @@ func TestChannelAuthorizerMiddleware_ExpiredToken(t *testing.T) {
 		Value: signedToken,
 	})
 
-	auth.ChannelAuthorizerMiddleware(authtest.HandlerMock{}, jwtSecret).ServeHTTP(recorder, req)
+	auth.ChannelAuthorizerMiddleware(authtest.HandlerMock{}, auth.StaticKeyset(jwtSecret)).ServeHTTP(recorder, req)
 	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
 	assert.Equal(t, "Token is expired", strings.TrimSpace(recorder.Body.String()))
 }
@@ -174,7 +177,7 @@ func TestChannelAuthorizerMiddleware_SignatureMismatch(t *testing.T) {
 		Value: signedToken,
 	})
 
-	auth.ChannelAuthorizerMiddleware(authtest.HandlerMock{}, []byte("a very secret secret")).ServeHTTP(recorder, req)
+	auth.ChannelAuthorizerMiddleware(authtest.HandlerMock{}, auth.StaticKeyset([]byte("a very secret secret"))).ServeHTTP(recorder, req)
 	assert.Equal(t, http.StatusUnauthorized, recorder.Code, "Response: %q", recorder.Body)
 }
 
@@ -205,7 +208,7 @@ func TestChannelAuthorizerMiddleware_UnexpectedSigningMethod(t *testing.T) {
 		Value: signedToken,
 	})
 
-	auth.ChannelAuthorizerMiddleware(authtest.HandlerMock{}, []byte("test secret")).ServeHTTP(recorder, req)
+	auth.ChannelAuthorizerMiddleware(authtest.HandlerMock{}, auth.StaticKeyset([]byte("test secret"))).ServeHTTP(recorder, req)
 	assert.Equal(t, http.StatusBadRequest, recorder.Code, "Response: %q", recorder.Body)
 }
 
@@ -234,6 +237,349 @@ func TestChannelAuthorizerMiddleware_NoChannelID(t *testing.T) {
 		Value: signedToken,
 	})
 
-	auth.ChannelAuthorizerMiddleware(handler, jwtSecret).ServeHTTP(recorder, req)
+	auth.ChannelAuthorizerMiddleware(handler, auth.StaticKeyset(jwtSecret)).ServeHTTP(recorder, req)
 	assert.Equal(t, http.StatusNotFound, recorder.Code)
 }
+
+func TestChannelAuthorizerMiddleware_Session_ChannelMember(t *testing.T) {
+	jwtSecret := []byte("test secret")
+
+	var handler authtest.HandlerMock
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("GET", "/channel1", nil)
+	require.NoError(t, err)
+
+	req.AddCookie(&http.Cookie{
+		Name:  "Session",
+		Value: signSessionToken(t, "U1", jwtSecret),
+	})
+
+	handler.On("ServeHTTP", recorder, req).Return().Once()
+
+	members := new(membershipCheckerMock)
+	members.On("IsMember", "channel1", "U1").Return(true, nil)
+
+	authorizer := auth.ChannelAuthorizerMiddleware(&handler, auth.StaticKeyset(jwtSecret))
+	authorizer.AllowSessions(members, "/auth/slack")
+
+	authorizer.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	handler.AssertExpectations(t)
+	members.AssertExpectations(t)
+}
+
+func TestChannelAuthorizerMiddleware_Session_NotChannelMember(t *testing.T) {
+	jwtSecret := []byte("test secret")
+
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("GET", "/channel1", nil)
+	require.NoError(t, err)
+
+	req.AddCookie(&http.Cookie{
+		Name:  "Session",
+		Value: signSessionToken(t, "U1", jwtSecret),
+	})
+
+	members := new(membershipCheckerMock)
+	members.On("IsMember", "channel1", "U1").Return(false, nil)
+
+	authorizer := auth.ChannelAuthorizerMiddleware(new(authtest.HandlerMock), auth.StaticKeyset(jwtSecret))
+	authorizer.AllowSessions(members, "/auth/slack")
+
+	authorizer.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, "No channel access", strings.TrimSpace(recorder.Body.String()))
+
+	members.AssertExpectations(t)
+}
+
+func TestChannelAuthorizerMiddleware_Session_ChannelAccessTokenPreferred(t *testing.T) {
+	jwtSecret := []byte("test secret")
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.JWTChannelClaims{
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  time.Now().Add(-10 * time.Minute).Unix(),
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		Channels: map[string]time.Time{
+			"channel1": time.Now().Add(time.Hour),
+		},
+	})
+
+	signedToken, err := token.SignedString(jwtSecret)
+	require.NoError(t, err)
+
+	var handler authtest.HandlerMock
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("GET", "/channel1", nil)
+	require.NoError(t, err)
+
+	req.AddCookie(&http.Cookie{
+		Name:  "Auth",
+		Value: signedToken,
+	})
+
+	handler.On("ServeHTTP", recorder, req).Return().Once()
+
+	members := new(membershipCheckerMock)
+
+	authorizer := auth.ChannelAuthorizerMiddleware(&handler, auth.StaticKeyset(jwtSecret))
+	authorizer.AllowSessions(members, "/auth/slack")
+
+	authorizer.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	handler.AssertExpectations(t)
+	members.AssertNotCalled(t, "IsMember", mock.Anything, mock.Anything)
+}
+
+func TestChannelAuthorizerMiddleware_Session_SignInRequired(t *testing.T) {
+	jwtSecret := []byte("test secret")
+
+	examples := map[string]*http.Cookie{
+		"no session":       nil,
+		"expired session":  {Name: "Session", Value: signExpiredSessionToken(t, "U1", jwtSecret)},
+		"invalid session":  {Name: "Session", Value: signSessionToken(t, "U1", []byte("another secret"))},
+		"malformed cookie": {Name: "Session", Value: "session1"},
+	}
+
+	for name, cookie := range examples {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+
+			req, err := http.NewRequest("GET", "/channel1.json?since=2016-08-01T00:00:00Z", nil)
+			require.NoError(t, err)
+
+			if cookie != nil {
+				req.AddCookie(cookie)
+			}
+
+			authorizer := auth.ChannelAuthorizerMiddleware(new(authtest.HandlerMock), auth.StaticKeyset(jwtSecret))
+			authorizer.AllowSessions(new(membershipCheckerMock), "/auth/slack")
+
+			authorizer.ServeHTTP(recorder, req)
+			assert.Equal(t, http.StatusFound, recorder.Code)
+			assert.Equal(t, "/auth/slack?return_to=%2Fchannel1.json%3Fsince%3D2016-08-01T00%3A00%3A00Z", recorder.Header().Get("Location"))
+		})
+	}
+}
+
+func TestChannelAuthorizerMiddleware_Session_MembershipCheckError(t *testing.T) {
+	jwtSecret := []byte("test secret")
+
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("GET", "/channel1", nil)
+	require.NoError(t, err)
+
+	req.AddCookie(&http.Cookie{
+		Name:  "Session",
+		Value: signSessionToken(t, "U1", jwtSecret),
+	})
+
+	members := new(membershipCheckerMock)
+	members.On("IsMember", "channel1", "U1").Return(false, errors.New("channel_not_found"))
+
+	authorizer := auth.ChannelAuthorizerMiddleware(new(authtest.HandlerMock), auth.StaticKeyset(jwtSecret))
+	authorizer.AllowSessions(members, "/auth/slack")
+
+	authorizer.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
+
+func TestChannelAuthorizer_CanAccess(t *testing.T) {
+	jwtSecret := []byte("test secret")
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.JWTChannelClaims{
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  time.Now().Add(-10 * time.Minute).Unix(),
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		Channels: map[string]time.Time{
+			"channel1": time.Now().Add(time.Hour),
+		},
+	})
+
+	signedToken, err := token.SignedString(jwtSecret)
+	require.NoError(t, err)
+
+	members := new(membershipCheckerMock)
+	members.
+		On("IsMember", "channel2", "U1").Return(true, nil).
+		On("IsMember", "channel3", "U1").Return(false, nil).
+		On("IsMember", "channel4", "U1").Return(false, errors.New("channel_not_found"))
+
+	authorizer := auth.ChannelAuthorizerMiddleware(nil, auth.StaticKeyset(jwtSecret))
+
+	req, err := http.NewRequest("GET", "/prs/octocat/helloworld/1", nil)
+	require.NoError(t, err)
+
+	req.AddCookie(&http.Cookie{Name: "Auth", Value: signedToken})
+
+	ok, err := authorizer.CanAccess(req, "channel1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = authorizer.CanAccess(req, "channel2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	authorizer.AllowSessions(members, "/auth/slack")
+	req.AddCookie(&http.Cookie{Name: "Session", Value: signSessionToken(t, "U1", jwtSecret)})
+
+	ok, err = authorizer.CanAccess(req, "channel2")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = authorizer.CanAccess(req, "channel3")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = authorizer.CanAccess(req, "channel4")
+	assert.Error(t, err)
+}
+
+func TestChannelAuthorizer_RequireCredentials(t *testing.T) {
+	jwtSecret := []byte("test secret")
+
+	authorizer := auth.ChannelAuthorizerMiddleware(nil, auth.StaticKeyset(jwtSecret))
+
+	var handler authtest.HandlerMock
+
+	req, err := http.NewRequest("GET", "/prs/octocat/helloworld/1", nil)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	authorizer.RequireCredentials(&handler).ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	authorizer.AllowSessions(new(membershipCheckerMock), "/auth/slack")
+
+	recorder = httptest.NewRecorder()
+	authorizer.RequireCredentials(&handler).ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusFound, recorder.Code)
+	assert.Equal(t, "/auth/slack?return_to=%2Fprs%2Foctocat%2Fhelloworld%2F1", recorder.Header().Get("Location"))
+
+	req.AddCookie(&http.Cookie{Name: "Session", Value: signSessionToken(t, "U1", jwtSecret)})
+
+	recorder = httptest.NewRecorder()
+	handler.On("ServeHTTP", recorder, req).Return().Once()
+
+	authorizer.RequireCredentials(&handler).ServeHTTP(recorder, req)
+	handler.AssertExpectations(t)
+}
+
+type membershipCheckerMock struct {
+	mock.Mock
+}
+
+func (m *membershipCheckerMock) IsMember(channelID, userID string) (bool, error) {
+	args := m.Called(channelID, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func signSessionToken(t *testing.T, userID string, secret []byte) string {
+	signedToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.JWTSessionClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   userID,
+			IssuedAt:  time.Now().Add(-10 * time.Minute).Unix(),
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	}).SignedString(secret)
+	require.NoError(t, err)
+
+	return signedToken
+}
+
+func signExpiredSessionToken(t *testing.T, userID string, secret []byte) string {
+	signedToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.JWTSessionClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   userID,
+			IssuedAt:  time.Now().Add(-2 * time.Hour).Unix(),
+			ExpiresAt: time.Now().Add(-time.Hour).Unix(),
+		},
+	}).SignedString(secret)
+	require.NoError(t, err)
+
+	return signedToken
+}
+
+func TestChannelAuthorizerMiddleware_RevokedToken(t *testing.T) {
+	jwtSecret := []byte("test secret")
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.JWTChannelClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        "jti1",
+			IssuedAt:  time.Now().Add(-10 * time.Minute).Unix(),
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		Channels: map[string]time.Time{
+			"channel1": time.Now().Add(time.Hour),
+		},
+	})
+
+	signedToken, err := token.SignedString(jwtSecret)
+	require.NoError(t, err)
+
+	revoked := auth.NewRecordRevocationList(deploy.NewInMemoryStore())
+	require.NoError(t, revoked.Revoke("jti1", time.Now().Add(time.Hour)))
+
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("GET", "/channel1", nil)
+	require.NoError(t, err)
+
+	req.AddCookie(&http.Cookie{
+		Name:  "Auth",
+		Value: signedToken,
+	})
+
+	authorizer := auth.ChannelAuthorizerMiddleware(new(authtest.HandlerMock), auth.StaticKeyset(jwtSecret))
+	authorizer.SetRevocationList(revoked)
+
+	authorizer.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, "Token has been revoked", strings.TrimSpace(recorder.Body.String()))
+}
+
+func TestChannelAuthorizerMiddleware_Session_Revoked(t *testing.T) {
+	jwtSecret := []byte("test secret")
+
+	sessionToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.JWTSessionClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        "jti1",
+			Subject:   "U1",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	}).SignedString(jwtSecret)
+	require.NoError(t, err)
+
+	revoked := auth.NewRecordRevocationList(deploy.NewInMemoryStore())
+	require.NoError(t, revoked.Revoke("jti1", time.Now().Add(time.Hour)))
+
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("GET", "/channel1", nil)
+	require.NoError(t, err)
+
+	req.AddCookie(&http.Cookie{
+		Name:  "Session",
+		Value: sessionToken,
+	})
+
+	members := new(membershipCheckerMock)
+
+	authorizer := auth.ChannelAuthorizerMiddleware(new(authtest.HandlerMock), auth.StaticKeyset(jwtSecret))
+	authorizer.SetRevocationList(revoked)
+	authorizer.AllowSessions(members, "/auth/slack")
+
+	authorizer.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusFound, recorder.Code)
+	assert.Equal(t, "/auth/slack?return_to=%2Fchannel1", recorder.Header().Get("Location"))
+
+	members.AssertNotCalled(t, "IsMember", mock.Anything, mock.Anything)
+}
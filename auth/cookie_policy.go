@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SecureCookies defines when cookies are marked as Secure.
+type SecureCookies int
+
+const (
+	// SecureCookiesAuto marks cookies as Secure if the request has been sent over HTTPS.
+	SecureCookiesAuto SecureCookies = iota
+	// SecureCookiesAlways marks all cookies as Secure. Use this mode if deploy bot is running behind
+	// a TLS-terminating proxy that does not set X-Forwarded-Proto header.
+	SecureCookiesAlways
+	// SecureCookiesNever never marks cookies as Secure.
+	SecureCookiesNever
+)
+
+// ParseSecureCookies parses "auto", "always" or "never" into SecureCookies.
+func ParseSecureCookies(s string) (SecureCookies, error) {
+	switch s {
+	case "auto":
+		return SecureCookiesAuto, nil
+	case "always":
+		return SecureCookiesAlways, nil
+	case "never":
+		return SecureCookiesNever, nil
+	default:
+		return SecureCookiesAuto, fmt.Errorf("unsupported secure cookies mode %q, expected auto, always or never", s)
+	}
+}
+
+// Set implements flag.Value.
+func (m *SecureCookies) Set(s string) error {
+	mode, err := ParseSecureCookies(s)
+	if err != nil {
+		return err
+	}
+
+	*m = mode
+
+	return nil
+}
+
+func (m SecureCookies) String() string {
+	switch m {
+	case SecureCookiesAlways:
+		return "always"
+	case SecureCookiesNever:
+		return "never"
+	default:
+		return "auto"
+	}
+}
+
+// CookiePolicy defines attributes of cookies set by deploy bot. All cookies are HttpOnly and available to
+// the whole site.
+type CookiePolicy struct {
+	Secure SecureCookies
+	// TrustProxyHeaders makes deploy bot rely on X-Forwarded-Proto header set by a reverse proxy to tell
+	// whether the request has been sent over HTTPS.
+	TrustProxyHeaders bool
+	SameSite          http.SameSite
+}
+
+// DefaultCookiePolicy marks cookies as Secure for HTTPS requests and only sends them along with same-site
+// requests and top-level navigation from other sites, such as following a link from Slack.
+var DefaultCookiePolicy = CookiePolicy{
+	Secure:   SecureCookiesAuto,
+	SameSite: http.SameSiteLaxMode,
+}
+
+// IsSecureRequest returns true if r has been sent over HTTPS.
+func (p CookiePolicy) IsSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || (p.TrustProxyHeaders && r.Header.Get("X-Forwarded-Proto") == "https")
+}
+
+// SetCookie adds a Set-Cookie header with given name and value expiring in expTime to the response.
+func (p CookiePolicy) SetCookie(w http.ResponseWriter, r *http.Request, name, value string, expTime time.Time) {
+	cookie := p.cookie(r, name, value)
+	cookie.Expires = expTime
+
+	http.SetCookie(w, cookie)
+}
+
+// ClearCookie adds a Set-Cookie header that removes a cookie with given name.
+func (p CookiePolicy) ClearCookie(w http.ResponseWriter, r *http.Request, name string) {
+	cookie := p.cookie(r, name, "")
+	cookie.MaxAge = -1
+
+	http.SetCookie(w, cookie)
+}
+
+func (p CookiePolicy) cookie(r *http.Request, name, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Secure:   p.Secure == SecureCookiesAlways || (p.Secure == SecureCookiesAuto && p.IsSecureRequest(r)),
+		HttpOnly: true,
+		SameSite: p.SameSite,
+	}
+}
@@ -0,0 +1,86 @@
+package auth_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSecureCookies(t *testing.T) {
+	for _, mode := range []auth.SecureCookies{auth.SecureCookiesAuto, auth.SecureCookiesAlways, auth.SecureCookiesNever} {
+		parsed, err := auth.ParseSecureCookies(mode.String())
+		require.NoError(t, err)
+		assert.Equal(t, mode, parsed)
+	}
+
+	_, err := auth.ParseSecureCookies("sometimes")
+	assert.Error(t, err)
+}
+
+func TestCookiePolicy_SetCookie(t *testing.T) {
+	examples := map[string]struct {
+		Policy auth.CookiePolicy
+		TLS    bool
+		Proto  string
+		Secure bool
+	}{
+		"auto, plain HTTP":                  {Policy: auth.CookiePolicy{Secure: auth.SecureCookiesAuto}},
+		"auto, TLS":                         {Policy: auth.CookiePolicy{Secure: auth.SecureCookiesAuto}, TLS: true, Secure: true},
+		"auto, untrusted X-Forwarded-Proto": {Policy: auth.CookiePolicy{Secure: auth.SecureCookiesAuto}, Proto: "https"},
+		"auto, trusted X-Forwarded-Proto":   {Policy: auth.CookiePolicy{Secure: auth.SecureCookiesAuto, TrustProxyHeaders: true}, Proto: "https", Secure: true},
+		"always, plain HTTP":                {Policy: auth.CookiePolicy{Secure: auth.SecureCookiesAlways}, Secure: true},
+		"never, TLS":                        {Policy: auth.CookiePolicy{Secure: auth.SecureCookiesNever}, TLS: true},
+	}
+
+	for name, example := range examples {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/", nil)
+			require.NoError(t, err)
+
+			if example.TLS {
+				req.TLS = &tls.ConnectionState{}
+			}
+
+			if example.Proto != "" {
+				req.Header.Set("X-Forwarded-Proto", example.Proto)
+			}
+
+			expTime := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+			recorder := httptest.NewRecorder()
+			example.Policy.SetCookie(recorder, req, "Name", "value", expTime)
+
+			cookies := recorder.Result().Cookies()
+			require.Len(t, cookies, 1)
+
+			assert.Equal(t, "Name", cookies[0].Name)
+			assert.Equal(t, "value", cookies[0].Value)
+			assert.Equal(t, "/", cookies[0].Path)
+			assert.True(t, cookies[0].HttpOnly)
+			assert.Equal(t, example.Secure, cookies[0].Secure)
+			assert.Equal(t, expTime, cookies[0].Expires)
+		})
+	}
+}
+
+func TestCookiePolicy_ClearCookie(t *testing.T) {
+	req, err := http.NewRequest("GET", "/", nil)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	auth.DefaultCookiePolicy.ClearCookie(recorder, req, "Name")
+
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	assert.Equal(t, "Name", cookies[0].Name)
+	assert.Empty(t, cookies[0].Value)
+	assert.True(t, cookies[0].MaxAge < 0)
+	assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+}
@@ -0,0 +1,39 @@
+package auth
+
+import "crypto/rand"
+
+// CryptoTokenSource is a TokenGenerator that uses cryptographically secure random number generator
+// provided by crypto/rand. Unlike RandomTokenSource the tokens it generates can not be predicted by
+// someone who has seen previously issued ones.
+type CryptoTokenSource struct{}
+
+// Generate returns a random alphanumeric string of given length. It panics if the system random number
+// generator is not available.
+func (CryptoTokenSource) Generate(tokenLen int) string {
+	const (
+		charIdxBits = 6 // number of bits needed to store an index: log2(len(tokenChars)-1)
+		charIdxMask = 1<<charIdxBits - 1
+	)
+
+	if tokenLen < 1 {
+		return ""
+	}
+
+	token := make([]byte, 0, tokenLen)
+	// Indices that are out of tokenChars range are discarded to avoid modulo bias, so a bit more
+	// random bytes than characters are needed
+	buf := make([]byte, tokenLen+tokenLen/4+1)
+	for len(token) < tokenLen {
+		if _, err := rand.Read(buf); err != nil {
+			panic("failed to read random bytes: " + err.Error())
+		}
+
+		for _, b := range buf {
+			if idx := int(b & charIdxMask); idx < len(tokenChars) && len(token) < tokenLen {
+				token = append(token, tokenChars[idx])
+			}
+		}
+	}
+
+	return string(token)
+}
@@ -0,0 +1,37 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/andrewslotin/michael/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCryptoTokenSource_Generate_Uniqueness(t *testing.T) {
+	const tokensNum = 256
+
+	var src auth.CryptoTokenSource
+
+	tokens := make(map[string]int)
+	for i := 0; i < tokensNum; i++ {
+		token := src.Generate(10)
+		dup, ok := tokens[token]
+
+		assert.False(t, ok, "Token #%d duplicates token #%d", i, dup)
+		tokens[token] = i
+	}
+
+	assert.Len(t, tokens, tokensNum)
+}
+
+func TestCryptoTokenSource_Generate_Length(t *testing.T) {
+	var src auth.CryptoTokenSource
+
+	for _, n := range [...]uint{0, 1, 2, 3, 4, 5, 6, 7, 8} {
+		l := 1<<n - 1
+		tok := src.Generate(l)
+		if assert.Len(t, tok, l) {
+			assert.Regexp(t, "^[a-zA-Z0-9]*$", tok)
+		}
+	}
+}
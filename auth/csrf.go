@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	csrfCookie = "CSRF"
+	// CSRFFormField is the name of form field that is expected to contain CSRF token.
+	CSRFFormField = "csrf_token"
+	// CSRFHeader is the name of request header that can be used to send CSRF token instead of a form field.
+	CSRFHeader = "X-CSRF-Token"
+)
+
+type csrfTokenKey struct{}
+
+// CSRFProtection is an http.Handler that rejects state-changing requests unless they contain a CSRF token
+// matching the one stored in CSRF= cookie. The token is generated on the first safe request and can be
+// obtained by the underlying handler with CSRFToken to be included in forms.
+type CSRFProtection struct {
+	// Cookies defines attributes of CSRF token cookie.
+	Cookies CookiePolicy
+
+	handler http.Handler
+}
+
+// CSRFMiddleware wraps an http.Handler with CSRF protection.
+func CSRFMiddleware(h http.Handler) *CSRFProtection {
+	return &CSRFProtection{
+		Cookies: DefaultCookiePolicy,
+		handler: h,
+	}
+}
+
+func (h *CSRFProtection) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var token string
+	if cookie, err := r.Cookie(csrfCookie); err == nil {
+		token = cookie.Value
+	}
+
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS":
+		if token == "" {
+			token = newTokenID()
+			// Zero expiration time makes it a session cookie
+			h.Cookies.SetCookie(w, r, csrfCookie, token, time.Time{})
+		}
+	default:
+		if !sameOrigin(r) || !validCSRFToken(token, submittedCSRFToken(r)) {
+			http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+			return
+		}
+	}
+
+	h.handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfTokenKey{}, token)))
+}
+
+// CSRFToken returns CSRF token to be sent along with state-changing requests. It returns an empty string
+// if the request has not been passed through CSRFProtection.
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfTokenKey{}).(string)
+	return token
+}
+
+func submittedCSRFToken(r *http.Request) string {
+	if token := r.Header.Get(CSRFHeader); token != "" {
+		return token
+	}
+
+	return r.PostFormValue(CSRFFormField)
+}
+
+func validCSRFToken(expected, submitted string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(submitted)) == 1
+}
+
+// sameOrigin returns false if the request contains Origin header pointing to another host.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return u.Host == r.Host
+}
@@ -0,0 +1,121 @@
+package auth_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/andrewslotin/michael/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSRFMiddleware_IssuesToken(t *testing.T) {
+	var token string
+	h := auth.CSRFMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = auth.CSRFToken(r)
+	}))
+
+	req, err := http.NewRequest("GET", "/", nil)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	require.NotEmpty(t, token)
+
+	cookies := recorder.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "CSRF", cookies[0].Name)
+		assert.Equal(t, token, cookies[0].Value)
+		assert.True(t, cookies[0].HttpOnly)
+	}
+
+	// the token is reused once issued
+	req.AddCookie(cookies[0])
+
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, req)
+
+	assert.Empty(t, recorder.Result().Cookies())
+	assert.Equal(t, cookies[0].Value, token)
+}
+
+func TestCSRFMiddleware_ValidToken(t *testing.T) {
+	examples := map[string]func(*http.Request){
+		"form field": func(req *http.Request) {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Body = ioutil.NopCloser(strings.NewReader(url.Values{auth.CSRFFormField: {"token1"}}.Encode()))
+		},
+		"header": func(req *http.Request) {
+			req.Header.Set(auth.CSRFHeader, "token1")
+		},
+	}
+
+	for name, setToken := range examples {
+		t.Run(name, func(t *testing.T) {
+			var called bool
+			h := auth.CSRFMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+
+			req, err := http.NewRequest("POST", "http://michael.example.com/sessions", nil)
+			require.NoError(t, err)
+
+			req.Header.Set("Origin", "http://michael.example.com")
+			req.AddCookie(&http.Cookie{Name: "CSRF", Value: "token1"})
+			setToken(req)
+
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.True(t, called)
+		})
+	}
+}
+
+func TestCSRFMiddleware_Rejected(t *testing.T) {
+	examples := map[string]struct {
+		Cookie, Token, Origin string
+	}{
+		"no cookie":        {Token: "token1"},
+		"no token":         {Cookie: "token1"},
+		"token mismatch":   {Cookie: "token1", Token: "token2"},
+		"foreign origin":   {Cookie: "token1", Token: "token1", Origin: "https://evil.example.com"},
+		"malformed origin": {Cookie: "token1", Token: "token1", Origin: "://"},
+	}
+
+	for name, example := range examples {
+		t.Run(name, func(t *testing.T) {
+			h := auth.CSRFMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("expected request to be rejected")
+			}))
+
+			req, err := http.NewRequest("POST", "http://michael.example.com/sessions", nil)
+			require.NoError(t, err)
+
+			if example.Cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "CSRF", Value: example.Cookie})
+			}
+
+			if example.Token != "" {
+				req.Header.Set(auth.CSRFHeader, example.Token)
+			}
+
+			if example.Origin != "" {
+				req.Header.Set("Origin", example.Origin)
+			}
+
+			recorder := httptest.NewRecorder()
+			h.ServeHTTP(recorder, req)
+
+			assert.Equal(t, http.StatusForbidden, recorder.Code)
+			assert.Equal(t, "Invalid CSRF token", strings.TrimSpace(recorder.Body.String()))
+		})
+	}
+}
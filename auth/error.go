@@ -18,4 +18,6 @@ var (
 	ErrInvalidTokenFormat   = Error{Message: "Invalid token format", Code: http.StatusBadRequest}
 	ErrNoChannelAccess      = Error{Message: "No channel access", Code: http.StatusUnauthorized}
 	ErrExpiredChannelAccess = Error{Message: "Channel access expired", Code: http.StatusUnauthorized}
+	ErrUnknownSigningKey    = Error{Message: "Token is signed with an unknown key", Code: http.StatusUnauthorized}
+	ErrRevokedToken         = Error{Message: "Token has been revoked", Code: http.StatusUnauthorized}
 )
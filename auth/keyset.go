@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// Key is a secret used to sign and verify JWT. Tokens signed with a key with non-empty ID carry this ID in
+// their kid header.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// Keyset holds the active key used to sign new tokens along with keys that are only accepted to verify
+// tokens issued before key rotation. Tokens without kid header are verified with the key that has an empty ID.
+// Keyset is safe for concurrent use and can be replaced while in use.
+type Keyset struct {
+	mu     sync.RWMutex
+	active Key
+	keys   map[string][]byte
+}
+
+// NewKeyset returns an instance of *Keyset that signs tokens with active key and accepts tokens signed with
+// active and any of verificationKeys.
+func NewKeyset(active Key, verificationKeys ...Key) *Keyset {
+	ks := &Keyset{
+		active: active,
+		keys:   make(map[string][]byte, len(verificationKeys)+1),
+	}
+
+	for _, k := range verificationKeys {
+		ks.keys[k.ID] = k.Secret
+	}
+	ks.keys[active.ID] = active.Secret
+
+	return ks
+}
+
+// StaticKeyset returns a keyset with a single key without ID.
+func StaticKeyset(secret []byte) *Keyset {
+	return NewKeyset(Key{Secret: secret})
+}
+
+// keysetFile is the JSON representation of a keyset file:
+//
+//	{
+//	  "active": "2017-02",
+//	  "keys": {
+//	    "2017-02": "new secret",
+//	    "2017-01": "old secret"
+//	  }
+//	}
+type keysetFile struct {
+	Active string            `json:"active"`
+	Keys   map[string]string `json:"keys"`
+}
+
+// LoadKeysetFile reads a keyset from a JSON file in path. Keys listed in extraKeys are accepted for
+// verification in addition to the ones from the file.
+func LoadKeysetFile(path string, extraKeys ...Key) (*Keyset, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyset file: %s", err)
+	}
+
+	var f keysetFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse keyset file %s: %s", path, err)
+	}
+
+	if f.Active == "" {
+		return nil, fmt.Errorf("malformed keyset file %s: active key ID is missing", path)
+	}
+
+	keys := extraKeys
+	for id, secret := range f.Keys {
+		if id == "" || secret == "" {
+			return nil, fmt.Errorf("malformed keyset file %s: key IDs and secrets can not be empty", path)
+		}
+
+		keys = append(keys, Key{ID: id, Secret: []byte(secret)})
+	}
+
+	secret, ok := f.Keys[f.Active]
+	if !ok {
+		return nil, fmt.Errorf("malformed keyset file %s: there is no active key %s", path, f.Active)
+	}
+
+	return NewKeyset(Key{ID: f.Active, Secret: []byte(secret)}, keys...), nil
+}
+
+// Replace atomically replaces keys in ks with ones from another keyset.
+func (ks *Keyset) Replace(another *Keyset) {
+	another.mu.RLock()
+	active, keys := another.active, another.keys
+	another.mu.RUnlock()
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.active, ks.keys = active, keys
+}
+
+// ActiveKeyID returns the ID of key used to sign new tokens.
+func (ks *Keyset) ActiveKeyID() string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	return ks.active.ID
+}
+
+// SignedString returns claims signed with the active key.
+func (ks *Keyset) SignedString(claims jwt.Claims) (string, error) {
+	ks.mu.RLock()
+	active := ks.active
+	ks.mu.RUnlock()
+
+	if len(active.Secret) == 0 {
+		return "", errors.New("empty signing key")
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if active.ID != "" {
+		token.Header["kid"] = active.ID
+	}
+
+	return token.SignedString(active.Secret)
+}
+
+// Keyfunc is a jwt.Keyfunc that returns the key identified by token kid header.
+func (ks *Keyset) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, ErrInvalidSigningMethod
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	secret, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownSigningKey
+	}
+
+	return secret, nil
+}
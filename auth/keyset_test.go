@@ -0,0 +1,141 @@
+package auth_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/auth"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyset_SignedString(t *testing.T) {
+	keys := auth.NewKeyset(auth.Key{ID: "key2", Secret: []byte("secret2")}, auth.Key{ID: "key1", Secret: []byte("secret1")})
+
+	tokenString, err := keys.SignedString(jwt.StandardClaims{Subject: "U1"})
+	require.NoError(t, err)
+
+	token, err := jwt.Parse(tokenString, func(*jwt.Token) (interface{}, error) {
+		return []byte("secret2"), nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "key2", token.Header["kid"])
+	assert.Equal(t, "HS256", token.Header["alg"])
+}
+
+func TestKeyset_Verify(t *testing.T) {
+	oldKeys := auth.NewKeyset(auth.Key{ID: "key1", Secret: []byte("secret1")})
+	newKeys := auth.NewKeyset(auth.Key{ID: "key2", Secret: []byte("secret2")}, auth.Key{ID: "key1", Secret: []byte("secret1")})
+
+	claims := auth.JWTChannelClaims{
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()},
+	}
+
+	oldToken, err := oldKeys.SignedString(claims)
+	require.NoError(t, err)
+
+	newToken, err := newKeys.SignedString(claims)
+	require.NoError(t, err)
+
+	_, err = auth.ParseChannelAccessTokenClaims(oldToken, newKeys)
+	assert.NoError(t, err, "expected tokens signed with a verification key to be accepted")
+
+	_, err = auth.ParseChannelAccessTokenClaims(newToken, newKeys)
+	assert.NoError(t, err)
+
+	_, err = auth.ParseChannelAccessTokenClaims(newToken, oldKeys)
+	assert.Equal(t, auth.ErrUnknownSigningKey, err)
+}
+
+func TestKeyset_Verify_KeyIDMismatch(t *testing.T) {
+	keys := auth.NewKeyset(auth.Key{ID: "key1", Secret: []byte("secret1")}, auth.Key{ID: "key2", Secret: []byte("secret2")})
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	token.Header["kid"] = "key2"
+
+	tokenString, err := token.SignedString([]byte("secret1"))
+	require.NoError(t, err)
+
+	_, err = auth.ParseChannelAccessTokenClaims(tokenString, keys)
+	assert.Equal(t, auth.ErrInvalidToken, err)
+}
+
+func TestKeyset_Verify_NoKeyID(t *testing.T) {
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("legacy secret"))
+	require.NoError(t, err)
+
+	_, err = auth.ParseChannelAccessTokenClaims(tokenString, auth.NewKeyset(auth.Key{ID: "key1", Secret: []byte("secret1")}))
+	assert.Equal(t, auth.ErrUnknownSigningKey, err)
+
+	_, err = auth.ParseChannelAccessTokenClaims(tokenString, auth.NewKeyset(auth.Key{ID: "key1", Secret: []byte("secret1")}, auth.Key{Secret: []byte("legacy secret")}))
+	assert.NoError(t, err)
+}
+
+func TestLoadKeysetFile(t *testing.T) {
+	path := writeKeysetFile(t, `{"active": "key2", "keys": {"key1": "secret1", "key2": "secret2"}}`)
+
+	keys, err := auth.LoadKeysetFile(path, auth.Key{Secret: []byte("legacy secret")})
+	require.NoError(t, err)
+
+	assert.Equal(t, "key2", keys.ActiveKeyID())
+
+	for secret, kid := range map[string]string{"secret1": "key1", "secret2": "key2", "legacy secret": ""} {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+
+		tokenString, err := token.SignedString([]byte(secret))
+		require.NoError(t, err)
+
+		_, err = auth.ParseChannelAccessTokenClaims(tokenString, keys)
+		assert.NoError(t, err, kid)
+	}
+}
+
+func TestLoadKeysetFile_Malformed(t *testing.T) {
+	examples := map[string]string{
+		"invalid JSON":       `{"active": "key1"`,
+		"no active key":      `{"keys": {"key1": "secret1"}}`,
+		"missing active key": `{"active": "key2", "keys": {"key1": "secret1"}}`,
+		"empty secret":       `{"active": "key1", "keys": {"key1": ""}}`,
+		"empty key ID":       `{"active": "key1", "keys": {"key1": "secret1", "": "secret2"}}`,
+	}
+
+	for name, content := range examples {
+		t.Run(name, func(t *testing.T) {
+			_, err := auth.LoadKeysetFile(writeKeysetFile(t, content))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestKeyset_Replace(t *testing.T) {
+	keys := auth.NewKeyset(auth.Key{ID: "key1", Secret: []byte("secret1")})
+	oldToken, err := keys.SignedString(jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+
+	keys.Replace(auth.NewKeyset(auth.Key{ID: "key2", Secret: []byte("secret2")}))
+	assert.Equal(t, "key2", keys.ActiveKeyID())
+
+	_, err = auth.ParseChannelAccessTokenClaims(oldToken, keys)
+	assert.Equal(t, auth.ErrUnknownSigningKey, err)
+}
+
+func writeKeysetFile(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "michael")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "keyset.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	return path
+}
@@ -2,61 +2,98 @@ package auth
 
 import (
 	"errors"
-	"sync"
+	"fmt"
+	"log"
+	"time"
 )
 
-// OneTimeTokenAuthenticator issues tokens that can be used for authorization only once.
+// DefaultTokenTTL is the default period of time during which an issued token can be used.
+const DefaultTokenTTL = 24 * time.Hour
+
+// OneTimeTokenAuthenticator issues tokens that can be used for authorization only once. Each token is
+// bound to the channel it has been issued for and can't be used to access another one.
 type OneTimeTokenAuthenticator struct {
+	// TTL is the period of time after which an unused token expires.
+	TTL time.Duration
+
 	gen    TokenGenerator
-	mu     sync.Mutex
-	tokens map[string]struct{}
+	tokens TokenStore
 }
 
-// NewOneTimeTokenAuthenticator returns an instance of *OneTimeTokenAuthenticator that uses src as a token source.
+// NewOneTimeTokenAuthenticator returns an instance of *OneTimeTokenAuthenticator that uses src as a token source
+// and keeps issued tokens in memory.
 func NewOneTimeTokenAuthenticator(src TokenGenerator) *OneTimeTokenAuthenticator {
+	return NewOneTimeTokenAuthenticatorWithStore(src, NewInMemoryTokenStore())
+}
+
+// NewOneTimeTokenAuthenticatorWithStore returns an instance of *OneTimeTokenAuthenticator that uses src as a token
+// source and keeps issued tokens in store.
+func NewOneTimeTokenAuthenticatorWithStore(src TokenGenerator, store TokenStore) *OneTimeTokenAuthenticator {
 	return &OneTimeTokenAuthenticator{
+		TTL:    DefaultTokenTTL,
 		gen:    src,
-		tokens: make(map[string]struct{}, 50),
+		tokens: store,
 	}
 }
 
-// IssueToken generates and stores a new unused token. This method returns an error if it failed to generate
-// an unused token after 16777216 (2^24) attempts.
-func (s *OneTimeTokenAuthenticator) IssueToken(tokenLen int) (token string, err error) {
+// IssueToken generates and stores a new unused token for channel. This method returns an error if it failed
+// to generate an unused token after 1048576 (2^20) attempts.
+func (s *OneTimeTokenAuthenticator) IssueToken(channelID string, tokenLen int) (token string, err error) {
 	const maxAttempts = 1 << 20
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	token = s.gen.Generate(tokenLen)
-	for i := 0; s.exists(token) && i < maxAttempts; i++ {
+	expiresAt := time.Now().Add(s.TTL)
+	for i := 0; i < maxAttempts; i++ {
 		token = s.gen.Generate(tokenLen)
-	}
 
-	if s.exists(token) {
-		return "", errors.New("failed to generate token")
-	}
+		added, err := s.tokens.AddToken(token, channelID, expiresAt)
+		if err != nil {
+			return "", fmt.Errorf("failed to store token: %s", err)
+		}
 
-	s.tokens[token] = struct{}{}
+		if added {
+			return token, nil
+		}
+	}
 
-	return token, nil
+	return "", errors.New("failed to generate token")
 }
 
-// Authenticate checks if provided token has been issued by this instance of OneTimeTokenAuthenticator and annuls it.
-func (s *OneTimeTokenAuthenticator) Authenticate(token string) bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if !s.exists(token) {
+// Authenticate checks if provided token has been issued for channel and has neither expired nor been used yet,
+// and annuls it. A token presented for another channel is annulled as well.
+func (s *OneTimeTokenAuthenticator) Authenticate(channelID, token string) bool {
+	issuedFor, ok, err := s.tokens.RemoveToken(token)
+	if err != nil {
+		log.Printf("failed to remove token: %s", err)
 		return false
 	}
 
-	delete(s.tokens, token)
-	return true
+	return ok && issuedFor == channelID
 }
 
-func (s *OneTimeTokenAuthenticator) exists(token string) bool {
-	_, ok := s.tokens[token]
+// Run periodically removes expired tokens from the store until stop channel is closed.
+func (s *OneTimeTokenAuthenticator) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			n, err := s.Sweep()
+			if err != nil {
+				log.Printf("failed to remove expired tokens: %s", err)
+				continue
+			}
+
+			if n > 0 {
+				log.Printf("removed %d expired tokens", n)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
 
-	return ok
+// Sweep removes expired tokens from the store and returns their number.
+func (s *OneTimeTokenAuthenticator) Sweep() (int, error) {
+	return s.tokens.RemoveExpiredTokens()
 }
@@ -1,7 +1,9 @@
 package auth_test
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/andrewslotin/michael/auth"
 	"github.com/andrewslotin/michael/auth/authtest"
@@ -16,11 +18,11 @@ func TestOneTimeTokenAuthenticator_IssueToken(t *testing.T) {
 
 	authenticator := auth.NewOneTimeTokenAuthenticator(src)
 
-	if token, err := authenticator.IssueToken(10); assert.NoError(t, err) {
+	if token, err := authenticator.IssueToken("channel1", 10); assert.NoError(t, err) {
 		assert.Equal(t, "abcdef1234", token)
 	}
 
-	if token, err := authenticator.IssueToken(5); assert.NoError(t, err) {
+	if token, err := authenticator.IssueToken("channel1", 5); assert.NoError(t, err) {
 		assert.Equal(t, "xyz12", token)
 	}
 
@@ -30,22 +32,129 @@ func TestOneTimeTokenAuthenticator_IssueToken(t *testing.T) {
 func TestOneTimeTokenAuthenticator_IssueToken_Uniqueness(t *testing.T) {
 	authenticator := auth.NewOneTimeTokenAuthenticator(authtest.StaticTokenSource("token1"))
 
-	token, err := authenticator.IssueToken(1)
+	token, err := authenticator.IssueToken("channel1", 1)
 	require.NoError(t, err)
 	require.Equal(t, "token1", token)
 
-	_, err = authenticator.IssueToken(1)
+	_, err = authenticator.IssueToken("channel2", 1)
 	assert.Error(t, err)
 }
 
 func TestOneTimeTokenAuthenticator_Authenticate(t *testing.T) {
 	authenticator := auth.NewOneTimeTokenAuthenticator(authtest.StaticTokenSource("token1"))
-	assert.False(t, authenticator.Authenticate("token1"))
+	assert.False(t, authenticator.Authenticate("channel1", "token1"))
 
-	token, err := authenticator.IssueToken(1)
+	token, err := authenticator.IssueToken("channel1", 1)
 	require.NoError(t, err)
 	require.Equal(t, "token1", token)
 
-	assert.True(t, authenticator.Authenticate(token))
-	assert.False(t, authenticator.Authenticate(token))
+	assert.True(t, authenticator.Authenticate("channel1", token))
+	assert.False(t, authenticator.Authenticate("channel1", token))
+}
+
+func TestOneTimeTokenAuthenticator_Authenticate_AnotherChannel(t *testing.T) {
+	authenticator := auth.NewOneTimeTokenAuthenticator(authtest.StaticTokenSource("token1"))
+
+	token, err := authenticator.IssueToken("channel1", 1)
+	require.NoError(t, err)
+
+	assert.False(t, authenticator.Authenticate("channel2", token))
+	assert.False(t, authenticator.Authenticate("channel1", token), "expected token to be annulled after an attempt to use it for another channel")
+}
+
+func TestOneTimeTokenAuthenticator_Authenticate_Expired(t *testing.T) {
+	authenticator := auth.NewOneTimeTokenAuthenticator(authtest.StaticTokenSource("token1"))
+	authenticator.TTL = -time.Second
+
+	token, err := authenticator.IssueToken("channel1", 1)
+	require.NoError(t, err)
+
+	assert.False(t, authenticator.Authenticate("channel1", token))
+
+	// Expired tokens can be issued again
+	authenticator.TTL = time.Hour
+
+	token, err = authenticator.IssueToken("channel1", 1)
+	require.NoError(t, err)
+
+	assert.True(t, authenticator.Authenticate("channel1", token))
+}
+
+func TestOneTimeTokenAuthenticator_Sweep(t *testing.T) {
+	store := auth.NewInMemoryTokenStore()
+	_, err := store.AddToken("token1", "channel1", time.Now().Add(-time.Second))
+	require.NoError(t, err)
+	_, err = store.AddToken("token2", "channel1", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	authenticator := auth.NewOneTimeTokenAuthenticatorWithStore(authtest.StaticTokenSource("token3"), store)
+
+	n, err := authenticator.Sweep()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = store.RemoveExpiredTokens()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	assert.True(t, authenticator.Authenticate("channel1", "token2"))
+}
+
+// sweepNotifyingTokenStore notifies about each attempt to remove expired tokens.
+type sweepNotifyingTokenStore struct {
+	auth.TokenStore
+	swept chan struct{}
+}
+
+func (s sweepNotifyingTokenStore) RemoveExpiredTokens() (int, error) {
+	defer func() {
+		select {
+		case s.swept <- struct{}{}:
+		default:
+		}
+	}()
+
+	return s.TokenStore.RemoveExpiredTokens()
+}
+
+func TestOneTimeTokenAuthenticator_Run(t *testing.T) {
+	store := sweepNotifyingTokenStore{TokenStore: auth.NewInMemoryTokenStore(), swept: make(chan struct{})}
+	authenticator := auth.NewOneTimeTokenAuthenticatorWithStore(authtest.StaticTokenSource("token1"), store)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		authenticator.Run(time.Millisecond, stop)
+		close(done)
+	}()
+
+	select {
+	case <-store.swept:
+	case <-time.After(10 * time.Second):
+		t.Error("expected expired tokens to be removed in background")
+	}
+
+	close(stop)
+	<-done
+}
+
+type failingTokenStore struct{}
+
+func (failingTokenStore) AddToken(string, string, time.Time) (bool, error) {
+	return false, errors.New("store is unavailable")
+}
+func (failingTokenStore) RemoveToken(string) (string, bool, error) {
+	return "", false, errors.New("store is unavailable")
+}
+func (failingTokenStore) RemoveExpiredTokens() (int, error) {
+	return 0, errors.New("store is unavailable")
+}
+
+func TestOneTimeTokenAuthenticator_StoreError(t *testing.T) {
+	authenticator := auth.NewOneTimeTokenAuthenticatorWithStore(authtest.StaticTokenSource("token1"), failingTokenStore{})
+
+	_, err := authenticator.IssueToken("channel1", 1)
+	assert.Error(t, err)
+
+	assert.False(t, authenticator.Authenticate("channel1", "token1"))
 }
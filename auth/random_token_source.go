@@ -5,6 +5,11 @@ import (
 	"sync"
 )
 
+// tokenChars is the alphabet used by token sources.
+const tokenChars = "abcdefghikjlmnopqurstuvwxyzABCDEFGHIKJLMNOPQURSTUVWXYZ0123456789"
+
+// RandomTokenSource is a TokenGenerator that uses math/rand. The tokens it generates are predictable, so
+// CryptoTokenSource should be preferred for issuing access tokens.
 type RandomTokenSource struct {
 	Src rand.Source
 	mu  sync.Mutex
@@ -14,8 +19,7 @@ type RandomTokenSource struct {
 // See his answer http://stackoverflow.com/a/31832326 for explanation.
 func (gen *RandomTokenSource) Generate(tokenLen int) string {
 	const (
-		chars       = "abcdefghikjlmnopqurstuvwxyzABCDEFGHIKJLMNOPQURSTUVWXYZ0123456789"
-		charIdxBits = 6 // number of bits needed to store an index: log2(len(chars)-1)
+		charIdxBits = 6 // number of bits needed to store an index: log2(len(tokenChars)-1)
 		charIdxMask = 1<<charIdxBits - 1
 		charIdxMax  = 63 / charIdxBits
 	)
@@ -29,8 +33,8 @@ func (gen *RandomTokenSource) Generate(tokenLen int) string {
 		if remain == 0 {
 			cache, remain = gen.getRandInt63(), charIdxMax
 		}
-		if idx := int(cache & charIdxMask); idx < len(chars) {
-			token[i-1] = chars[idx]
+		if idx := int(cache & charIdxMask); idx < len(tokenChars) {
+			token[i-1] = tokenChars[idx]
 			i--
 		}
 		cache >>= charIdxBits
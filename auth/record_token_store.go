@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/andrewslotin/michael/deploy"
+)
+
+// tokenRecordsCollection is the name of deploy.RecordStore collection used to keep issued tokens.
+const tokenRecordsCollection = "dashboard_tokens"
+
+// RecordTokenStore is a TokenStore that keeps issued tokens in a deploy.RecordStore, so that they survive
+// restarts and can be shared between several instances using the same database.
+type RecordTokenStore struct {
+	records deploy.RecordStore
+}
+
+// NewRecordTokenStore returns an instance of *RecordTokenStore that keeps tokens in records.
+func NewRecordTokenStore(records deploy.RecordStore) *RecordTokenStore {
+	return &RecordTokenStore{records: records}
+}
+
+// AddToken stores a new token and returns false if it has already been stored.
+func (s *RecordTokenStore) AddToken(token, channelID string, expiresAt time.Time) (bool, error) {
+	return s.records.AddRecord(tokenRecordsCollection, deploy.Record{
+		Key:       token,
+		Value:     []byte(channelID),
+		ExpiresAt: expiresAt,
+	})
+}
+
+// RemoveToken removes a token and returns the ID of channel it has been issued for.
+func (s *RecordTokenStore) RemoveToken(token string) (string, bool, error) {
+	rec, ok, err := s.records.DeleteRecord(tokenRecordsCollection, token)
+	if err != nil || !ok {
+		return "", false, err
+	}
+
+	return string(rec.Value), true, nil
+}
+
+// RemoveExpiredTokens removes expired tokens from the underlying store and returns their number.
+func (s *RecordTokenStore) RemoveExpiredTokens() (int, error) {
+	return s.records.RemoveExpiredRecords(tokenRecordsCollection)
+}
@@ -0,0 +1,51 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/auth"
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordTokenStore(t *testing.T) {
+	records := deploy.NewInMemoryStore()
+	require.NoError(t, records.PutRecord("other", deploy.Record{Key: "key1", ExpiresAt: time.Now().Add(-time.Second)}))
+
+	store := auth.NewRecordTokenStore(records)
+
+	added, err := store.AddToken("token1", "channel1", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	added, err = store.AddToken("token1", "channel2", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, added)
+
+	added, err = store.AddToken("token2", "channel2", time.Now().Add(-time.Second))
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	if channelID, ok, err := store.RemoveToken("token1"); assert.NoError(t, err) && assert.True(t, ok) {
+		assert.Equal(t, "channel1", channelID)
+	}
+
+	_, ok, err := store.RemoveToken("token1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	n, err := store.RemoveExpiredTokens()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// records that do not belong to issued tokens are left intact
+	n, err = records.RemoveExpiredRecords("other")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, ok, err = store.RemoveToken("token2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
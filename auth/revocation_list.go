@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/andrewslotin/michael/deploy"
+)
+
+// revokedTokensCollection is the name of deploy.RecordStore collection used to keep revoked token IDs.
+const revokedTokensCollection = "revoked_tokens"
+
+// RevocationList is an interface for storages of revoked JWT IDs (jti claim).
+//
+// Revoke adds token ID to the list. The ID can be removed from the list after expiresAt since the token
+// is not accepted anymore by then.
+//
+// Revoked checks whether token ID is in the list.
+type RevocationList interface {
+	Revoke(tokenID string, expiresAt time.Time) error
+	Revoked(tokenID string) (bool, error)
+}
+
+// RecordRevocationList is a RevocationList that keeps revoked token IDs in a deploy.RecordStore.
+type RecordRevocationList struct {
+	records deploy.RecordStore
+}
+
+// NewRecordRevocationList returns an instance of *RecordRevocationList that keeps token IDs in records.
+func NewRecordRevocationList(records deploy.RecordStore) *RecordRevocationList {
+	return &RecordRevocationList{records: records}
+}
+
+// Revoke adds token ID to the list until expiresAt.
+func (l *RecordRevocationList) Revoke(tokenID string, expiresAt time.Time) error {
+	return l.records.PutRecord(revokedTokensCollection, deploy.Record{
+		Key:       tokenID,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// Revoked returns true if token ID has been revoked.
+func (l *RecordRevocationList) Revoked(tokenID string) (bool, error) {
+	_, ok, err := l.records.GetRecord(revokedTokensCollection, tokenID)
+	return ok, err
+}
+
+// checkRevoked returns ErrRevokedToken if token ID is in the revocation list. Tokens issued without ID can
+// not be revoked individually, the only way to invalidate them is to remove their signing key from the keyset.
+func checkRevoked(revoked RevocationList, tokenID string) error {
+	if revoked == nil || tokenID == "" {
+		return nil
+	}
+
+	ok, err := revoked.Revoked(tokenID)
+	if err != nil {
+		return fmt.Errorf("failed to check whether token %s has been revoked: %s", tokenID, err)
+	}
+
+	if ok {
+		return ErrRevokedToken
+	}
+
+	return nil
+}
+
+// newTokenID returns a random ID to be used as a jti claim.
+func newTokenID() string {
+	return CryptoTokenSource{}.Generate(DefaultTokenLength)
+}
@@ -0,0 +1,30 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/auth"
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordRevocationList(t *testing.T) {
+	list := auth.NewRecordRevocationList(deploy.NewInMemoryStore())
+
+	revoked, err := list.Revoked("token1")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	require.NoError(t, list.Revoke("token1", time.Now().Add(time.Hour)))
+	require.NoError(t, list.Revoke("token2", time.Now().Add(-time.Second)))
+
+	revoked, err = list.Revoked("token1")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = list.Revoked("token2")
+	require.NoError(t, err)
+	assert.False(t, revoked, "expected revocation to expire together with the token")
+}
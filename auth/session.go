@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// SessionExpirationPeriod is the period of time after which a user who has signed in with Slack needs to
+// sign in again.
+const SessionExpirationPeriod = 7 * 24 * time.Hour
+
+// JWTSessionClaims identifies a user who has signed in with Slack. The user ID is stored as a subject claim.
+type JWTSessionClaims struct {
+	jwt.StandardClaims
+
+	TeamID string `json:"team_id,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// SessionTokenFromRequest reads and returns signed session JWT from request. If the request doesn't contain
+// session token this method returns an empty string.
+func SessionTokenFromRequest(r *http.Request) string {
+	sessionCookie, err := r.Cookie("Session")
+	if err != nil {
+		return ""
+	}
+
+	return sessionCookie.Value
+}
+
+// ParseSessionClaims verifies signed JWT string with a key from keyset and returns encoded JWTSessionClaims.
+// Most of the time the returned error is of type auth.Error.
+func ParseSessionClaims(tokenString string, keys *Keyset) (*JWTSessionClaims, error) {
+	claims := &JWTSessionClaims{}
+	if err := parseToken(tokenString, claims, keys); err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" {
+		return nil, ErrInvalidTokenFormat
+	}
+
+	return claims, nil
+}
+
+// StoreSessionToken writes tokenString into Session= cookie expiring in expTime. Cookie attributes are set
+// according to policy.
+func StoreSessionToken(w http.ResponseWriter, r *http.Request, tokenString string, expTime time.Time, policy CookiePolicy) {
+	policy.SetCookie(w, r, "Session", tokenString, expTime)
+}
+
+// ClearSessionToken removes Session= cookie.
+func ClearSessionToken(w http.ResponseWriter, r *http.Request, policy CookiePolicy) {
+	policy.ClearCookie(w, r, "Session")
+}
@@ -0,0 +1,69 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/auth"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionTokenFromRequest(t *testing.T) {
+	req, err := http.NewRequest("GET", "/", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "", auth.SessionTokenFromRequest(req))
+
+	req.AddCookie(&http.Cookie{
+		Name:  "Session",
+		Value: "cookie1",
+	})
+	assert.Equal(t, "cookie1", auth.SessionTokenFromRequest(req))
+}
+
+func TestParseSessionClaims(t *testing.T) {
+	secret := []byte("test secret")
+
+	claims, err := auth.ParseSessionClaims(signSessionToken(t, "U1", secret), auth.StaticKeyset(secret))
+	require.NoError(t, err)
+
+	assert.Equal(t, "U1", claims.Subject)
+}
+
+func TestParseSessionClaims_NoSubject(t *testing.T) {
+	secret := []byte("test secret")
+
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.JWTSessionClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	}).SignedString(secret)
+	require.NoError(t, err)
+
+	_, err = auth.ParseSessionClaims(tokenString, auth.StaticKeyset(secret))
+	assert.Equal(t, auth.ErrInvalidTokenFormat, err)
+}
+
+func TestParseSessionClaims_ExpiredToken(t *testing.T) {
+	secret := []byte("test secret")
+
+	_, err := auth.ParseSessionClaims(signExpiredSessionToken(t, "U1", secret), auth.StaticKeyset(secret))
+	assert.Equal(t, auth.ErrExpiredToken, err)
+}
+
+func TestStoreSessionToken(t *testing.T) {
+	expirationTime := time.Now().Add(time.Hour)
+	recorder := httptest.NewRecorder()
+
+	req, err := http.NewRequest("GET", "/auth/slack", nil)
+	require.NoError(t, err)
+
+	auth.StoreSessionToken(recorder, req, "token1", expirationTime, auth.CookiePolicy{Secure: auth.SecureCookiesAlways, SameSite: http.SameSiteStrictMode})
+
+	cookie := &http.Cookie{Name: "Session", Value: "token1", Path: "/", Expires: expirationTime, Secure: true, HttpOnly: true, SameSite: http.SameSiteStrictMode}
+	assert.Equal(t, cookie.String(), recorder.Header().Get("Set-Cookie"))
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+var sessionsPageTemplate = template.Must(template.New("sessions").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sessions</title></head>
+<body>
+{{- if .User}}
+<p>Signed in with Slack as {{.User.Name}} ({{.User.Subject}}) until {{.SessionExpiresAt}}</p>
+{{- end}}
+{{- if .Channels}}
+<table>
+<tr><th>Channel</th><th>Access expires at</th><th></th></tr>
+{{- range .Channels}}
+<tr>
+<td><a href="/{{.ID}}">{{.ID}}</a></td>
+<td>{{.ExpiresAt}}</td>
+<td><form method="POST" action="{{$.Path}}"><input type="hidden" name="csrf_token" value="{{$.CSRFToken}}"><input type="hidden" name="channel" value="{{.ID}}"><button type="submit">Drop</button></form></td>
+</tr>
+{{- end}}
+</table>
+{{- else}}
+<p>No channel access has been granted to this browser.</p>
+{{- end}}
+{{- if or .User .Channels}}
+<form method="POST" action="{{.LogoutPath}}"><input type="hidden" name="csrf_token" value="{{.CSRFToken}}"><button type="submit">Log out</button></form>
+{{- end}}
+</body>
+</html>
+`))
+
+type sessionsPage struct {
+	Path, LogoutPath string
+	CSRFToken        string
+	User             *JWTSessionClaims
+	SessionExpiresAt string
+	Channels         []channelGrant
+}
+
+type channelGrant struct {
+	ID        string
+	ExpiresAt string
+}
+
+// SessionsHandler lists channels granted by the channel access token in current request and allows to drop
+// individual grants with POST requests containing channel ID in channel form field. The handler is expected
+// to be wrapped with CSRFProtection.
+type SessionsHandler struct {
+	// Cookies defines attributes of the channel access token cookie.
+	Cookies CookiePolicy
+	// LogoutPath is the path to LogoutHandler.
+	LogoutPath string
+
+	keys    *Keyset
+	revoked RevocationList
+}
+
+// NewSessionsHandler returns an instance of *SessionsHandler that verifies and signs tokens with keys and
+// revokes the tokens that have been replaced.
+func NewSessionsHandler(keys *Keyset, revoked RevocationList) *SessionsHandler {
+	return &SessionsHandler{
+		Cookies:    DefaultCookiePolicy,
+		LogoutPath: "/logout",
+		keys:       keys,
+		revoked:    revoked,
+	}
+}
+
+func (h *SessionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch r.Method {
+	case "GET", "HEAD":
+		h.list(w, r)
+	case "POST":
+		h.drop(w, r)
+	default:
+		http.Error(w, "Only GET and POST requests are supported", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *SessionsHandler) list(w http.ResponseWriter, r *http.Request) {
+	page := sessionsPage{
+		Path:       r.URL.Path,
+		LogoutPath: h.LogoutPath,
+		CSRFToken:  CSRFToken(r),
+	}
+
+	if claims := h.channelAccessClaims(r); claims != nil {
+		for channelID, expiresAt := range claims.Channels {
+			page.Channels = append(page.Channels, channelGrant{ID: channelID, ExpiresAt: expiresAt.UTC().Format(time.RFC1123)})
+		}
+
+		sort.Slice(page.Channels, func(i, j int) bool {
+			return page.Channels[i].ID < page.Channels[j].ID
+		})
+	}
+
+	if claims, err := ParseSessionClaims(SessionTokenFromRequest(r), h.keys); err == nil && checkRevoked(h.revoked, claims.Id) == nil {
+		page.User = claims
+		page.SessionExpiresAt = time.Unix(claims.ExpiresAt, 0).UTC().Format(time.RFC1123)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := sessionsPageTemplate.Execute(w, page); err != nil {
+		log.Printf("failed to render sessions page: %s", err)
+	}
+}
+
+func (h *SessionsHandler) drop(w http.ResponseWriter, r *http.Request) {
+	channelID := r.PostFormValue("channel")
+
+	claims := h.channelAccessClaims(r)
+	if claims == nil {
+		http.Error(w, ErrNoChannelAccess.Message, ErrNoChannelAccess.Code)
+		return
+	}
+
+	if _, ok := claims.Channels[channelID]; !ok {
+		http.Error(w, ErrNoChannelAccess.Message, ErrNoChannelAccess.Code)
+		return
+	}
+
+	delete(claims.Channels, channelID)
+
+	var err error
+	if len(claims.Channels) == 0 {
+		err = revokeToken(h.revoked, claims.StandardClaims)
+		ClearChannelAccessToken(w, r, h.Cookies)
+	} else {
+		err = reissueChannelAccessToken(w, r, claims, time.Unix(claims.ExpiresAt, 0), h.keys, h.revoked, h.Cookies)
+	}
+
+	if err != nil {
+		log.Printf("failed to drop access to %s: %s", channelID, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+}
+
+// channelAccessClaims returns claims of a valid channel access token sent with request or nil.
+func (h *SessionsHandler) channelAccessClaims(r *http.Request) *JWTChannelClaims {
+	claims, err := ParseChannelAccessTokenClaims(ChannelAccessTokenFromRequest(r), h.keys)
+	if err != nil || checkRevoked(h.revoked, claims.Id) != nil {
+		return nil
+	}
+
+	return claims
+}
+
+// LogoutHandler revokes channel access and session tokens sent with a POST request and removes their cookies.
+type LogoutHandler struct {
+	// Cookies defines attributes of removed cookies.
+	Cookies CookiePolicy
+	// RedirectPath is the path to redirect to after logging out.
+	RedirectPath string
+
+	keys    *Keyset
+	revoked RevocationList
+}
+
+// NewLogoutHandler returns an instance of *LogoutHandler that verifies tokens with keys and adds their IDs to
+// revocation list.
+func NewLogoutHandler(keys *Keyset, revoked RevocationList) *LogoutHandler {
+	return &LogoutHandler{
+		Cookies:      DefaultCookiePolicy,
+		RedirectPath: "/sessions",
+		keys:         keys,
+		revoked:      revoked,
+	}
+}
+
+func (h *LogoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Only POST requests are supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if claims, err := ParseChannelAccessTokenClaims(ChannelAccessTokenFromRequest(r), h.keys); err == nil {
+		if err := revokeToken(h.revoked, claims.StandardClaims); err != nil {
+			log.Printf("failed to revoke channel access token on logout: %s", err)
+		}
+	}
+
+	if claims, err := ParseSessionClaims(SessionTokenFromRequest(r), h.keys); err == nil {
+		if err := revokeToken(h.revoked, claims.StandardClaims); err != nil {
+			log.Printf("failed to revoke session token on logout: %s", err)
+		}
+	}
+
+	ClearChannelAccessToken(w, r, h.Cookies)
+	ClearSessionToken(w, r, h.Cookies)
+
+	http.Redirect(w, r, h.RedirectPath, http.StatusSeeOther)
+}
+
+// revokeToken adds token ID to revocation list until the token expires.
+func revokeToken(revoked RevocationList, claims jwt.StandardClaims) error {
+	if revoked == nil || claims.Id == "" {
+		return nil
+	}
+
+	if err := revoked.Revoke(claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		return fmt.Errorf("failed to revoke token %s: %s", claims.Id, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/auth"
+	"github.com/andrewslotin/michael/deploy"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionsHandler_List(t *testing.T) {
+	jwtSecret := []byte("test secret")
+
+	req, err := http.NewRequest("GET", "/sessions", nil)
+	require.NoError(t, err)
+
+	req.AddCookie(&http.Cookie{
+		Name:  "Auth",
+		Value: signChannelAccessToken(t, "jti1", jwtSecret, "channel1", "channel2"),
+	})
+
+	recorder := httptest.NewRecorder()
+	auth.NewSessionsHandler(auth.StaticKeyset(jwtSecret), nil).ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+
+	body := recorder.Body.String()
+	assert.Contains(t, body, `value="channel1"`)
+	assert.Contains(t, body, `value="channel2"`)
+	assert.Contains(t, body, `action="/logout"`)
+}
+
+func TestSessionsHandler_List_NoToken(t *testing.T) {
+	req, err := http.NewRequest("GET", "/sessions", nil)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	auth.NewSessionsHandler(auth.StaticKeyset([]byte("test secret")), nil).ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "No channel access has been granted")
+	assert.NotContains(t, recorder.Body.String(), `action="/logout"`)
+}
+
+func TestSessionsHandler_Drop(t *testing.T) {
+	jwtSecret := []byte("test secret")
+	revoked := auth.NewRecordRevocationList(deploy.NewInMemoryStore())
+
+	req := newDropChannelRequest(t, "channel1")
+	req.AddCookie(&http.Cookie{
+		Name:  "Auth",
+		Value: signChannelAccessToken(t, "jti1", jwtSecret, "channel1", "channel2"),
+	})
+
+	recorder := httptest.NewRecorder()
+	auth.NewSessionsHandler(auth.StaticKeyset(jwtSecret), revoked).ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusSeeOther, recorder.Code)
+	assert.Equal(t, "/sessions", recorder.Header().Get("Location"))
+
+	isRevoked, err := revoked.Revoked("jti1")
+	require.NoError(t, err)
+	assert.True(t, isRevoked, "expected replaced token to be revoked")
+
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	claims, err := auth.ParseChannelAccessTokenClaims(cookies[0].Value, auth.StaticKeyset(jwtSecret))
+	require.NoError(t, err)
+
+	assert.NotEqual(t, "jti1", claims.Id)
+	assert.NotContains(t, claims.Channels, "channel1")
+	assert.Contains(t, claims.Channels, "channel2")
+}
+
+func TestSessionsHandler_Drop_LastChannel(t *testing.T) {
+	jwtSecret := []byte("test secret")
+	revoked := auth.NewRecordRevocationList(deploy.NewInMemoryStore())
+
+	req := newDropChannelRequest(t, "channel1")
+	req.AddCookie(&http.Cookie{
+		Name:  "Auth",
+		Value: signChannelAccessToken(t, "jti1", jwtSecret, "channel1"),
+	})
+
+	recorder := httptest.NewRecorder()
+	auth.NewSessionsHandler(auth.StaticKeyset(jwtSecret), revoked).ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusSeeOther, recorder.Code)
+
+	isRevoked, err := revoked.Revoked("jti1")
+	require.NoError(t, err)
+	assert.True(t, isRevoked)
+
+	cookies := recorder.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "Auth", cookies[0].Name)
+		assert.True(t, cookies[0].MaxAge < 0)
+	}
+}
+
+func TestSessionsHandler_Drop_NoChannelAccess(t *testing.T) {
+	jwtSecret := []byte("test secret")
+
+	req := newDropChannelRequest(t, "channel3")
+	req.AddCookie(&http.Cookie{
+		Name:  "Auth",
+		Value: signChannelAccessToken(t, "jti1", jwtSecret, "channel1"),
+	})
+
+	recorder := httptest.NewRecorder()
+	auth.NewSessionsHandler(auth.StaticKeyset(jwtSecret), nil).ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Empty(t, recorder.Result().Cookies())
+}
+
+func TestLogoutHandler(t *testing.T) {
+	jwtSecret := []byte("test secret")
+	revoked := auth.NewRecordRevocationList(deploy.NewInMemoryStore())
+
+	sessionToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.JWTSessionClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        "jti2",
+			Subject:   "U1",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	}).SignedString(jwtSecret)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("POST", "/logout", nil)
+	require.NoError(t, err)
+
+	req.AddCookie(&http.Cookie{Name: "Auth", Value: signChannelAccessToken(t, "jti1", jwtSecret, "channel1")})
+	req.AddCookie(&http.Cookie{Name: "Session", Value: sessionToken})
+
+	recorder := httptest.NewRecorder()
+	auth.NewLogoutHandler(auth.StaticKeyset(jwtSecret), revoked).ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusSeeOther, recorder.Code)
+	assert.Equal(t, "/sessions", recorder.Header().Get("Location"))
+
+	for _, id := range []string{"jti1", "jti2"} {
+		isRevoked, err := revoked.Revoked(id)
+		require.NoError(t, err)
+		assert.True(t, isRevoked, "expected %s to be revoked", id)
+	}
+
+	cleared := make(map[string]bool)
+	for _, cookie := range recorder.Result().Cookies() {
+		cleared[cookie.Name] = cookie.MaxAge < 0
+	}
+
+	assert.Equal(t, map[string]bool{"Auth": true, "Session": true}, cleared)
+}
+
+func signChannelAccessToken(t *testing.T, id string, secret []byte, channels ...string) string {
+	claims := auth.JWTChannelClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        id,
+			IssuedAt:  time.Now().Add(-10 * time.Minute).Unix(),
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		Channels: make(map[string]time.Time),
+	}
+
+	for _, channelID := range channels {
+		claims.Channels[channelID] = time.Now().Add(time.Hour)
+	}
+
+	signedToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	require.NoError(t, err)
+
+	return signedToken
+}
+
+func newDropChannelRequest(t *testing.T, channelID string) *http.Request {
+	req, err := http.NewRequest("POST", "/sessions", strings.NewReader(url.Values{"channel": {channelID}}.Encode()))
+	require.NoError(t, err)
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return req
+}
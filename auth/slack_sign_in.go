@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/andrewslotin/michael/slack"
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// SlackAuthorizeURL is the "Sign in with Slack" OpenID Connect authorization endpoint.
+const SlackAuthorizeURL = "https://slack.com/openid/connect/authorize"
+
+// signInStateCookie keeps the OpenID Connect state parameter and the page to return to after signing in.
+const signInStateCookie = "SignInState"
+
+// SlackIdentityProvider is an interface for "Sign in with Slack" OpenID Connect provider.
+//
+// ExchangeOpenIDCode is used to exchange an authorization code for a user access token.
+//
+// OpenIDUserInfo is used to identify the user who has obtained access token.
+type SlackIdentityProvider interface {
+	ExchangeOpenIDCode(clientID, clientSecret, code, redirectURI string) (string, error)
+	OpenIDUserInfo(accessToken string) (slack.OpenIDIdentity, error)
+}
+
+// SlackSignIn is an http.Handler that implements "Sign in with Slack" OpenID Connect flow. A user who has
+// signed in gets a session cookie that can be used to access channels they are member of.
+//
+// The same URL is used both to start the sign in and as a redirect URI, so it needs to be added to the list of
+// redirect URLs in Slack app settings.
+type SlackSignIn struct {
+	// TeamID restricts sign in to members of a Slack workspace. An empty value allows users from any workspace
+	// to sign in.
+	TeamID string
+	// AuthorizeURL is the URL of OpenID Connect authorization endpoint.
+	AuthorizeURL string
+	// Cookies defines attributes of session cookie. It is also used to tell whether the redirect URI should
+	// use HTTPS.
+	Cookies CookiePolicy
+
+	provider     SlackIdentityProvider
+	clientID     string
+	clientSecret string
+	keys         *Keyset
+	states       TokenGenerator
+}
+
+// NewSlackSignIn returns an instance of *SlackSignIn that uses Slack app credentials to identify users with
+// provider and signs session tokens with the active key from keys.
+func NewSlackSignIn(provider SlackIdentityProvider, clientID, clientSecret string, keys *Keyset) *SlackSignIn {
+	return &SlackSignIn{
+		AuthorizeURL: SlackAuthorizeURL,
+		Cookies:      DefaultCookiePolicy,
+		provider:     provider,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		keys:         keys,
+		states:       CryptoTokenSource{},
+	}
+}
+
+func (h *SlackSignIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.FormValue("error") != "":
+		http.Error(w, "Sign in with Slack failed: "+r.FormValue("error"), http.StatusUnauthorized)
+	case r.FormValue("code") != "":
+		h.finishSignIn(w, r)
+	default:
+		h.startSignIn(w, r)
+	}
+}
+
+// SignInURL returns the URL to redirect a user to in order to sign in and get back to returnTo.
+func SignInURL(signInPath, returnTo string) string {
+	u := &url.URL{Path: signInPath}
+
+	q := u.Query()
+	q.Set("return_to", returnTo)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+func (h *SlackSignIn) startSignIn(w http.ResponseWriter, r *http.Request) {
+	returnTo := r.FormValue("return_to")
+	if !isLocalPath(returnTo) {
+		returnTo = "/"
+	}
+
+	state := h.states.Generate(DefaultTokenLength * 2)
+
+	h.Cookies.SetCookie(w, r, signInStateCookie, url.Values{"state": {state}, "return_to": {returnTo}}.Encode(), time.Now().Add(10*time.Minute))
+
+	authorizeURL, err := url.Parse(h.AuthorizeURL)
+	if err != nil {
+		log.Printf("malformed Slack authorization URL %s: %s", h.AuthorizeURL, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	q := authorizeURL.Query()
+	q.Set("response_type", "code")
+	q.Set("scope", "openid profile")
+	q.Set("client_id", h.clientID)
+	q.Set("state", state)
+	q.Set("redirect_uri", h.redirectURI(r))
+	if h.TeamID != "" {
+		q.Set("team", h.TeamID)
+	}
+	authorizeURL.RawQuery = q.Encode()
+
+	http.Redirect(w, r, authorizeURL.String(), http.StatusFound)
+}
+
+func (h *SlackSignIn) finishSignIn(w http.ResponseWriter, r *http.Request) {
+	stateCookie, err := r.Cookie(signInStateCookie)
+	if err != nil {
+		http.Error(w, "Sign in session has expired, please try again", http.StatusBadRequest)
+		return
+	}
+
+	// Remove the state to make sure it's not used again
+	h.Cookies.ClearCookie(w, r, signInStateCookie)
+
+	expected, err := url.ParseQuery(stateCookie.Value)
+	if err != nil || expected.Get("state") == "" || subtle.ConstantTimeCompare([]byte(expected.Get("state")), []byte(r.FormValue("state"))) != 1 {
+		http.Error(w, "Sign in state mismatch, please try again", http.StatusBadRequest)
+		return
+	}
+
+	accessToken, err := h.provider.ExchangeOpenIDCode(h.clientID, h.clientSecret, r.FormValue("code"), h.redirectURI(r))
+	if err != nil {
+		log.Printf("failed to exchange Slack authorization code: %s", err)
+		http.Error(w, "Sign in with Slack failed", http.StatusUnauthorized)
+		return
+	}
+
+	identity, err := h.provider.OpenIDUserInfo(accessToken)
+	if err != nil {
+		log.Printf("failed to fetch Slack user identity: %s", err)
+		http.Error(w, "Sign in with Slack failed", http.StatusUnauthorized)
+		return
+	}
+
+	if h.TeamID != "" && identity.TeamID != h.TeamID {
+		log.Printf("%s (%s) from team %s attempted to sign in", identity.Name, identity.UserID, identity.TeamID)
+		http.Error(w, "Sign in is only allowed for members of the team", http.StatusForbidden)
+		return
+	}
+
+	issueTime := time.Now()
+	expirationTime := issueTime.Add(SessionExpirationPeriod)
+
+	tokenString, err := h.keys.SignedString(JWTSessionClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        newTokenID(),
+			Subject:   identity.UserID,
+			IssuedAt:  issueTime.Unix(),
+			ExpiresAt: expirationTime.Unix(),
+		},
+		TeamID: identity.TeamID,
+		Name:   identity.Name,
+	})
+	if err != nil {
+		log.Printf("failed to sign session token: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	StoreSessionToken(w, r, tokenString, expirationTime, h.Cookies)
+	log.Printf("%s (%s) has signed in with Slack", identity.Name, identity.UserID)
+
+	returnTo := expected.Get("return_to")
+	if !isLocalPath(returnTo) {
+		returnTo = "/"
+	}
+
+	http.Redirect(w, r, returnTo, http.StatusFound)
+}
+
+// redirectURI returns the absolute URL of the current request without query string.
+func (h *SlackSignIn) redirectURI(r *http.Request) string {
+	scheme := "http"
+	if h.Cookies.IsSecureRequest(r) {
+		scheme = "https"
+	}
+
+	return (&url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path}).String()
+}
+
+// isLocalPath returns true if s is a path on the same host, so that it's safe to redirect to it.
+func isLocalPath(s string) bool {
+	return strings.HasPrefix(s, "/") && !strings.HasPrefix(s, "//") && !strings.HasPrefix(s, "/\\")
+}
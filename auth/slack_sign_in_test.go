@@ -0,0 +1,164 @@
+package auth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/andrewslotin/michael/auth"
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlackSignIn_Start(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "http://michael.example.com/auth/slack?return_to=%2Fchannel1", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Forwarded-Proto", "https")
+
+	signIn := auth.NewSlackSignIn(new(identityProviderMock), "client1", "secret1", auth.StaticKeyset([]byte("secret")))
+	signIn.TeamID = "T1"
+	signIn.Cookies.TrustProxyHeaders = true
+
+	signIn.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusFound, recorder.Code)
+
+	location, err := url.Parse(recorder.Header().Get("Location"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "slack.com", location.Host)
+	assert.Equal(t, "/openid/connect/authorize", location.Path)
+
+	q := location.Query()
+	assert.Equal(t, "code", q.Get("response_type"))
+	assert.Equal(t, "openid profile", q.Get("scope"))
+	assert.Equal(t, "client1", q.Get("client_id"))
+	assert.Equal(t, "T1", q.Get("team"))
+	assert.Equal(t, "https://michael.example.com/auth/slack", q.Get("redirect_uri"))
+	assert.NotEmpty(t, q.Get("state"))
+
+	if cookies := recorder.Result().Cookies(); assert.Len(t, cookies, 1) {
+		assert.Equal(t, "SignInState", cookies[0].Name)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.True(t, cookies[0].Secure)
+
+		state, err := url.ParseQuery(cookies[0].Value)
+		require.NoError(t, err)
+		assert.Equal(t, q.Get("state"), state.Get("state"))
+		assert.Equal(t, "/channel1", state.Get("return_to"))
+	}
+}
+
+func TestSlackSignIn_Callback(t *testing.T) {
+	secret := []byte("secret")
+
+	provider := new(identityProviderMock)
+	provider.On("ExchangeOpenIDCode", "client1", "secret1", "code1", "http://michael.example.com/auth/slack").Return("xoxp-1234", nil)
+	provider.On("OpenIDUserInfo", "xoxp-1234").Return(slack.OpenIDIdentity{UserID: "U1", TeamID: "T1", Name: "user1"}, nil)
+
+	recorder := signInCallback(t, auth.NewSlackSignIn(provider, "client1", "secret1", auth.StaticKeyset(secret)), "state1", "state1", "/channel1")
+	require.Equal(t, http.StatusFound, recorder.Code)
+	assert.Equal(t, "/channel1", recorder.Header().Get("Location"))
+
+	provider.AssertExpectations(t)
+
+	var sessionCookie *http.Cookie
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == "Session" {
+			sessionCookie = cookie
+		}
+	}
+
+	if assert.NotNil(t, sessionCookie) {
+		if claims, err := auth.ParseSessionClaims(sessionCookie.Value, auth.StaticKeyset(secret)); assert.NoError(t, err) {
+			assert.Equal(t, "U1", claims.Subject)
+			assert.Equal(t, "T1", claims.TeamID)
+			assert.Equal(t, "user1", claims.Name)
+		}
+	}
+}
+
+func TestSlackSignIn_Callback_UnsafeReturnPath(t *testing.T) {
+	provider := new(identityProviderMock)
+	provider.On("ExchangeOpenIDCode", "client1", "secret1", "code1", "http://michael.example.com/auth/slack").Return("xoxp-1234", nil)
+	provider.On("OpenIDUserInfo", "xoxp-1234").Return(slack.OpenIDIdentity{UserID: "U1", TeamID: "T1", Name: "user1"}, nil)
+
+	recorder := signInCallback(t, auth.NewSlackSignIn(provider, "client1", "secret1", auth.StaticKeyset([]byte("secret"))), "state1", "state1", "//evil.example.com")
+	require.Equal(t, http.StatusFound, recorder.Code)
+	assert.Equal(t, "/", recorder.Header().Get("Location"))
+}
+
+func TestSlackSignIn_Callback_StateMismatch(t *testing.T) {
+	provider := new(identityProviderMock)
+
+	recorder := signInCallback(t, auth.NewSlackSignIn(provider, "client1", "secret1", auth.StaticKeyset([]byte("secret"))), "state1", "state2", "/channel1")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	provider.AssertNotCalled(t, "ExchangeOpenIDCode", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSlackSignIn_Callback_AnotherTeam(t *testing.T) {
+	provider := new(identityProviderMock)
+	provider.On("ExchangeOpenIDCode", "client1", "secret1", "code1", "http://michael.example.com/auth/slack").Return("xoxp-1234", nil)
+	provider.On("OpenIDUserInfo", "xoxp-1234").Return(slack.OpenIDIdentity{UserID: "U1", TeamID: "T2", Name: "user1"}, nil)
+
+	signIn := auth.NewSlackSignIn(provider, "client1", "secret1", auth.StaticKeyset([]byte("secret")))
+	signIn.TeamID = "T1"
+
+	recorder := signInCallback(t, signIn, "state1", "state1", "/channel1")
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	for _, cookie := range recorder.Result().Cookies() {
+		assert.NotEqual(t, "Session", cookie.Name)
+	}
+}
+
+func TestSlackSignIn_Callback_ProviderError(t *testing.T) {
+	provider := new(identityProviderMock)
+	provider.On("ExchangeOpenIDCode", "client1", "secret1", "code1", "http://michael.example.com/auth/slack").Return("", errors.New("invalid_code"))
+
+	recorder := signInCallback(t, auth.NewSlackSignIn(provider, "client1", "secret1", auth.StaticKeyset([]byte("secret"))), "state1", "state1", "/channel1")
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestSlackSignIn_Denied(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "http://michael.example.com/auth/slack?error=access_denied&state=state1", nil)
+	require.NoError(t, err)
+
+	auth.NewSlackSignIn(new(identityProviderMock), "client1", "secret1", auth.StaticKeyset([]byte("secret"))).ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func signInCallback(t *testing.T, h http.Handler, expectedState, state, returnTo string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "http://michael.example.com/auth/slack?code=code1&state="+state, nil)
+	require.NoError(t, err)
+
+	req.AddCookie(&http.Cookie{
+		Name:  "SignInState",
+		Value: url.Values{"state": {expectedState}, "return_to": {returnTo}}.Encode(),
+	})
+
+	h.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+type identityProviderMock struct {
+	mock.Mock
+}
+
+func (m *identityProviderMock) ExchangeOpenIDCode(clientID, clientSecret, code, redirectURI string) (string, error) {
+	args := m.Called(clientID, clientSecret, code, redirectURI)
+	return args.String(0), args.Error(1)
+}
+
+func (m *identityProviderMock) OpenIDUserInfo(accessToken string) (slack.OpenIDIdentity, error) {
+	args := m.Called(accessToken)
+	return args.Get(0).(slack.OpenIDIdentity), args.Error(1)
+}
@@ -5,16 +5,16 @@ const DefaultTokenLength = 16
 
 // TokenAuthenticator is an interface that wraps Authenticate method.
 //
-// Authenticate is used to check token authenticity.
+// Authenticate is used to check whether token grants access to channel.
 type TokenAuthenticator interface {
-	Authenticate(token string) bool
+	Authenticate(channelID, token string) bool
 }
 
 // TokenIssuer is an interface that wraps IssueToken method.
 //
-// IssueToken is used to generate a new token of given length.
+// IssueToken is used to generate a new token of given length granting access to channel.
 type TokenIssuer interface {
-	IssueToken(tokenLen int) (token string, err error)
+	IssueToken(channelID string, tokenLen int) (token string, err error)
 }
 
 // None is TokenAuthenticator and TokenIssuer that always issues an empty token and authenticates everything.
@@ -22,10 +22,10 @@ var None = noopAuth{}
 
 type noopAuth struct{}
 
-func (noopAuth) IssueToken(int) (string, error) {
+func (noopAuth) IssueToken(string, int) (string, error) {
 	return "", nil
 }
 
-func (noopAuth) Authenticate(token string) bool {
+func (noopAuth) Authenticate(channelID, token string) bool {
 	return true
 }
@@ -1,31 +1,49 @@
 package auth
 
 import (
+	"log"
 	"net/http"
 	"time"
 
+	"github.com/andrewslotin/michael/audit"
 	"github.com/andrewslotin/michael/dashboard"
-	jwt "github.com/dgrijalva/jwt-go"
 )
 
 type ChannelAuthenticator struct {
-	handler http.Handler
-	auth    TokenAuthenticator
-	secret  []byte
+	// Cookies defines attributes of the channel access token cookie.
+	Cookies CookiePolicy
+
+	handler  http.Handler
+	auth     TokenAuthenticator
+	keys     *Keyset
+	revoked  RevocationList
+	auditLog audit.Log
 }
 
 // TokenAuthenticationMiddleware wraps an http.Handler and checks if the request contains token parameter
-// which value can be authenticated by given authenticator. If the token is authenticated CahnnelAuthenticator
+// which value can be authenticated by given authenticator for requested channel. If the token is authenticated CahnnelAuthenticator
 // grants access to requested channel. If there was no token provided, the request gets passed further leaving
-// the underlying handler to deal with authorization.
-func TokenAuthenticationMiddleware(h http.Handler, authenticator TokenAuthenticator, jwtSecret []byte) http.Handler {
+// the underlying handler to deal with authorization. Channel access tokens are signed with the active key from keys.
+func TokenAuthenticationMiddleware(h http.Handler, authenticator TokenAuthenticator, keys *Keyset) *ChannelAuthenticator {
 	return &ChannelAuthenticator{
+		Cookies: DefaultCookiePolicy,
 		handler: h,
 		auth:    authenticator,
-		secret:  jwtSecret,
+		keys:    keys,
 	}
 }
 
+// SetRevocationList prevents ChannelAuthenticator from extending channel access tokens which IDs are
+// in revocation list.
+func (h *ChannelAuthenticator) SetRevocationList(revoked RevocationList) {
+	h.revoked = revoked
+}
+
+// SetAuditLog makes ChannelAuthenticator log each attempt to redeem a token.
+func (h *ChannelAuthenticator) SetAuditLog(l audit.Log) {
+	h.auditLog = l
+}
+
 func (h *ChannelAuthenticator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	channelID := dashboard.ChannelIDFromRequest(r)
 	if channelID == "" {
@@ -33,12 +51,30 @@ func (h *ChannelAuthenticator) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if token := r.FormValue("token"); token == "" || !h.auth.Authenticate(token) {
+	token := r.FormValue("token")
+	if token == "" {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+
+	if !h.auth.Authenticate(channelID, token) {
+		h.audit(channelID, r, audit.Denied, "invalid or expired token")
 		h.handler.ServeHTTP(w, r)
 		return
 	}
 
-	h.grantChannelAccess(channelID, w, r)
+	if err := h.grantChannelAccess(channelID, w, r); err != nil {
+		log.Printf("failed to grant access to %s: %s", channelID, err)
+		h.audit(channelID, r, audit.Failed, "failed to grant channel access")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(channelID, r, audit.Succeeded, "granted channel access")
+
+	// Make sure the URL with token is neither cached nor sent as a referrer
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
 
 	url := *r.URL
 	q := url.Query()
@@ -55,7 +91,7 @@ func (h *ChannelAuthenticator) grantChannelAccess(channelID string, w http.Respo
 
 	var claims *JWTChannelClaims
 	if token := ChannelAccessTokenFromRequest(r); token != "" {
-		if existingClaims, err := ParseChannelAccessTokenClaims(token, h.secret); err == nil { // TODO: inject key
+		if existingClaims, err := ParseChannelAccessTokenClaims(token, h.keys); err == nil && checkRevoked(h.revoked, existingClaims.Id) == nil {
 			claims = existingClaims
 		}
 	}
@@ -65,19 +101,26 @@ func (h *ChannelAuthenticator) grantChannelAccess(channelID string, w http.Respo
 		claims.Channels = make(map[string]time.Time, 1)
 	}
 
-	issueTime := time.Now()
-	expirationTime := issueTime.Add(ChannelAccessTokenExpirationPeriod)
-
-	claims.IssuedAt = issueTime.Unix()
-	claims.ExpiresAt = expirationTime.Unix()
+	expirationTime := time.Now().Add(ChannelAccessTokenExpirationPeriod)
 	claims.Channels[channelID] = expirationTime
 
-	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(h.secret)
-	if err != nil {
-		return err
-	}
+	return reissueChannelAccessToken(w, r, claims, expirationTime, h.keys, h.revoked, h.Cookies)
+}
 
-	StoreChannelAccessToken(w, tokenString, expirationTime)
+func (h *ChannelAuthenticator) audit(channelID string, r *http.Request, outcome audit.Outcome, details string) {
+	if h.auditLog == nil {
+		return
+	}
 
-	return nil
+	err := h.auditLog.Append(audit.Entry{
+		Time:      time.Now().UTC(),
+		Source:    audit.SourceDashboard,
+		ChannelID: channelID,
+		Text:      "redeem history link",
+		Outcome:   outcome,
+		Details:   details + " to " + r.RemoteAddr,
+	})
+	if err != nil {
+		log.Printf("failed to write audit entry: %s", err)
+	}
 }
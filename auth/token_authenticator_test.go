@@ -7,9 +7,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/andrewslotin/michael/audit"
 	"github.com/andrewslotin/michael/auth"
 	"github.com/andrewslotin/michael/auth/authtest"
+	"github.com/andrewslotin/michael/deploy"
+	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -25,9 +29,9 @@ func TestTokenAuthenticationMiddleware_ValidToken(t *testing.T) {
 		handler       authtest.HandlerMock
 		authenticator authtest.TokenAuthenticatorMock
 	)
-	authenticator.On("Authenticate", token).Return(true)
+	authenticator.On("Authenticate", "channel1", token).Return(true)
 
-	auth.TokenAuthenticationMiddleware(handler, authenticator, secret).ServeHTTP(recorder, req)
+	auth.TokenAuthenticationMiddleware(handler, &authenticator, auth.StaticKeyset(secret)).ServeHTTP(recorder, req)
 
 	authenticator.AssertExpectations(t)
 
@@ -38,7 +42,7 @@ func TestTokenAuthenticationMiddleware_ValidToken(t *testing.T) {
 		parts := strings.SplitN(cookieString, ";", 2)
 
 		token := strings.TrimPrefix(parts[0], "Auth=")
-		if claims, err := auth.ParseChannelAccessTokenClaims(token, secret); assert.NoError(t, err) {
+		if claims, err := auth.ParseChannelAccessTokenClaims(token, auth.StaticKeyset(secret)); assert.NoError(t, err) {
 			assert.WithinDuration(t, time.Now().Add(auth.ChannelAccessTokenExpirationPeriod), claims.Channels["channel1"], time.Second)
 		}
 	}
@@ -56,9 +60,9 @@ func TestTokenAuthenticationMiddleware_InvalidToken(t *testing.T) {
 		authenticator authtest.TokenAuthenticatorMock
 	)
 	handler.On("ServeHTTP", recorder, req).Return().Once()
-	authenticator.On("Authenticate", token).Return(false)
+	authenticator.On("Authenticate", "channel1", token).Return(false)
 
-	auth.TokenAuthenticationMiddleware(handler, authenticator, []byte("secret")).ServeHTTP(recorder, req)
+	auth.TokenAuthenticationMiddleware(handler, &authenticator, auth.StaticKeyset([]byte("secret"))).ServeHTTP(recorder, req)
 	assert.Equal(t, http.StatusOK, recorder.Code)
 
 	assert.Empty(t, recorder.Header().Get("Set-Cookie"))
@@ -82,7 +86,7 @@ func TestTokenAuthenticationMiddleware_NoChannelID(t *testing.T) {
 	)
 	handler.On("ServeHTTP", recorder, req).Return().Once()
 
-	auth.TokenAuthenticationMiddleware(handler, authenticator, []byte("secret")).ServeHTTP(recorder, req)
+	auth.TokenAuthenticationMiddleware(handler, &authenticator, auth.StaticKeyset([]byte("secret"))).ServeHTTP(recorder, req)
 	assert.Equal(t, http.StatusOK, recorder.Code)
 
 	assert.Empty(t, recorder.Header().Get("Set-Cookie"))
@@ -103,7 +107,7 @@ func TestTokenAuthenticationMiddleware_NoToken(t *testing.T) {
 	)
 	handler.On("ServeHTTP", recorder, req).Return().Once()
 
-	auth.TokenAuthenticationMiddleware(handler, authenticator, nil).ServeHTTP(recorder, req)
+	auth.TokenAuthenticationMiddleware(handler, &authenticator, auth.StaticKeyset(nil)).ServeHTTP(recorder, req)
 	assert.Equal(t, http.StatusOK, recorder.Code)
 
 	assert.Empty(t, recorder.Header().Get("Set-Cookie"))
@@ -112,3 +116,100 @@ func TestTokenAuthenticationMiddleware_NoToken(t *testing.T) {
 
 	handler.AssertExpectations(t)
 }
+
+func TestTokenAuthenticationMiddleware_KeyRotation(t *testing.T) {
+	keys := auth.NewKeyset(auth.Key{ID: "key2", Secret: []byte("secret2")}, auth.Key{ID: "key1", Secret: []byte("secret1")})
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/channel1?token=token1", nil)
+	require.NoError(t, err)
+
+	var authenticator authtest.TokenAuthenticatorMock
+	authenticator.On("Authenticate", "channel1", "token1").Return(true)
+
+	auth.TokenAuthenticationMiddleware(new(authtest.HandlerMock), &authenticator, keys).ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusFound, recorder.Code)
+
+	if cookies := recorder.Result().Cookies(); assert.Len(t, cookies, 1) {
+		token, err := jwt.ParseWithClaims(cookies[0].Value, &auth.JWTChannelClaims{}, keys.Keyfunc)
+		require.NoError(t, err)
+
+		assert.Equal(t, "key2", token.Header["kid"])
+		assert.NotEmpty(t, token.Claims.(*auth.JWTChannelClaims).Id)
+	}
+}
+
+func TestTokenAuthenticationMiddleware_RevokedToken(t *testing.T) {
+	keys := auth.StaticKeyset([]byte("secret"))
+
+	existingToken, err := keys.SignedString(auth.JWTChannelClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        "jti1",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		Channels: map[string]time.Time{
+			"channel2": time.Now().Add(time.Hour),
+		},
+	})
+	require.NoError(t, err)
+
+	revoked := auth.NewRecordRevocationList(deploy.NewInMemoryStore())
+	require.NoError(t, revoked.Revoke("jti1", time.Now().Add(time.Hour)))
+
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/channel1?token=token1", nil)
+	require.NoError(t, err)
+	req.AddCookie(&http.Cookie{Name: "Auth", Value: existingToken})
+
+	var authenticator authtest.TokenAuthenticatorMock
+	authenticator.On("Authenticate", "channel1", "token1").Return(true)
+
+	authMiddleware := auth.TokenAuthenticationMiddleware(new(authtest.HandlerMock), &authenticator, keys)
+	authMiddleware.SetRevocationList(revoked)
+
+	authMiddleware.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusFound, recorder.Code)
+
+	if cookies := recorder.Result().Cookies(); assert.Len(t, cookies, 1) {
+		claims, err := auth.ParseChannelAccessTokenClaims(cookies[0].Value, keys)
+		require.NoError(t, err)
+
+		assert.NotEqual(t, "jti1", claims.Id)
+		assert.Contains(t, claims.Channels, "channel1")
+		assert.NotContains(t, claims.Channels, "channel2", "expected grants from a revoked token to be dropped")
+	}
+}
+
+func TestTokenAuthenticationMiddleware_AuditLog(t *testing.T) {
+	auditLog := audit.NewRecordLog(deploy.NewInMemoryStore())
+
+	var authenticator authtest.TokenAuthenticatorMock
+	authenticator.On("Authenticate", "channel1", "token1").Return(true)
+	authenticator.On("Authenticate", "channel1", "token2").Return(false)
+
+	handler := new(authtest.HandlerMock)
+	handler.On("ServeHTTP", mock.Anything, mock.Anything).Return()
+
+	channelAuthenticator := auth.TokenAuthenticationMiddleware(handler, &authenticator, auth.StaticKeyset([]byte("secret")))
+	channelAuthenticator.SetAuditLog(auditLog)
+
+	for _, token := range []string{"token1", "token2"} {
+		req, err := http.NewRequest("GET", "/channel1?token="+token, nil)
+		require.NoError(t, err)
+
+		channelAuthenticator.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	entries, err := auditLog.Entries("channel1")
+	require.NoError(t, err)
+
+	if assert.Len(t, entries, 2) {
+		var outcomes []audit.Outcome
+		for _, e := range entries {
+			assert.Equal(t, audit.SourceDashboard, e.Source)
+			outcomes = append(outcomes, e.Outcome)
+		}
+
+		assert.ElementsMatch(t, []audit.Outcome{audit.Succeeded, audit.Denied}, outcomes)
+	}
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenStore is an interface for storages of issued one-time tokens. Using a shared TokenStore allows several
+// instances of michael to authenticate tokens issued by each other.
+//
+// AddToken stores a new token issued for a channel and returns false if there is already an unexpired token
+// with the same value.
+//
+// RemoveToken removes a token and returns the ID of channel it has been issued for. It returns false if there was
+// no such token or it has already expired.
+//
+// RemoveExpiredTokens removes expired tokens and returns their number.
+type TokenStore interface {
+	AddToken(token, channelID string, expiresAt time.Time) (bool, error)
+	RemoveToken(token string) (channelID string, ok bool, err error)
+	RemoveExpiredTokens() (int, error)
+}
+
+type issuedToken struct {
+	ChannelID string
+	ExpiresAt time.Time
+}
+
+func (t issuedToken) Expired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+// InMemoryTokenStore is a TokenStore that keeps tokens in memory of the current process.
+type InMemoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]issuedToken
+}
+
+// NewInMemoryTokenStore returns an instance of *InMemoryTokenStore.
+func NewInMemoryTokenStore() *InMemoryTokenStore {
+	return &InMemoryTokenStore{
+		tokens: make(map[string]issuedToken, 50),
+	}
+}
+
+// AddToken stores a new token and returns false if it has already been stored.
+func (s *InMemoryTokenStore) AddToken(token, channelID string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.tokens[token]; ok && !t.Expired(time.Now()) {
+		return false, nil
+	}
+
+	s.tokens[token] = issuedToken{ChannelID: channelID, ExpiresAt: expiresAt}
+
+	return true, nil
+}
+
+// RemoveToken removes a token and returns the ID of channel it has been issued for.
+func (s *InMemoryTokenStore) RemoveToken(token string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[token]
+	if !ok {
+		return "", false, nil
+	}
+
+	delete(s.tokens, token)
+
+	if t.Expired(time.Now()) {
+		return "", false, nil
+	}
+
+	return t.ChannelID, true, nil
+}
+
+// RemoveExpiredTokens removes expired tokens and returns their number.
+func (s *InMemoryTokenStore) RemoveExpiredTokens() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	var n int
+	for token, t := range s.tokens {
+		if t.Expired(now) {
+			delete(s.tokens, token)
+			n++
+		}
+	}
+
+	return n, nil
+}
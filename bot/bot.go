@@ -2,13 +2,20 @@ package bot
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/andrewslotin/michael/audit"
 	"github.com/andrewslotin/michael/auth"
+	"github.com/andrewslotin/michael/changelog"
 	"github.com/andrewslotin/michael/deploy"
 	"github.com/andrewslotin/michael/github"
 	"github.com/andrewslotin/michael/slack"
@@ -24,17 +31,67 @@ type Bot struct {
 	slackToken    string
 	deploys       *deploy.ChannelDeploys
 	responses     *ResponseBuilder
+	providers     *deploy.ReferenceProviders
+	github        *GitHubReferenceProvider
 	dashboardAuth auth.TokenIssuer
+	historyPruner *deploy.HistoryPruner
+	admins        map[string]struct{}
+	permissions   *Permissions
+	auditLog      audit.Log
+	settings      SettingsStore
+	pending       *deploy.PendingDeploys
 
 	deployEventHandlers []DeployEventHandler
+	deployGates         []DeployGate
+	pullRequestGate     *PullRequestGate
+
+	messages         MessagePoster
+	lookupTimeout    time.Duration
+	changelogTimeout time.Duration
+	gateTimeout      time.Duration
+	membersTimeout   time.Duration
+
+	history      deploy.Repository
+	changelog    *changelog.Builder
+	releaseNotes *changelog.Options
+	references   deploy.ReferenceIndex
+	members      auth.ChannelMembershipChecker
+
+	mu            sync.Mutex
+	announcements map[string]string // timestamps of announcements posted via Web API
+}
+
+// MessagePoster posts messages to Slack channels and updates them.
+type MessagePoster interface {
+	PostChannelMessage(channelID string, message slack.Message) (string, error)
+	UpdateMessage(channelID, ts string, message slack.Message) error
 }
 
 func New(slackToken, githubToken string, store deploy.Store) *Bot {
+	githubClient := github.NewClient(githubToken, nil)
+	githubReferences := NewGitHubReferenceProvider(githubClient)
+	providers := deploy.NewReferenceProviders(githubReferences)
+
+	responses := NewResponseBuilder(githubClient)
+	responses.SetReferenceProviders(providers)
+
 	return &Bot{
-		slackToken:    slackToken,
-		deploys:       deploy.NewChannelDeploys(store),
-		responses:     NewResponseBuilder(github.NewClient(githubToken, nil)),
-		dashboardAuth: auth.None,
+		slackToken:       slackToken,
+		deploys:          deploy.NewChannelDeploys(store),
+		responses:        responses,
+		providers:        providers,
+		github:           githubReferences,
+		pullRequestGate:  NewPullRequestGate(githubClient),
+		dashboardAuth:    auth.None,
+		permissions:      NewPermissions(NewRecordRoleStore(deploy.NewInMemoryStore())),
+		auditLog:         audit.StdLogger{},
+		settings:         NewRecordSettingsStore(deploy.NewInMemoryStore()),
+		pending:          deploy.NewPendingDeploys(deploy.NewInMemoryStore()),
+		lookupTimeout:    DefaultPullRequestLookupTimeout,
+		changelogTimeout: DefaultChangelogTimeout,
+		gateTimeout:      DefaultGateTimeout,
+		membersTimeout:   DefaultMembershipCheckTimeout,
+		announcements:    make(map[string]string),
 	}
 }
 
@@ -42,6 +99,87 @@ func (b *Bot) AddDeployEventHandler(h DeployEventHandler) {
 	b.deployEventHandlers = append(b.deployEventHandlers, h)
 }
 
+// AddDeployGate adds a check to perform before starting a deploy. Gates are evaluated in the order they were added.
+func (b *Bot) AddDeployGate(g DeployGate) {
+	b.deployGates = append(b.deployGates, g)
+}
+
+// AddReferenceProvider makes bot recognize references of p in deploy subjects in addition to GitHub ones, i.e. Jira
+// issues or GitLab merge requests. A provider added with the same name before is replaced.
+func (b *Bot) AddReferenceProvider(p deploy.ReferenceProvider) {
+	b.providers.Register(p)
+}
+
+// SetGitHubClient replaces the client used to fetch pull request details, i.e. to authenticate as a GitHub App
+// or to talk to GitHub Enterprise Server. Links to client.WebURL are recognized as GitHub references.
+func (b *Bot) SetGitHubClient(c *github.Client) {
+	b.github.setClient(c)
+	b.pullRequestGate.client = c
+}
+
+// SetGateTimeout sets the time all deploy gates together may take to decide whether a deploy can be started.
+func (b *Bot) SetGateTimeout(d time.Duration) {
+	b.gateTimeout = d
+}
+
+// SetPullRequestGateTimeout sets the time to wait for pull request details in channels that require pull requests
+// to be ready to deploy, and the decision to make if GitHub has not responded in time.
+func (b *Bot) SetPullRequestGateTimeout(d time.Duration, decision GateDecision) {
+	b.pullRequestGate.Timeout, b.pullRequestGate.TimeoutDecision = d, decision
+}
+
+// SetMessagePoster makes bot post deploy announcements via Slack Web API instead of the response URL, so that
+// the announcement can be updated with the details of pull requests that were not fetched in time.
+func (b *Bot) SetMessagePoster(p MessagePoster) {
+	b.messages = p
+}
+
+// SetPullRequestDescriptionLength limits the number of characters of pull request description included into
+// deploy announcement. Non-positive n disables truncation.
+func (b *Bot) SetPullRequestDescriptionLength(n int) {
+	b.responses.MaxDescriptionLength = n
+}
+
+// SetPullRequestLookupTimeout sets the time to wait for pull request details before sending a deploy announcement.
+func (b *Bot) SetPullRequestLookupTimeout(d time.Duration) {
+	b.lookupTimeout = d
+}
+
+// SetChangelog enables /deploy changelog command that lists pull requests deployed in channel.
+func (b *Bot) SetChangelog(history deploy.Repository, builder *changelog.Builder) {
+	b.history, b.changelog = history, builder
+}
+
+// SetChangelogTimeout sets the time to wait for pull request details when building changelogs and release notes.
+// Pull requests that have not been fetched in time are listed without details.
+func (b *Bot) SetChangelogTimeout(d time.Duration) {
+	b.changelogTimeout = d
+}
+
+// SetReleaseNotes makes bot reply to deploy announcement with the list of deployed pull requests once the deploy
+// is done. Release notes are only posted if the changelog is enabled with SetChangelog and a message poster
+// is set with SetMessagePoster.
+func (b *Bot) SetReleaseNotes(opts changelog.Options) {
+	b.releaseNotes = &opts
+}
+
+// SetReferenceIndex enables /deploy where command that looks up deploys of a pull request, commit, tag or an issue.
+func (b *Bot) SetReferenceIndex(index deploy.ReferenceIndex) {
+	b.references = index
+}
+
+// SetChannelMembers makes /deploy where list deploys from other channels the user is a member of. Otherwise only
+// the deploys from the channel the command was issued in are listed.
+func (b *Bot) SetChannelMembers(members auth.ChannelMembershipChecker) {
+	b.members = members
+}
+
+// SetMembershipCheckTimeout sets the time to wait for channel membership checks in /deploy where. Deploys from
+// channels that have not been checked in time are not listed.
+func (b *Bot) SetMembershipCheckTimeout(d time.Duration) {
+	b.membersTimeout = d
+}
+
 func (b *Bot) SetDashboardAuth(issuer auth.TokenIssuer) {
 	if issuer == nil {
 		b.dashboardAuth = auth.None
@@ -50,12 +188,115 @@ func (b *Bot) SetDashboardAuth(issuer auth.TokenIssuer) {
 	b.dashboardAuth = issuer
 }
 
+// SetHistoryPruner enables /deploy history purge command.
+func (b *Bot) SetHistoryPruner(pruner *deploy.HistoryPruner) {
+	b.historyPruner = pruner
+}
+
+// SetAdmins replaces the list of Slack user IDs allowed to run administrative commands.
+func (b *Bot) SetAdmins(userIDs ...string) {
+	b.admins = make(map[string]struct{}, len(userIDs))
+	for _, id := range userIDs {
+		b.admins[id] = struct{}{}
+	}
+}
+
+func (b *Bot) isAdmin(user slack.User) bool {
+	_, ok := b.admins[user.ID]
+	return ok
+}
+
+// SetPermissions replaces the rules that decide which deploy commands users are allowed to run in channel.
+// Deploy bot admins are allowed to run any command.
+func (b *Bot) SetPermissions(p *Permissions) {
+	b.permissions = p
+}
+
+// SetAuditLog replaces the log that keeps track of executed commands.
+func (b *Bot) SetAuditLog(l audit.Log) {
+	b.auditLog = l
+}
+
+// SetChannelSettings replaces the store that keeps channel settings changed with /deploy config.
+func (b *Bot) SetChannelSettings(s SettingsStore) {
+	b.settings = s
+}
+
+// SetPendingDeploys replaces the queue of deploys waiting for approval in channels that require it.
+func (b *Bot) SetPendingDeploys(p *deploy.PendingDeploys) {
+	b.pending = p
+}
+
+func (b *Bot) audit(e audit.Entry) {
+	if err := b.auditLog.Append(e); err != nil {
+		log.Printf("failed to write audit entry: %s", err)
+	}
+}
+
+// authorize checks whether the user who has sent the command is allowed to perform an action in channel and
+// responds with an ephemeral message otherwise.
+func (b *Bot) authorize(w http.ResponseWriter, entry *audit.Entry, action Action) bool {
+	if response := b.checkPermission(entry, action); response != nil {
+		sendImmediateResponse(w, response)
+		return false
+	}
+
+	return true
+}
+
+// checkPermission returns a message to respond with if the user is not allowed to perform an action in channel
+// and nil otherwise.
+func (b *Bot) checkPermission(entry *audit.Entry, action Action) *slack.Response {
+	if b.isAdmin(entry.User) {
+		return nil
+	}
+
+	allowed, err := b.permissions.Allowed(entry.ChannelID, entry.User.ID, action)
+	if err != nil {
+		log.Printf("failed to check whether %s is allowed to %s in %s: %s", entry.User.Name, action, entry.ChannelID, err)
+		entry.Outcome, entry.Details = audit.Failed, "failed to check permissions"
+
+		return b.responses.ErrorMessage(entry.Text, errors.New("failed to check permissions"))
+	}
+
+	if !allowed {
+		requiredRole := b.permissions.RequiredRole(action)
+		entry.Outcome, entry.Details = audit.Denied, fmt.Sprintf("%s role is required to %s", requiredRole, action)
+
+		return b.responses.PermissionDeniedMessage(action, requiredRole)
+	}
+
+	return nil
+}
+
+// permitOthersDeploy returns a deploy.PermitFunc that lets the user finish their own deploy and checks whether
+// they are allowed to perform action on a deploy started by someone else. If the permission is denied, the message
+// to respond with is stored in denied.
+func (b *Bot) permitOthersDeploy(entry *audit.Entry, action Action, denied **slack.Response) deploy.PermitFunc {
+	return func(current deploy.Deploy) bool {
+		// the update might be retried, so the decision made during the previous attempt is discarded
+		*denied, entry.Outcome, entry.Details = nil, audit.Succeeded, ""
+		if current.User.ID == entry.User.ID {
+			return true
+		}
+
+		*denied = b.checkPermission(entry, action)
+
+		return *denied == nil
+	}
+}
+
 func (b *Bot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Only POST requests are supported", http.StatusBadRequest)
 		return
 	}
 
+	if payload := r.PostFormValue("payload"); payload != "" {
+		b.serveInteraction(w, payload)
+		return
+	}
+
 	if r.PostFormValue("token") != b.slackToken {
 		http.Error(w, "Invalid token", http.StatusForbidden)
 		return
@@ -75,6 +316,16 @@ func (b *Bot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// TODO: make commands case-insensitive
 	subject := strings.TrimSpace(r.PostFormValue("text"))
 
+	entry := audit.Entry{
+		Time:      time.Now().UTC(),
+		Source:    audit.SourceSlack,
+		ChannelID: channelID,
+		User:      user,
+		Text:      subject,
+		Outcome:   audit.Succeeded,
+	}
+	defer func() { b.audit(entry) }()
+
 	switch {
 	case subject == "help" || subject == "":
 		sendImmediateResponse(w, b.responses.HelpMessage())
@@ -87,18 +338,30 @@ func (b *Bot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		sendImmediateResponse(w, b.responses.DeployStatusMessage(d))
 	case subject == "done":
-		d, ok := b.deploys.Finish(channelID)
+		var denied *slack.Response
+
+		d, ok := b.deploys.Finish(channelID, user, b.permitOthersDeploy(&entry, ActionFinishOthers, &denied))
+		if denied != nil {
+			sendImmediateResponse(w, denied)
+			return
+		}
+
 		if !ok {
+			entry.Outcome, entry.Details = audit.Failed, "no running deploy"
 			sendImmediateResponse(w, b.responses.NoRunningDeploysMessage())
 			return
 		}
 
+		entry.Details = fmt.Sprintf("finished deploy of %s started by %s", d.Subject, d.User.Name)
+
 		if d.User.ID == user.ID {
 			go sendDelayedResponse(w, r, b.responses.DeployDoneAnnouncement(user))
 		} else {
 			go sendDelayedResponse(w, r, b.responses.DeployInterruptedAnnouncement(d, user))
 		}
 
+		go b.postReleaseNotes(channelID, d)
+
 		for _, h := range b.deployEventHandlers {
 			go h.DeployCompleted(channelID, d)
 		}
@@ -108,41 +371,830 @@ func (b *Bot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			reason = subject[len("abort "):]
 		}
 
-		d, ok := b.deploys.Abort(channelID, reason)
+		var denied *slack.Response
+
+		d, ok := b.deploys.Abort(channelID, reason, user, b.permitOthersDeploy(&entry, ActionAbortOthers, &denied))
+		if denied != nil {
+			sendImmediateResponse(w, denied)
+			return
+		}
+
 		if !ok {
+			entry.Outcome, entry.Details = audit.Failed, "no running deploy"
 			sendImmediateResponse(w, b.responses.NoRunningDeploysMessage())
 			return
 		}
 
+		entry.Details = fmt.Sprintf("aborted deploy of %s started by %s", d.Subject, d.User.Name)
+
 		go sendDelayedResponse(w, r, b.responses.DeployAbortedAnnouncement(reason, user))
+		b.takeAnnouncement(channelID, d)
 
 		for _, h := range b.deployEventHandlers {
 			go h.DeployAborted(channelID, d)
 		}
+	case subject == "history purge" || strings.HasPrefix(subject, "history purge "):
+		if !b.isAdmin(user) {
+			entry.Outcome, entry.Details = audit.Denied, "not a deploy bot admin"
+			sendImmediateResponse(w, b.responses.AdminOnlyMessage("history purge"))
+			return
+		}
+
+		if b.historyPruner == nil {
+			entry.Outcome, entry.Details = audit.Failed, "not supported"
+			sendImmediateResponse(w, b.responses.ErrorMessage("history purge", errors.New("not supported")))
+			return
+		}
+
+		before, err := parsePurgeArgs(strings.TrimPrefix(subject, "history purge"))
+		if err != nil {
+			entry.Outcome, entry.Details = audit.Failed, err.Error()
+			sendImmediateResponse(w, b.responses.ErrorMessage("history purge", err))
+			return
+		}
+
+		n := b.historyPruner.Purge(channelID, before)
+		log.Printf("%s has purged %d deploys started before %s in %s", user.Name, n, before.Format(time.RFC3339), channelID)
+
+		entry.Details = fmt.Sprintf("removed %d deploys", n)
+
+		sendImmediateResponse(w, b.responses.HistoryPurgedMessage(n, before))
+	case subject == "role" || strings.HasPrefix(subject, "role "):
+		cmd, userID, role, err := parseRoleArgs(strings.TrimPrefix(subject, "role"))
+		if err != nil {
+			entry.Outcome, entry.Details = audit.Failed, err.Error()
+			sendImmediateResponse(w, b.responses.ErrorMessage("role", err))
+			return
+		}
+
+		if !b.authorize(w, &entry, ActionManageRoles) {
+			return
+		}
+
+		if cmd == "grant" {
+			err = b.permissions.Grant(channelID, userID, role)
+		} else {
+			err = b.permissions.Revoke(channelID, userID)
+			role = b.permissions.DefaultRole
+		}
+
+		if err != nil {
+			log.Print(err)
+			entry.Outcome, entry.Details = audit.Failed, "failed to update role"
+			sendImmediateResponse(w, b.responses.ErrorMessage("role "+cmd, errors.New("failed to update role")))
+			return
+		}
+
+		log.Printf("%s has set the role of %s in %s to %s", user.Name, userID, channelID, role)
+
+		entry.Details = fmt.Sprintf("set the role of %s to %s", userID, role)
+
+		sendImmediateResponse(w, b.responses.RoleChangedMessage(userID, role))
+	case subject == "config" || strings.HasPrefix(subject, "config "):
+		settings, err := b.settings.Settings(channelID)
+		if err != nil {
+			log.Print(err)
+			entry.Outcome, entry.Details = audit.Failed, "failed to get channel settings"
+			sendImmediateResponse(w, b.responses.ErrorMessage("config", errors.New("failed to get channel settings")))
+			return
+		}
+
+		args := strings.TrimSpace(strings.TrimPrefix(subject, "config"))
+		if args == "" {
+			sendImmediateResponse(w, b.responses.ChannelSettingsMessage(settings))
+			return
+		}
+
+		if !b.authorize(w, &entry, ActionConfigure) {
+			return
+		}
+
+		var argsErr error
+		err = b.settings.UpdateSettings(channelID, func(s *ChannelSettings) error {
+			if argsErr = applyConfigArgs(s, args); argsErr != nil {
+				return argsErr
+			}
+
+			settings = *s
+
+			return nil
+		})
+		if argsErr != nil {
+			entry.Outcome, entry.Details = audit.Failed, argsErr.Error()
+			sendImmediateResponse(w, b.responses.ErrorMessage("config", argsErr))
+			return
+		}
+
+		if err != nil {
+			log.Print(err)
+			entry.Outcome, entry.Details = audit.Failed, "failed to update channel settings"
+			sendImmediateResponse(w, b.responses.ErrorMessage("config", errors.New("failed to update channel settings")))
+			return
+		}
+
+		log.Printf("%s has changed settings of %s: %s", user.Name, channelID, args)
+
+		entry.Details = "changed channel settings"
+
+		sendImmediateResponse(w, b.responses.ChannelSettingsMessage(settings))
+	case subject == "lock" || strings.HasPrefix(subject, "lock "):
+		if !b.authorize(w, &entry, ActionLock) {
+			return
+		}
+
+		lock := ChannelLock{
+			User:     user,
+			Reason:   strings.TrimSpace(strings.TrimPrefix(subject, "lock")),
+			LockedAt: time.Now().UTC(),
+		}
+
+		if err := b.settings.UpdateSettings(channelID, func(settings *ChannelSettings) error {
+			settings.Lock = &lock
+			return nil
+		}); err != nil {
+			log.Print(err)
+			entry.Outcome, entry.Details = audit.Failed, "failed to update channel settings"
+			sendImmediateResponse(w, b.responses.ErrorMessage("lock", errors.New("failed to update channel settings")))
+			return
+		}
+
+		log.Printf("%s has locked deploys in %s", user.Name, channelID)
+
+		entry.Details = "locked deploys"
+
+		sendImmediateResponse(w, b.responses.ChannelLockedAnnouncement(lock))
+	case subject == "unlock":
+		if !b.authorize(w, &entry, ActionLock) {
+			return
+		}
+
+		var wasLocked bool
+		if err := b.settings.UpdateSettings(channelID, func(settings *ChannelSettings) error {
+			wasLocked, settings.Lock = settings.Lock != nil, nil
+			return nil
+		}); err != nil {
+			log.Print(err)
+			entry.Outcome, entry.Details = audit.Failed, "failed to update channel settings"
+			sendImmediateResponse(w, b.responses.ErrorMessage("unlock", errors.New("failed to update channel settings")))
+			return
+		}
+
+		if !wasLocked {
+			entry.Outcome, entry.Details = audit.Failed, "not locked"
+			sendImmediateResponse(w, b.responses.ChannelNotLockedMessage())
+			return
+		}
+
+		log.Printf("%s has unlocked deploys in %s", user.Name, channelID)
+
+		entry.Details = "unlocked deploys"
+
+		sendImmediateResponse(w, b.responses.ChannelUnlockedAnnouncement(user))
+	case subject == "approve":
+		d, response := b.approve(&entry, "")
+		if response != nil {
+			sendImmediateResponse(w, response)
+			return
+		}
+
+		w.Write(nil)
+
+		go b.announceDeploy(r.PostFormValue("response_url"), channelID, d, nil)
+		for _, h := range b.deployEventHandlers {
+			go h.DeployStarted(channelID, d)
+		}
+	case subject == "changelog" || strings.HasPrefix(subject, "changelog "):
+		if !b.authorize(w, &entry, ActionViewHistory) {
+			return
+		}
+
+		if b.changelog == nil {
+			entry.Outcome, entry.Details = audit.Failed, "not supported"
+			sendImmediateResponse(w, b.responses.ErrorMessage("changelog", errors.New("not supported")))
+			return
+		}
+
+		since, opts, err := parseChangelogArgs(strings.TrimPrefix(subject, "changelog"), time.Now())
+		if err != nil {
+			entry.Outcome, entry.Details = audit.Failed, err.Error()
+			sendImmediateResponse(w, b.responses.ErrorMessage("changelog", err))
+			return
+		}
+
+		w.Write(nil)
+
+		go b.sendChangelog(r.PostFormValue("response_url"), channelID, since, opts)
+	case subject == "where" || strings.HasPrefix(subject, "where "):
+		if !b.authorize(w, &entry, ActionViewHistory) {
+			return
+		}
+
+		if b.references == nil {
+			entry.Outcome, entry.Details = audit.Failed, "not supported"
+			sendImmediateResponse(w, b.responses.ErrorMessage("where", errors.New("not supported")))
+			return
+		}
+
+		ref := strings.TrimSpace(strings.TrimPrefix(subject, "where"))
+
+		key, ok := b.providers.ReferenceKey(ref)
+		if !ok {
+			entry.Outcome, entry.Details = audit.Failed, "malformed reference"
+			sendImmediateResponse(w, b.responses.ErrorMessage("where", errors.New("usage: /deploy where <owner/repo#number|owner/repo@sha|owner/repo@tag|issue>")))
+			return
+		}
+
+		w.Write(nil)
+
+		go b.sendReferencedDeploys(r.PostFormValue("response_url"), channelID, user, ref, key)
 	case subject == "history":
-		dashboardToken, err := b.dashboardAuth.IssueToken(auth.DefaultTokenLength)
+		if !b.authorize(w, &entry, ActionViewHistory) {
+			return
+		}
+
+		dashboardToken, err := b.dashboardAuth.IssueToken(channelID, auth.DefaultTokenLength)
 		if err != nil {
+			entry.Outcome, entry.Details = audit.Failed, err.Error()
 			sendImmediateResponse(w, b.responses.ErrorMessage("history", err))
 			return
 		}
 
 		sendImmediateResponse(w, b.responses.DeployHistoryLink(r.Host, channelID, dashboardToken))
 	default:
-		d, ok := b.deploys.Start(channelID, deploy.New(user, slack.EscapeMessage(subject)))
+		if !b.authorize(w, &entry, ActionStart) {
+			return
+		}
+
+		settings, err := b.settings.Settings(channelID)
+		if err != nil {
+			log.Print(err)
+			entry.Outcome, entry.Details = audit.Failed, "failed to get channel settings"
+			sendImmediateResponse(w, b.responses.ErrorMessage(subject, errors.New("failed to get channel settings")))
+			return
+		}
+
+		if settings.Lock != nil {
+			entry.Outcome, entry.Details = audit.Denied, "deploys are locked by "+settings.Lock.User.Name
+			sendImmediateResponse(w, b.responses.DeployLockedMessage(*settings.Lock))
+			return
+		}
+
+		subject, force, replace := parseStartFlags(subject)
+		d := b.providers.New(user, slack.EscapeMessage(subject))
+
+		gates := b.deployGates
+		if settings.RequireReadyPullRequests {
+			gates = append(gates[:len(gates):len(gates)], b.pullRequestGate)
+		}
+
+		gateResults, denied := b.checkGates(gates, channelID, d)
+		if denied != nil {
+			if !force {
+				entry.Outcome, entry.Details = audit.Denied, denied.Message
+				sendImmediateResponse(w, b.responses.GateDeniedMessage(*denied))
+				return
+			}
+
+			if !b.authorize(w, &entry, ActionForce) {
+				return
+			}
+
+			log.Printf("%s has forced the deploy of %s in %s past deploy gates: %s", user.Name, d.Subject, channelID, denied.Message)
+			entry.Details = "forced past deploy gates: " + denied.Message
+		}
+
+		if settings.RequireApproval {
+			b.requestApproval(w, r, &entry, d, gateResults)
+			return
+		}
+
+		start := b.deploys.Start
+		if replace {
+			start = b.deploys.Replace
+		}
+
+		d, ok := start(channelID, d)
 		if !ok {
-			sendImmediateResponse(w, b.responses.DeployInProgressMessage(d))
+			entry.Outcome = audit.Failed
+			if d.User.ID != "" {
+				entry.Details = fmt.Sprintf("%s is deploying since %s", d.User.Name, d.StartedAt.Format(time.RFC3339))
+			}
+
+			sendImmediateResponse(w, b.deployInProgressMessage(d, user))
 			return
 		}
 
 		w.Write(nil)
 
-		go sendDelayedResponse(w, r, b.responses.DeployAnnouncement(d))
+		go b.announceDeploy(r.PostFormValue("response_url"), channelID, d, gateResults)
 		for _, h := range b.deployEventHandlers {
 			go h.DeployStarted(channelID, d)
 		}
 	}
 }
 
+// checkGates evaluates deploy gates in order and returns the results of those that did not allow the deploy along
+// with the first denial if there was any. All gates share the same deadline, so that the slash command is answered
+// in time.
+func (b *Bot) checkGates(gates []DeployGate, channelID string, d deploy.Deploy) (results []GateResult, denied *GateResult) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.gateTimeout)
+	defer cancel()
+
+	for _, g := range gates {
+		res := g.Check(ctx, channelID, d)
+		if res.Decision == GateAllow {
+			continue
+		}
+
+		results = append(results, res)
+		if res.Decision == GateDeny && denied == nil {
+			denied = &res
+		}
+	}
+
+	return results, denied
+}
+
+// serveInteraction handles clicks on buttons attached to the messages sent by bot.
+func (b *Bot) serveInteraction(w http.ResponseWriter, payload string) {
+	p, err := slack.ParseInteractionPayload(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if p.Token != b.slackToken {
+		http.Error(w, "Invalid token", http.StatusForbidden)
+		return
+	}
+
+	if p.CallbackID != approvalCallbackID || len(p.Actions) == 0 || p.Actions[0].Name != approveActionName {
+		sendInteractionResponse(w, b.responses.ErrorMessage(p.CallbackID, errors.New("not supported")), false)
+		return
+	}
+
+	entry := audit.Entry{
+		Time:      time.Now().UTC(),
+		Source:    audit.SourceSlack,
+		ChannelID: p.Channel.ID,
+		User:      p.User,
+		Text:      "approve",
+		Outcome:   audit.Succeeded,
+	}
+	defer func() { b.audit(entry) }()
+
+	d, response := b.approve(&entry, p.Actions[0].Value)
+	if response != nil {
+		sendInteractionResponse(w, response, false)
+		return
+	}
+
+	w.Write(nil)
+
+	go b.replaceWithAnnouncement(p.ResponseURL, d)
+	for _, h := range b.deployEventHandlers {
+		go h.DeployStarted(p.Channel.ID, d)
+	}
+}
+
+// sendReferencedDeploys sends the list of deploys that included the reference with given key to the response URL.
+// Deploys from other channels are only listed if the user has access to them.
+func (b *Bot) sendReferencedDeploys(responseURL, channelID string, user slack.User, ref, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.membersTimeout)
+	defer cancel()
+
+	postResponse(responseURL, b.responses.ReferencedDeploysMessage(ref, b.accessibleDeploys(ctx, channelID, user, b.references.DeploysOf(key))))
+}
+
+// accessibleDeploys filters out deploys made in channels other than channelID unless user is a member of them
+// and is allowed to view their history. Channels are checked concurrently, the ones that have not been checked
+// before ctx is done are filtered out as well.
+func (b *Bot) accessibleDeploys(ctx context.Context, channelID string, user slack.User, deploys []deploy.IndexedDeploy) []deploy.IndexedDeploy {
+	allowed := map[string]bool{channelID: true}
+
+	var channels []interface{}
+	for _, d := range deploys {
+		if _, ok := allowed[d.ChannelID]; !ok {
+			allowed[d.ChannelID] = false
+			channels = append(channels, d.ChannelID)
+		}
+	}
+
+	lookups := startLookups(channels, DefaultMaxParallelLookups, func(id interface{}) (interface{}, error) {
+		return b.canViewHistory(id.(string), user), nil
+	})
+
+	for _, l := range lookups {
+		v, ok, _ := l.Wait(ctx)
+		if !ok {
+			log.Printf("failed to check whether %s has access to %s in time", user.Name, l.Key)
+			continue
+		}
+
+		allowed[l.Key.(string)] = v.(bool)
+	}
+
+	var filtered []deploy.IndexedDeploy
+	for _, d := range deploys {
+		if allowed[d.ChannelID] {
+			filtered = append(filtered, d)
+		}
+	}
+
+	return filtered
+}
+
+// canViewHistory returns true if user is a member of channel and is allowed to view its history.
+func (b *Bot) canViewHistory(channelID string, user slack.User) bool {
+	if b.members == nil {
+		return false
+	}
+
+	member, err := b.members.IsMember(channelID, user.ID)
+	if err != nil {
+		log.Printf("failed to check whether %s is a member of %s: %s", user.Name, channelID, err)
+		return false
+	}
+
+	if !member {
+		return false
+	}
+
+	if b.isAdmin(user) {
+		return true
+	}
+
+	allowed, err := b.permissions.Allowed(channelID, user.ID, ActionViewHistory)
+	if err != nil {
+		log.Printf("failed to check whether %s is allowed to %s in %s: %s", user.Name, ActionViewHistory, channelID, err)
+		return false
+	}
+
+	return allowed
+}
+
+// announceDeploy posts deploy announcement to the channel. If a message poster is set, the announcement is sent via
+// Slack Web API and updated once the details of pull requests that were not fetched in time arrive. Otherwise, or if
+// the Web API call fails, it is sent to the response URL with bare links to such pull requests.
+func (b *Bot) announceDeploy(responseURL, channelID string, d deploy.Deploy, gateResults []GateResult) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.lookupTimeout)
+	defer cancel()
+
+	announcement, updates := b.responses.DeployAnnouncement(ctx, d)
+	announcement = b.responses.AddGateResults(announcement, gateResults)
+
+	if b.messages == nil {
+		postResponse(responseURL, announcement)
+		return
+	}
+
+	ts, err := b.messages.PostChannelMessage(channelID, announcement.Message)
+	if err != nil {
+		log.Printf("failed to post deploy announcement to %s via Web API, sending it to the response URL instead: %s", channelID, err)
+		postResponse(responseURL, announcement)
+		return
+	}
+
+	b.mu.Lock()
+	b.announcements[announcementKey(channelID, d)] = ts
+	b.mu.Unlock()
+
+	if update, ok := <-updates; ok {
+		update = b.responses.AddGateResults(update, gateResults)
+		if err := b.messages.UpdateMessage(channelID, ts, update.Message); err != nil {
+			log.Printf("failed to update deploy announcement in %s: %s", channelID, err)
+		}
+	}
+}
+
+// takeAnnouncement returns the timestamp of deploy announcement posted via Slack Web API and forgets it.
+func (b *Bot) takeAnnouncement(channelID string, d deploy.Deploy) string {
+	k := announcementKey(channelID, d)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ts := b.announcements[k]
+	delete(b.announcements, k)
+
+	return ts
+}
+
+// announcementKey identifies a deploy in channel.
+func announcementKey(channelID string, d deploy.Deploy) string {
+	return channelID + "/" + d.Key()
+}
+
+// sendChangelog sends the changelog of deploys made in channel since given time to the response URL. Pull requests
+// that have not been fetched within the changelog timeout are listed without details.
+func (b *Bot) sendChangelog(responseURL, channelID string, since time.Time, opts changelog.Options) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.changelogTimeout)
+	defer cancel()
+
+	postResponse(responseURL, b.responses.ChangelogMessage(since, b.changelog.Build(ctx, b.history.Since(channelID, since), opts)))
+}
+
+// postReleaseNotes replies to deploy announcement with the list of deployed pull requests. If the announcement
+// was not posted via Slack Web API, release notes are posted to the channel.
+func (b *Bot) postReleaseNotes(channelID string, d deploy.Deploy) {
+	threadTS := b.takeAnnouncement(channelID, d)
+	if b.releaseNotes == nil || b.changelog == nil || b.messages == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.changelogTimeout)
+	defer cancel()
+
+	cl := b.changelog.Build(ctx, []deploy.Deploy{d}, *b.releaseNotes)
+	if len(cl.Deploys) == 0 {
+		return
+	}
+
+	message := b.responses.ReleaseNotesMessage(cl).Message
+	message.ThreadTS = threadTS
+
+	if _, err := b.messages.PostChannelMessage(channelID, message); err != nil {
+		log.Printf("failed to post release notes to %s: %s", channelID, err)
+	}
+}
+
+// replaceWithAnnouncement replaces the approval request with deploy announcement, and then replaces it once more
+// if there were pull requests that were not fetched in time.
+func (b *Bot) replaceWithAnnouncement(responseURL string, d deploy.Deploy) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.lookupTimeout)
+	defer cancel()
+
+	announcement, updates := b.responses.DeployAnnouncement(ctx, d)
+	postResponse(responseURL, interactionResponse{Response: announcement, ReplaceOriginal: true})
+
+	if update, ok := <-updates; ok {
+		postResponse(responseURL, interactionResponse{Response: update, ReplaceOriginal: true})
+	}
+}
+
+// deployInProgressMessage returns a message to respond to user with if their deploy has not been started because
+// of the deploy d running in channel.
+func (b *Bot) deployInProgressMessage(d deploy.Deploy, user slack.User) *slack.Response {
+	if d.User.ID == user.ID {
+		return b.responses.OwnDeployInProgressMessage(d)
+	}
+
+	return b.responses.DeployInProgressMessage(d)
+}
+
+// requestApproval puts the deploy into the approval queue of the channel and asks channel members to approve it.
+func (b *Bot) requestApproval(w http.ResponseWriter, r *http.Request, entry *audit.Entry, d deploy.Deploy, gateResults []GateResult) {
+	if current, ok := b.deploys.Current(entry.ChannelID); ok {
+		entry.Outcome, entry.Details = audit.Failed, fmt.Sprintf("%s is deploying since %s", current.User.Name, current.StartedAt.Format(time.RFC3339))
+		sendImmediateResponse(w, b.deployInProgressMessage(current, entry.User))
+		return
+	}
+
+	pending, ok, err := b.pending.Request(entry.ChannelID, d)
+	if err != nil {
+		log.Print(err)
+		entry.Outcome, entry.Details = audit.Failed, "failed to request approval"
+		sendImmediateResponse(w, b.responses.ErrorMessage(entry.Text, errors.New("failed to request approval")))
+		return
+	}
+
+	if !ok {
+		entry.Outcome, entry.Details = audit.Failed, fmt.Sprintf("%s is waiting for approval", pending.Deploy.User.Name)
+		sendImmediateResponse(w, b.responses.ApprovalPendingMessage(pending))
+		return
+	}
+
+	if entry.Details != "" {
+		entry.Details += ", "
+	}
+	entry.Details += "requested approval"
+
+	w.Write(nil)
+
+	go sendDelayedResponse(w, r, b.responses.AddGateResults(b.responses.ApprovalRequest(pending), gateResults))
+}
+
+// approve starts the deploy waiting for approval in channel. If id is not empty, the pending deploy is only
+// approved if it has the same ID. Otherwise approve returns a message to respond to the user with.
+func (b *Bot) approve(entry *audit.Entry, id string) (deploy.Deploy, *slack.Response) {
+	pending, ok, err := b.pending.Get(entry.ChannelID)
+	if err != nil {
+		log.Print(err)
+		entry.Outcome, entry.Details = audit.Failed, "failed to get pending deploy"
+		return deploy.Deploy{}, b.responses.ErrorMessage("approve", errors.New("failed to get pending deploy"))
+	}
+
+	if !ok || (id != "" && pending.ID != id) {
+		entry.Outcome, entry.Details = audit.Failed, "no pending deploy"
+		return deploy.Deploy{}, b.responses.NoPendingDeploysMessage()
+	}
+
+	if pending.Deploy.User.ID == entry.User.ID {
+		entry.Outcome, entry.Details = audit.Denied, "cannot approve own deploy"
+		return deploy.Deploy{}, b.responses.SelfApprovalMessage()
+	}
+
+	if response := b.checkPermission(entry, ActionApprove); response != nil {
+		return deploy.Deploy{}, response
+	}
+
+	settings, err := b.settings.Settings(entry.ChannelID)
+	if err != nil {
+		log.Print(err)
+		entry.Outcome, entry.Details = audit.Failed, "failed to get channel settings"
+		return deploy.Deploy{}, b.responses.ErrorMessage("approve", errors.New("failed to get channel settings"))
+	}
+
+	if settings.Lock != nil {
+		entry.Outcome, entry.Details = audit.Denied, "deploys are locked by "+settings.Lock.User.Name
+		return deploy.Deploy{}, b.responses.DeployLockedMessage(*settings.Lock)
+	}
+
+	if current, ok := b.deploys.Current(entry.ChannelID); ok {
+		entry.Outcome, entry.Details = audit.Failed, fmt.Sprintf("%s is deploying since %s", current.User.Name, current.StartedAt.Format(time.RFC3339))
+		return deploy.Deploy{}, b.responses.DeployInProgressMessage(current)
+	}
+
+	pending, ok, err = b.pending.Take(entry.ChannelID, pending.ID)
+	if err != nil {
+		log.Print(err)
+		entry.Outcome, entry.Details = audit.Failed, "failed to get pending deploy"
+		return deploy.Deploy{}, b.responses.ErrorMessage("approve", errors.New("failed to get pending deploy"))
+	}
+
+	if !ok {
+		// someone else has approved this deploy in the meantime or it has just expired
+		entry.Outcome, entry.Details = audit.Failed, "no pending deploy"
+		return deploy.Deploy{}, b.responses.NoPendingDeploysMessage()
+	}
+
+	d := pending.Deploy
+	d.ApprovedBy, d.ApprovedAt = entry.User, time.Now().UTC()
+
+	d, ok = b.deploys.Start(entry.ChannelID, d)
+	if !ok {
+		entry.Outcome, entry.Details = audit.Failed, fmt.Sprintf("%s is deploying since %s", d.User.Name, d.StartedAt.Format(time.RFC3339))
+		return deploy.Deploy{}, b.responses.DeployInProgressMessage(d)
+	}
+
+	entry.Details = fmt.Sprintf("approved deploy of %s requested by %s", d.Subject, d.User.Name)
+
+	return d, nil
+}
+
+// parseStartFlags strips the --force and --replace flags from /deploy [--force] [--replace] <subject>.
+func parseStartFlags(subject string) (string, bool, bool) {
+	var force, replace bool
+	for {
+		switch {
+		case strings.HasPrefix(subject, "--force "):
+			subject, force = strings.TrimSpace(strings.TrimPrefix(subject, "--force ")), true
+		case strings.HasPrefix(subject, "--replace "):
+			subject, replace = strings.TrimSpace(strings.TrimPrefix(subject, "--replace ")), true
+		default:
+			return subject, force, replace
+		}
+	}
+}
+
+// parsePurgeArgs parses --before <date> argument of /deploy history purge. The date is expected to be either
+// in YYYY-MM-DD or RFC3339 format.
+func parsePurgeArgs(args string) (time.Time, error) {
+	fields := strings.Fields(args)
+	if len(fields) != 2 || fields[0] != "--before" {
+		return time.Time{}, errors.New("usage: /deploy history purge --before <YYYY-MM-DD>")
+	}
+
+	if t, err := time.Parse("2006-01-02", fields[1]); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, fields[1])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed date %q, expected YYYY-MM-DD", fields[1])
+	}
+
+	return t, nil
+}
+
+// parseChangelogArgs parses arguments of /deploy changelog [<YYYY-MM-DD>] [--labels] [--authors]. If the date
+// is omitted, the changelog covers the last week.
+func parseChangelogArgs(args string, now time.Time) (since time.Time, opts changelog.Options, err error) {
+	const usage = "usage: /deploy changelog [<YYYY-MM-DD>] [--labels] [--authors]"
+
+	since = now.Add(-DefaultChangelogPeriod)
+	sinceSet := false
+	for _, field := range strings.Fields(args) {
+		switch {
+		case field == "--labels":
+			opts.Labels = true
+		case field == "--authors":
+			opts.Authors = true
+		case !sinceSet && !strings.HasPrefix(field, "--"):
+			if since, err = time.Parse("2006-01-02", field); err != nil {
+				return since, opts, fmt.Errorf("malformed date %q, expected YYYY-MM-DD", field)
+			}
+			sinceSet = true
+		default:
+			return since, opts, errors.New(usage)
+		}
+	}
+
+	return since, opts, nil
+}
+
+var userMentionRegex = regexp.MustCompile(`^<@([A-Z0-9]+)(?:\|[^>]*)?>$`)
+
+// parseRoleArgs parses arguments of /deploy role grant <@user> <role> and /deploy role revoke <@user>. The user
+// is expected to be an escaped mention containing user ID.
+func parseRoleArgs(args string) (cmd, userID string, role Role, err error) {
+	const usage = "usage: /deploy role grant @user deployer|maintainer|admin|none or /deploy role revoke @user"
+
+	fields := strings.Fields(args)
+	switch {
+	case len(fields) == 3 && fields[0] == "grant":
+		if role, err = ParseRole(fields[2]); err != nil {
+			return "", "", RoleNone, err
+		}
+	case len(fields) == 2 && fields[0] == "revoke":
+	default:
+		return "", "", RoleNone, errors.New(usage)
+	}
+
+	m := userMentionRegex.FindStringSubmatch(fields[1])
+	if m == nil {
+		return "", "", RoleNone, fmt.Errorf("%s is not a user mention, make sure that the slash command escapes users", fields[1])
+	}
+
+	return fields[0], m[1], role, nil
+}
+
+// applyConfigArgs updates channel settings according to arguments of /deploy config <setting> <value>.
+func applyConfigArgs(settings *ChannelSettings, args string) error {
+	const usage = "usage: /deploy config require-approval|require-ready-prs on|off"
+
+	fields := strings.Fields(args)
+	if len(fields) != 2 {
+		return errors.New(usage)
+	}
+
+	switch fields[0] {
+	case "require-approval":
+		v, err := parseSwitch(fields[1])
+		if err != nil {
+			return err
+		}
+
+		settings.RequireApproval = v
+	case "require-ready-prs":
+		v, err := parseSwitch(fields[1])
+		if err != nil {
+			return err
+		}
+
+		settings.RequireReadyPullRequests = v
+	default:
+		return fmt.Errorf("unknown setting %q, %s", fields[0], usage)
+	}
+
+	return nil
+}
+
+func parseSwitch(s string) (bool, error) {
+	switch s {
+	case "on", "yes", "true":
+		return true, nil
+	case "off", "no", "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("malformed value %q, expected on or off", s)
+	}
+}
+
+const (
+	approvalCallbackID = "deploy_approval"
+	approveActionName  = "approve"
+)
+
+// interactionResponse is a response to a click on a message button. Unless ReplaceOriginal is set, the response
+// is sent as a new message.
+type interactionResponse struct {
+	*slack.Response
+	ReplaceOriginal bool `json:"replace_original"`
+}
+
+func sendInteractionResponse(w http.ResponseWriter, response *slack.Response, replaceOriginal bool) {
+	body, err := json.Marshal(interactionResponse{Response: response, ReplaceOriginal: replaceOriginal})
+	if err != nil {
+		log.Printf("failed to respond to user with %q (%s)", response.Text, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
 func sendImmediateResponse(w http.ResponseWriter, response *slack.Response) {
 	body, err := json.Marshal(response)
 	if err != nil {
@@ -156,15 +1208,20 @@ func sendImmediateResponse(w http.ResponseWriter, response *slack.Response) {
 }
 
 func sendDelayedResponse(w http.ResponseWriter, req *http.Request, response *slack.Response) {
-	responseURL := req.PostFormValue("response_url")
+	postResponse(req.PostFormValue("response_url"), response)
+}
+
+// postResponse sends a message to Slack response URL, v is expected to be either *slack.Response or
+// interactionResponse.
+func postResponse(responseURL string, v interface{}) {
 	if responseURL == "" {
 		log.Printf("cannot send delayed response to a without without response_url")
 		return
 	}
 
-	body, err := json.Marshal(response)
+	body, err := json.Marshal(v)
 	if err != nil {
-		log.Printf("failed to respond in channel with %s (%s)", response.Text, err)
+		log.Printf("failed to respond in channel (%s)", err)
 		return
 	}
 
@@ -0,0 +1,1044 @@
+package bot_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/audit"
+	"github.com/andrewslotin/michael/bot"
+	"github.com/andrewslotin/michael/changelog"
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/github"
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const slackToken = "slash-command-token"
+
+func TestBot_HistoryPurge(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+	for _, startedAt := range []time.Time{
+		time.Date(2016, 8, 1, 10, 0, 0, 0, time.UTC),
+		time.Date(2016, 8, 2, 10, 0, 0, 0, time.UTC),
+		time.Date(2016, 8, 3, 10, 0, 0, 0, time.UTC),
+	} {
+		store.Set("C1", deploy.Deploy{User: slack.User{ID: "U1", Name: "user1"}, StartedAt: startedAt, FinishedAt: startedAt.Add(time.Minute)})
+	}
+
+	b := bot.New(slackToken, "", store)
+	b.SetAdmins("U1")
+	b.SetHistoryPruner(deploy.NewHistoryPruner(store, deploy.RetentionPolicies{}))
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "history purge --before 2016-08-03")
+	assert.Equal(t, slack.ResponseTypeEphemeral, response.ResponseType)
+	assert.Contains(t, response.Text, "Removed 2 deploys")
+
+	assert.Len(t, store.All("C1"), 1)
+}
+
+func TestBot_HistoryPurge_NotAdmin(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+	store.Set("C1", deploy.Deploy{User: slack.User{ID: "U1", Name: "user1"}, StartedAt: time.Now().Add(-time.Hour)})
+	store.Set("C1", deploy.Deploy{User: slack.User{ID: "U1", Name: "user1"}, StartedAt: time.Now()})
+
+	b := bot.New(slackToken, "", store)
+	b.SetAdmins("U1")
+	b.SetHistoryPruner(deploy.NewHistoryPruner(store, deploy.RetentionPolicies{}))
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U2", Name: "user2"}, "history purge --before 2100-01-01")
+	assert.Equal(t, slack.ResponseTypeEphemeral, response.ResponseType)
+	assert.Contains(t, response.Text, "Only deploy bot admins")
+
+	assert.Len(t, store.All("C1"), 2)
+}
+
+func TestBot_HistoryPurge_MalformedDate(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+
+	b := bot.New(slackToken, "", store)
+	b.SetAdmins("U1")
+	b.SetHistoryPruner(deploy.NewHistoryPruner(store, deploy.RetentionPolicies{}))
+
+	for _, args := range [...]string{"", " --before", " --before yesterday", " --after 2016-08-03"} {
+		response := sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "history purge"+args)
+		assert.Equal(t, slack.ResponseTypeEphemeral, response.ResponseType)
+		assert.Contains(t, response.Text, "returned an error", "args: %q", args)
+	}
+}
+
+func TestBot_Done_OthersDeploy_NotPermitted(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+	store.Set("C1", deploy.Deploy{User: slack.User{ID: "U1", Name: "user1"}, StartedAt: time.Now()})
+
+	auditLog := new(auditLogMock)
+
+	b := bot.New(slackToken, "", store)
+	b.SetAuditLog(auditLog)
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U2", Name: "user2"}, "done")
+	assert.Equal(t, slack.ResponseTypeEphemeral, response.ResponseType)
+	assert.Contains(t, response.Text, "You need to be a channel maintainer to finish deploys started by others")
+
+	d, ok := store.Get("C1")
+	require.True(t, ok)
+	assert.False(t, d.Finished())
+
+	if assert.Len(t, auditLog.Entries, 1) {
+		entry := auditLog.Entries[0]
+		assert.Equal(t, "C1", entry.ChannelID)
+		assert.Equal(t, slack.User{ID: "U2", Name: "user2"}, entry.User)
+		assert.Equal(t, "done", entry.Text)
+		assert.Equal(t, audit.Denied, entry.Outcome)
+	}
+}
+
+func TestBot_Done_DeployReplacedConcurrently(t *testing.T) {
+	own := deploy.Deploy{User: slack.User{ID: "U1", Name: "user1"}, Subject: "own", StartedAt: time.Now().Add(-time.Minute)}
+	others := deploy.Deploy{User: slack.User{ID: "U2", Name: "user2"}, Subject: "others", StartedAt: time.Now()}
+
+	// the deploy of user1 is replaced by user2 right after it has been read for the first time
+	store := &sequentialStore{Deploys: []deploy.Deploy{own, others}}
+
+	b := bot.New(slackToken, "", store)
+
+	serveSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "done")
+
+	if assert.Len(t, store.Written, 1) {
+		assert.Equal(t, "own", store.Written[0].Subject)
+		assert.True(t, store.Written[0].Finished())
+	}
+}
+
+func TestBot_Done_OthersDeploy_Maintainer(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+	store.Set("C1", deploy.Deploy{User: slack.User{ID: "U1", Name: "user1"}, StartedAt: time.Now()})
+
+	permissions := bot.NewPermissions(bot.NewRecordRoleStore(deploy.NewInMemoryStore()))
+	require.NoError(t, permissions.Grant("C1", "U2", bot.RoleMaintainer))
+
+	auditLog := new(auditLogMock)
+
+	b := bot.New(slackToken, "", store)
+	b.SetPermissions(permissions)
+	b.SetAuditLog(auditLog)
+
+	serveSlashCommand(t, b, "C1", slack.User{ID: "U2", Name: "user2"}, "done")
+
+	d, ok := store.Get("C1")
+	require.True(t, ok)
+	assert.True(t, d.Finished())
+	assert.Equal(t, slack.User{ID: "U2", Name: "user2"}, d.FinishedBy)
+
+	if assert.Len(t, auditLog.Entries, 1) {
+		entry := auditLog.Entries[0]
+		assert.Equal(t, audit.SourceSlack, entry.Source)
+		assert.Equal(t, "C1", entry.ChannelID)
+		assert.Equal(t, slack.User{ID: "U2", Name: "user2"}, entry.User)
+		assert.Equal(t, "done", entry.Text)
+		assert.Equal(t, audit.Succeeded, entry.Outcome)
+	}
+}
+
+func TestBot_Done_NoRunningDeploy(t *testing.T) {
+	auditLog := new(auditLogMock)
+
+	b := bot.New(slackToken, "", deploy.NewInMemoryStore())
+	b.SetAuditLog(auditLog)
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "done")
+	assert.Equal(t, "No one is deploying at the moment", response.Text)
+
+	if assert.Len(t, auditLog.Entries, 1) {
+		assert.Equal(t, audit.Failed, auditLog.Entries[0].Outcome)
+	}
+}
+
+func TestBot_Abort_OwnDeploy(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+	store.Set("C1", deploy.Deploy{User: slack.User{ID: "U1", Name: "user1"}, StartedAt: time.Now()})
+
+	b := bot.New(slackToken, "", store)
+
+	serveSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "abort oops")
+
+	d, ok := store.Get("C1")
+	require.True(t, ok)
+	assert.True(t, d.Aborted)
+	assert.Equal(t, slack.User{ID: "U1", Name: "user1"}, d.AbortedBy)
+}
+
+func TestBot_Start_NotPermitted(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+
+	permissions := bot.NewPermissions(bot.NewRecordRoleStore(deploy.NewInMemoryStore()))
+	permissions.DefaultRole = bot.RoleNone
+
+	b := bot.New(slackToken, "", store)
+	b.SetPermissions(permissions)
+	b.SetAuditLog(new(auditLogMock))
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1")
+	assert.Contains(t, response.Text, "You need to be a channel deployer to start deploys")
+
+	_, ok := store.Get("C1")
+	assert.False(t, ok)
+}
+
+func TestBot_RoleGrant(t *testing.T) {
+	permissions := bot.NewPermissions(bot.NewRecordRoleStore(deploy.NewInMemoryStore()))
+	require.NoError(t, permissions.Grant("C1", "U1", bot.RoleAdmin))
+
+	b := bot.New(slackToken, "", deploy.NewInMemoryStore())
+	b.SetPermissions(permissions)
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "role grant <@U2|user2> maintainer")
+	assert.Equal(t, slack.ResponseTypeEphemeral, response.ResponseType)
+	assert.Equal(t, "<@U2> is now a maintainer in this channel", response.Text)
+
+	role, err := permissions.Role("C1", "U2")
+	require.NoError(t, err)
+	assert.Equal(t, bot.RoleMaintainer, role)
+
+	role, err = permissions.Role("C2", "U2")
+	require.NoError(t, err)
+	assert.Equal(t, bot.RoleDeployer, role, "expected role to be granted only in C1")
+
+	response = sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "role revoke <@U2>")
+	assert.Equal(t, "<@U2> is now a deployer in this channel", response.Text)
+
+	role, err = permissions.Role("C1", "U2")
+	require.NoError(t, err)
+	assert.Equal(t, bot.RoleDeployer, role)
+}
+
+func TestBot_RoleGrant_BotAdmin(t *testing.T) {
+	permissions := bot.NewPermissions(bot.NewRecordRoleStore(deploy.NewInMemoryStore()))
+
+	b := bot.New(slackToken, "", deploy.NewInMemoryStore())
+	b.SetAdmins("U1")
+	b.SetPermissions(permissions)
+
+	sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "role grant <@U2|user2> admin")
+
+	role, err := permissions.Role("C1", "U2")
+	require.NoError(t, err)
+	assert.Equal(t, bot.RoleAdmin, role)
+}
+
+func TestBot_RoleGrant_NotPermitted(t *testing.T) {
+	permissions := bot.NewPermissions(bot.NewRecordRoleStore(deploy.NewInMemoryStore()))
+	require.NoError(t, permissions.Grant("C1", "U1", bot.RoleMaintainer))
+
+	b := bot.New(slackToken, "", deploy.NewInMemoryStore())
+	b.SetPermissions(permissions)
+	b.SetAuditLog(new(auditLogMock))
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "role grant <@U1|user1> admin")
+	assert.Contains(t, response.Text, "You need to be a channel admin to manage roles")
+
+	role, err := permissions.Role("C1", "U1")
+	require.NoError(t, err)
+	assert.Equal(t, bot.RoleMaintainer, role)
+}
+
+func TestBot_RoleGrant_MalformedArgs(t *testing.T) {
+	b := bot.New(slackToken, "", deploy.NewInMemoryStore())
+	b.SetAdmins("U1")
+
+	for _, args := range [...]string{"", " grant", " grant <@U2|user2>", " grant @user2 admin", " grant <@U2|user2> owner", " revoke"} {
+		response := sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "role"+args)
+		assert.Contains(t, response.Text, "returned an error", "args: %q", args)
+	}
+}
+
+func TestBot_Start_RequiresApproval(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+
+	settings := bot.NewRecordSettingsStore(deploy.NewInMemoryStore())
+	require.NoError(t, settings.SetSettings("C1", bot.ChannelSettings{RequireApproval: true}))
+
+	pending := deploy.NewPendingDeploys(deploy.NewInMemoryStore())
+	auditLog := new(auditLogMock)
+
+	b := bot.New(slackToken, "", store)
+	b.SetChannelSettings(settings)
+	b.SetPendingDeploys(pending)
+	b.SetAuditLog(auditLog)
+
+	serveSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1")
+
+	_, ok := store.Get("C1")
+	assert.False(t, ok, "expected deploy to wait for approval")
+
+	p, ok, err := pending.Get("C1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, slack.User{ID: "U1", Name: "user1"}, p.Deploy.User)
+	assert.Equal(t, "octocat/helloworld#1", p.Deploy.Subject)
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "approve")
+	assert.Contains(t, response.Text, "You cannot approve your own deploy")
+
+	_, ok = store.Get("C1")
+	assert.False(t, ok)
+
+	serveSlashCommand(t, b, "C1", slack.User{ID: "U2", Name: "user2"}, "approve")
+
+	d, ok := store.Get("C1")
+	require.True(t, ok)
+	assert.Equal(t, slack.User{ID: "U1", Name: "user1"}, d.User)
+	assert.Equal(t, "octocat/helloworld#1", d.Subject)
+	assert.Equal(t, slack.User{ID: "U2", Name: "user2"}, d.ApprovedBy)
+	assert.False(t, d.ApprovedAt.IsZero())
+	assert.False(t, d.Finished())
+
+	_, ok, err = pending.Get("C1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	if assert.Len(t, auditLog.Entries, 3) {
+		assert.Equal(t, audit.Succeeded, auditLog.Entries[0].Outcome)
+		assert.Equal(t, audit.Denied, auditLog.Entries[1].Outcome)
+		assert.Equal(t, audit.Succeeded, auditLog.Entries[2].Outcome)
+	}
+}
+
+func TestBot_Start_RequiresApproval_AnotherPending(t *testing.T) {
+	settings := bot.NewRecordSettingsStore(deploy.NewInMemoryStore())
+	require.NoError(t, settings.SetSettings("C1", bot.ChannelSettings{RequireApproval: true}))
+
+	b := bot.New(slackToken, "", deploy.NewInMemoryStore())
+	b.SetChannelSettings(settings)
+	b.SetAuditLog(new(auditLogMock))
+
+	serveSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1")
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U2", Name: "user2"}, "octocat/helloworld#2")
+	assert.Equal(t, slack.ResponseTypeEphemeral, response.ResponseType)
+	assert.Contains(t, response.Text, "is waiting for approval to deploy octocat/helloworld#1")
+}
+
+func TestBot_Approve_Button(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+
+	pending := deploy.NewPendingDeploys(deploy.NewInMemoryStore())
+	p, ok, err := pending.Request("C1", deploy.New(slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	b := bot.New(slackToken, "", store)
+	b.SetPendingDeploys(pending)
+	b.SetAuditLog(new(auditLogMock))
+
+	recorder := clickButton(t, b, slackToken, "C1", slack.User{ID: "U2", Name: "user2"}, "deploy_approval", slack.NewButton("approve", "Approve", "outdated"))
+	assert.Contains(t, recorder.Body.String(), "There are no deploys waiting for approval")
+	assert.Contains(t, recorder.Body.String(), `"replace_original":false`)
+
+	_, ok = store.Get("C1")
+	assert.False(t, ok)
+
+	clickButton(t, b, slackToken, "C1", slack.User{ID: "U2", Name: "user2"}, "deploy_approval", slack.NewButton("approve", "Approve", p.ID))
+
+	d, ok := store.Get("C1")
+	require.True(t, ok)
+	assert.Equal(t, slack.User{ID: "U1", Name: "user1"}, d.User)
+	assert.Equal(t, slack.User{ID: "U2", Name: "user2"}, d.ApprovedBy)
+}
+
+func TestBot_Approve_Button_InvalidToken(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+
+	pending := deploy.NewPendingDeploys(deploy.NewInMemoryStore())
+	p, _, err := pending.Request("C1", deploy.New(slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1"))
+	require.NoError(t, err)
+
+	b := bot.New(slackToken, "", store)
+	b.SetPendingDeploys(pending)
+
+	recorder := clickButton(t, b, "invalid", "C1", slack.User{ID: "U2", Name: "user2"}, "deploy_approval", slack.NewButton("approve", "Approve", p.ID))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	_, ok := store.Get("C1")
+	assert.False(t, ok)
+}
+
+func TestBot_Approve_Expired(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+
+	pending := deploy.NewPendingDeploys(deploy.NewInMemoryStore())
+	pending.TTL = -time.Minute
+
+	_, _, err := pending.Request("C1", deploy.New(slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1"))
+	require.NoError(t, err)
+
+	b := bot.New(slackToken, "", store)
+	b.SetPendingDeploys(pending)
+	b.SetAuditLog(new(auditLogMock))
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U2", Name: "user2"}, "approve")
+	assert.Equal(t, "There are no deploys waiting for approval in this channel", response.Text)
+
+	_, ok := store.Get("C1")
+	assert.False(t, ok)
+}
+
+func TestBot_Config(t *testing.T) {
+	settings := bot.NewRecordSettingsStore(deploy.NewInMemoryStore())
+
+	permissions := bot.NewPermissions(bot.NewRecordRoleStore(deploy.NewInMemoryStore()))
+	require.NoError(t, permissions.Grant("C1", "U1", bot.RoleAdmin))
+
+	b := bot.New(slackToken, "", deploy.NewInMemoryStore())
+	b.SetChannelSettings(settings)
+	b.SetPermissions(permissions)
+	b.SetAuditLog(new(auditLogMock))
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U2", Name: "user2"}, "config require-approval on")
+	assert.Contains(t, response.Text, "You need to be a channel admin to change channel settings")
+
+	response = sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "config require-approval on")
+	assert.Equal(t, slack.ResponseTypeEphemeral, response.ResponseType)
+	assert.Contains(t, response.Text, "need to be approved")
+
+	s, err := settings.Settings("C1")
+	require.NoError(t, err)
+	assert.True(t, s.RequireApproval)
+
+	response = sendSlashCommand(t, b, "C1", slack.User{ID: "U2", Name: "user2"}, "config")
+	assert.Contains(t, response.Text, "need to be approved")
+
+	response = sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "config require-ready-prs on")
+	assert.Contains(t, response.Text, "are refused")
+
+	s, err = settings.Settings("C1")
+	require.NoError(t, err)
+	assert.Equal(t, bot.ChannelSettings{RequireApproval: true, RequireReadyPullRequests: true}, s)
+
+	for _, args := range [...]string{" require-approval", " require-approval maybe", " lock on"} {
+		response := sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "config"+args)
+		assert.Contains(t, response.Text, "returned an error", "args: %q", args)
+	}
+}
+
+func TestBot_Lock(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+	settings := bot.NewRecordSettingsStore(deploy.NewInMemoryStore())
+
+	permissions := bot.NewPermissions(bot.NewRecordRoleStore(deploy.NewInMemoryStore()))
+	require.NoError(t, permissions.Grant("C1", "U1", bot.RoleMaintainer))
+
+	auditLog := new(auditLogMock)
+
+	b := bot.New(slackToken, "", store)
+	b.SetChannelSettings(settings)
+	b.SetPermissions(permissions)
+	b.SetAuditLog(auditLog)
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U2", Name: "user2"}, "lock")
+	assert.Contains(t, response.Text, "You need to be a channel maintainer to lock and unlock deploys")
+
+	response = sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "lock incident in progress")
+	assert.Equal(t, slack.ResponseTypeInChannel, response.ResponseType)
+	assert.Contains(t, response.Text, "has locked deploys in this channel (incident in progress)")
+
+	s, err := settings.Settings("C1")
+	require.NoError(t, err)
+	if assert.NotNil(t, s.Lock) {
+		assert.Equal(t, slack.User{ID: "U1", Name: "user1"}, s.Lock.User)
+		assert.Equal(t, "incident in progress", s.Lock.Reason)
+	}
+
+	for _, user := range []slack.User{{ID: "U1", Name: "user1"}, {ID: "U2", Name: "user2"}} {
+		response = sendSlashCommand(t, b, "C1", user, "--force octocat/helloworld#1")
+		assert.Equal(t, slack.ResponseTypeEphemeral, response.ResponseType)
+		assert.Contains(t, response.Text, "Deploys in this channel have been locked by")
+		assert.Contains(t, response.Text, "(incident in progress)")
+	}
+
+	_, ok := store.Get("C1")
+	assert.False(t, ok, "expected deploys to be refused while channel is locked")
+
+	serveSlashCommand(t, b, "C2", slack.User{ID: "U2", Name: "user2"}, "octocat/helloworld#1")
+
+	_, ok = store.Get("C2")
+	assert.True(t, ok, "expected lock to apply to C1 only")
+
+	response = sendSlashCommand(t, b, "C1", slack.User{ID: "U2", Name: "user2"}, "unlock")
+	assert.Contains(t, response.Text, "You need to be a channel maintainer to lock and unlock deploys")
+
+	response = sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "unlock")
+	assert.Equal(t, slack.ResponseTypeInChannel, response.ResponseType)
+	assert.Contains(t, response.Text, "has unlocked deploys in this channel")
+
+	response = sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "unlock")
+	assert.Equal(t, "Deploys in this channel are not locked", response.Text)
+
+	serveSlashCommand(t, b, "C1", slack.User{ID: "U2", Name: "user2"}, "octocat/helloworld#1")
+
+	_, ok = store.Get("C1")
+	assert.True(t, ok)
+
+	var outcomes []audit.Outcome
+	for _, entry := range auditLog.Entries {
+		outcomes = append(outcomes, entry.Outcome)
+	}
+
+	assert.Equal(t, []audit.Outcome{
+		audit.Denied, audit.Succeeded, audit.Denied, audit.Denied, audit.Succeeded,
+		audit.Denied, audit.Succeeded, audit.Failed, audit.Succeeded,
+	}, outcomes)
+}
+
+func TestBot_Approve_Locked(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+
+	settings := bot.NewRecordSettingsStore(deploy.NewInMemoryStore())
+	require.NoError(t, settings.SetSettings("C1", bot.ChannelSettings{RequireApproval: true}))
+
+	b := bot.New(slackToken, "", store)
+	b.SetChannelSettings(settings)
+	b.SetAdmins("U3")
+
+	serveSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1")
+	sendSlashCommand(t, b, "C1", slack.User{ID: "U3", Name: "user3"}, "lock")
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U2", Name: "user2"}, "approve")
+	assert.Contains(t, response.Text, "Deploys in this channel have been locked by")
+
+	_, ok := store.Get("C1")
+	assert.False(t, ok)
+}
+
+func TestBot_Start_DeployGates(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+	auditLog := new(auditLogMock)
+
+	b := bot.New(slackToken, "", store)
+	b.SetAuditLog(auditLog)
+	b.AddDeployGate(gateMock{Decision: bot.GateWarn, Message: "CI is flaky"})
+	b.AddDeployGate(bot.ForChannels(gateMock{Decision: bot.GateDeny, Message: "There is an open incident"}, "C1"))
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1")
+	assert.Equal(t, slack.ResponseTypeEphemeral, response.ResponseType)
+	assert.Contains(t, response.Text, "There is an open incident")
+	assert.Contains(t, response.Text, "/deploy --force")
+
+	_, ok := store.Get("C1")
+	assert.False(t, ok)
+
+	serveSlashCommand(t, b, "C2", slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1")
+
+	_, ok = store.Get("C2")
+	assert.True(t, ok, "expected warnings not to prevent the deploy")
+
+	if assert.Len(t, auditLog.Entries, 2) {
+		assert.Equal(t, audit.Denied, auditLog.Entries[0].Outcome)
+		assert.Equal(t, "There is an open incident", auditLog.Entries[0].Details)
+		assert.Equal(t, audit.Succeeded, auditLog.Entries[1].Outcome)
+	}
+}
+
+func TestBot_Start_DeployGatesDeadline(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+
+	b := bot.New(slackToken, "", store)
+	b.SetGateTimeout(50 * time.Millisecond)
+	b.AddDeployGate(slowGateMock(time.Second))
+	b.AddDeployGate(slowGateMock(time.Second))
+
+	start := time.Now()
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1")
+	assert.WithinDuration(t, start, time.Now(), 500*time.Millisecond, "expected gates to share the same deadline")
+	assert.Contains(t, response.Text, "Check has not completed in time")
+
+	_, ok := store.Get("C1")
+	assert.False(t, ok)
+}
+
+func TestBot_Start_Force(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+
+	permissions := bot.NewPermissions(bot.NewRecordRoleStore(deploy.NewInMemoryStore()))
+	require.NoError(t, permissions.Grant("C1", "U2", bot.RoleMaintainer))
+
+	auditLog := new(auditLogMock)
+
+	b := bot.New(slackToken, "", store)
+	b.SetPermissions(permissions)
+	b.SetAuditLog(auditLog)
+	b.AddDeployGate(gateMock{Decision: bot.GateDeny, Message: "CI is red"})
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "--force octocat/helloworld#1")
+	assert.Contains(t, response.Text, "You need to be a channel maintainer to start deploys denied by deploy gates")
+
+	_, ok := store.Get("C1")
+	assert.False(t, ok)
+
+	serveSlashCommand(t, b, "C1", slack.User{ID: "U2", Name: "user2"}, "--force octocat/helloworld#1")
+
+	d, ok := store.Get("C1")
+	require.True(t, ok)
+	assert.Equal(t, "octocat/helloworld#1", d.Subject)
+
+	if assert.Len(t, auditLog.Entries, 2) {
+		assert.Equal(t, audit.Denied, auditLog.Entries[0].Outcome)
+
+		assert.Equal(t, "--force octocat/helloworld#1", auditLog.Entries[1].Text)
+		assert.Equal(t, audit.Succeeded, auditLog.Entries[1].Outcome)
+		assert.Equal(t, "forced past deploy gates: CI is red", auditLog.Entries[1].Details)
+	}
+}
+
+func TestBot_Start_OwnDeployRunning(t *testing.T) {
+	startedAt := time.Now().Add(-time.Minute)
+
+	store := deploy.NewInMemoryStore()
+	store.Set("C1", deploy.Deploy{User: slack.User{ID: "U1", Name: "user1"}, Subject: "octocat/helloworld#1", StartedAt: startedAt})
+
+	auditLog := new(auditLogMock)
+
+	b := bot.New(slackToken, "", store)
+	b.SetAuditLog(auditLog)
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#2")
+	assert.Contains(t, response.Text, "You are deploying octocat/helloworld#1")
+	assert.Contains(t, response.Text, "/deploy --replace")
+
+	d, ok := store.Get("C1")
+	require.True(t, ok)
+	assert.Equal(t, "octocat/helloworld#1", d.Subject)
+	assert.True(t, d.FinishedAt.IsZero())
+
+	if assert.Len(t, auditLog.Entries, 1) {
+		assert.Equal(t, audit.Failed, auditLog.Entries[0].Outcome)
+	}
+}
+
+func TestBot_Start_Replace(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+	store.Set("C1", deploy.Deploy{User: slack.User{ID: "U1", Name: "user1"}, Subject: "octocat/helloworld#1", StartedAt: time.Now().Add(-time.Minute)})
+
+	b := bot.New(slackToken, "", store)
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U2", Name: "user2"}, "--replace octocat/helloworld#2")
+	assert.Contains(t, response.Text, "<@U1|user1> is deploying since")
+
+	serveSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "--replace octocat/helloworld#2")
+
+	d, ok := store.Get("C1")
+	require.True(t, ok)
+	assert.Equal(t, "octocat/helloworld#2", d.Subject)
+	assert.Equal(t, slack.User{ID: "U1", Name: "user1"}, d.User)
+	assert.True(t, d.FinishedAt.IsZero())
+}
+
+func TestBot_Start_MessagePoster(t *testing.T) {
+	baseURL, mux, teardown := setupGitHubTestServer()
+	defer teardown()
+
+	release := make(chan struct{})
+	mux.HandleFunc("/repos/octocat/helloworld/pulls/1", func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		w.Write([]byte(`{"number":1,"title":"Slow","html_url":"http://xyz.abc/1"}`))
+	})
+
+	githubClient := github.NewClient("", nil)
+	githubClient.BaseURL = baseURL
+
+	messages := &messagePosterMock{
+		Posted:  make(chan slack.Message, 1),
+		Updated: make(chan slack.Message, 1),
+	}
+
+	b := bot.New(slackToken, "", deploy.NewInMemoryStore())
+	b.SetGitHubClient(githubClient)
+	b.SetMessagePoster(messages)
+	b.SetPullRequestLookupTimeout(50 * time.Millisecond)
+
+	serveSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1")
+
+	select {
+	case announcement := <-messages.Posted:
+		if assert.Len(t, announcement.Attachments, 1) {
+			assert.Equal(t, "octocat/helloworld#1", announcement.Attachments[0].Title)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected deploy announcement to be posted")
+	}
+
+	close(release)
+
+	select {
+	case update := <-messages.Updated:
+		if assert.Len(t, update.Attachments, 1) {
+			assert.Equal(t, "PR #1: Slow", update.Attachments[0].Title)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected deploy announcement to be updated")
+	}
+}
+
+func TestBot_Changelog_MalformedArgs(t *testing.T) {
+	b := bot.New(slackToken, "", deploy.NewInMemoryStore())
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "changelog")
+	assert.Contains(t, response.Text, "not supported")
+
+	store := deploy.NewInMemoryStore()
+	b.SetChangelog(store, changelog.NewBuilder(github.NewClient("", nil)))
+
+	for _, args := range [...]string{" yesterday", " 2018-01-01 2018-02-01", " --everything"} {
+		response := sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "changelog"+args)
+		assert.Contains(t, response.Text, "returned an error", "args: %q", args)
+	}
+}
+
+func TestBot_Changelog_SlowGitHub(t *testing.T) {
+	baseURL, mux, teardown := setupGitHubTestServer()
+	defer teardown()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	mux.HandleFunc("/repos/octocat/helloworld/pulls/1", func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		w.Write([]byte(`{"number":1,"title":"Fix typo","html_url":"https://github.com/octocat/helloworld/pull/1"}`))
+	})
+
+	responseURL, responses, teardownResponseURL := setupResponseURLServer(t)
+	defer teardownResponseURL()
+
+	githubClient := github.NewClient("", nil)
+	githubClient.BaseURL = baseURL
+
+	d := deploy.New(slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1")
+	d.StartedAt, d.FinishedAt = time.Now().Add(-time.Hour), time.Now().Add(-30*time.Minute)
+
+	store := deploy.NewInMemoryStore()
+	store.Set("C1", d)
+
+	b := bot.New(slackToken, "", store)
+	b.SetChangelog(store, changelog.NewBuilder(githubClient))
+	b.SetChangelogTimeout(50 * time.Millisecond)
+
+	served := make(chan struct{})
+	go func() {
+		serveSlashCommandWithResponseURL(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "changelog", responseURL)
+		close(served)
+	}()
+
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		t.Fatal("slash command response is blocked by GitHub")
+	}
+
+	select {
+	case text := <-responses:
+		assert.Contains(t, text, "• <https://github.com/octocat/helloworld/pull/1|#1>")
+		assert.NotContains(t, text, "Fix typo")
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected changelog to be sent once the timeout is exceeded")
+	}
+}
+
+func TestBot_Done_ReleaseNotes(t *testing.T) {
+	baseURL, mux, teardown := setupGitHubTestServer()
+	defer teardown()
+
+	mux.HandleFunc("/repos/octocat/helloworld/pulls/1", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":1,"title":"Fix typo","html_url":"https://github.com/octocat/helloworld/pull/1","user":{"login":"author1"}}`))
+	})
+
+	githubClient := github.NewClient("", nil)
+	githubClient.BaseURL = baseURL
+
+	messages := &messagePosterMock{
+		Posted:  make(chan slack.Message, 1),
+		Updated: make(chan slack.Message, 1),
+	}
+
+	store := deploy.NewInMemoryStore()
+
+	b := bot.New(slackToken, "", store)
+	b.SetGitHubClient(githubClient)
+	b.SetMessagePoster(messages)
+	b.SetChangelog(store, changelog.NewBuilder(githubClient))
+	b.SetReleaseNotes(changelog.Options{Authors: true})
+
+	serveSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1")
+
+	select {
+	case announcement := <-messages.Posted:
+		assert.Empty(t, announcement.ThreadTS)
+	case <-time.After(time.Second):
+		t.Fatal("expected deploy announcement to be posted")
+	}
+
+	serveSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "done")
+
+	select {
+	case notes := <-messages.Posted:
+		assert.Equal(t, "1503435956.000247", notes.ThreadTS)
+		assert.Contains(t, notes.Text, "<https://github.com/octocat/helloworld/pull/1|#1> Fix typo by author1")
+	case <-time.After(time.Second):
+		t.Fatal("expected release notes to be posted")
+	}
+}
+
+func TestBot_Where(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+
+	d1 := deploy.New(slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1")
+	d1.StartedAt = time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	d1.Abort("")
+	store.Set("C1", d1)
+
+	d2 := deploy.New(slack.User{ID: "U2", Name: "user2"}, "https://github.com/octocat/helloworld/pull/1")
+	d2.StartedAt = time.Date(2018, 3, 1, 11, 0, 0, 0, time.UTC)
+	d2.FinishedAt = d2.StartedAt.Add(time.Minute)
+	store.Set("C2", d2)
+
+	d3 := deploy.New(slack.User{ID: "U3", Name: "user3"}, "octocat/helloworld#1")
+	d3.StartedAt = time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+	store.Set("C3", d3)
+
+	responseURL, responses, teardown := setupResponseURLServer(t)
+	defer teardown()
+
+	b := bot.New(slackToken, "", store)
+
+	response := sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "where octocat/helloworld#1")
+	assert.Contains(t, response.Text, "not supported")
+
+	b.SetReferenceIndex(store)
+
+	where := func(ref string) string {
+		serveSlashCommandWithResponseURL(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "where "+ref, responseURL)
+
+		select {
+		case text := <-responses:
+			return text
+		case <-time.After(time.Second):
+			t.Fatalf("expected deploys of %s to be sent to response URL", ref)
+			return ""
+		}
+	}
+
+	// deploys from other channels are not listed unless channel membership can be checked
+	assert.Equal(t, "octocat/helloworld#1 has been included into following deploys:\n"+
+		"• <#C1> 01 Mar 18 10:00 UTC by <@U1|user1>, aborted", where("octocat/helloworld#1"))
+
+	b.SetChannelMembers(channelMembersStub{"C2": {"U1", "U2"}, "C3": {"U3"}})
+
+	assert.Equal(t, "Octocat/HelloWorld#1 has been included into following deploys:\n"+
+		"• <#C1> 01 Mar 18 10:00 UTC by <@U1|user1>, aborted\n"+
+		"• <#C2> 01 Mar 18 11:00 UTC by <@U2|user2>, deployed", where("Octocat/HelloWorld#1"))
+
+	assert.Equal(t, "octocat/helloworld#2 has not been deployed yet", where("octocat/helloworld#2"))
+
+	response = sendSlashCommand(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "where octocat/helloworld")
+	assert.Contains(t, response.Text, "returned an error")
+}
+
+func TestBot_Where_SlowMembershipCheck(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+
+	d1 := deploy.New(slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1")
+	d1.StartedAt = time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	store.Set("C1", d1)
+
+	d2 := deploy.New(slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1")
+	d2.StartedAt = time.Date(2018, 3, 1, 11, 0, 0, 0, time.UTC)
+	store.Set("C2", d2)
+
+	responseURL, responses, teardown := setupResponseURLServer(t)
+	defer teardown()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	b := bot.New(slackToken, "", store)
+	b.SetReferenceIndex(store)
+	b.SetChannelMembers(slowChannelMembersStub(release))
+	b.SetMembershipCheckTimeout(50 * time.Millisecond)
+
+	served := make(chan struct{})
+	go func() {
+		serveSlashCommandWithResponseURL(t, b, "C1", slack.User{ID: "U1", Name: "user1"}, "where octocat/helloworld#1", responseURL)
+		close(served)
+	}()
+
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		t.Fatal("slash command response is blocked by membership check")
+	}
+
+	select {
+	case text := <-responses:
+		assert.Equal(t, "octocat/helloworld#1 has been included into following deploys:\n"+
+			"• <#C1> 01 Mar 18 10:00 UTC by <@U1|user1>, in progress", text)
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected deploys to be sent once the timeout is exceeded")
+	}
+}
+
+// channelMembersStub lists IDs of channel members by channel ID.
+type channelMembersStub map[string][]string
+
+func (s channelMembersStub) IsMember(channelID, userID string) (bool, error) {
+	for _, id := range s[channelID] {
+		if id == userID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// slowChannelMembersStub makes every user a member of any channel once closed.
+type slowChannelMembersStub chan struct{}
+
+func (s slowChannelMembersStub) IsMember(channelID, userID string) (bool, error) {
+	<-s
+	return true, nil
+}
+
+type auditLogMock struct {
+	Entries []audit.Entry
+}
+
+func (m *auditLogMock) Append(e audit.Entry) error {
+	m.Entries = append(m.Entries, e)
+	return nil
+}
+
+// sequentialStore returns its deploys one by one on each read, repeating the last one afterwards.
+type sequentialStore struct {
+	Deploys []deploy.Deploy
+	Written []deploy.Deploy
+}
+
+func (s *sequentialStore) Get(key string) (deploy.Deploy, bool) {
+	d := s.Deploys[0]
+	if len(s.Deploys) > 1 {
+		s.Deploys = s.Deploys[1:]
+	}
+
+	return d, true
+}
+
+func (s *sequentialStore) Set(key string, d deploy.Deploy) {
+	s.Written = append(s.Written, d)
+}
+
+type messagePosterMock struct {
+	Posted, Updated chan slack.Message
+}
+
+func (m *messagePosterMock) PostChannelMessage(channelID string, message slack.Message) (string, error) {
+	m.Posted <- message
+	return "1503435956.000247", nil
+}
+
+func (m *messagePosterMock) UpdateMessage(channelID, ts string, message slack.Message) error {
+	if ts != "1503435956.000247" {
+		return errors.New("message_not_found")
+	}
+
+	m.Updated <- message
+	return nil
+}
+
+func sendSlashCommand(t *testing.T, b *bot.Bot, channelID string, user slack.User, text string) slack.Response {
+	recorder := serveSlashCommand(t, b, channelID, user, text)
+
+	var v struct {
+		Text         string `json:"text"`
+		ResponseType string `json:"response_type"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &v), recorder.Body.String())
+
+	response := slack.Response{Message: slack.Message{Text: v.Text}}
+	if v.ResponseType == "in_channel" {
+		response.ResponseType = slack.ResponseTypeInChannel
+	}
+
+	return response
+}
+
+func serveSlashCommand(t *testing.T, b *bot.Bot, channelID string, user slack.User, text string) *httptest.ResponseRecorder {
+	return serveSlashCommandWithResponseURL(t, b, channelID, user, text, "")
+}
+
+func serveSlashCommandWithResponseURL(t *testing.T, b *bot.Bot, channelID string, user slack.User, text, responseURL string) *httptest.ResponseRecorder {
+	form := url.Values{}
+	form.Set("token", slackToken)
+	form.Set("command", "/deploy")
+	form.Set("channel_id", channelID)
+	form.Set("user_id", user.ID)
+	form.Set("user_name", user.Name)
+	form.Set("text", text)
+	if responseURL != "" {
+		form.Set("response_url", responseURL)
+	}
+
+	req, err := http.NewRequest("POST", "/deploy", strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	recorder := httptest.NewRecorder()
+	b.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	return recorder
+}
+
+// setupResponseURLServer starts a server that reports texts of delayed responses sent to its URL.
+func setupResponseURLServer(t *testing.T) (responseURL string, responses <-chan string, teardownFn func()) {
+	ch := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var v struct {
+			Text string `json:"text"`
+		}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&v))
+
+		ch <- v.Text
+	}))
+
+	return server.URL, ch, server.Close
+}
+
+func clickButton(t *testing.T, b *bot.Bot, token, channelID string, user slack.User, callbackID string, action slack.Action) *httptest.ResponseRecorder {
+	payload := slack.InteractionPayload{
+		Type:       "interactive_message",
+		Token:      token,
+		CallbackID: callbackID,
+		User:       user,
+		Actions:    []slack.Action{action},
+	}
+	payload.Channel.ID = channelID
+
+	data, err := json.Marshal(payload)
+	require.NoError(t, err)
+
+	form := url.Values{}
+	form.Set("payload", string(data))
+
+	req, err := http.NewRequest("POST", "/deploy", strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	recorder := httptest.NewRecorder()
+	b.ServeHTTP(recorder, req)
+
+	return recorder
+}
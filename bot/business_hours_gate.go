@@ -0,0 +1,119 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andrewslotin/michael/deploy"
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// BusinessHoursGate denies deploys outside of business hours.
+type BusinessHoursGate struct {
+	Days     [7]bool // indexed with time.Weekday
+	From, To time.Duration
+	Location *time.Location
+
+	spec string
+}
+
+// ParseBusinessHours parses business hours in <days>,<hh:mm>-<hh:mm>[,<time zone>] format, where days are
+// either a single day or a range of days, i.e. Mon-Fri,09:00-18:00,Europe/Berlin. The time zone defaults to UTC.
+func ParseBusinessHours(s string) (*BusinessHoursGate, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, fmt.Errorf("expected <days>,<hh:mm>-<hh:mm>[,<time zone>], got %q", s)
+	}
+
+	g := &BusinessHoursGate{Location: time.UTC, spec: strings.Join(fields, " ")}
+
+	days := strings.SplitN(strings.ToLower(fields[0]), "-", 2)
+	first, ok := weekdayNames[days[0]]
+	if !ok {
+		return nil, fmt.Errorf("malformed day %q", days[0])
+	}
+
+	last := first
+	if len(days) == 2 {
+		if last, ok = weekdayNames[days[1]]; !ok {
+			return nil, fmt.Errorf("malformed day %q", days[1])
+		}
+	}
+
+	for day := first; ; day = (day + 1) % 7 {
+		g.Days[day] = true
+		if day == last {
+			break
+		}
+	}
+
+	hours := strings.SplitN(fields[1], "-", 2)
+	if len(hours) != 2 {
+		return nil, fmt.Errorf("malformed business hours %q", fields[1])
+	}
+
+	var err error
+	if g.From, err = parseTimeOfDay(hours[0]); err != nil {
+		return nil, err
+	}
+
+	if g.To, err = parseTimeOfDay(hours[1]); err != nil {
+		return nil, err
+	}
+
+	if g.To <= g.From {
+		return nil, fmt.Errorf("business hours %q should end after they start", fields[1])
+	}
+
+	if len(fields) == 3 {
+		if g.Location, err = time.LoadLocation(fields[2]); err != nil {
+			return nil, fmt.Errorf("unknown time zone %q: %s", fields[2], err)
+		}
+	}
+
+	return g, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("malformed time %q, expected hh:mm", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Check denies the deploy if it is started outside of business hours.
+func (g *BusinessHoursGate) Check(ctx context.Context, channelID string, d deploy.Deploy) GateResult {
+	return g.CheckAt(time.Now())
+}
+
+// CheckAt denies the deploy if given time is outside of business hours.
+func (g *BusinessHoursGate) CheckAt(t time.Time) GateResult {
+	t = t.In(g.Location)
+
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if g.Days[t.Weekday()] && sinceMidnight >= g.From && sinceMidnight < g.To {
+		return Allow()
+	}
+
+	return GateResult{
+		Decision: GateDeny,
+		Message:  "Deploys are only allowed during business hours (" + g.String() + ")",
+	}
+}
+
+func (g *BusinessHoursGate) String() string {
+	return g.spec
+}
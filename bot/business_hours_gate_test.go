@@ -0,0 +1,63 @@
+package bot_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/bot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBusinessHours(t *testing.T) {
+	g, err := bot.ParseBusinessHours("Mon-Fri,09:00-18:30,Europe/Berlin")
+	require.NoError(t, err)
+
+	assert.Equal(t, [7]bool{false, true, true, true, true, true, false}, g.Days)
+	assert.Equal(t, 9*time.Hour, g.From)
+	assert.Equal(t, 18*time.Hour+30*time.Minute, g.To)
+	assert.Equal(t, "Europe/Berlin", g.Location.String())
+
+	g, err = bot.ParseBusinessHours("Sat-Mon,10:00-12:00")
+	require.NoError(t, err)
+
+	assert.Equal(t, [7]bool{true, true, false, false, false, false, true}, g.Days)
+	assert.Equal(t, time.UTC, g.Location)
+}
+
+func TestParseBusinessHours_Malformed(t *testing.T) {
+	for _, s := range [...]string{
+		"",
+		"Mon-Fri",
+		"Mon-Fri,09:00",
+		"Mon-Someday,09:00-18:00",
+		"Mon-Fri,9am-6pm",
+		"Mon-Fri,18:00-09:00",
+		"Mon-Fri,09:00-18:00,Mars/Olympus",
+	} {
+		_, err := bot.ParseBusinessHours(s)
+		assert.Error(t, err, "spec: %q", s)
+	}
+}
+
+func TestBusinessHoursGate_CheckAt(t *testing.T) {
+	g, err := bot.ParseBusinessHours("Mon-Fri,09:00-18:00,Europe/Berlin")
+	require.NoError(t, err)
+
+	examples := map[time.Time]bot.GateDecision{
+		time.Date(2016, 8, 4, 7, 0, 0, 0, time.UTC):   bot.GateAllow, // Thursday 09:00 CEST
+		time.Date(2016, 8, 4, 15, 59, 0, 0, time.UTC): bot.GateAllow, // Thursday 17:59 CEST
+		time.Date(2016, 8, 4, 6, 59, 0, 0, time.UTC):  bot.GateDeny,  // Thursday 08:59 CEST
+		time.Date(2016, 8, 4, 16, 0, 0, 0, time.UTC):  bot.GateDeny,  // Thursday 18:00 CEST
+		time.Date(2016, 8, 6, 12, 0, 0, 0, time.UTC):  bot.GateDeny,  // Saturday
+	}
+
+	for tm, expected := range examples {
+		res := g.CheckAt(tm)
+		assert.Equal(t, expected, res.Decision, "time: %s", tm)
+
+		if expected == bot.GateDeny {
+			assert.Contains(t, res.Message, "Mon-Fri 09:00-18:00 Europe/Berlin")
+		}
+	}
+}
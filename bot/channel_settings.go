@@ -0,0 +1,134 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/slack"
+)
+
+// ChannelSettings configures how deploys are run in a channel.
+type ChannelSettings struct {
+	// RequireApproval makes /deploy <subject> wait until another user approves the deploy.
+	RequireApproval bool `json:"require_approval"`
+	// RequireReadyPullRequests refuses to start deploys of pull requests that are not merged, closed or
+	// have failing checks.
+	RequireReadyPullRequests bool `json:"require_ready_pull_requests"`
+	// Lock prevents new deploys from being started in channel until it is removed with /deploy unlock.
+	Lock *ChannelLock `json:"lock,omitempty"`
+}
+
+// ChannelLock describes who has locked deploys in a channel and why.
+type ChannelLock struct {
+	User     slack.User `json:"user"`
+	Reason   string     `json:"reason,omitempty"`
+	LockedAt time.Time  `json:"locked_at"`
+}
+
+// SettingsStore keeps channel settings.
+//
+// UpdateSettings applies fn to the settings of channel and atomically stores them unless fn returns an error. Since
+// fn may be called more than once if settings are changed concurrently, it should not have side effects.
+type SettingsStore interface {
+	Settings(channelID string) (ChannelSettings, error)
+	SetSettings(channelID string, settings ChannelSettings) error
+	UpdateSettings(channelID string, fn func(settings *ChannelSettings) error) error
+}
+
+const channelSettingsCollection = "channel_settings"
+
+// RecordSettingsStore is a SettingsStore that keeps channel settings in a deploy.RecordStore.
+type RecordSettingsStore struct {
+	records deploy.RecordStore
+	mu      sync.Mutex // serializes updates of record stores that are not deploy.TransactionalRecordStore
+}
+
+// NewRecordSettingsStore returns an instance of *RecordSettingsStore that uses records to keep settings.
+func NewRecordSettingsStore(records deploy.RecordStore) *RecordSettingsStore {
+	return &RecordSettingsStore{records: records}
+}
+
+// Settings returns settings of a channel. Channels that have never been configured get zero settings.
+func (s *RecordSettingsStore) Settings(channelID string) (ChannelSettings, error) {
+	var settings ChannelSettings
+
+	rec, ok, err := s.records.GetRecord(channelSettingsCollection, channelID)
+	if err != nil {
+		return settings, fmt.Errorf("failed to get settings of %s: %s", channelID, err)
+	}
+
+	if !ok {
+		return settings, nil
+	}
+
+	return decodeSettings(channelID, rec)
+}
+
+// SetSettings replaces settings of a channel.
+func (s *RecordSettingsStore) SetSettings(channelID string, settings ChannelSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal settings of %s: %s", channelID, err)
+	}
+
+	if err := s.records.PutRecord(channelSettingsCollection, deploy.Record{Key: channelID, Value: data}); err != nil {
+		return fmt.Errorf("failed to store settings of %s: %s", channelID, err)
+	}
+
+	return nil
+}
+
+// UpdateSettings applies fn to the settings of channel and stores them. See SettingsStore for details.
+func (s *RecordSettingsStore) UpdateSettings(channelID string, fn func(settings *ChannelSettings) error) error {
+	records, ok := s.records.(deploy.TransactionalRecordStore)
+	if !ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		settings, err := s.Settings(channelID)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(&settings); err != nil {
+			return err
+		}
+
+		return s.SetSettings(channelID, settings)
+	}
+
+	return records.UpdateRecord(channelSettingsCollection, channelID, func(rec deploy.Record, ok bool) (deploy.Record, error) {
+		var (
+			settings ChannelSettings
+			err      error
+		)
+		if ok {
+			if settings, err = decodeSettings(channelID, rec); err != nil {
+				return rec, err
+			}
+		}
+
+		if err := fn(&settings); err != nil {
+			return rec, err
+		}
+
+		data, err := json.Marshal(settings)
+		if err != nil {
+			return rec, fmt.Errorf("failed to marshal settings of %s: %s", channelID, err)
+		}
+
+		return deploy.Record{Key: channelID, Value: data}, nil
+	})
+}
+
+func decodeSettings(channelID string, rec deploy.Record) (ChannelSettings, error) {
+	var settings ChannelSettings
+	if err := json.Unmarshal(rec.Value, &settings); err != nil {
+		return settings, fmt.Errorf("malformed settings of %s: %s", channelID, err)
+	}
+
+	return settings, nil
+}
@@ -0,0 +1,108 @@
+package bot_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/andrewslotin/michael/bot"
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordSettingsStore(t *testing.T) {
+	store := bot.NewRecordSettingsStore(deploy.NewInMemoryStore())
+
+	settings, err := store.Settings("C1")
+	require.NoError(t, err)
+	assert.Equal(t, bot.ChannelSettings{}, settings)
+
+	require.NoError(t, store.SetSettings("C1", bot.ChannelSettings{RequireApproval: true}))
+
+	settings, err = store.Settings("C1")
+	require.NoError(t, err)
+	assert.Equal(t, bot.ChannelSettings{RequireApproval: true}, settings)
+
+	settings, err = store.Settings("C2")
+	require.NoError(t, err)
+	assert.Equal(t, bot.ChannelSettings{}, settings)
+}
+
+// slowRecordStore widens the window between reading and writing a record to make lost updates likely.
+type slowRecordStore struct {
+	deploy.RecordStore
+}
+
+func (s slowRecordStore) GetRecord(collection, key string) (deploy.Record, bool, error) {
+	rec, ok, err := s.RecordStore.GetRecord(collection, key)
+	time.Sleep(time.Millisecond)
+
+	return rec, ok, err
+}
+
+func TestRecordSettingsStore_UpdateSettings(t *testing.T) {
+	srv, err := miniredis.Run()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	redisStore, err := deploy.NewRedisStore("redis://" + srv.Addr())
+	require.NoError(t, err)
+	defer redisStore.Close()
+
+	for name, records := range map[string]deploy.RecordStore{
+		"in-memory": slowRecordStore{deploy.NewInMemoryStore()},
+		"redis":     redisStore,
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := bot.NewRecordSettingsStore(records)
+			require.NoError(t, store.SetSettings("C1", bot.ChannelSettings{RequireApproval: true}))
+
+			// Updates that failed due to too many concurrent ones are reported, the rest must not be lost
+			var (
+				wg      sync.WaitGroup
+				updated int32
+			)
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					err := store.UpdateSettings("C1", func(settings *bot.ChannelSettings) error {
+						if settings.Lock == nil {
+							settings.Lock = &bot.ChannelLock{}
+						}
+						settings.Lock.Reason += "x"
+
+						return nil
+					})
+					if err == nil {
+						atomic.AddInt32(&updated, 1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			settings, err := store.Settings("C1")
+			require.NoError(t, err)
+			assert.True(t, settings.RequireApproval)
+			if assert.NotNil(t, settings.Lock) {
+				assert.Equal(t, strings.Repeat("x", int(updated)), settings.Lock.Reason, "expected no updates to be lost")
+			}
+
+			err = store.UpdateSettings("C1", func(settings *bot.ChannelSettings) error {
+				settings.RequireApproval = false
+				return errors.New("invalid settings")
+			})
+			assert.Error(t, err)
+
+			settings, err = store.Settings("C1")
+			require.NoError(t, err)
+			assert.True(t, settings.RequireApproval, "expected settings to be left intact")
+		})
+	}
+}
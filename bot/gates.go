@@ -0,0 +1,106 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/andrewslotin/michael/deploy"
+)
+
+// DefaultGateTimeout limits the time all deploy gates together may take to decide. Slack expects slash commands
+// to respond within 3 seconds.
+const DefaultGateTimeout = 2500 * time.Millisecond
+
+// GateDecision is the verdict of a DeployGate.
+type GateDecision int
+
+const (
+	// GateAllow lets the deploy start.
+	GateAllow GateDecision = iota
+	// GateWarn lets the deploy start, but the announcement includes the gate message.
+	GateWarn
+	// GateDeny prevents the deploy from starting unless forced with /deploy --force <subject>.
+	GateDeny
+)
+
+var gateDecisionNames = [...]string{
+	GateAllow: "allow",
+	GateWarn:  "warn",
+	GateDeny:  "deny",
+}
+
+// ParseGateDecision returns a gate decision by its name.
+func ParseGateDecision(s string) (GateDecision, error) {
+	for decision, name := range gateDecisionNames {
+		if name == s {
+			return GateDecision(decision), nil
+		}
+	}
+
+	return GateDeny, fmt.Errorf("unknown gate decision %q, expected allow, warn or deny", s)
+}
+
+// Set implements flag.Value.
+func (d *GateDecision) Set(s string) error {
+	decision, err := ParseGateDecision(s)
+	if err != nil {
+		return err
+	}
+
+	*d = decision
+
+	return nil
+}
+
+func (d GateDecision) String() string {
+	if d < 0 || int(d) >= len(gateDecisionNames) {
+		return fmt.Sprintf("GateDecision(%d)", int(d))
+	}
+
+	return gateDecisionNames[d]
+}
+
+// GateResult is returned by a DeployGate along with a message explaining the decision.
+type GateResult struct {
+	Decision GateDecision
+	Message  string
+}
+
+// Allow returns a GateResult that lets the deploy start.
+func Allow() GateResult {
+	return GateResult{Decision: GateAllow}
+}
+
+// DeployGate is a check performed before a deploy is started. Gates are evaluated in the order they were added
+// to the bot and share the same deadline, so Check is expected to return as soon as ctx is done.
+type DeployGate interface {
+	Check(ctx context.Context, channelID string, d deploy.Deploy) GateResult
+}
+
+type channelGate struct {
+	DeployGate
+	channels map[string]struct{}
+}
+
+// ForChannels returns a DeployGate that only checks deploys started in given channels and allows the rest.
+func ForChannels(gate DeployGate, channelIDs ...string) DeployGate {
+	g := channelGate{
+		DeployGate: gate,
+		channels:   make(map[string]struct{}, len(channelIDs)),
+	}
+
+	for _, id := range channelIDs {
+		g.channels[id] = struct{}{}
+	}
+
+	return g
+}
+
+func (g channelGate) Check(ctx context.Context, channelID string, d deploy.Deploy) GateResult {
+	if _, ok := g.channels[channelID]; !ok {
+		return Allow()
+	}
+
+	return g.DeployGate.Check(ctx, channelID, d)
+}
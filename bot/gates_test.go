@@ -0,0 +1,39 @@
+package bot_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/bot"
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForChannels(t *testing.T) {
+	gate := bot.ForChannels(gateMock{Decision: bot.GateDeny, Message: "denied"}, "C1", "C2")
+	d := deploy.New(slack.User{ID: "U1", Name: "user1"}, "subject")
+
+	assert.Equal(t, bot.GateDeny, gate.Check(context.Background(), "C1", d).Decision)
+	assert.Equal(t, bot.GateDeny, gate.Check(context.Background(), "C2", d).Decision)
+	assert.Equal(t, bot.GateAllow, gate.Check(context.Background(), "C3", d).Decision)
+}
+
+type gateMock bot.GateResult
+
+func (m gateMock) Check(ctx context.Context, channelID string, d deploy.Deploy) bot.GateResult {
+	return bot.GateResult(m)
+}
+
+// slowGateMock allows deploys after a delay unless ctx is done earlier.
+type slowGateMock time.Duration
+
+func (m slowGateMock) Check(ctx context.Context, channelID string, d deploy.Deploy) bot.GateResult {
+	select {
+	case <-time.After(time.Duration(m)):
+		return bot.Allow()
+	case <-ctx.Done():
+		return bot.GateResult{Decision: bot.GateDeny, Message: "Check has not completed in time"}
+	}
+}
@@ -0,0 +1,238 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/github"
+)
+
+// DefaultGitHubEnvironment is the name of environment GitHub deployments are created for by default.
+const DefaultGitHubEnvironment = "production"
+
+// earlyStatusTTL limits the time a status reported before the deploy has been started is kept, so that statuses
+// of deploys started before restart do not pile up.
+const earlyStatusTTL = time.Hour
+
+type githubDeployment struct {
+	Repository string
+	ID         int64
+}
+
+// githubDeploys are the GitHub deployments created for a deploy.
+type githubDeploys struct {
+	Deployments []githubDeployment
+	// Created is false while the deployments are being created
+	Created bool
+	// Status is set if the deploy has been completed before its deployments were created
+	Status *github.DeploymentStatusRequest
+}
+
+// earlyStatus is the status of a deploy that has been completed before DeployStarted was called for it.
+type earlyStatus struct {
+	Status     github.DeploymentStatusRequest
+	ReportedAt time.Time
+}
+
+// GitHubDeploymentsNotifier is a DeployEventHandler that creates a GitHub deployment for the head commit of each pull
+// request mentioned in deploy subject and reports its status once the deploy is finished or aborted.
+//
+// Deployments are only kept in memory. This is a known limitation: the status of deploys that were in progress
+// while the service restarted is never reported, so their deployments remain pending in GitHub.
+type GitHubDeploymentsNotifier struct {
+	// Environment is the name of environment to create deployments for.
+	Environment string
+	// CommentOnPullRequests enables comments on deployed pull requests.
+	CommentOnPullRequests bool
+	// DashboardURL is the base URL of deploy history dashboard. If set, links to channel history are added to
+	// deployment statuses and pull request comments.
+	DashboardURL string
+
+	client *github.Client
+
+	mu          sync.Mutex
+	deployments map[string]*githubDeploys
+	early       map[string]earlyStatus
+}
+
+// NewGitHubDeploymentsNotifier returns an instance of *GitHubDeploymentsNotifier that uses GitHub client to create
+// deployments.
+func NewGitHubDeploymentsNotifier(client *github.Client) *GitHubDeploymentsNotifier {
+	return &GitHubDeploymentsNotifier{
+		Environment: DefaultGitHubEnvironment,
+		client:      client,
+		deployments: make(map[string]*githubDeploys),
+		early:       make(map[string]earlyStatus),
+	}
+}
+
+func (notifier *GitHubDeploymentsNotifier) DeployStarted(channelID string, d deploy.Deploy) {
+	if len(d.PullRequests) == 0 {
+		return
+	}
+
+	key := deploymentKey(channelID, d)
+
+	// event handlers are called concurrently, so the deploy might have already been completed
+	notifier.mu.Lock()
+	early, completed := notifier.early[key]
+	if completed {
+		delete(notifier.early, key)
+	} else {
+		// mark the deploy as pending, so that the status reported while deployments are being created is not lost
+		notifier.deployments[key] = &githubDeploys{}
+	}
+	notifier.mu.Unlock()
+
+	deployments := notifier.createDeployments(channelID, d)
+	if completed {
+		notifier.createStatuses(deployments, early.Status)
+		return
+	}
+
+	notifier.mu.Lock()
+	entry := notifier.deployments[key]
+	if entry.Status == nil && len(deployments) > 0 {
+		entry.Deployments, entry.Created = deployments, true
+		notifier.mu.Unlock()
+
+		return
+	}
+	delete(notifier.deployments, key)
+	notifier.mu.Unlock()
+
+	if entry.Status != nil {
+		notifier.createStatuses(deployments, *entry.Status)
+	}
+}
+
+// createDeployments creates a GitHub deployment for each pull request mentioned in deploy subject.
+func (notifier *GitHubDeploymentsNotifier) createDeployments(channelID string, d deploy.Deploy) []githubDeployment {
+	var deployments []githubDeployment
+	for _, ref := range d.PullRequests {
+		pr, err := notifier.client.GetPullRequest(ref.Repository, ref.ID)
+		if err != nil {
+			log.Printf("failed to get %s#%s to create a GitHub deployment: %s", ref.Repository, ref.ID, err)
+			continue
+		}
+
+		deployment, err := notifier.client.CreateDeployment(ref.Repository, github.DeploymentRequest{
+			Ref:              pr.Head.SHA,
+			Environment:      notifier.Environment,
+			Description:      fmt.Sprintf("Deployed by %s via Slack", d.User.Name),
+			RequiredContexts: []string{},
+		})
+		if err != nil {
+			log.Printf("failed to create a GitHub deployment for %s#%s: %s", ref.Repository, ref.ID, err)
+			continue
+		}
+
+		deployments = append(deployments, githubDeployment{Repository: ref.Repository, ID: deployment.ID})
+
+		if notifier.CommentOnPullRequests {
+			if err := notifier.client.CreateIssueComment(ref.Repository, ref.ID, notifier.comment(channelID, d)); err != nil {
+				log.Printf("failed to comment on %s#%s: %s", ref.Repository, ref.ID, err)
+			}
+		}
+	}
+
+	return deployments
+}
+
+func (notifier *GitHubDeploymentsNotifier) DeployCompleted(channelID string, d deploy.Deploy) {
+	notifier.setStatus(channelID, d, github.DeploymentStatusRequest{
+		State:       "success",
+		Description: fmt.Sprintf("Finished by %s", d.FinishedBy.Name),
+	})
+}
+
+func (notifier *GitHubDeploymentsNotifier) DeployAborted(channelID string, d deploy.Deploy) {
+	desc := fmt.Sprintf("Aborted by %s", d.AbortedBy.Name)
+	if d.AbortReason != "" {
+		desc += ": " + d.AbortReason
+	}
+
+	notifier.setStatus(channelID, d, github.DeploymentStatusRequest{
+		State:       "failure",
+		Description: desc,
+	})
+}
+
+func (notifier *GitHubDeploymentsNotifier) setStatus(channelID string, d deploy.Deploy, st github.DeploymentStatusRequest) {
+	key := deploymentKey(channelID, d)
+	st.LogURL = notifier.historyURL(channelID, d)
+
+	notifier.mu.Lock()
+	entry, ok := notifier.deployments[key]
+	if !ok {
+		// keep the status until DeployStarted is called for this deploy
+		if len(d.PullRequests) > 0 {
+			notifier.forgetEarlyStatuses(time.Now().Add(-earlyStatusTTL))
+			notifier.early[key] = earlyStatus{Status: st, ReportedAt: time.Now()}
+		}
+		notifier.mu.Unlock()
+
+		return
+	}
+
+	if !entry.Created {
+		// the status is set by DeployStarted once deployments are created
+		entry.Status = &st
+		notifier.mu.Unlock()
+
+		return
+	}
+	delete(notifier.deployments, key)
+	notifier.mu.Unlock()
+
+	notifier.createStatuses(entry.Deployments, st)
+}
+
+// forgetEarlyStatuses removes statuses reported before given time for deploys that have never been started. The
+// caller is expected to hold notifier.mu.
+func (notifier *GitHubDeploymentsNotifier) forgetEarlyStatuses(before time.Time) {
+	for key, st := range notifier.early {
+		if st.ReportedAt.Before(before) {
+			delete(notifier.early, key)
+		}
+	}
+}
+
+func (notifier *GitHubDeploymentsNotifier) createStatuses(deployments []githubDeployment, st github.DeploymentStatusRequest) {
+	for _, deployment := range deployments {
+		if err := notifier.client.CreateDeploymentStatus(deployment.Repository, deployment.ID, st); err != nil {
+			log.Printf("failed to set the status of GitHub deployment %d in %s to %s: %s", deployment.ID, deployment.Repository, st.State, err)
+		}
+	}
+}
+
+func (notifier *GitHubDeploymentsNotifier) comment(channelID string, d deploy.Deploy) string {
+	comment := fmt.Sprintf("Deployed to %s by %s", notifier.Environment, d.User.Name)
+	if historyURL := notifier.historyURL(channelID, d); historyURL != "" {
+		comment += fmt.Sprintf(" ([deploy history](%s))", historyURL)
+	}
+
+	return comment
+}
+
+// historyURL returns the link to channel history dashboard starting from given deploy.
+func (notifier *GitHubDeploymentsNotifier) historyURL(channelID string, d deploy.Deploy) string {
+	if notifier.DashboardURL == "" {
+		return ""
+	}
+
+	u := &url.URL{Path: channelID}
+	u.RawQuery = url.Values{"since": {d.StartedAt.UTC().Format(time.RFC3339)}}.Encode()
+
+	return strings.TrimSuffix(notifier.DashboardURL, "/") + "/" + u.String()
+}
+
+// deploymentKey identifies a deploy in channel.
+func deploymentKey(channelID string, d deploy.Deploy) string {
+	return channelID + "/" + d.User.ID + "/" + d.Key()
+}
@@ -0,0 +1,278 @@
+package bot_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/bot"
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/github"
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type githubDeploymentsStub struct {
+	mu          sync.Mutex
+	Deployments []map[string]interface{}
+	Statuses    map[string][]map[string]interface{}
+	Comments    map[string][]string
+
+	// if set, requests to create a deployment are reported to Held and wait until Hold is closed
+	Hold, Held chan struct{}
+}
+
+func setupGitHubDeploymentsStub(t *testing.T) (*githubDeploymentsStub, *github.Client, func()) {
+	baseURL, mux, teardown := setupGitHubTestServer()
+
+	stub := &githubDeploymentsStub{
+		Statuses: make(map[string][]map[string]interface{}),
+		Comments: make(map[string][]string),
+	}
+
+	mux.HandleFunc("/repos/user1/repo1/pulls/1", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":1,"state":"open","head":{"sha":"sha1"}}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/pulls/2", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":2,"state":"open","head":{"sha":"sha2"}}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/deployments", func(w http.ResponseWriter, req *http.Request) {
+		if stub.Hold != nil {
+			stub.Held <- struct{}{}
+			<-stub.Hold
+		}
+
+		var payload map[string]interface{}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+
+		stub.mu.Lock()
+		stub.Deployments = append(stub.Deployments, payload)
+		stub.mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":10` + payload["ref"].(string)[3:] + `}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/deployments/", func(w http.ResponseWriter, req *http.Request) {
+		var payload map[string]interface{}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+
+		stub.mu.Lock()
+		stub.Statuses[req.URL.Path] = append(stub.Statuses[req.URL.Path], payload)
+		stub.mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/issues/", func(w http.ResponseWriter, req *http.Request) {
+		var payload struct {
+			Body string `json:"body"`
+		}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+
+		stub.mu.Lock()
+		stub.Comments[req.URL.Path] = append(stub.Comments[req.URL.Path], payload.Body)
+		stub.mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	})
+
+	client := github.NewClient("", nil)
+	client.BaseURL = baseURL
+
+	return stub, client, teardown
+}
+
+func TestGitHubDeploymentsNotifier_DeployCompleted(t *testing.T) {
+	stub, client, teardown := setupGitHubDeploymentsStub(t)
+	defer teardown()
+
+	notifier := bot.NewGitHubDeploymentsNotifier(client)
+
+	d := deploy.New(slack.User{ID: "U1", Name: "user1"}, "user1/repo1#1 and user1/repo1#2")
+	d.StartedAt = time.Date(2016, 8, 4, 9, 28, 0, 0, time.UTC)
+
+	notifier.DeployStarted("C1", d)
+
+	if assert.Len(t, stub.Deployments, 2) {
+		assert.Equal(t, map[string]interface{}{
+			"ref":               "sha1",
+			"environment":       "production",
+			"description":       "Deployed by user1 via Slack",
+			"auto_merge":        false,
+			"required_contexts": []interface{}{},
+		}, stub.Deployments[0])
+		assert.Equal(t, "sha2", stub.Deployments[1]["ref"])
+	}
+	assert.Empty(t, stub.Statuses)
+	assert.Empty(t, stub.Comments)
+
+	d.Finish()
+	d.FinishedBy = d.User
+	notifier.DeployCompleted("C1", d)
+
+	assert.Equal(t, map[string][]map[string]interface{}{
+		"/repos/user1/repo1/deployments/101/statuses": {{"state": "success", "description": "Finished by user1"}},
+		"/repos/user1/repo1/deployments/102/statuses": {{"state": "success", "description": "Finished by user1"}},
+	}, stub.Statuses)
+
+	// the status is only reported once
+	notifier.DeployCompleted("C1", d)
+	assert.Len(t, stub.Statuses["/repos/user1/repo1/deployments/101/statuses"], 1)
+}
+
+func TestGitHubDeploymentsNotifier_DeployCompleted_WhileCreatingDeployments(t *testing.T) {
+	stub, client, teardown := setupGitHubDeploymentsStub(t)
+	defer teardown()
+
+	stub.Hold, stub.Held = make(chan struct{}), make(chan struct{}, 1)
+
+	notifier := bot.NewGitHubDeploymentsNotifier(client)
+
+	d := deploy.New(slack.User{ID: "U1", Name: "user1"}, "user1/repo1#1")
+	d.StartedAt = time.Date(2016, 8, 4, 9, 28, 0, 0, time.UTC)
+
+	started := make(chan struct{})
+	go func() {
+		notifier.DeployStarted("C1", d)
+		close(started)
+	}()
+
+	select {
+	case <-stub.Held:
+	case <-time.After(10 * time.Second):
+		t.Fatal("deployment has not been requested")
+	}
+
+	d.Finish()
+	d.FinishedBy = d.User
+
+	completed := make(chan struct{})
+	go func() {
+		notifier.DeployCompleted("C1", d)
+		close(completed)
+	}()
+
+	select {
+	case <-completed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("DeployCompleted is blocked by DeployStarted")
+	}
+
+	close(stub.Hold)
+	<-started
+
+	assert.Equal(t, map[string][]map[string]interface{}{
+		"/repos/user1/repo1/deployments/101/statuses": {{"state": "success", "description": "Finished by user1"}},
+	}, stub.Statuses)
+}
+
+func TestGitHubDeploymentsNotifier_DeployCompleted_BeforeStarted(t *testing.T) {
+	stub, client, teardown := setupGitHubDeploymentsStub(t)
+	defer teardown()
+
+	notifier := bot.NewGitHubDeploymentsNotifier(client)
+
+	d := deploy.New(slack.User{ID: "U1", Name: "user1"}, "user1/repo1#1")
+	d.StartedAt = time.Date(2016, 8, 4, 9, 28, 0, 0, time.UTC)
+
+	completed := d
+	completed.Finish()
+	completed.FinishedBy = d.User
+
+	// event handlers run concurrently, so the completion may be handled first
+	notifier.DeployCompleted("C1", completed)
+	notifier.DeployStarted("C1", d)
+
+	assert.Len(t, stub.Deployments, 1)
+	assert.Equal(t, map[string][]map[string]interface{}{
+		"/repos/user1/repo1/deployments/101/statuses": {{"state": "success", "description": "Finished by user1"}},
+	}, stub.Statuses)
+
+	// the status is only reported once
+	notifier.DeployCompleted("C1", completed)
+	assert.Len(t, stub.Statuses["/repos/user1/repo1/deployments/101/statuses"], 1)
+}
+
+func TestGitHubDeploymentsNotifier_DeployAborted(t *testing.T) {
+	stub, client, teardown := setupGitHubDeploymentsStub(t)
+	defer teardown()
+
+	notifier := bot.NewGitHubDeploymentsNotifier(client)
+	notifier.Environment = "staging"
+	notifier.CommentOnPullRequests = true
+	notifier.DashboardURL = "https://deploy.example.com/"
+
+	d := deploy.New(slack.User{ID: "U1", Name: "user1"}, "user1/repo1#1")
+	d.StartedAt = time.Date(2016, 8, 4, 9, 28, 0, 0, time.UTC)
+
+	notifier.DeployStarted("C1", d)
+
+	if assert.Len(t, stub.Deployments, 1) {
+		assert.Equal(t, "staging", stub.Deployments[0]["environment"])
+	}
+
+	assert.Equal(t, map[string][]string{
+		"/repos/user1/repo1/issues/1/comments": {"Deployed to staging by user1 ([deploy history](https://deploy.example.com/C1?since=2016-08-04T09%3A28%3A00Z))"},
+	}, stub.Comments)
+
+	d.Aborted, d.AbortReason, d.AbortedBy = true, "tests failed", slack.User{ID: "U2", Name: "user2"}
+	notifier.DeployAborted("C1", d)
+
+	assert.Equal(t, map[string][]map[string]interface{}{
+		"/repos/user1/repo1/deployments/101/statuses": {{
+			"state":       "failure",
+			"description": "Aborted by user2: tests failed",
+			"log_url":     "https://deploy.example.com/C1?since=2016-08-04T09%3A28%3A00Z",
+		}},
+	}, stub.Statuses)
+}
+
+func TestGitHubDeploymentsNotifier_SameSecond(t *testing.T) {
+	stub, client, teardown := setupGitHubDeploymentsStub(t)
+	defer teardown()
+
+	notifier := bot.NewGitHubDeploymentsNotifier(client)
+
+	// the deploy is replaced within the same second
+	d1 := deploy.New(slack.User{ID: "U1", Name: "user1"}, "user1/repo1#1")
+	d1.StartedAt = time.Date(2016, 8, 4, 9, 28, 0, 0, time.UTC)
+
+	d2 := deploy.New(slack.User{ID: "U1", Name: "user1"}, "user1/repo1#2")
+	d2.StartedAt = d1.StartedAt.Add(time.Millisecond)
+
+	notifier.DeployStarted("C1", d1)
+	notifier.DeployStarted("C1", d2)
+
+	d1.Finish()
+	d1.FinishedBy = d1.User
+	notifier.DeployCompleted("C1", d1)
+
+	d2.Abort("")
+	d2.AbortedBy = d2.User
+	notifier.DeployAborted("C1", d2)
+
+	assert.Equal(t, map[string][]map[string]interface{}{
+		"/repos/user1/repo1/deployments/101/statuses": {{"state": "success", "description": "Finished by user1"}},
+		"/repos/user1/repo1/deployments/102/statuses": {{"state": "failure", "description": "Aborted by user1"}},
+	}, stub.Statuses)
+}
+
+func TestGitHubDeploymentsNotifier_NoPullRequests(t *testing.T) {
+	stub, client, teardown := setupGitHubDeploymentsStub(t)
+	defer teardown()
+
+	notifier := bot.NewGitHubDeploymentsNotifier(client)
+
+	d := deploy.New(slack.User{ID: "U1", Name: "user1"}, "hotfix")
+	d.StartedAt = time.Now()
+
+	notifier.DeployStarted("C1", d)
+	notifier.DeployCompleted("C1", d)
+
+	assert.Empty(t, stub.Deployments)
+	assert.Empty(t, stub.Statuses)
+}
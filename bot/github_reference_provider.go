@@ -0,0 +1,201 @@
+package bot
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/github"
+	"github.com/andrewslotin/michael/slack"
+)
+
+// GitHubReferenceProvider recognizes GitHub pull requests, commits, tags and commit ranges mentioned in deploy
+// subjects, fetches pull requests along with their checks and commit range comparisons, and renders them in deploy
+// announcements. Commits and tags are only indexed. Links to a GitHub Enterprise Server installation are recognized
+// if the client is configured to use one.
+type GitHubReferenceProvider struct {
+	*deploy.GitHubReferences
+
+	// MaxRangeItems is the number of pull requests and commits listed for a commit range
+	MaxRangeItems int
+
+	client *github.Client
+}
+
+// NewGitHubReferenceProvider returns an instance of *GitHubReferenceProvider that recognizes links to client.WebURL
+// in addition to github.com ones.
+func NewGitHubReferenceProvider(client *github.Client) *GitHubReferenceProvider {
+	p := &GitHubReferenceProvider{MaxRangeItems: DefaultMaxRangeItems}
+	p.setClient(client)
+
+	return p
+}
+
+// setClient makes p fetch references using client and recognize links to its host.
+func (p *GitHubReferenceProvider) setClient(client *github.Client) {
+	var hosts []string
+	if u, err := url.Parse(client.WebURL); err == nil && u.Host != "" && u.Host != "github.com" {
+		hosts = append(hosts, u.Host)
+	}
+
+	p.GitHubReferences, p.client = deploy.NewGitHubReferences(hosts...), client
+}
+
+func (p *GitHubReferenceProvider) Name() string {
+	return deploy.GitHubReferenceProviderName
+}
+
+// FindReferences returns pull requests and commit ranges mentioned in s. Reference IDs are formatted as
+// owner/repo#12 and owner/repo@base...head.
+func (p *GitHubReferenceProvider) FindReferences(s string) []deploy.Reference {
+	var refs []deploy.Reference
+	for _, ref := range p.FindPullRequestReferences(s) {
+		refs = append(refs, p.pullRequestReference(ref))
+	}
+
+	for _, ref := range p.FindRangeReferences(s) {
+		refs = append(refs, p.rangeReference(ref))
+	}
+
+	return refs
+}
+
+// DeployReferences returns pull requests and commit ranges mentioned in deploy subject.
+func (p *GitHubReferenceProvider) DeployReferences(d deploy.Deploy) []deploy.Reference {
+	var refs []deploy.Reference
+	for _, ref := range d.PullRequests {
+		refs = append(refs, p.pullRequestReference(ref))
+	}
+
+	for _, ref := range d.Ranges {
+		refs = append(refs, p.rangeReference(ref))
+	}
+
+	return refs
+}
+
+func (p *GitHubReferenceProvider) pullRequestReference(ref deploy.PullRequestReference) deploy.Reference {
+	return deploy.Reference{
+		Provider: deploy.GitHubReferenceProviderName,
+		ID:       ref.String(),
+		URL:      p.client.WebURL + "/" + ref.Repository + "/pulls/" + ref.ID,
+	}
+}
+
+func (p *GitHubReferenceProvider) rangeReference(ref deploy.RangeReference) deploy.Reference {
+	return deploy.Reference{
+		Provider: deploy.GitHubReferenceProviderName,
+		ID:       ref.String(),
+		URL:      p.client.WebURL + "/" + ref.Repository + "/compare/" + ref.Base + "..." + ref.Head,
+	}
+}
+
+// Resolve fetches a pull request along with its checks or a commit range comparison. The details keep
+// the fetched github.PullRequest or github.Comparison in Raw.
+func (p *GitHubReferenceProvider) Resolve(ref deploy.Reference) (deploy.ReferenceDetails, error) {
+	if prs := p.FindPullRequestReferences(ref.ID); len(prs) > 0 {
+		pr, err := fetchPullRequest(p.client, prs[0])
+		if err != nil {
+			return deploy.ReferenceDetails{}, err
+		}
+
+		return deploy.ReferenceDetails{
+			Title:       pr.Title,
+			Description: pr.Body,
+			Author:      pr.Author.Name,
+			State:       pr.State,
+			Done:        pr.Merged,
+			URL:         pr.URL,
+			Raw:         pr,
+		}, nil
+	}
+
+	if ranges := p.FindRangeReferences(ref.ID); len(ranges) > 0 {
+		cmp, err := p.client.CompareCommits(ranges[0].Repository, ranges[0].Base, ranges[0].Head)
+		if err != nil {
+			return deploy.ReferenceDetails{}, err
+		}
+
+		return deploy.ReferenceDetails{Title: ref.ID, URL: cmp.URL, Raw: cmp}, nil
+	}
+
+	return deploy.ReferenceDetails{}, fmt.Errorf("unsupported GitHub reference %q", ref.ID)
+}
+
+// Attachment describes a pull request along with the problems that may prevent it from being deployed or lists
+// the pull requests and commits of a commit range.
+func (p *GitHubReferenceProvider) Attachment(ref deploy.Reference, details deploy.ReferenceDetails) slack.Attachment {
+	switch raw := details.Raw.(type) {
+	case github.PullRequest:
+		return p.pullRequestAttachment(raw)
+	case github.Comparison:
+		if ranges := p.FindRangeReferences(ref.ID); len(ranges) > 0 {
+			return p.rangeAttachment(ranges[0], raw)
+		}
+	}
+
+	return slack.Attachment{Title: ref.String(), TitleLink: ref.URL}
+}
+
+// pullRequestAttachment describes a pull request along with the problems that may prevent it from being deployed.
+func (p *GitHubReferenceProvider) pullRequestAttachment(pr github.PullRequest) slack.Attachment {
+	problems := pullRequestProblems(pr)
+
+	text := slack.ConvertMarkdown(pr.Body)
+	if len(problems) > 0 {
+		lines := make([]string, len(problems))
+		for i, problem := range problems {
+			lines[i] = problem.String()
+		}
+
+		text = strings.TrimSpace(strings.Join(lines, "\n") + "\n\n" + text)
+	}
+
+	return slack.Attachment{
+		AuthorName: pr.Author.Name,
+		Title:      fmt.Sprintf("PR #%d: %s", pr.Number, slack.EscapeMessage(pr.Title)),
+		TitleLink:  pr.URL,
+		Text:       text,
+		Markdown:   true,
+		Color:      pullRequestColor(pr, problems),
+	}
+}
+
+// rangeAttachment lists pull requests merged within a commit range followed by the rest of commits. The list is
+// truncated to p.MaxRangeItems entries.
+func (p *GitHubReferenceProvider) rangeAttachment(ref deploy.RangeReference, cmp github.Comparison) slack.Attachment {
+	var prs, commits []string
+	for _, c := range cmp.Commits {
+		if n, ok := c.PullRequestNumber(); ok {
+			title := strings.TrimSuffix(c.Title(), fmt.Sprintf(" (#%d)", n))
+			prs = append(prs, fmt.Sprintf(rangePullRequestItem, p.client.WebURL, ref.Repository, n, n, slack.EscapeMessage(title)))
+			continue
+		}
+
+		sha := deploy.CommitReference{SHA: c.SHA}.ShortSHA()
+		commits = append(commits, fmt.Sprintf(rangeCommitItem, c.URL, sha, slack.EscapeMessage(c.Title()), slack.EscapeMessage(c.AuthorName())))
+	}
+
+	lines := append(prs, commits...)
+	if p.MaxRangeItems > 0 && len(lines) > p.MaxRangeItems {
+		lines = lines[:p.MaxRangeItems]
+	}
+
+	// GitHub returns at most 250 commits, so the total number is used to tell how many were left out
+	if hidden := cmp.TotalCommits - len(lines); hidden > 0 {
+		lines = append(lines, fmt.Sprintf(rangeMoreItems, pluralize(hidden, "more commit")))
+	}
+
+	link := cmp.URL
+	if link == "" {
+		link = p.rangeReference(ref).URL
+	}
+
+	return slack.Attachment{
+		Title:     fmt.Sprintf(rangeTitle, ref, pluralize(cmp.TotalCommits, "commit")),
+		TitleLink: link,
+		Text:      strings.Join(lines, "\n"),
+		Markdown:  true,
+	}
+}
@@ -0,0 +1,62 @@
+package bot_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/andrewslotin/michael/bot"
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitHubReferenceProvider_FindReferences(t *testing.T) {
+	client := github.NewClient("", nil)
+	client.WebURL = "https://github.example.com"
+
+	p := bot.NewGitHubReferenceProvider(client)
+
+	s := "https://github.example.com/org/api/pull/1 org/api@v1.2...v1.3 org/api@7fd1a60 https://github.com/org/web/pull/2"
+	assert.Equal(t, []deploy.Reference{
+		{Provider: "github", ID: "org/api#1", URL: "https://github.example.com/org/api/pulls/1"},
+		{Provider: "github", ID: "org/web#2", URL: "https://github.example.com/org/web/pulls/2"},
+		{Provider: "github", ID: "org/api@v1.2...v1.3", URL: "https://github.example.com/org/api/compare/v1.2...v1.3"},
+	}, p.FindReferences(s))
+
+	// links to GitHub Enterprise Server are only recognized by the provider configured to use it
+	assert.Empty(t, bot.NewGitHubReferenceProvider(github.NewClient("", nil)).FindReferences("https://github.example.com/org/api/pull/1"))
+}
+
+func TestGitHubReferenceProvider_Resolve(t *testing.T) {
+	baseURL, mux, teardown := setupGitHubTestServer()
+	defer teardown()
+
+	mux.HandleFunc("/repos/org/api/pulls/1", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":1,"title":"Hello","body":"PR description","html_url":"https://github.com/org/api/pull/1","state":"closed","merged":true,"user":{"login":"author1"}}`))
+	})
+
+	client := github.NewClient("", nil)
+	client.BaseURL = baseURL
+
+	p := bot.NewGitHubReferenceProvider(client)
+
+	refs := p.FindReferences("org/api#1")
+	require.Len(t, refs, 1)
+
+	details, err := p.Resolve(refs[0])
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hello", details.Title)
+	assert.Equal(t, "PR description", details.Description)
+	assert.Equal(t, "author1", details.Author)
+	assert.True(t, details.Done)
+
+	attachment := p.Attachment(refs[0], details)
+	assert.Equal(t, "PR #1: Hello", attachment.Title)
+	assert.Equal(t, "https://github.com/org/api/pull/1", attachment.TitleLink)
+	assert.Equal(t, "good", attachment.Color)
+
+	_, err = p.Resolve(deploy.Reference{Provider: "github", ID: "org/api"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/andrewslotin/michael/deploy"
+)
+
+// DefaultHTTPCheckTimeout limits the time HTTPCheckGate waits for a response. Slack expects slash commands
+// to respond within 3 seconds.
+const DefaultHTTPCheckTimeout = 2 * time.Second
+
+// HTTPCheckGate asks an HTTP endpoint whether a deploy is allowed to start. The endpoint receives a GET request with
+// channel_id, user_id, user_name and subject query parameters and is expected to respond with a JSON object
+// {"decision": "allow|warn|deny", "message": "..."}. If the response does not contain a decision, any 2xx response
+// allows the deploy and the rest deny it. Deploys are denied if the endpoint is unreachable.
+type HTTPCheckGate struct {
+	URL string
+
+	client *http.Client
+}
+
+// NewHTTPCheckGate returns an instance of *HTTPCheckGate that sends requests to checkURL using client. If client
+// is nil, a client with DefaultHTTPCheckTimeout is used.
+func NewHTTPCheckGate(checkURL string, client *http.Client) *HTTPCheckGate {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultHTTPCheckTimeout}
+	}
+
+	return &HTTPCheckGate{
+		URL:    checkURL,
+		client: client,
+	}
+}
+
+type httpCheckResponse struct {
+	Decision string `json:"decision"`
+	Message  string `json:"message"`
+}
+
+// Check requests the endpoint and returns its decision. The deploy is denied if the endpoint has not responded
+// before ctx is done.
+func (g *HTTPCheckGate) Check(ctx context.Context, channelID string, d deploy.Deploy) GateResult {
+	u, err := url.Parse(g.URL)
+	if err != nil {
+		return g.deny(fmt.Sprintf("malformed check URL (%s)", err))
+	}
+
+	q := u.Query()
+	q.Set("channel_id", channelID)
+	q.Set("user_id", d.User.ID)
+	q.Set("user_name", d.User.Name)
+	q.Set("subject", d.Subject)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return g.deny(fmt.Sprintf("malformed check URL (%s)", err))
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return g.deny(fmt.Sprintf("request failed (%s)", err))
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return g.deny(fmt.Sprintf("failed to read response body (%s)", err))
+	}
+
+	var v httpCheckResponse
+	if json.Unmarshal(body, &v) == nil && v.Decision != "" {
+		decision, err := ParseGateDecision(v.Decision)
+		if err != nil {
+			return g.deny(err.Error())
+		}
+
+		return GateResult{Decision: decision, Message: v.Message}
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return Allow()
+	}
+
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		msg = resp.Status
+	}
+
+	return GateResult{Decision: GateDeny, Message: msg}
+}
+
+func (g *HTTPCheckGate) deny(reason string) GateResult {
+	return GateResult{
+		Decision: GateDeny,
+		Message:  "Deploy check " + g.URL + " failed: " + reason,
+	}
+}
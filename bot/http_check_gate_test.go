@@ -0,0 +1,83 @@
+package bot_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/bot"
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPCheckGate_Check(t *testing.T) {
+	var query map[string][]string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+
+		switch r.URL.Path {
+		case "/ok":
+		case "/warn":
+			w.Write([]byte(`{"decision": "warn", "message": "CI is flaky"}`))
+		case "/incident":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"decision": "deny", "message": "There is an open incident"}`))
+		case "/red":
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("CI is red\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	d := deploy.New(slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1")
+
+	res := bot.NewHTTPCheckGate(srv.URL+"/ok", nil).Check(context.Background(), "C1", d)
+	assert.Equal(t, bot.Allow(), res)
+	assert.Equal(t, []string{"C1"}, query["channel_id"])
+	assert.Equal(t, []string{"U1"}, query["user_id"])
+	assert.Equal(t, []string{"user1"}, query["user_name"])
+	assert.Equal(t, []string{"octocat/helloworld#1"}, query["subject"])
+
+	res = bot.NewHTTPCheckGate(srv.URL+"/warn", nil).Check(context.Background(), "C1", d)
+	assert.Equal(t, bot.GateResult{Decision: bot.GateWarn, Message: "CI is flaky"}, res)
+
+	res = bot.NewHTTPCheckGate(srv.URL+"/incident", nil).Check(context.Background(), "C1", d)
+	assert.Equal(t, bot.GateResult{Decision: bot.GateDeny, Message: "There is an open incident"}, res)
+
+	res = bot.NewHTTPCheckGate(srv.URL+"/red", nil).Check(context.Background(), "C1", d)
+	assert.Equal(t, bot.GateResult{Decision: bot.GateDeny, Message: "CI is red"}, res)
+}
+
+func TestHTTPCheckGate_Check_Deadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	res := bot.NewHTTPCheckGate(srv.URL, nil).Check(ctx, "C1", deploy.New(slack.User{ID: "U1", Name: "user1"}, "subject"))
+	assert.WithinDuration(t, start, time.Now(), 500*time.Millisecond)
+	assert.Equal(t, bot.GateDeny, res.Decision)
+	assert.Contains(t, res.Message, "request failed")
+}
+
+func TestHTTPCheckGate_Check_Unreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	res := bot.NewHTTPCheckGate(srv.URL, nil).Check(context.Background(), "C1", deploy.New(slack.User{ID: "U1", Name: "user1"}, "subject"))
+	assert.Equal(t, bot.GateDeny, res.Decision)
+	assert.Contains(t, res.Message, "request failed")
+}
@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/andrewslotin/michael/deploy"
+)
+
+// lookup is a value being fetched in background for a key, i.e. the details of a reference mentioned
+// in deploy subject.
+type lookup struct {
+	Key interface{}
+
+	value interface{}
+	err   error
+	done  chan struct{}
+}
+
+// startLookups starts fetching values for keys running at most concurrency fetches at once. Lookups are returned
+// in the same order as keys.
+func startLookups(keys []interface{}, concurrency int, fetch func(key interface{}) (interface{}, error)) []*lookup {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	sem := make(chan struct{}, concurrency)
+
+	lookups := make([]*lookup, len(keys))
+	for i, key := range keys {
+		l := &lookup{Key: key, done: make(chan struct{})}
+		lookups[i] = l
+
+		go func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			l.value, l.err = fetch(l.Key)
+			close(l.done)
+		}()
+	}
+
+	return lookups
+}
+
+// Wait blocks until the value is fetched or ctx is done. The second value is false if the lookup has not
+// finished in time.
+func (l *lookup) Wait(ctx context.Context) (interface{}, bool, error) {
+	select {
+	case <-l.done:
+		return l.value, true, l.err
+	case <-ctx.Done():
+	}
+
+	// the lookup could have finished at the same time as the deadline was exceeded
+	select {
+	case <-l.done:
+		return l.value, true, l.err
+	default:
+		return nil, false, nil
+	}
+}
+
+// lookupReferences starts fetching the details of references using their providers. See startLookups for details.
+func lookupReferences(providers *deploy.ReferenceProviders, refs []deploy.Reference, concurrency int) []*lookup {
+	keys := make([]interface{}, len(refs))
+	for i, ref := range refs {
+		keys[i] = ref
+	}
+
+	return startLookups(keys, concurrency, func(ref interface{}) (interface{}, error) {
+		return resolveReference(providers, ref.(deploy.Reference))
+	})
+}
+
+// resolveReference fetches the details of reference using the provider that has recognized it.
+func resolveReference(providers *deploy.ReferenceProviders, ref deploy.Reference) (deploy.ReferenceDetails, error) {
+	p, ok := providers.Lookup(ref.Provider)
+	if !ok {
+		return deploy.ReferenceDetails{}, fmt.Errorf("no reference provider %q registered", ref.Provider)
+	}
+
+	return p.Resolve(ref)
+}
@@ -0,0 +1,123 @@
+package bot
+
+import "fmt"
+
+// Action is a deploy command that requires a permission.
+type Action int
+
+const (
+	ActionStart Action = iota
+	ActionFinishOthers
+	ActionAbortOthers
+	ActionViewHistory
+	ActionManageRoles
+	ActionConfigure
+	ActionApprove
+	ActionForce
+	ActionLock
+)
+
+var actionDescriptions = [...]string{
+	ActionStart:        "start deploys",
+	ActionFinishOthers: "finish deploys started by others",
+	ActionAbortOthers:  "abort deploys started by others",
+	ActionViewHistory:  "view deploy history",
+	ActionManageRoles:  "manage roles",
+	ActionConfigure:    "change channel settings",
+	ActionApprove:      "approve deploys",
+	ActionForce:        "start deploys denied by deploy gates",
+	ActionLock:         "lock and unlock deploys",
+}
+
+func (a Action) String() string {
+	if a < 0 || int(a) >= len(actionDescriptions) {
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+
+	return actionDescriptions[a]
+}
+
+// DefaultPermissionRules maps actions to the least role required to perform them.
+var DefaultPermissionRules = map[Action]Role{
+	ActionStart:        RoleDeployer,
+	ActionFinishOthers: RoleMaintainer,
+	ActionAbortOthers:  RoleMaintainer,
+	ActionViewHistory:  RoleDeployer,
+	ActionManageRoles:  RoleAdmin,
+	ActionConfigure:    RoleAdmin,
+	ActionApprove:      RoleDeployer,
+	ActionForce:        RoleMaintainer,
+	ActionLock:         RoleMaintainer,
+}
+
+// Permissions decides whether a user is allowed to perform an action in channel based on their role.
+type Permissions struct {
+	// DefaultRole is the role of users who have not been granted any role in channel.
+	DefaultRole Role
+	// Rules maps actions to the least role required to perform them. Actions missing from this map
+	// require RoleAdmin.
+	Rules map[Action]Role
+
+	roles RoleStore
+}
+
+// NewPermissions returns an instance of *Permissions that looks up granted roles in roles store. By default
+// everyone is a deployer in any channel.
+func NewPermissions(roles RoleStore) *Permissions {
+	return &Permissions{
+		DefaultRole: RoleDeployer,
+		Rules:       DefaultPermissionRules,
+		roles:       roles,
+	}
+}
+
+// Role returns the role of user in channel.
+func (p *Permissions) Role(channelID, userID string) (Role, error) {
+	role, ok, err := p.roles.Role(channelID, userID)
+	if err != nil {
+		return RoleNone, fmt.Errorf("failed to get role of %s in %s: %s", userID, channelID, err)
+	}
+
+	if !ok {
+		return p.DefaultRole, nil
+	}
+
+	return role, nil
+}
+
+// RequiredRole returns the least role required to perform an action.
+func (p *Permissions) RequiredRole(action Action) Role {
+	if role, ok := p.Rules[action]; ok {
+		return role
+	}
+
+	return RoleAdmin
+}
+
+// Allowed returns true if user is allowed to perform an action in channel.
+func (p *Permissions) Allowed(channelID, userID string, action Action) (bool, error) {
+	role, err := p.Role(channelID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return role >= p.RequiredRole(action), nil
+}
+
+// Grant grants a role to user in channel.
+func (p *Permissions) Grant(channelID, userID string, role Role) error {
+	if err := p.roles.SetRole(channelID, userID, role); err != nil {
+		return fmt.Errorf("failed to grant %s role to %s in %s: %s", role, userID, channelID, err)
+	}
+
+	return nil
+}
+
+// Revoke removes the role granted to user in channel, so that they fall back to the default role.
+func (p *Permissions) Revoke(channelID, userID string) error {
+	if err := p.roles.RemoveRole(channelID, userID); err != nil {
+		return fmt.Errorf("failed to revoke role of %s in %s: %s", userID, channelID, err)
+	}
+
+	return nil
+}
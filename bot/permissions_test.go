@@ -0,0 +1,78 @@
+package bot_test
+
+import (
+	"testing"
+
+	"github.com/andrewslotin/michael/bot"
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermissions_Allowed(t *testing.T) {
+	permissions := bot.NewPermissions(bot.NewRecordRoleStore(deploy.NewInMemoryStore()))
+	require.NoError(t, permissions.Grant("C1", "maintainer", bot.RoleMaintainer))
+	require.NoError(t, permissions.Grant("C1", "admin", bot.RoleAdmin))
+	require.NoError(t, permissions.Grant("C1", "banned", bot.RoleNone))
+
+	examples := map[string]map[bot.Action]bool{
+		"default": {
+			bot.ActionStart:        true,
+			bot.ActionFinishOthers: false,
+			bot.ActionAbortOthers:  false,
+			bot.ActionViewHistory:  true,
+			bot.ActionManageRoles:  false,
+			bot.ActionLock:         false,
+		},
+		"maintainer": {
+			bot.ActionStart:        true,
+			bot.ActionFinishOthers: true,
+			bot.ActionAbortOthers:  true,
+			bot.ActionViewHistory:  true,
+			bot.ActionManageRoles:  false,
+			bot.ActionLock:         true,
+		},
+		"admin": {
+			bot.ActionStart:        true,
+			bot.ActionFinishOthers: true,
+			bot.ActionAbortOthers:  true,
+			bot.ActionViewHistory:  true,
+			bot.ActionManageRoles:  true,
+			bot.ActionLock:         true,
+		},
+		"banned": {
+			bot.ActionStart:        false,
+			bot.ActionFinishOthers: false,
+			bot.ActionAbortOthers:  false,
+			bot.ActionViewHistory:  false,
+			bot.ActionManageRoles:  false,
+			bot.ActionLock:         false,
+		},
+	}
+
+	for userID, actions := range examples {
+		for action, expected := range actions {
+			allowed, err := permissions.Allowed("C1", userID, action)
+			require.NoError(t, err)
+			assert.Equal(t, expected, allowed, "%s to %s", userID, action)
+		}
+	}
+}
+
+func TestPermissions_CustomRules(t *testing.T) {
+	permissions := bot.NewPermissions(bot.NewRecordRoleStore(deploy.NewInMemoryStore()))
+	permissions.DefaultRole = bot.RoleNone
+	permissions.Rules = map[bot.Action]bot.Role{
+		bot.ActionViewHistory: bot.RoleNone,
+	}
+
+	allowed, err := permissions.Allowed("C1", "U1", bot.ActionViewHistory)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, err = permissions.Allowed("C1", "U1", bot.ActionStart)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	assert.Equal(t, bot.RoleAdmin, permissions.RequiredRole(bot.ActionStart), "expected actions without rules to require admin role")
+}
@@ -0,0 +1,181 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/github"
+)
+
+// pullRequestProblem is a reason why a pull request may not be ready to deploy.
+type pullRequestProblem struct {
+	Emoji string
+	Text  string
+	// Severe problems are highlighted with red color in deploy announcement
+	Severe bool
+}
+
+func (p pullRequestProblem) String() string {
+	return p.Emoji + " " + p.Text
+}
+
+// pullRequestProblems checks the state of a pull request along with its commit statuses and check runs.
+func pullRequestProblems(pr github.PullRequest) []pullRequestProblem {
+	var problems []pullRequestProblem
+
+	switch {
+	case pr.Closed():
+		problems = append(problems, pullRequestProblem{":no_entry_sign:", "closed without merging", true})
+	case pr.Draft:
+		problems = append(problems, pullRequestProblem{":construction:", "draft", false})
+	case pr.State == "open":
+		problems = append(problems, pullRequestProblem{":warning:", "not merged", false})
+	}
+
+	if n := pr.FailingChecks(); n > 0 {
+		problems = append(problems, pullRequestProblem{":x:", pluralize(n, "check") + " failing", true})
+	}
+
+	if n := pr.PendingChecks(); n > 0 {
+		problems = append(problems, pullRequestProblem{":hourglass:", pluralize(n, "check") + " pending", false})
+	}
+
+	return problems
+}
+
+// pullRequestColor returns the color of deploy announcement attachment for a pull request.
+func pullRequestColor(pr github.PullRequest, problems []pullRequestProblem) string {
+	for _, p := range problems {
+		if p.Severe {
+			return "danger"
+		}
+	}
+
+	if len(problems) > 0 {
+		return "warning"
+	}
+
+	if pr.Merged {
+		return "good"
+	}
+
+	return ""
+}
+
+// fetchPullRequest returns a pull request along with its commit statuses and check runs. The checks are
+// omitted if GitHub fails to return them.
+func fetchPullRequest(client *github.Client, ref deploy.PullRequestReference) (github.PullRequest, error) {
+	pr, err := client.GetPullRequest(ref.Repository, ref.ID)
+	if err != nil {
+		return pr, err
+	}
+
+	if pr.Head.SHA != "" {
+		if err := client.GetPullRequestChecks(ref.Repository, &pr); err != nil {
+			log.Printf("failed to get checks of %s#%s: %s", ref.Repository, ref.ID, err)
+		}
+	}
+
+	return pr, nil
+}
+
+func pluralize(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// DefaultPullRequestGateTimeout limits the time PullRequestGate waits for GitHub. Slack expects slash commands
+// to respond within 3 seconds.
+const DefaultPullRequestGateTimeout = 2 * time.Second
+
+// PullRequestGate denies deploys of pull requests that are not merged, closed or have failing checks.
+type PullRequestGate struct {
+	// Timeout limits the time to wait for pull request details
+	Timeout time.Duration
+	// TimeoutDecision is returned if some of pull requests have not been fetched in time
+	TimeoutDecision    GateDecision
+	MaxParallelLookups int
+
+	client *github.Client
+}
+
+// NewPullRequestGate returns an instance of *PullRequestGate that looks up pull requests using GitHub client. By
+// default it waits for DefaultPullRequestGateTimeout and denies deploys if GitHub has not responded in time.
+func NewPullRequestGate(client *github.Client) *PullRequestGate {
+	return &PullRequestGate{
+		Timeout:            DefaultPullRequestGateTimeout,
+		TimeoutDecision:    GateDeny,
+		MaxParallelLookups: DefaultMaxParallelLookups,
+		client:             client,
+	}
+}
+
+// Check denies the deploy if any of the pull requests mentioned in deploy subject is not ready to deploy. Pull
+// requests that have not been fetched within the timeout or before ctx is done result in g.TimeoutDecision.
+func (g *PullRequestGate) Check(ctx context.Context, channelID string, d deploy.Deploy) GateResult {
+	ctx, cancel := context.WithTimeout(ctx, g.Timeout)
+	defer cancel()
+
+	refs := make([]interface{}, len(d.PullRequests))
+	for i, ref := range d.PullRequests {
+		refs[i] = ref
+	}
+
+	lookups := startLookups(refs, g.MaxParallelLookups, func(ref interface{}) (interface{}, error) {
+		return fetchPullRequest(g.client, ref.(deploy.PullRequestReference))
+	})
+
+	var notReady, notFetched []string
+	for _, l := range lookups {
+		ref := l.Key.(deploy.PullRequestReference)
+
+		v, ok, err := l.Wait(ctx)
+		if !ok {
+			log.Printf("%s#%s has not been fetched within %s", ref.Repository, ref.ID, g.Timeout)
+			notFetched = append(notFetched, ref.Repository+"#"+ref.ID)
+			continue
+		}
+
+		if err != nil {
+			log.Printf("failed to get %s#%s: %s", ref.Repository, ref.ID, err)
+			notReady = append(notReady, ref.Repository+"#"+ref.ID+" (failed to get pull request)")
+			continue
+		}
+
+		problems := pullRequestProblems(v.(github.PullRequest))
+		if len(problems) == 0 {
+			continue
+		}
+
+		texts := make([]string, len(problems))
+		for i, p := range problems {
+			texts[i] = p.Text
+		}
+
+		notReady = append(notReady, ref.Repository+"#"+ref.ID+" ("+strings.Join(texts, ", ")+")")
+	}
+
+	switch {
+	case len(notReady) > 0:
+		msg := "Pull requests are not ready to deploy: " + strings.Join(notReady, ", ")
+		if len(notFetched) > 0 {
+			msg += ". GitHub has not responded in time for " + strings.Join(notFetched, ", ")
+		}
+
+		return GateResult{Decision: GateDeny, Message: msg}
+	case len(notFetched) > 0:
+		return GateResult{
+			Decision: g.TimeoutDecision,
+			Message:  "Could not check whether pull requests are ready to deploy, GitHub has not responded in time for " + strings.Join(notFetched, ", "),
+		}
+	default:
+		return Allow()
+	}
+}
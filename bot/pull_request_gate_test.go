@@ -0,0 +1,88 @@
+package bot_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/bot"
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/github"
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPullRequestGate_Check(t *testing.T) {
+	baseURL, mux, teardown := setupGitHubTestServer()
+	defer teardown()
+
+	mux.HandleFunc("/repos/user1/repo1/pulls/1", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":1,"state":"closed","merged":true}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/pulls/2", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":2,"state":"closed","merged":false}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/pulls/3", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":3,"state":"open","draft":true}`))
+	})
+
+	githubClient := github.NewClient("", nil)
+	githubClient.BaseURL = baseURL
+
+	gate := bot.NewPullRequestGate(githubClient)
+
+	res := gate.Check(context.Background(), "C1", deploy.New(slack.User{ID: "abc123", Name: "user1"}, "user1/repo1#1"))
+	assert.Equal(t, bot.Allow(), res)
+
+	res = gate.Check(context.Background(), "C1", deploy.New(slack.User{ID: "abc123", Name: "user1"}, "user1/repo1#1 user1/repo1#2 user1/repo1#3"))
+	assert.Equal(t, bot.GateResult{
+		Decision: bot.GateDeny,
+		Message:  "Pull requests are not ready to deploy: user1/repo1#2 (closed without merging), user1/repo1#3 (draft)",
+	}, res)
+}
+
+func TestPullRequestGate_Check_Timeout(t *testing.T) {
+	baseURL, mux, teardown := setupGitHubTestServer()
+	defer teardown()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	mux.HandleFunc("/repos/user1/repo1/pulls/1", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":1,"state":"closed","merged":true}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/pulls/2", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":2,"state":"closed","merged":false}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/pulls/3", func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		w.Write([]byte(`{"number":3,"state":"closed","merged":true}`))
+	})
+
+	githubClient := github.NewClient("", nil)
+	githubClient.BaseURL = baseURL
+
+	gate := bot.NewPullRequestGate(githubClient)
+	gate.Timeout = 50 * time.Millisecond
+	gate.TimeoutDecision = bot.GateWarn
+
+	start := time.Now()
+	res := gate.Check(context.Background(), "C1", deploy.New(slack.User{ID: "abc123", Name: "user1"}, "user1/repo1#1 user1/repo1#3"))
+	assert.WithinDuration(t, start, time.Now(), time.Second)
+	assert.Equal(t, bot.GateResult{
+		Decision: bot.GateWarn,
+		Message:  "Could not check whether pull requests are ready to deploy, GitHub has not responded in time for user1/repo1#3",
+	}, res)
+
+	gate.TimeoutDecision = bot.GateDeny
+
+	res = gate.Check(context.Background(), "C1", deploy.New(slack.User{ID: "abc123", Name: "user1"}, "user1/repo1#1 user1/repo1#3"))
+	assert.Equal(t, bot.GateDeny, res.Decision)
+
+	res = gate.Check(context.Background(), "C1", deploy.New(slack.User{ID: "abc123", Name: "user1"}, "user1/repo1#2 user1/repo1#3"))
+	assert.Equal(t, bot.GateResult{
+		Decision: bot.GateDeny,
+		Message:  "Pull requests are not ready to deploy: user1/repo1#2 (closed without merging). GitHub has not responded in time for user1/repo1#3",
+	}, res)
+}
@@ -1,11 +1,14 @@
 package bot
 
 import (
+	"context"
 	"fmt"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/andrewslotin/michael/changelog"
 	"github.com/andrewslotin/michael/deploy"
 	"github.com/andrewslotin/michael/github"
 	"github.com/andrewslotin/michael/slack"
@@ -16,28 +19,109 @@ const (
 
 /deploy help — print help (this message)
 /deploy <subject> — announce deploy of <subject> in channel
+/deploy --force <subject> — announce deploy of <subject> even if it was denied by deploy checks (channel maintainers only)
+/deploy --replace <subject> — finish your running deploy and announce deploy of <subject> instead
 /deploy status — show deploy status in channel
 /deploy done — finish deploy
 /deploy abort [<reason>] — abort current deploy, optionally providing a reason
-/deploy history — get a link to history of deploys in this channel`
-	errorMessage                   = "`%s` returned an error %s"
-	noRunningDeploysMessage        = "No one is deploying at the moment"
-	deployStatusMessage            = "%s is deploying %s since %s"
-	deployConflictMessage          = "%s is deploying since %s. You can type `/deploy done` if you think this deploy is finished."
-	deployDoneMessage              = "%s done deploying"
-	deployInterruptedMessage       = "%s has finished the deploy started by %s"
-	deployAnnouncementMessage      = "%s is about to deploy %s"
-	deployHistoryLinkMessage       = "Click <https://%s/%s|here> to see deploy history in this channel"
-	deployAbortedMessage           = "%s has aborted the deploy"
-	deployAbortedWithReasonMessage = "%s has aborted the deploy (%s)"
+/deploy history — get a link to history of deploys in this channel
+/deploy changelog [<YYYY-MM-DD>] [--labels] [--authors] — list pull requests deployed in this channel since given date or during the last week
+/deploy where <owner/repo#number|owner/repo@sha|owner/repo@tag|issue> — list deploys in all channels that included given pull request, commit, tag or issue
+/deploy history purge --before <YYYY-MM-DD> — remove deploys started before given date from channel history (admins only)
+/deploy role grant @user <role> — make user a deployer, maintainer or admin in this channel, or deny them deploying with none (channel admins only)
+/deploy role revoke @user — reset user role in this channel to the default one (channel admins only)
+/deploy approve — start the deploy waiting for approval in this channel
+/deploy lock [<reason>] — prevent new deploys from being started in this channel, i.e. during an incident (channel maintainers only)
+/deploy unlock — allow deploys in this channel again (channel maintainers only)
+/deploy config — show channel settings
+/deploy config require-approval on|off — require deploys in this channel to be approved by someone else (channel admins only)
+/deploy config require-ready-prs on|off — refuse to deploy pull requests that are not merged or have failing checks (channel admins only)`
+	errorMessage                        = "`%s` returned an error %s"
+	noRunningDeploysMessage             = "No one is deploying at the moment"
+	deployStatusMessage                 = "%s is deploying %s since %s"
+	deployConflictMessage               = "%s is deploying since %s. You can type `/deploy done` if you think this deploy is finished."
+	ownDeployConflictMessage            = "You are deploying %s since %s. Type `/deploy done` to finish it first or `/deploy --replace <subject>` to finish it and start a new one."
+	deployDoneMessage                   = "%s done deploying"
+	deployInterruptedMessage            = "%s has finished the deploy started by %s"
+	deployAnnouncementMessage           = "%s is about to deploy %s"
+	deployHistoryLinkMessage            = "Click <https://%s/%s|here> to see deploy history in this channel"
+	deployAbortedMessage                = "%s has aborted the deploy"
+	deployAbortedWithReasonMessage      = "%s has aborted the deploy (%s)"
+	adminOnlyMessage                    = "Only deploy bot admins can run `/deploy %s`"
+	historyPurgedMessage                = "Removed %d deploys started before %s from channel history"
+	permissionDeniedMessage             = "You need to be a channel %s to %s. Ask a channel admin to run `/deploy role grant` for you."
+	roleChangedMessage                  = "<@%s> is now %s in this channel"
+	approvalRequestMessage              = "%s requests approval to deploy %s. Type `/deploy approve` or click the button below to start the deploy."
+	approvalExpiresMessage              = "The request expires at %s"
+	approvalPendingMessage              = "%s is waiting for approval to deploy %s since %s"
+	noPendingDeploysMessage             = "There are no deploys waiting for approval in this channel"
+	selfApprovalMessage                 = "You cannot approve your own deploy, ask someone else in this channel to run `/deploy approve`"
+	approvedByMessage                   = " (approved by %s)"
+	approvalRequiredMessage             = "Deploys in this channel need to be approved by someone other than the deployer"
+	approvalNotRequiredMessage          = "Deploys in this channel start without approval"
+	readyPullRequestsRequiredMessage    = "Deploys of pull requests that are not merged or have failing checks are refused"
+	readyPullRequestsNotRequiredMessage = "Deploy announcements warn about pull requests that are not merged or have failing checks"
+	channelLockedMessage                = "%s has locked deploys in this channel"
+	channelLockedWithReasonMessage      = "%s has locked deploys in this channel (%s)"
+	channelUnlockedMessage              = "%s has unlocked deploys in this channel"
+	channelNotLockedMessage             = "Deploys in this channel are not locked"
+	deployLockedMessage                 = ":lock: Deploys in this channel have been locked by %s since %s%s. Ask a channel maintainer to run `/deploy unlock` once it's safe to deploy."
+	gateDeniedMessage                   = ":no_entry: %s. Type `/deploy --force <subject>` if you need to deploy anyway."
+	gateWarningMessage                  = ":warning: %s"
+	gateForcedMessage                   = ":no_entry: %s (forced)"
+	changelogMessage                    = "Pull requests deployed since %s:\n\n%s"
+	releaseNotesMessage                 = "Release notes:\n\n%s"
+	referencedDeploysMessage            = "%s has been included into following deploys:\n%s"
+	referencedDeployItem                = "• <#%s> %s by %s, %s"
+	notDeployedMessage                  = "%s has not been deployed yet"
+	rangeTitle                          = "%s (%s)"
+	rangePullRequestItem                = "• <%s/%s/pull/%d|#%d> %s"
+	rangeCommitItem                     = "• <%s|%s> %s by %s"
+	rangeMoreItems                      = "…and %s"
+)
+
+const (
+	// DefaultMaxParallelLookups is the default number of pull requests fetched from GitHub at once
+	// for a deploy announcement.
+	DefaultMaxParallelLookups = 4
+	// DefaultMaxRangeItems is the default number of pull requests and commits listed for a commit range
+	// in deploy announcement.
+	DefaultMaxRangeItems = 10
+	// DefaultMaxDescriptionLength is the default number of characters of pull request description included into
+	// deploy announcement.
+	DefaultMaxDescriptionLength = 500
+	// DefaultChangelogPeriod is the period covered by /deploy changelog unless the start date is provided.
+	DefaultChangelogPeriod = 7 * 24 * time.Hour
+	// DefaultPullRequestLookupTimeout is the default time to wait for pull request details before sending
+	// a deploy announcement with bare links to the pull requests that were not fetched in time.
+	DefaultPullRequestLookupTimeout = 3 * time.Second
+	// DefaultChangelogTimeout is the default time to wait for pull request details when building a changelog.
+	DefaultChangelogTimeout = 10 * time.Second
+	// DefaultMembershipCheckTimeout is the default time to wait for channel member lists when looking up deploys
+	// from other channels. Deploys from channels that have not been checked in time are not listed.
+	DefaultMembershipCheckTimeout = 5 * time.Second
 )
 
 type ResponseBuilder struct {
-	githubClient *github.Client
+	MaxParallelLookups   int
+	MaxDescriptionLength int
+
+	providers *deploy.ReferenceProviders
 }
 
+// NewResponseBuilder returns an instance of *ResponseBuilder that resolves GitHub references mentioned in deploy
+// subjects using githubClient. Use SetReferenceProviders to resolve references to other systems as well.
 func NewResponseBuilder(githubClient *github.Client) *ResponseBuilder {
-	return &ResponseBuilder{githubClient: githubClient}
+	return &ResponseBuilder{
+		MaxParallelLookups:   DefaultMaxParallelLookups,
+		MaxDescriptionLength: DefaultMaxDescriptionLength,
+		providers:            deploy.NewReferenceProviders(NewGitHubReferenceProvider(githubClient)),
+	}
+}
+
+// SetReferenceProviders makes response builder resolve references using providers.
+func (b *ResponseBuilder) SetReferenceProviders(providers *deploy.ReferenceProviders) {
+	b.providers = providers
 }
 
 func (b *ResponseBuilder) HelpMessage() *slack.Response {
@@ -60,33 +144,137 @@ func (b *ResponseBuilder) DeployInProgressMessage(d deploy.Deploy) *slack.Respon
 	return newUserMessage(fmt.Sprintf(deployConflictMessage, d.User, d.StartedAt.Format(time.RFC822)))
 }
 
+func (b *ResponseBuilder) OwnDeployInProgressMessage(d deploy.Deploy) *slack.Response {
+	return newUserMessage(fmt.Sprintf(ownDeployConflictMessage, slack.EscapeMessage(d.Subject), d.StartedAt.Format(time.RFC822)))
+}
+
 func (b *ResponseBuilder) DeployInterruptedAnnouncement(d deploy.Deploy, user slack.User) *slack.Response {
 	return newAnnouncement(fmt.Sprintf(deployInterruptedMessage, user, d.User))
 }
 
-func (b *ResponseBuilder) DeployAnnouncement(d deploy.Deploy) *slack.Response {
+// DeployAnnouncement returns an announcement with details of pull requests, commit ranges and other references
+// mentioned in deploy subject resolved by their reference providers. The details are fetched concurrently, and the ones that were not
+// fetched before ctx is done are attached as bare links. In this case the returned channel receives an announcement
+// with all details once the remaining lookups are finished. The channel is closed without sending anything if
+// everything was fetched in time.
+func (b *ResponseBuilder) DeployAnnouncement(ctx context.Context, d deploy.Deploy) (*slack.Response, <-chan *slack.Response) {
+	lookups := lookupReferences(b.providers, b.subjectReferences(d), b.MaxParallelLookups)
+
+	response, complete := b.deployAnnouncement(ctx, d, lookups)
+
+	updates := make(chan *slack.Response, 1)
+	if complete {
+		close(updates)
+		return response, updates
+	}
+
+	go func() {
+		defer close(updates)
+
+		response, _ := b.deployAnnouncement(context.Background(), d, lookups)
+		updates <- response
+	}()
+
+	return response, updates
+}
+
+// deployAnnouncement builds a deploy announcement attaching the details of references in lookup order. The second
+// value is false if some of the lookups were not finished before ctx is done.
+func (b *ResponseBuilder) deployAnnouncement(ctx context.Context, d deploy.Deploy, lookups []*lookup) (*slack.Response, bool) {
 	responseText := fmt.Sprintf(deployAnnouncementMessage, d.User, d.Subject)
+	if d.ApprovedBy.ID != "" {
+		responseText += fmt.Sprintf(approvedByMessage, d.ApprovedBy)
+	}
+
+	complete := true
+
 	response := newAnnouncement(responseText)
-	for _, ref := range d.PullRequests {
-		pr, err := b.githubClient.GetPullRequest(ref.Repository, ref.ID)
-		if err != nil {
-			response.Attachments = append(response.Attachments, slack.Attachment{
-				Title:     ref.Repository + "#" + ref.ID,
-				TitleLink: "https://github.com/" + ref.Repository + "/pulls/" + ref.ID,
-			})
+	for _, l := range lookups {
+		ref := l.Key.(deploy.Reference)
+
+		v, ok, err := l.Wait(ctx)
+		if !ok || err != nil {
+			complete = complete && ok
+			response.Attachments = append(response.Attachments, slack.Attachment{Title: ref.String(), TitleLink: ref.URL})
 			continue
 		}
 
-		response.Attachments = append(response.Attachments, slack.Attachment{
-			AuthorName: pr.Author.Name,
-			Title:      fmt.Sprintf("PR #%d: %s", pr.Number, slack.EscapeMessage(pr.Title)),
-			TitleLink:  pr.URL,
-			Text:       pr.Body,
-			Markdown:   true,
-		})
+		p, _ := b.providers.Lookup(ref.Provider)
+
+		details := v.(deploy.ReferenceDetails)
+
+		attachment := p.Attachment(ref, details)
+		// lists, such as commits of a range, have no description and are limited by their providers
+		if details.Description != "" {
+			attachment.Text = slack.TruncateMessage(attachment.Text, b.MaxDescriptionLength, attachment.TitleLink)
+		}
+
+		response.Attachments = append(response.Attachments, attachment)
 	}
 
-	return response
+	return response, complete
+}
+
+// subjectReferences returns references of deploy in the order they are mentioned in deploy subject. References
+// that are not found in subject go last.
+func (b *ResponseBuilder) subjectReferences(d deploy.Deploy) []deploy.Reference {
+	refs := b.providers.DeployReferences(d)
+
+	positions := make(map[string]int, len(refs))
+	for i, ref := range b.providers.FindReferences(d.Subject) {
+		if _, ok := positions[ref.Key()]; !ok {
+			positions[ref.Key()] = i
+		}
+	}
+
+	position := func(ref deploy.Reference) int {
+		if i, ok := positions[ref.Key()]; ok {
+			return i
+		}
+
+		return len(positions)
+	}
+
+	sort.SliceStable(refs, func(i, j int) bool {
+		return position(refs[i]) < position(refs[j])
+	})
+
+	return refs
+}
+
+// ChangelogMessage lists pull requests deployed in channel.
+func (b *ResponseBuilder) ChangelogMessage(since time.Time, cl changelog.Changelog) *slack.Response {
+	text, err := changelog.SlackMarkdown(cl)
+	if err != nil {
+		return b.ErrorMessage("changelog", err)
+	}
+
+	return newUserMessage(fmt.Sprintf(changelogMessage, since.Format("2006-01-02"), text))
+}
+
+// ReleaseNotesMessage lists pull requests shipped with a deploy.
+func (b *ResponseBuilder) ReleaseNotesMessage(cl changelog.Changelog) *slack.Response {
+	text, err := changelog.SlackMarkdown(cl)
+	if err != nil {
+		return b.ErrorMessage("changelog", err)
+	}
+
+	return newAnnouncement(fmt.Sprintf(releaseNotesMessage, text))
+}
+
+// ReferencedDeploysMessage lists channels, start times and outcomes of deploys that included a pull request
+// or commit.
+func (b *ResponseBuilder) ReferencedDeploysMessage(ref string, deploys []deploy.IndexedDeploy) *slack.Response {
+	if len(deploys) == 0 {
+		return newUserMessage(fmt.Sprintf(notDeployedMessage, ref))
+	}
+
+	items := make([]string, len(deploys))
+	for i, d := range deploys {
+		items[i] = fmt.Sprintf(referencedDeployItem, d.ChannelID, d.StartedAt.Format(time.RFC822), d.User, d.Outcome())
+	}
+
+	return newUserMessage(fmt.Sprintf(referencedDeploysMessage, ref, strings.Join(items, "\n")))
 }
 
 func (b *ResponseBuilder) DeployDoneAnnouncement(user slack.User) *slack.Response {
@@ -114,6 +302,132 @@ func (*ResponseBuilder) DeployHistoryLink(host, channelID, authToken string) *sl
 	return newUserMessage(fmt.Sprintf(deployHistoryLinkMessage, host, path))
 }
 
+func (*ResponseBuilder) AdminOnlyMessage(cmd string) *slack.Response {
+	return newUserMessage(fmt.Sprintf(adminOnlyMessage, cmd))
+}
+
+func (*ResponseBuilder) HistoryPurgedMessage(n int, before time.Time) *slack.Response {
+	return newUserMessage(fmt.Sprintf(historyPurgedMessage, n, before.Format(time.RFC822)))
+}
+
+func (*ResponseBuilder) PermissionDeniedMessage(action Action, requiredRole Role) *slack.Response {
+	return newUserMessage(fmt.Sprintf(permissionDeniedMessage, requiredRole, action))
+}
+
+func (*ResponseBuilder) RoleChangedMessage(userID string, role Role) *slack.Response {
+	return newUserMessage(fmt.Sprintf(roleChangedMessage, userID, roleWithArticle(role)))
+}
+
+func (*ResponseBuilder) ApprovalRequest(pending deploy.PendingDeploy) *slack.Response {
+	response := newAnnouncement(fmt.Sprintf(approvalRequestMessage, pending.Deploy.User, pending.Deploy.Subject))
+	response.Attachments = append(response.Attachments, slack.Attachment{
+		Title:      fmt.Sprintf(approvalExpiresMessage, pending.ExpiresAt.Format(time.RFC822)),
+		CallbackID: approvalCallbackID,
+		Actions: []slack.Action{
+			{Name: approveActionName, Text: "Approve", Type: "button", Value: pending.ID, Style: "primary"},
+		},
+	})
+
+	return response
+}
+
+func (*ResponseBuilder) ApprovalPendingMessage(pending deploy.PendingDeploy) *slack.Response {
+	return newUserMessage(fmt.Sprintf(approvalPendingMessage, pending.Deploy.User, pending.Deploy.Subject, pending.RequestedAt.Format(time.RFC822)))
+}
+
+func (*ResponseBuilder) NoPendingDeploysMessage() *slack.Response {
+	return newUserMessage(noPendingDeploysMessage)
+}
+
+func (*ResponseBuilder) SelfApprovalMessage() *slack.Response {
+	return newUserMessage(selfApprovalMessage)
+}
+
+func (*ResponseBuilder) ChannelSettingsMessage(settings ChannelSettings) *slack.Response {
+	lines := []string{approvalNotRequiredMessage, readyPullRequestsNotRequiredMessage}
+	if settings.RequireApproval {
+		lines[0] = approvalRequiredMessage
+	}
+
+	if settings.RequireReadyPullRequests {
+		lines[1] = readyPullRequestsRequiredMessage
+	}
+
+	if settings.Lock != nil {
+		lines = append(lines, deployLockedText(*settings.Lock))
+	}
+
+	return newUserMessage(strings.Join(lines, "\n"))
+}
+
+func (*ResponseBuilder) ChannelLockedAnnouncement(lock ChannelLock) *slack.Response {
+	if lock.Reason == "" {
+		return newAnnouncement(fmt.Sprintf(channelLockedMessage, lock.User))
+	}
+
+	return newAnnouncement(fmt.Sprintf(channelLockedWithReasonMessage, lock.User, slack.EscapeMessage(lock.Reason)))
+}
+
+func (*ResponseBuilder) ChannelUnlockedAnnouncement(user slack.User) *slack.Response {
+	return newAnnouncement(fmt.Sprintf(channelUnlockedMessage, user))
+}
+
+func (*ResponseBuilder) ChannelNotLockedMessage() *slack.Response {
+	return newUserMessage(channelNotLockedMessage)
+}
+
+func (*ResponseBuilder) DeployLockedMessage(lock ChannelLock) *slack.Response {
+	return newUserMessage(deployLockedText(lock))
+}
+
+func deployLockedText(lock ChannelLock) string {
+	var reason string
+	if lock.Reason != "" {
+		reason = " (" + slack.EscapeMessage(lock.Reason) + ")"
+	}
+
+	return fmt.Sprintf(deployLockedMessage, lock.User, lock.LockedAt.Format(time.RFC822), reason)
+}
+
+func (*ResponseBuilder) GateDeniedMessage(result GateResult) *slack.Response {
+	return newUserMessage(fmt.Sprintf(gateDeniedMessage, strings.TrimSuffix(result.Message, ".")))
+}
+
+// AddGateResults attaches warnings and forced denials returned by deploy gates to the response.
+func (*ResponseBuilder) AddGateResults(response *slack.Response, results []GateResult) *slack.Response {
+	if len(results) == 0 {
+		return response
+	}
+
+	lines := make([]string, 0, len(results))
+	for _, res := range results {
+		switch res.Decision {
+		case GateWarn:
+			lines = append(lines, fmt.Sprintf(gateWarningMessage, res.Message))
+		case GateDeny:
+			lines = append(lines, fmt.Sprintf(gateForcedMessage, res.Message))
+		}
+	}
+
+	response.Attachments = append(response.Attachments, slack.Attachment{
+		Text:     strings.Join(lines, "\n"),
+		Markdown: true,
+	})
+
+	return response
+}
+
+func roleWithArticle(role Role) string {
+	switch role {
+	case RoleNone:
+		return "not allowed to deploy"
+	case RoleAdmin:
+		return "an admin"
+	default:
+		return "a " + role.String()
+	}
+}
+
 func newUserMessage(s string) *slack.Response {
 	return slack.NewEphemeralResponse(s)
 }
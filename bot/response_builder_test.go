@@ -1,6 +1,7 @@
 package bot_test
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -10,6 +11,8 @@ import (
 	"github.com/andrewslotin/michael/bot"
 	"github.com/andrewslotin/michael/deploy"
 	"github.com/andrewslotin/michael/github"
+	"github.com/andrewslotin/michael/gitlab"
+	"github.com/andrewslotin/michael/jira"
 	"github.com/andrewslotin/michael/slack"
 	"github.com/stretchr/testify/assert"
 )
@@ -112,7 +115,7 @@ func TestResponseBuilder_DeployAnnouncement(t *testing.T) {
 	}
 
 	b := bot.NewResponseBuilder(githubClient)
-	response := b.DeployAnnouncement(d)
+	response, _ := b.DeployAnnouncement(context.Background(), d)
 
 	assert.Equal(t, slack.ResponseTypeInChannel, response.ResponseType)
 	assert.Contains(t, response.Text, d.User.String())
@@ -131,6 +134,34 @@ func TestResponseBuilder_DeployAnnouncement(t *testing.T) {
 	}
 }
 
+func TestResponseBuilder_DeployAnnouncement_MarkdownDescription(t *testing.T) {
+	baseURL, mux, teardown := setupGitHubTestServer()
+	defer teardown()
+
+	mux.HandleFunc("/repos/user1/repo1/pulls/123", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":123,"title":"Hello","body":"<!-- template -->\n## Summary\n\nFixes [the bug](https://example.com/bugs/1) in **parser** and much more","html_url":"http://xyz.abc"}`))
+	})
+
+	githubClient := github.NewClient("", nil)
+	githubClient.BaseURL = baseURL
+
+	d := deploy.New(slack.User{ID: "abc123", Name: "user1"}, "user1/repo1#123")
+
+	b := bot.NewResponseBuilder(githubClient)
+	response, _ := b.DeployAnnouncement(context.Background(), d)
+
+	if assert.Len(t, response.Attachments, 1) {
+		assert.Equal(t, "*Summary*\n\nFixes <https://example.com/bugs/1|the bug> in *parser* and much more", response.Attachments[0].Text)
+	}
+
+	b.MaxDescriptionLength = 60
+	response, _ = b.DeployAnnouncement(context.Background(), d)
+
+	if assert.Len(t, response.Attachments, 1) {
+		assert.Equal(t, "*Summary*\n\nFixes <https://example.com/bugs/1|the bug> in… <http://xyz.abc|read more>", response.Attachments[0].Text)
+	}
+}
+
 func TestResponseBuilder_DeployDoneAnnouncement(t *testing.T) {
 	user := slack.User{ID: "abc123", Name: "user1"}
 
@@ -190,6 +221,345 @@ func TestResponseBuilder_DeployHistoryLink_StandardPorts(t *testing.T) {
 	}
 }
 
+func TestResponseBuilder_AdminOnlyMessage(t *testing.T) {
+	b := bot.NewResponseBuilder(github.NewClient("", nil))
+	response := b.AdminOnlyMessage("history purge")
+
+	assert.Equal(t, slack.ResponseTypeEphemeral, response.ResponseType)
+	assert.Contains(t, response.Text, "/deploy history purge")
+}
+
+func TestResponseBuilder_HistoryPurgedMessage(t *testing.T) {
+	before := time.Date(2016, 8, 4, 0, 0, 0, 0, time.UTC)
+
+	b := bot.NewResponseBuilder(github.NewClient("", nil))
+	response := b.HistoryPurgedMessage(42, before)
+
+	assert.Equal(t, slack.ResponseTypeEphemeral, response.ResponseType)
+	assert.Contains(t, response.Text, "42")
+	assert.Contains(t, response.Text, before.Format(time.RFC822))
+}
+
+func TestResponseBuilder_DeployAnnouncement_PullRequestChecks(t *testing.T) {
+	baseURL, mux, teardown := setupGitHubTestServer()
+	defer teardown()
+
+	mux.HandleFunc("/repos/user1/repo1/pulls/1", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":1,"title":"Merged","state":"closed","merged":true,"head":{"sha":"sha1"}}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/commits/sha1/status", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"state":"success","statuses":[{"context":"ci","state":"success"}]}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/commits/sha1/check-runs", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"check_runs":[{"name":"test","status":"completed","conclusion":"success"}]}`))
+	})
+
+	mux.HandleFunc("/repos/user1/repo1/pulls/2", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":2,"title":"Open","body":"PR description","state":"open","head":{"sha":"sha2"}}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/commits/sha2/status", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"state":"pending","statuses":[]}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/commits/sha2/check-runs", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"check_runs":[{"name":"test","status":"in_progress"}]}`))
+	})
+
+	mux.HandleFunc("/repos/user1/repo1/pulls/3", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":3,"title":"Failing","state":"open","head":{"sha":"sha3"}}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/commits/sha3/status", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"state":"failure","statuses":[{"context":"ci","state":"failure"}]}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/commits/sha3/check-runs", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"check_runs":[{"name":"test","status":"completed","conclusion":"timed_out"}]}`))
+	})
+
+	githubClient := github.NewClient("", nil)
+	githubClient.BaseURL = baseURL
+
+	d := deploy.New(slack.User{ID: "abc123", Name: "user1"}, "user1/repo1#1 user1/repo1#2 user1/repo1#3")
+
+	b := bot.NewResponseBuilder(githubClient)
+	response, _ := b.DeployAnnouncement(context.Background(), d)
+
+	if assert.Len(t, response.Attachments, 3) {
+		assert.Equal(t, "good", response.Attachments[0].Color)
+		assert.Empty(t, response.Attachments[0].Text)
+
+		assert.Equal(t, "warning", response.Attachments[1].Color)
+		assert.Equal(t, ":warning: not merged\n:hourglass: 1 check pending\n\nPR description", response.Attachments[1].Text)
+
+		assert.Equal(t, "danger", response.Attachments[2].Color)
+		assert.Equal(t, ":warning: not merged\n:x: 2 checks failing", response.Attachments[2].Text)
+	}
+}
+
+func TestResponseBuilder_DeployAnnouncement_Timeout(t *testing.T) {
+	baseURL, mux, teardown := setupGitHubTestServer()
+	defer teardown()
+
+	release := make(chan struct{})
+	mux.HandleFunc("/repos/user1/repo1/pulls/1", func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		w.Write([]byte(`{"number":1,"title":"Slow","html_url":"http://xyz.abc/1"}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/pulls/2", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":2,"title":"Fast","html_url":"http://xyz.abc/2"}`))
+	})
+
+	githubClient := github.NewClient("", nil)
+	githubClient.BaseURL = baseURL
+
+	d := deploy.New(slack.User{ID: "abc123", Name: "user1"}, "user1/repo1#1 user1/repo1#2")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	b := bot.NewResponseBuilder(githubClient)
+	response, updates := b.DeployAnnouncement(ctx, d)
+
+	if assert.Len(t, response.Attachments, 2) {
+		assert.Equal(t, "user1/repo1#1", response.Attachments[0].Title)
+		assert.Equal(t, "https://github.com/user1/repo1/pulls/1", response.Attachments[0].TitleLink)
+
+		assert.Equal(t, "PR #2: Fast", response.Attachments[1].Title)
+	}
+
+	close(release)
+
+	select {
+	case update, ok := <-updates:
+		if assert.True(t, ok) && assert.Len(t, update.Attachments, 2) {
+			assert.Equal(t, "PR #1: Slow", update.Attachments[0].Title)
+			assert.Equal(t, "PR #2: Fast", update.Attachments[1].Title)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected an announcement update with late pull request details")
+	}
+}
+
+func TestResponseBuilder_DeployAnnouncement_Range(t *testing.T) {
+	baseURL, mux, teardown := setupGitHubTestServer()
+	defer teardown()
+
+	mux.HandleFunc("/repos/org/api/compare/v1.2...v1.3", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{
+			"html_url": "https://github.com/org/api/compare/v1.2...v1.3",
+			"total_commits": 5,
+			"commits": [
+				{"sha": "7fd1a60b01f91b314f59955a4e4d4e80d8edf11d", "html_url": "https://github.com/org/api/commit/7fd1a60", "commit": {"message": "Fix <typo>"}, "author": {"login": "author1"}},
+				{"sha": "762941318ee16e59dabbacb1b4049eec22f0d303", "html_url": "https://github.com/org/api/commit/7629413", "commit": {"message": "Merge pull request #12 from org/feature\n\nAdd feature"}},
+				{"sha": "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", "html_url": "https://github.com/org/api/commit/553c207", "commit": {"message": "Squashed change (#13)", "author": {"name": "Author Two"}}}
+			]
+		}`))
+	})
+	mux.HandleFunc("/repos/org/web/compare/v1.0...v1.1", func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	})
+
+	githubClient := github.NewClient("", nil)
+	githubClient.BaseURL = baseURL
+
+	d := deploy.New(slack.User{ID: "abc123", Name: "user1"}, "org/api@v1.2...v1.3 and https://github.com/org/web/compare/v1.0...v1.1")
+
+	github := bot.NewGitHubReferenceProvider(githubClient)
+	github.MaxRangeItems = 2
+
+	b := bot.NewResponseBuilder(githubClient)
+	b.SetReferenceProviders(deploy.NewReferenceProviders(github))
+
+	response, _ := b.DeployAnnouncement(context.Background(), d)
+
+	if assert.Len(t, response.Attachments, 2) {
+		assert.Equal(t, "org/api@v1.2...v1.3 (5 commits)", response.Attachments[0].Title)
+		assert.Equal(t, "https://github.com/org/api/compare/v1.2...v1.3", response.Attachments[0].TitleLink)
+		assert.Equal(t, "• <https://github.com/org/api/pull/12|#12> Add feature\n"+
+			"• <https://github.com/org/api/pull/13|#13> Squashed change\n"+
+			"…and 3 more commits", response.Attachments[0].Text)
+		assert.True(t, response.Attachments[0].Markdown)
+
+		assert.Equal(t, "org/web@v1.0...v1.1", response.Attachments[1].Title)
+		assert.Equal(t, "https://github.com/org/web/compare/v1.0...v1.1", response.Attachments[1].TitleLink)
+		assert.Empty(t, response.Attachments[1].Text)
+	}
+
+	github.MaxRangeItems = bot.DefaultMaxRangeItems
+	response, _ = b.DeployAnnouncement(context.Background(), d)
+
+	if assert.Len(t, response.Attachments, 2) {
+		assert.Equal(t, "• <https://github.com/org/api/pull/12|#12> Add feature\n"+
+			"• <https://github.com/org/api/pull/13|#13> Squashed change\n"+
+			"• <https://github.com/org/api/commit/7fd1a60|7fd1a60> Fix &lt;typo&gt; by author1\n"+
+			"…and 2 more commits", response.Attachments[0].Text)
+	}
+}
+
+func TestResponseBuilder_DeployAnnouncement_ProviderReferences(t *testing.T) {
+	baseURL, mux, teardown := setupGitHubTestServer()
+	defer teardown()
+
+	mux.HandleFunc("/jira/rest/api/2/issue/OPS-12", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"key":"OPS-12","fields":{"summary":"Rotate certificates","status":{"name":"In Progress","statusCategory":{"key":"indeterminate"}},"assignee":{"displayName":"Jane Doe"}}}`))
+	})
+	mux.HandleFunc("/gitlab/api/v4/projects/", func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	})
+
+	gitlabClient := gitlab.NewClient("", nil)
+	gitlabClient.BaseURL, gitlabClient.WebURL = baseURL+"/gitlab/api/v4", "https://gitlab.example.com"
+
+	githubClient := github.NewClient("", nil)
+	githubClient.BaseURL = baseURL
+
+	providers := deploy.NewReferenceProviders(
+		bot.NewGitHubReferenceProvider(githubClient),
+		jira.NewReferenceProvider(jira.NewClient(baseURL+"/jira", "", "", nil), []string{"OPS"}),
+		gitlab.NewReferenceProvider(gitlabClient),
+	)
+
+	d := providers.New(slack.User{ID: "abc123", Name: "user1"}, "OPS-12 and group/project!3")
+	d.References = append(d.References, deploy.Reference{Provider: "unknown", ID: "X-1", URL: "https://tracker.example.com/X-1"})
+
+	b := bot.NewResponseBuilder(githubClient)
+	b.SetReferenceProviders(providers)
+
+	response, _ := b.DeployAnnouncement(context.Background(), d)
+
+	if assert.Len(t, response.Attachments, 3) {
+		assert.Equal(t, "OPS-12: Rotate certificates", response.Attachments[0].Title)
+		assert.Equal(t, baseURL+"/jira/browse/OPS-12", response.Attachments[0].TitleLink)
+		assert.Equal(t, "Jane Doe", response.Attachments[0].AuthorName)
+		assert.Equal(t, "In Progress", response.Attachments[0].Text)
+
+		assert.Equal(t, "group/project!3", response.Attachments[1].Title)
+		assert.Equal(t, "https://gitlab.example.com/group/project/-/merge_requests/3", response.Attachments[1].TitleLink)
+		assert.Empty(t, response.Attachments[1].Text)
+
+		assert.Equal(t, "X-1", response.Attachments[2].Title)
+		assert.Equal(t, "https://tracker.example.com/X-1", response.Attachments[2].TitleLink)
+	}
+}
+
+func TestResponseBuilder_DeployAnnouncement_SubjectOrder(t *testing.T) {
+	baseURL, mux, teardown := setupGitHubTestServer()
+	defer teardown()
+
+	mux.HandleFunc("/jira/rest/api/2/issue/OPS-12", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"key":"OPS-12","fields":{"summary":"Rotate certificates","status":{"name":"In Progress","statusCategory":{"key":"indeterminate"}}}}`))
+	})
+	mux.HandleFunc("/repos/org/api/compare/v1.2...v1.3", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"html_url": "https://github.com/org/api/compare/v1.2...v1.3", "total_commits": 0, "commits": []}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/pulls/1", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":1,"title":"Pull request 1","html_url":"https://github.com/user1/repo1/pull/1","state":"closed","merged":true}`))
+	})
+	mux.HandleFunc("/gitlab/api/v4/projects/", func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	})
+
+	gitlabClient := gitlab.NewClient("", nil)
+	gitlabClient.BaseURL, gitlabClient.WebURL = baseURL+"/gitlab/api/v4", "https://gitlab.example.com"
+
+	githubClient := github.NewClient("", nil)
+	githubClient.BaseURL = baseURL
+
+	providers := deploy.NewReferenceProviders(
+		bot.NewGitHubReferenceProvider(githubClient),
+		jira.NewReferenceProvider(jira.NewClient(baseURL+"/jira", "", "", nil), []string{"OPS"}),
+		gitlab.NewReferenceProvider(gitlabClient),
+	)
+
+	d := providers.New(slack.User{ID: "abc123", Name: "user1"}, "OPS-12: group/project!3, org/api@v1.2...v1.3 and user1/repo1#1")
+
+	b := bot.NewResponseBuilder(githubClient)
+	b.SetReferenceProviders(providers)
+
+	response, _ := b.DeployAnnouncement(context.Background(), d)
+
+	var titles []string
+	for _, attachment := range response.Attachments {
+		titles = append(titles, attachment.Title)
+	}
+
+	assert.Equal(t, []string{
+		"OPS-12: Rotate certificates",
+		"group/project!3",
+		"org/api@v1.2...v1.3 (0 commits)",
+		"PR #1: Pull request 1",
+	}, titles)
+}
+
+func TestResponseBuilder_DeployAnnouncement_NoUpdates(t *testing.T) {
+	d := deploy.New(slack.User{ID: "abc123", Name: "user1"}, "deploy subject")
+
+	b := bot.NewResponseBuilder(github.NewClient("", nil))
+	_, updates := b.DeployAnnouncement(context.Background(), d)
+
+	_, ok := <-updates
+	assert.False(t, ok)
+}
+
+func TestResponseBuilder_DeployAnnouncement_Approved(t *testing.T) {
+	d := deploy.Deploy{
+		User:       slack.User{ID: "abc123", Name: "user1"},
+		Subject:    "deploy subject",
+		ApprovedBy: slack.User{ID: "xyz456", Name: "user2"},
+	}
+
+	b := bot.NewResponseBuilder(github.NewClient("", nil))
+	response, _ := b.DeployAnnouncement(context.Background(), d)
+
+	assert.Equal(t, slack.ResponseTypeInChannel, response.ResponseType)
+	assert.Contains(t, response.Text, "approved by "+d.ApprovedBy.String())
+}
+
+func TestResponseBuilder_ApprovalRequest(t *testing.T) {
+	pending := deploy.PendingDeploy{
+		ID:        "123",
+		Deploy:    deploy.New(slack.User{ID: "abc123", Name: "user1"}, "deploy subject"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	b := bot.NewResponseBuilder(github.NewClient("", nil))
+	response := b.ApprovalRequest(pending)
+
+	assert.Equal(t, slack.ResponseTypeInChannel, response.ResponseType)
+	assert.Contains(t, response.Text, pending.Deploy.User.String())
+	assert.Contains(t, response.Text, pending.Deploy.Subject)
+
+	if assert.Len(t, response.Attachments, 1) {
+		attachment := response.Attachments[0]
+		assert.Contains(t, attachment.Title, pending.ExpiresAt.Format(time.RFC822))
+		if assert.Len(t, attachment.Actions, 1) {
+			assert.Equal(t, "button", attachment.Actions[0].Type)
+			assert.Equal(t, pending.ID, attachment.Actions[0].Value)
+		}
+	}
+}
+
+func TestResponseBuilder_GateDeniedMessage(t *testing.T) {
+	b := bot.NewResponseBuilder(github.NewClient("", nil))
+	response := b.GateDeniedMessage(bot.GateResult{Decision: bot.GateDeny, Message: "CI is red."})
+
+	assert.Equal(t, slack.ResponseTypeEphemeral, response.ResponseType)
+	assert.Equal(t, ":no_entry: CI is red. Type `/deploy --force <subject>` if you need to deploy anyway.", response.Text)
+}
+
+func TestResponseBuilder_AddGateResults(t *testing.T) {
+	b := bot.NewResponseBuilder(github.NewClient("", nil))
+
+	response := b.AddGateResults(slack.NewInChannelResponse("announcement"), nil)
+	assert.Empty(t, response.Attachments)
+
+	response = b.AddGateResults(slack.NewInChannelResponse("announcement"), []bot.GateResult{
+		{Decision: bot.GateWarn, Message: "CI is flaky"},
+		{Decision: bot.GateDeny, Message: "Deploys are only allowed during business hours"},
+	})
+	if assert.Len(t, response.Attachments, 1) {
+		assert.Equal(t, ":warning: CI is flaky\n:no_entry: Deploys are only allowed during business hours (forced)", response.Attachments[0].Text)
+	}
+}
+
 func setupGitHubTestServer() (baseURL string, mux *http.ServeMux, teardownFn func()) {
 	mux = http.NewServeMux()
 	server := httptest.NewServer(mux)
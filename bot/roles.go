@@ -0,0 +1,111 @@
+package bot
+
+import (
+	"fmt"
+
+	"github.com/andrewslotin/michael/deploy"
+)
+
+// Role defines what a user is allowed to do in a channel. Each role includes permissions of the roles below it.
+type Role int
+
+const (
+	// RoleNone does not allow to do anything but checking deploy status.
+	RoleNone Role = iota
+	// RoleDeployer allows to start, finish and abort own deploys and to view channel history.
+	RoleDeployer
+	// RoleMaintainer additionally allows to finish and abort deploys started by others.
+	RoleMaintainer
+	// RoleAdmin additionally allows to manage roles of other users and channel settings.
+	RoleAdmin
+)
+
+var roleNames = [...]string{
+	RoleNone:       "none",
+	RoleDeployer:   "deployer",
+	RoleMaintainer: "maintainer",
+	RoleAdmin:      "admin",
+}
+
+// ParseRole returns a role by its name.
+func ParseRole(s string) (Role, error) {
+	for role, name := range roleNames {
+		if name == s {
+			return Role(role), nil
+		}
+	}
+
+	return RoleNone, fmt.Errorf("unknown role %q, expected none, deployer, maintainer or admin", s)
+}
+
+// Set implements flag.Value.
+func (r *Role) Set(s string) error {
+	role, err := ParseRole(s)
+	if err != nil {
+		return err
+	}
+
+	*r = role
+
+	return nil
+}
+
+func (r Role) String() string {
+	if r < 0 || int(r) >= len(roleNames) {
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+
+	return roleNames[r]
+}
+
+// RoleStore keeps roles granted to users in channels.
+type RoleStore interface {
+	Role(channelID, userID string) (role Role, ok bool, err error)
+	SetRole(channelID, userID string, role Role) error
+	RemoveRole(channelID, userID string) error
+}
+
+const rolesCollection = "roles"
+
+// RecordRoleStore is a RoleStore that keeps roles in a deploy.RecordStore.
+type RecordRoleStore struct {
+	records deploy.RecordStore
+}
+
+// NewRecordRoleStore returns an instance of *RecordRoleStore that uses records to keep roles.
+func NewRecordRoleStore(records deploy.RecordStore) *RecordRoleStore {
+	return &RecordRoleStore{records: records}
+}
+
+// Role returns the role granted to user in channel.
+func (s *RecordRoleStore) Role(channelID, userID string) (Role, bool, error) {
+	rec, ok, err := s.records.GetRecord(rolesCollection, roleKey(channelID, userID))
+	if err != nil || !ok {
+		return RoleNone, false, err
+	}
+
+	role, err := ParseRole(string(rec.Value))
+	if err != nil {
+		return RoleNone, false, fmt.Errorf("malformed role of %s in %s: %s", userID, channelID, err)
+	}
+
+	return role, true, nil
+}
+
+// SetRole grants a role to user in channel replacing the previous one.
+func (s *RecordRoleStore) SetRole(channelID, userID string, role Role) error {
+	return s.records.PutRecord(rolesCollection, deploy.Record{
+		Key:   roleKey(channelID, userID),
+		Value: []byte(role.String()),
+	})
+}
+
+// RemoveRole removes the role granted to user in channel.
+func (s *RecordRoleStore) RemoveRole(channelID, userID string) error {
+	_, _, err := s.records.DeleteRecord(rolesCollection, roleKey(channelID, userID))
+	return err
+}
+
+func roleKey(channelID, userID string) string {
+	return channelID + "/" + userID
+}
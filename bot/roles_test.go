@@ -0,0 +1,48 @@
+package bot_test
+
+import (
+	"testing"
+
+	"github.com/andrewslotin/michael/bot"
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRole(t *testing.T) {
+	for _, role := range []bot.Role{bot.RoleNone, bot.RoleDeployer, bot.RoleMaintainer, bot.RoleAdmin} {
+		parsed, err := bot.ParseRole(role.String())
+		require.NoError(t, err)
+		assert.Equal(t, role, parsed)
+	}
+
+	_, err := bot.ParseRole("owner")
+	assert.Error(t, err)
+}
+
+func TestRecordRoleStore(t *testing.T) {
+	store := bot.NewRecordRoleStore(deploy.NewInMemoryStore())
+
+	_, ok, err := store.Role("C1", "U1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, store.SetRole("C1", "U1", bot.RoleMaintainer))
+	require.NoError(t, store.SetRole("C2", "U1", bot.RoleNone))
+
+	role, ok, err := store.Role("C1", "U1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, bot.RoleMaintainer, role)
+
+	role, ok, err = store.Role("C2", "U1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, bot.RoleNone, role)
+
+	require.NoError(t, store.RemoveRole("C1", "U1"))
+
+	_, ok, err = store.Role("C1", "U1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
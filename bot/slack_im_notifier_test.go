@@ -36,22 +36,22 @@ func TestSlackIMNotifier_DeployCompleted(t *testing.T) {
 
 	mux.HandleFunc("/users.list", func(w http.ResponseWriter, r *http.Request) {
 		requestNum.UsersList++
-		assert.Equal(t, webAPIToken, r.FormValue("token"))
+		assert.Equal(t, "Bearer "+webAPIToken, r.Header.Get("Authorization"))
 
 		fmt.Fprint(w, `{"ok":true,"members":[{"id":"R1","name":"recipient1"},{"id":"R2","name":"recipient2"},{"id":"R3","name":"recipient3"}]}`)
 	})
-	mux.HandleFunc("/im.open", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/conversations.open", func(w http.ResponseWriter, r *http.Request) {
 		requestNum.IMOpen++
-		assert.Equal(t, webAPIToken, r.FormValue("token"))
+		assert.Equal(t, "Bearer "+webAPIToken, r.Header.Get("Authorization"))
 
-		if userID := r.FormValue("user"); assert.NotEmpty(t, userID) {
+		if userID := r.FormValue("users"); assert.NotEmpty(t, userID) {
 			fmt.Fprintf(w, `{"ok":true,"channel":{"id":"DM%s"}}`, userID)
 		} else {
 			fmt.Fprint(w, `{"ok":false,"error":"user_not_found"}`)
 		}
 	})
 	mux.HandleFunc("/chat.postMessage", func(w http.ResponseWriter, r *http.Request) {
-		assert.Equal(t, webAPIToken, r.FormValue("token"))
+		assert.Equal(t, "Bearer "+webAPIToken, r.Header.Get("Authorization"))
 
 		if channelID := r.FormValue("channel"); assert.NotEmpty(t, channelID) {
 			receivers = append(receivers, channelID)
@@ -168,12 +168,12 @@ func setupSlackWebAPITestServer(t *testing.T) (baseURL string, channel *SlackCha
 	mux := http.NewServeMux()
 	server := httptest.NewServer(mux)
 
-	mux.HandleFunc("/channels.info", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/conversations.info", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, `{"ok":true,"channel":{"topic":{"value":"%s"}}}`, channel.Topic)
 	})
 
-	mux.HandleFunc("/channels.setTopic", func(w http.ResponseWriter, r *http.Request) {
-		if token := r.FormValue("token"); !assert.Equal(t, webAPIToken, token) {
+	mux.HandleFunc("/conversations.setTopic", func(w http.ResponseWriter, r *http.Request) {
+		if token := r.Header.Get("Authorization"); !assert.Equal(t, "Bearer "+webAPIToken, token) {
 			fmt.Fprintf(w, `{"ok":false,"error":"wrong token %q"}`, token)
 			return
 		}
@@ -0,0 +1,212 @@
+// Package changelog builds release notes out of pull requests mentioned in deploy history.
+package changelog
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/github"
+)
+
+// DefaultMaxParallelLookups is the default number of pull requests fetched from GitHub at once.
+const DefaultMaxParallelLookups = 4
+
+// Changelog is a list of deploys along with pull requests they shipped, newest first.
+type Changelog struct {
+	Deploys []Deploy `json:"deploys"`
+}
+
+// Deploy is a finished deploy in changelog.
+type Deploy struct {
+	DeployedBy   string       `json:"deployed_by"`
+	Subject      string       `json:"subject"`
+	StartedAt    time.Time    `json:"started_at"`
+	FinishedAt   time.Time    `json:"finished_at"`
+	Repositories []Repository `json:"repositories"`
+}
+
+// Repository groups pull requests shipped with a deploy by repository they belong to.
+type Repository struct {
+	Name         string        `json:"name"`
+	PullRequests []PullRequest `json:"pull_requests"`
+}
+
+// PullRequest is a deployed pull request. Title, Author and Labels are empty if GitHub failed to return
+// pull request details.
+type PullRequest struct {
+	Number int      `json:"number"`
+	Title  string   `json:"title,omitempty"`
+	URL    string   `json:"url"`
+	Author string   `json:"author,omitempty"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+// Options control which pull request details are included into changelog.
+type Options struct {
+	Labels  bool
+	Authors bool
+}
+
+// Builder resolves pull requests mentioned in deploy subjects using GitHub API.
+type Builder struct {
+	MaxParallelLookups int
+
+	client *github.Client
+}
+
+// NewBuilder returns an instance of *Builder that uses client to fetch pull request details.
+func NewBuilder(client *github.Client) *Builder {
+	return &Builder{
+		MaxParallelLookups: DefaultMaxParallelLookups,
+		client:             client,
+	}
+}
+
+// Build returns the changelog of deploys in history. Aborted, running deploys and the ones that did not
+// mention any pull requests are skipped. Pull requests that have not been fetched before ctx is done are
+// listed without details.
+func (b *Builder) Build(ctx context.Context, history []deploy.Deploy, opts Options) Changelog {
+	var deploys []deploy.Deploy
+	for _, d := range history {
+		if !d.Finished() || d.Aborted || len(d.PullRequests) == 0 {
+			continue
+		}
+
+		deploys = append(deploys, d)
+	}
+
+	prs := b.fetchPullRequests(ctx, deploys)
+
+	cl := Changelog{Deploys: make([]Deploy, 0, len(deploys))}
+	for i := len(deploys) - 1; i >= 0; i-- {
+		d := deploys[i]
+
+		entry := Deploy{
+			DeployedBy: d.User.Name,
+			Subject:    d.Subject,
+			StartedAt:  d.StartedAt,
+			FinishedAt: d.FinishedAt,
+		}
+
+		repoIndex := make(map[string]int)
+		for _, ref := range d.PullRequests {
+			n, ok := repoIndex[ref.Repository]
+			if !ok {
+				n = len(entry.Repositories)
+				repoIndex[ref.Repository] = n
+				entry.Repositories = append(entry.Repositories, Repository{Name: ref.Repository})
+			}
+
+			entry.Repositories[n].PullRequests = append(entry.Repositories[n].PullRequests, newPullRequest(b.client, ref, prs[ref], opts))
+		}
+
+		cl.Deploys = append(cl.Deploys, entry)
+	}
+
+	return cl
+}
+
+// fetchPullRequests fetches all pull requests mentioned in deploys running at most b.MaxParallelLookups
+// requests at once. The pull requests that failed to load or have not been loaded before ctx is done are
+// missing in the returned map.
+func (b *Builder) fetchPullRequests(ctx context.Context, deploys []deploy.Deploy) map[deploy.PullRequestReference]github.PullRequest {
+	concurrency := b.MaxParallelLookups
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, concurrency)
+		prs = make(map[deploy.PullRequestReference]github.PullRequest)
+	)
+
+	seen := make(map[deploy.PullRequestReference]struct{})
+	for _, d := range deploys {
+		for _, ref := range d.PullRequests {
+			if _, ok := seen[ref]; ok {
+				continue
+			}
+			seen[ref] = struct{}{}
+
+			wg.Add(1)
+			go func(ref deploy.PullRequestReference) {
+				defer wg.Done()
+
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				defer func() { <-sem }()
+
+				pr, err := b.client.GetPullRequest(ref.Repository, ref.ID)
+				if err != nil {
+					log.Printf("failed to get %s#%s: %s", ref.Repository, ref.ID, err)
+					return
+				}
+
+				mu.Lock()
+				prs[ref] = pr
+				mu.Unlock()
+			}(ref)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return prs
+	case <-ctx.Done():
+	}
+
+	// the lookups that are still running keep writing to prs, so the caller gets a copy
+	mu.Lock()
+	defer mu.Unlock()
+
+	fetched := make(map[deploy.PullRequestReference]github.PullRequest, len(prs))
+	for ref, pr := range prs {
+		fetched[ref] = pr
+	}
+
+	return fetched
+}
+
+func newPullRequest(client *github.Client, ref deploy.PullRequestReference, pr github.PullRequest, opts Options) PullRequest {
+	if pr.Number == 0 {
+		number, _ := strconv.Atoi(ref.ID)
+
+		return PullRequest{
+			Number: number,
+			URL:    client.WebURL + "/" + ref.Repository + "/pull/" + ref.ID,
+		}
+	}
+
+	v := PullRequest{
+		Number: pr.Number,
+		Title:  pr.Title,
+		URL:    pr.URL,
+	}
+
+	if opts.Authors {
+		v.Author = pr.Author.Name
+	}
+
+	if opts.Labels {
+		for _, l := range pr.Labels {
+			v.Labels = append(v.Labels, l.Name)
+		}
+	}
+
+	return v
+}
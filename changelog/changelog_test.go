@@ -0,0 +1,218 @@
+package changelog_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/changelog"
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/github"
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder_Build(t *testing.T) {
+	client, teardown := setupGitHub()
+	defer teardown()
+
+	history := testHistory()
+
+	cl := changelog.NewBuilder(client).Build(context.Background(), history, changelog.Options{Labels: true, Authors: true})
+
+	require.Len(t, cl.Deploys, 2)
+
+	// newest first
+	assert.Equal(t, "user2", cl.Deploys[0].DeployedBy)
+	assert.Equal(t, history[3].FinishedAt, cl.Deploys[0].FinishedAt)
+	if assert.Len(t, cl.Deploys[0].Repositories, 1) {
+		assert.Equal(t, changelog.Repository{
+			Name: "octocat/helloworld",
+			PullRequests: []changelog.PullRequest{
+				{Number: 3, URL: "https://github.com/octocat/helloworld/pull/3"},
+			},
+		}, cl.Deploys[0].Repositories[0])
+	}
+
+	assert.Equal(t, "user1", cl.Deploys[1].DeployedBy)
+	assert.Equal(t, []changelog.Repository{
+		{
+			Name: "octocat/helloworld",
+			PullRequests: []changelog.PullRequest{
+				{Number: 1, Title: "Fix typo", URL: "https://github.com/octocat/helloworld/pull/1", Author: "author1", Labels: []string{"bug", "docs"}},
+				{Number: 2, Title: "Add feature", URL: "https://github.com/octocat/helloworld/pull/2", Author: "author2"},
+			},
+		},
+		{
+			Name: "octocat/spoon-knife",
+			PullRequests: []changelog.PullRequest{
+				{Number: 5, Title: "Sharpen the knife", URL: "https://github.com/octocat/spoon-knife/pull/5", Author: "author1"},
+			},
+		},
+	}, cl.Deploys[1].Repositories)
+}
+
+func TestBuilder_Build_Options(t *testing.T) {
+	client, teardown := setupGitHub()
+	defer teardown()
+
+	cl := changelog.NewBuilder(client).Build(context.Background(), testHistory(), changelog.Options{})
+
+	require.Len(t, cl.Deploys, 2)
+	if assert.Len(t, cl.Deploys[1].Repositories, 2) && assert.Len(t, cl.Deploys[1].Repositories[0].PullRequests, 2) {
+		assert.Equal(t, changelog.PullRequest{
+			Number: 1,
+			Title:  "Fix typo",
+			URL:    "https://github.com/octocat/helloworld/pull/1",
+		}, cl.Deploys[1].Repositories[0].PullRequests[0])
+	}
+}
+
+func TestBuilder_Build_Timeout(t *testing.T) {
+	release := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		w.Write([]byte(`{"number":1,"title":"Fix typo","html_url":"https://github.com/octocat/helloworld/pull/1"}`))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := github.NewClient("", nil)
+	client.BaseURL = srv.URL
+
+	d := deploy.New(slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1")
+	d.StartedAt = time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	d.FinishedAt = d.StartedAt.Add(30 * time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	cl := changelog.NewBuilder(client).Build(ctx, []deploy.Deploy{d}, changelog.Options{})
+
+	require.Len(t, cl.Deploys, 1)
+	assert.Equal(t, []changelog.Repository{
+		{
+			Name: "octocat/helloworld",
+			PullRequests: []changelog.PullRequest{
+				{Number: 1, URL: "https://github.com/octocat/helloworld/pull/1"},
+			},
+		},
+	}, cl.Deploys[0].Repositories)
+}
+
+func TestMarkdown(t *testing.T) {
+	client, teardown := setupGitHub()
+	defer teardown()
+
+	cl := changelog.NewBuilder(client).Build(context.Background(), testHistory(), changelog.Options{Labels: true, Authors: true})
+
+	var buf bytes.Buffer
+	require.NoError(t, changelog.Markdown(&buf, cl))
+
+	assert.Equal(t, `# Changelog
+
+## 2018-03-02 12:30 UTC
+
+Deployed by user2
+
+### octocat/helloworld
+
+* [#3](https://github.com/octocat/helloworld/pull/3)
+
+## 2018-03-01 10:30 UTC
+
+Deployed by user1
+
+### octocat/helloworld
+
+* [#1](https://github.com/octocat/helloworld/pull/1) Fix typo by @author1 `+"`bug` `docs`"+`
+* [#2](https://github.com/octocat/helloworld/pull/2) Add feature by @author2
+
+### octocat/spoon-knife
+
+* [#5](https://github.com/octocat/spoon-knife/pull/5) Sharpen the knife by @author1
+`, buf.String())
+}
+
+func TestMarkdown_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, changelog.Markdown(&buf, changelog.Changelog{}))
+
+	assert.Equal(t, "# Changelog\n\nNo pull requests have been deployed\n", buf.String())
+}
+
+func TestSlackMarkdown(t *testing.T) {
+	client, teardown := setupGitHub()
+	defer teardown()
+
+	cl := changelog.NewBuilder(client).Build(context.Background(), testHistory(), changelog.Options{Labels: true, Authors: true})
+
+	s, err := changelog.SlackMarkdown(cl)
+	require.NoError(t, err)
+
+	assert.Equal(t, `*02 Mar 18 12:30 UTC*, deployed by user2
+_octocat/helloworld_
+• <https://github.com/octocat/helloworld/pull/3|#3>
+
+*01 Mar 18 10:30 UTC*, deployed by user1
+_octocat/helloworld_
+• <https://github.com/octocat/helloworld/pull/1|#1> Fix typo by author1 `+"`bug` `docs`"+`
+• <https://github.com/octocat/helloworld/pull/2|#2> Add feature by author2
+_octocat/spoon-knife_
+• <https://github.com/octocat/spoon-knife/pull/5|#5> Sharpen the knife by author1`, s)
+}
+
+func setupGitHub() (*github.Client, func()) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octocat/helloworld/pulls/1", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":1,"title":"Fix typo","html_url":"https://github.com/octocat/helloworld/pull/1","user":{"login":"author1"},"labels":[{"name":"bug"},{"name":"docs"}]}`))
+	})
+	mux.HandleFunc("/repos/octocat/helloworld/pulls/2", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":2,"title":"Add feature","html_url":"https://github.com/octocat/helloworld/pull/2","user":{"login":"author2"}}`))
+	})
+	mux.HandleFunc("/repos/octocat/spoon-knife/pulls/5", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":5,"title":"Sharpen the knife","html_url":"https://github.com/octocat/spoon-knife/pull/5","user":{"login":"author1"}}`))
+	})
+
+	srv := httptest.NewServer(mux)
+
+	client := github.NewClient("", nil)
+	client.BaseURL = srv.URL
+
+	return client, srv.Close
+}
+
+func testHistory() []deploy.Deploy {
+	user1, user2 := slack.User{ID: "U1", Name: "user1"}, slack.User{ID: "U2", Name: "user2"}
+
+	d1 := deploy.New(user1, "octocat/helloworld#1 octocat/helloworld#2 and octocat/spoon-knife#5")
+	d1.StartedAt = time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	d1.FinishedAt = d1.StartedAt.Add(30 * time.Minute)
+
+	// no pull requests
+	d2 := deploy.New(user2, "hotfix")
+	d2.StartedAt = time.Date(2018, 3, 1, 11, 0, 0, 0, time.UTC)
+	d2.FinishedAt = d2.StartedAt.Add(30 * time.Minute)
+
+	// aborted
+	d3 := deploy.New(user2, "octocat/helloworld#4")
+	d3.StartedAt = time.Date(2018, 3, 2, 11, 0, 0, 0, time.UTC)
+	d3.FinishedAt = d3.StartedAt.Add(30 * time.Minute)
+	d3.Aborted = true
+
+	// pull request that is failed to load
+	d4 := deploy.New(user2, "octocat/helloworld#3")
+	d4.StartedAt = time.Date(2018, 3, 2, 12, 0, 0, 0, time.UTC)
+	d4.FinishedAt = d4.StartedAt.Add(30 * time.Minute)
+
+	// still running
+	d5 := deploy.New(user1, "octocat/helloworld#2")
+	d5.StartedAt = time.Date(2018, 3, 2, 13, 0, 0, 0, time.UTC)
+
+	return []deploy.Deploy{d1, d2, d3, d4, d5}
+}
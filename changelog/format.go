@@ -0,0 +1,71 @@
+package changelog
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var (
+	markdownEscaper = strings.NewReplacer("\\", "\\\\", "[", "\\[", "]", "\\]", "*", "\\*", "_", "\\_", "`", "\\`", "<", "&lt;", ">", "&gt;")
+	slackEscaper    = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+	markdownTemplate = template.Must(
+		template.New("markdown").
+			Funcs(template.FuncMap{
+				"ftime":  func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 MST") },
+				"escape": markdownEscaper.Replace,
+			}).
+			Parse(strings.TrimSpace(`
+# Changelog
+{{ range .Deploys }}
+## {{ .FinishedAt | ftime }}
+
+Deployed by {{ .DeployedBy | escape }}
+{{ range .Repositories }}
+### {{ .Name | escape }}
+
+{{ range .PullRequests -}}
+* [#{{ .Number }}]({{ .URL }}){{ with .Title }} {{ . | escape }}{{ end }}{{ with .Author }} by @{{ . | escape }}{{ end }}{{ range .Labels }} ` + "`{{ . }}`" + `{{ end }}
+{{ end -}}
+{{ end -}}
+{{ else }}
+No pull requests have been deployed
+{{ end }}`)))
+
+	slackTemplate = template.Must(
+		template.New("slack").
+			Funcs(template.FuncMap{
+				"ftime":  func(t time.Time) string { return t.UTC().Format(time.RFC822) },
+				"escape": slackEscaper.Replace,
+			}).
+			Parse(strings.TrimSpace(`
+{{ range $i, $d := .Deploys }}{{ if $i }}
+{{ end }}*{{ .FinishedAt | ftime }}*, deployed by {{ .DeployedBy | escape }}
+{{ range .Repositories -}}
+_{{ .Name | escape }}_
+{{ range .PullRequests -}}
+• <{{ .URL }}|#{{ .Number }}>{{ with .Title }} {{ . | escape }}{{ end }}{{ with .Author }} by {{ . | escape }}{{ end }}{{ range .Labels }} ` + "`{{ . | escape }}`" + `{{ end }}
+{{ end -}}
+{{ end -}}
+{{ else -}}
+No pull requests have been deployed
+{{ end }}`)))
+)
+
+// Markdown writes changelog to w as a Markdown document, i.e. to publish it in a wiki.
+func Markdown(w io.Writer, cl Changelog) error {
+	return markdownTemplate.Execute(w, cl)
+}
+
+// SlackMarkdown renders changelog using Slack message formatting.
+func SlackMarkdown(cl Changelog) (string, error) {
+	var buf bytes.Buffer
+	if err := slackTemplate.Execute(&buf, cl); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
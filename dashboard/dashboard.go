@@ -2,16 +2,22 @@ package dashboard
 
 import (
 	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/andrewslotin/michael/audit"
+	"github.com/andrewslotin/michael/changelog"
 	"github.com/andrewslotin/michael/dashboard/formatters"
 	"github.com/andrewslotin/michael/deploy"
 )
 
 type Dashboard struct {
-	repo deploy.Repository
+	repo      deploy.Repository
+	auditLog  audit.Reader
+	changelog *changelog.Builder
 }
 
 func New(repo deploy.Repository) *Dashboard {
@@ -20,6 +26,16 @@ func New(repo deploy.Repository) *Dashboard {
 	}
 }
 
+// SetAuditLog enables /CHANNEL/audit page listing actions performed in channel.
+func (h *Dashboard) SetAuditLog(l audit.Reader) {
+	h.auditLog = l
+}
+
+// SetChangelog enables /CHANNEL/changelog page listing pull requests deployed in channel.
+func (h *Dashboard) SetChangelog(b *changelog.Builder) {
+	h.changelog = b
+}
+
 func (h *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	channelID := ChannelIDFromRequest(r)
 	if channelID == "" {
@@ -27,27 +43,103 @@ func (h *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var history []deploy.Deploy
-	if v := r.FormValue("since"); v != "" {
-		timeSince, err := time.Parse(time.RFC3339, v)
-		if err != nil {
-			if err = Responder(r).RespondWithError(w, errors.New("Malformed time in `since` parameter"), http.StatusBadRequest); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-			}
+	switch channelPage(r.URL.Path, channelID) {
+	case "/audit":
+		h.serveAuditLog(w, r, channelID)
+		return
+	case "/changelog":
+		h.serveChangelog(w, r, channelID)
+		return
+	}
+
+	history, ok := h.history(w, r, channelID)
+	if !ok {
+		return
+	}
+
+	if err := Responder(r).RespondWithHistory(w, history); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// history returns channel deploys started after the time provided in `since` parameter or the whole history if
+// it's omitted. If the parameter is malformed, history responds with an error and returns false.
+func (h *Dashboard) history(w http.ResponseWriter, r *http.Request, channelID string) ([]deploy.Deploy, bool) {
+	v := r.FormValue("since")
+	if v == "" {
+		return h.repo.All(channelID), true
+	}
 
-			return
+	timeSince, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		if err = Responder(r).RespondWithError(w, errors.New("Malformed time in `since` parameter"), http.StatusBadRequest); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 
-		history = h.repo.Since(channelID, timeSince)
-	} else {
-		history = h.repo.All(channelID)
+		return nil, false
 	}
 
-	if err := Responder(r).RespondWithHistory(w, history); err != nil {
+	return h.repo.Since(channelID, timeSince), true
+}
+
+func (h *Dashboard) serveChangelog(w http.ResponseWriter, r *http.Request, channelID string) {
+	if h.changelog == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	history, ok := h.history(w, r, channelID)
+	if !ok {
+		return
+	}
+
+	cl := h.changelog.Build(r.Context(), history, changelog.Options{
+		Labels:  isEnabled(r.FormValue("labels")),
+		Authors: isEnabled(r.FormValue("authors")),
+	})
+
+	if err := Responder(r).RespondWithChangelog(w, cl); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
+func (h *Dashboard) serveAuditLog(w http.ResponseWriter, r *http.Request, channelID string) {
+	if h.auditLog == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	entries, err := h.auditLog.Entries(channelID)
+	if err != nil {
+		log.Printf("failed to read audit log of %s: %s", channelID, err)
+		if err = Responder(r).RespondWithError(w, errors.New("Failed to read audit log"), http.StatusInternalServerError); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	if err := Responder(r).RespondWithAuditLog(w, entries); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// channelPage returns the path of channel page without format extension, i.e. /audit for /CHANNEL/audit.json.
+func channelPage(path, channelID string) string {
+	page := strings.TrimPrefix(strings.TrimPrefix(path, "/"), channelID)
+	if n := strings.LastIndexByte(page, '.'); n >= 0 {
+		page = page[:n]
+	}
+
+	return page
+}
+
+// isEnabled returns true if query parameter value is set to a truthy value, i.e. ?labels=1 or ?labels=true.
+func isEnabled(v string) bool {
+	enabled, _ := strconv.ParseBool(v)
+	return enabled
+}
+
 // ChannelIDFromRequest extracts and returns channelID from request URL.
 func ChannelIDFromRequest(r *http.Request) string {
 	path := strings.TrimPrefix(r.URL.Path, "/")
@@ -69,7 +161,9 @@ func Responder(r *http.Request) formatters.ResponseFormatter {
 	switch {
 	case strings.HasSuffix(r.URL.Path, ".json"):
 		return formatters.JSON
-	case strings.HasSuffix(r.URL.Path, ".txt"):
+	case strings.HasSuffix(r.URL.Path, ".jsonl"):
+		return formatters.JSONLines
+	case strings.HasSuffix(r.URL.Path, ".txt"), strings.HasSuffix(r.URL.Path, ".md"):
 		return formatters.PlainText
 	default:
 		return formatters.PlainText
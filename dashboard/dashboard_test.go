@@ -9,8 +9,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/andrewslotin/michael/audit"
+	"github.com/andrewslotin/michael/changelog"
 	"github.com/andrewslotin/michael/dashboard"
 	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/github"
 	"github.com/andrewslotin/michael/slack"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -116,6 +119,73 @@ func TestDashboard_MultipleDeploys(t *testing.T) {
 	repo.AssertExpectations(t)
 }
 
+func TestDashboard_ApprovedDeploy(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	d := deploy.New(slack.User{ID: "1", Name: "Test User"}, "Test deploy")
+	d.ApprovedBy = slack.User{ID: "2", Name: "Another User"}
+	d.ApprovedAt = time.Date(2016, 8, 4, 7, 27, 0, 0, time.UTC)
+	d.StartedAt = time.Date(2016, 8, 4, 7, 28, 0, 0, time.UTC)
+
+	var repo repoMock
+	repo.On("All", "key1").Return([]deploy.Deploy{d})
+
+	mux.Handle("/", dashboard.New(repo))
+
+	response, err := http.Get(baseURL + "/key1")
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	require.NoError(t, err)
+
+	assert.Contains(t, string(body), "* Test User is currently deploying Test deploy (approved by Another User) since 04 Aug 16 07:28 UTC")
+
+	response, err = http.Get(baseURL + "/key1.json")
+	require.NoError(t, err)
+
+	body, err = ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	require.NoError(t, err)
+
+	assert.Contains(t, string(body), `"approved_by":"Another User","approved_at":"2016-08-04T07:27:00Z"`)
+}
+
+func TestDashboard_References(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	d := deploy.New(slack.User{ID: "1", Name: "Test User"}, "org/api#1, org/api@7fd1a60, org/api@v1.2...v1.3 and org/web@v2.0 for OPS-12")
+	d.StartedAt = time.Date(2016, 8, 4, 7, 28, 0, 0, time.UTC)
+	d.References = []deploy.Reference{{Provider: "jira", ID: "OPS-12", URL: "https://jira.example.com/browse/OPS-12"}}
+
+	var repo repoMock
+	repo.On("All", "key1").Return([]deploy.Deploy{d})
+
+	mux.Handle("/", dashboard.New(repo))
+
+	response, err := http.Get(baseURL + "/key1")
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	require.NoError(t, err)
+
+	assert.Contains(t, string(body), "since 04 Aug 16 07:28 UTC\n    References: org/api#1, org/api@7fd1a60, org/web@v2.0, org/api@v1.2...v1.3, OPS-12\n")
+
+	for _, ext := range []string{".json", ".jsonl"} {
+		response, err = http.Get(baseURL + "/key1" + ext)
+		require.NoError(t, err)
+
+		body, err = ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		require.NoError(t, err)
+
+		assert.Contains(t, string(body), `"pull_requests":["org/api#1"],"commits":["org/api@7fd1a60"],"tags":["org/web@v2.0"],"ranges":["org/api@v1.2...v1.3"],"references":[{"provider":"jira","id":"OPS-12","url":"https://jira.example.com/browse/OPS-12"}]`, ext)
+	}
+}
+
 func TestDashboard_NoDeploys(t *testing.T) {
 	baseURL, mux, teardown := setup()
 	defer teardown()
@@ -233,6 +303,146 @@ func TestDashboard_MissingChannelID(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, response.StatusCode)
 }
 
+func TestDashboard_AuditLog(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	auditLog := audit.NewRecordLog(deploy.NewInMemoryStore())
+	entries := []audit.Entry{
+		{Time: time.Date(2016, 8, 4, 9, 28, 0, 0, time.UTC), Source: audit.SourceSlack, ChannelID: "key1", User: slack.User{ID: "U1", Name: "user1"}, Text: "Test deploy", Outcome: audit.Succeeded},
+		{Time: time.Date(2016, 8, 4, 9, 30, 0, 0, time.UTC), Source: audit.SourceSlack, ChannelID: "key1", User: slack.User{ID: "U2", Name: "user2"}, Text: "abort", Outcome: audit.Denied, Details: "maintainer role is required to abort deploys started by others"},
+		{Time: time.Date(2016, 8, 4, 9, 31, 0, 0, time.UTC), Source: audit.SourceSlack, ChannelID: "key2", User: slack.User{ID: "U2", Name: "user2"}, Text: "done", Outcome: audit.Failed},
+	}
+	for _, e := range entries {
+		require.NoError(t, auditLog.Append(e))
+	}
+
+	d := dashboard.New(new(repoMock))
+	d.SetAuditLog(auditLog)
+	mux.Handle("/", d)
+
+	response, err := http.Get(baseURL + "/key1/audit")
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "text/plain", response.Header.Get("Content-Type"))
+
+	expected := "" +
+		"Audit log\n" +
+		"---------\n" +
+		"\n" +
+		"* 04 Aug 16 09:28 UTC [slack] user1: Test deploy — succeeded\n" +
+		"* 04 Aug 16 09:30 UTC [slack] user2: abort — denied (maintainer role is required to abort deploys started by others)"
+
+	assert.Equal(t, expected, string(bytes.TrimSpace(body)))
+
+	response, err = http.Get(baseURL + "/key1/audit.jsonl")
+	require.NoError(t, err)
+
+	body, err = ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "application/x-ndjson", response.Header.Get("Content-Type"))
+
+	lines := bytes.Split(bytes.TrimSpace(body), []byte("\n"))
+	if assert.Len(t, lines, 2) {
+		assert.JSONEq(t, `{"time":"2016-08-04T09:28:00Z","source":"slack","channel_id":"key1","user_id":"U1","user_name":"user1","text":"Test deploy","outcome":"succeeded"}`, string(lines[0]))
+		assert.JSONEq(t, `{"time":"2016-08-04T09:30:00Z","source":"slack","channel_id":"key1","user_id":"U2","user_name":"user2","text":"abort","outcome":"denied","details":"maintainer role is required to abort deploys started by others"}`, string(lines[1]))
+	}
+}
+
+func TestDashboard_AuditLog_NotEnabled(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	mux.Handle("/", dashboard.New(new(repoMock)))
+
+	response, err := http.Get(baseURL + "/key1/audit")
+	require.NoError(t, err)
+	response.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
+func TestDashboard_Changelog(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	githubMux := http.NewServeMux()
+	githubMux.HandleFunc("/repos/octocat/helloworld/pulls/1", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":1,"title":"Fix typo","html_url":"https://github.com/octocat/helloworld/pull/1","user":{"login":"author1"},"labels":[{"name":"bug"}]}`))
+	})
+	githubSrv := httptest.NewServer(githubMux)
+	defer githubSrv.Close()
+
+	githubClient := github.NewClient("", nil)
+	githubClient.BaseURL = githubSrv.URL
+
+	d := deploy.New(slack.User{ID: "1", Name: "Test User"}, "octocat/helloworld#1")
+	d.StartedAt = time.Date(2016, 8, 4, 9, 28, 0, 0, time.UTC)
+	d.FinishedAt = time.Date(2016, 8, 4, 9, 30, 0, 0, time.UTC)
+
+	repo := new(repoMock)
+	repo.On("All", "key1").Return([]deploy.Deploy{d})
+	repo.On("Since", "key1", d.StartedAt).Return([]deploy.Deploy{d})
+
+	h := dashboard.New(repo)
+	h.SetChangelog(changelog.NewBuilder(githubClient))
+	mux.Handle("/", h)
+
+	response, err := http.Get(baseURL + "/key1/changelog.md?authors=1")
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, string(body), "## 2016-08-04 09:30 UTC")
+	assert.Contains(t, string(body), "* [#1](https://github.com/octocat/helloworld/pull/1) Fix typo by @author1\n")
+
+	response, err = http.Get(baseURL + "/key1/changelog.json?labels=true&since=" + url.QueryEscape(d.StartedAt.Format(time.RFC3339)))
+	require.NoError(t, err)
+
+	body, err = ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+	assert.JSONEq(t, `{"deploys":[{
+		"deployed_by":"Test User",
+		"subject":"octocat/helloworld#1",
+		"started_at":"2016-08-04T09:28:00Z",
+		"finished_at":"2016-08-04T09:30:00Z",
+		"repositories":[{
+			"name":"octocat/helloworld",
+			"pull_requests":[{"number":1,"title":"Fix typo","url":"https://github.com/octocat/helloworld/pull/1","labels":["bug"]}]
+		}]
+	}]}`, string(body))
+
+	repo.AssertExpectations(t)
+}
+
+func TestDashboard_Changelog_NotEnabled(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	mux.Handle("/", dashboard.New(new(repoMock)))
+
+	response, err := http.Get(baseURL + "/key1/changelog")
+	require.NoError(t, err)
+	response.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
 func TestChannelIDFromRequest(t *testing.T) {
 	examples := map[string]string{
 		"/channel1":                        "channel1",
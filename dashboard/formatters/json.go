@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/andrewslotin/michael/audit"
+	"github.com/andrewslotin/michael/changelog"
 	"github.com/andrewslotin/michael/deploy"
 )
 
@@ -13,12 +15,109 @@ var (
 )
 
 type jsonPresenter struct {
-	Author     string    `json:"author"`
-	Subject    string    `json:"subject"`
-	StartedAt  time.Time `json:"started_at"`
-	FinishedAt time.Time `json:"finished_at,omitempty"`
-	Aborted    bool      `json:"aborted,omitempty"`
-	Reason     string    `json:"reason,omitempty"`
+	Author       string                   `json:"author"`
+	Subject      string                   `json:"subject"`
+	StartedAt    time.Time                `json:"started_at"`
+	FinishedAt   time.Time                `json:"finished_at,omitempty"`
+	Aborted      bool                     `json:"aborted,omitempty"`
+	Reason       string                   `json:"reason,omitempty"`
+	FinishedBy   string                   `json:"finished_by,omitempty"`
+	AbortedBy    string                   `json:"aborted_by,omitempty"`
+	ApprovedBy   string                   `json:"approved_by,omitempty"`
+	ApprovedAt   *time.Time               `json:"approved_at,omitempty"`
+	PullRequests []string                 `json:"pull_requests,omitempty"`
+	Commits      []string                 `json:"commits,omitempty"`
+	Tags         []string                 `json:"tags,omitempty"`
+	Ranges       []string                 `json:"ranges,omitempty"`
+	References   []jsonReferencePresenter `json:"references,omitempty"`
+}
+
+type jsonReferencePresenter struct {
+	Provider string `json:"provider"`
+	ID       string `json:"id"`
+	URL      string `json:"url"`
+}
+
+func newJSONPresenter(d deploy.Deploy) jsonPresenter {
+	v := jsonPresenter{
+		Author:     d.User.Name,
+		Subject:    d.Subject,
+		StartedAt:  d.StartedAt,
+		FinishedAt: d.FinishedAt,
+		Aborted:    d.Aborted,
+		Reason:     d.AbortReason,
+		FinishedBy: d.FinishedBy.Name,
+		AbortedBy:  d.AbortedBy.Name,
+		ApprovedBy: d.ApprovedBy.Name,
+	}
+
+	if !d.ApprovedAt.IsZero() {
+		v.ApprovedAt = &d.ApprovedAt
+	}
+
+	for _, ref := range d.PullRequests {
+		v.PullRequests = append(v.PullRequests, ref.String())
+	}
+
+	for _, ref := range d.Commits {
+		v.Commits = append(v.Commits, ref.String())
+	}
+
+	for _, ref := range d.Tags {
+		v.Tags = append(v.Tags, ref.String())
+	}
+
+	for _, ref := range d.Ranges {
+		v.Ranges = append(v.Ranges, ref.String())
+	}
+
+	for _, ref := range d.References {
+		v.References = append(v.References, jsonReferencePresenter{
+			Provider: ref.Provider,
+			ID:       ref.ID,
+			URL:      ref.URL,
+		})
+	}
+
+	return v
+}
+
+type jsonIndexedPresenter struct {
+	ChannelID string `json:"channel_id"`
+	jsonPresenter
+	Outcome string `json:"outcome"`
+}
+
+func newJSONIndexedPresenter(d deploy.IndexedDeploy) jsonIndexedPresenter {
+	return jsonIndexedPresenter{
+		ChannelID:     d.ChannelID,
+		jsonPresenter: newJSONPresenter(d.Deploy),
+		Outcome:       d.Outcome(),
+	}
+}
+
+type jsonAuditPresenter struct {
+	Time      time.Time     `json:"time"`
+	Source    audit.Source  `json:"source"`
+	ChannelID string        `json:"channel_id,omitempty"`
+	UserID    string        `json:"user_id,omitempty"`
+	UserName  string        `json:"user_name,omitempty"`
+	Text      string        `json:"text"`
+	Outcome   audit.Outcome `json:"outcome"`
+	Details   string        `json:"details,omitempty"`
+}
+
+func newJSONAuditPresenter(e audit.Entry) jsonAuditPresenter {
+	return jsonAuditPresenter{
+		Time:      e.Time,
+		Source:    e.Source,
+		ChannelID: e.ChannelID,
+		UserID:    e.User.ID,
+		UserName:  e.User.Name,
+		Text:      e.Text,
+		Outcome:   e.Outcome,
+		Details:   e.Details,
+	}
 }
 
 type jsonFormatter struct{}
@@ -28,12 +127,53 @@ func (jsonFormatter) RespondWithHistory(w http.ResponseWriter, history []deploy.
 
 	v := make([]jsonPresenter, len(history))
 	for i, d := range history {
-		v[i].Author = d.User.Name
-		v[i].Subject = d.Subject
-		v[i].StartedAt = d.StartedAt
-		v[i].FinishedAt = d.FinishedAt
-		v[i].Aborted = d.Aborted
-		v[i].Reason = d.AbortReason
+		v[i] = newJSONPresenter(d)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+func (jsonFormatter) RespondWithAuditLog(w http.ResponseWriter, entries []audit.Entry) error {
+	w.Header().Set("Content-Type", "application/json")
+
+	v := make([]jsonAuditPresenter, len(entries))
+	for i, e := range entries {
+		v[i] = newJSONAuditPresenter(e)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+func (jsonFormatter) RespondWithChangelog(w http.ResponseWriter, cl changelog.Changelog) error {
+	w.Header().Set("Content-Type", "application/json")
+
+	data, err := json.Marshal(cl)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+func (jsonFormatter) RespondWithDeploysOf(w http.ResponseWriter, ref string, deploys []deploy.IndexedDeploy) error {
+	w.Header().Set("Content-Type", "application/json")
+
+	v := make([]jsonIndexedPresenter, len(deploys))
+	for i, d := range deploys {
+		v[i] = newJSONIndexedPresenter(d)
 	}
 
 	data, err := json.Marshal(v)
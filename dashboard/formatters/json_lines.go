@@ -0,0 +1,73 @@
+package formatters
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/andrewslotin/michael/audit"
+	"github.com/andrewslotin/michael/changelog"
+	"github.com/andrewslotin/michael/deploy"
+)
+
+var (
+	JSONLines jsonLinesFormatter
+)
+
+// jsonLinesFormatter responds with one JSON object per line, which is convenient to export large logs.
+type jsonLinesFormatter struct{}
+
+func (jsonLinesFormatter) RespondWithHistory(w http.ResponseWriter, history []deploy.Deploy) error {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	enc := json.NewEncoder(w)
+	for _, d := range history {
+		if err := enc.Encode(newJSONPresenter(d)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (jsonLinesFormatter) RespondWithAuditLog(w http.ResponseWriter, entries []audit.Entry) error {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(newJSONAuditPresenter(e)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (jsonLinesFormatter) RespondWithChangelog(w http.ResponseWriter, cl changelog.Changelog) error {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	enc := json.NewEncoder(w)
+	for _, d := range cl.Deploys {
+		if err := enc.Encode(d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (jsonLinesFormatter) RespondWithDeploysOf(w http.ResponseWriter, ref string, deploys []deploy.IndexedDeploy) error {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	enc := json.NewEncoder(w)
+	for _, d := range deploys {
+		if err := enc.Encode(newJSONIndexedPresenter(d)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (jsonLinesFormatter) RespondWithError(w http.ResponseWriter, err error, statusCode int) error {
+	return JSON.RespondWithError(w, err, statusCode)
+}
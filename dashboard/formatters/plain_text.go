@@ -6,6 +6,8 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/andrewslotin/michael/audit"
+	"github.com/andrewslotin/michael/changelog"
 	"github.com/andrewslotin/michael/deploy"
 )
 
@@ -15,7 +17,9 @@ var (
 	dashboardTemplate = template.Must(
 		template.New("dashboard").
 			Funcs(template.FuncMap{
-				"ftime": func(t time.Time) string { return t.Format(time.RFC822) },
+				"ftime":      func(t time.Time) string { return t.Format(time.RFC822) },
+				"references": references,
+				"join":       strings.Join,
 			}).
 			Parse(strings.TrimSpace(`
 Deploy history
@@ -23,13 +27,44 @@ Deploy history
 
 {{ range . -}}
 {{ if not .FinishedAt.IsZero -}}
-  * {{ .User.Name }} was deploying {{ .Subject }} since {{ .StartedAt | ftime }} until {{ .FinishedAt | ftime }}{{ if .Aborted }} (aborted{{ if .AbortReason }}, {{ .AbortReason }}{{ end }}){{ end }}
+  * {{ .User.Name }} was deploying {{ .Subject }}{{ if .ApprovedBy.Name }} (approved by {{ .ApprovedBy.Name }}){{ end }} since {{ .StartedAt | ftime }} until {{ .FinishedAt | ftime }}{{ if .Aborted }} (aborted{{ if .AbortedBy.Name }} by {{ .AbortedBy.Name }}{{ end }}{{ if .AbortReason }}, {{ .AbortReason }}{{ end }}){{ else if and .FinishedBy.Name (ne .FinishedBy.ID .User.ID) }} (finished by {{ .FinishedBy.Name }}){{ end }}{{ with references . }}
+    References: {{ join . ", " }}{{ end }}
 {{ else -}}
-  * {{ .User.Name }} is currently deploying {{ .Subject }} since {{ .StartedAt | ftime }}
+  * {{ .User.Name }} is currently deploying {{ .Subject }}{{ if .ApprovedBy.Name }} (approved by {{ .ApprovedBy.Name }}){{ end }} since {{ .StartedAt | ftime }}{{ with references . }}
+    References: {{ join . ", " }}{{ end }}
 {{ end -}}
 {{ else -}}
   No deploys in channel so far
 {{ end }}`)))
+
+	auditLogTemplate = template.Must(
+		template.New("audit").
+			Funcs(template.FuncMap{
+				"ftime": func(t time.Time) string { return t.Format(time.RFC822) },
+			}).
+			Parse(strings.TrimSpace(`
+Audit log
+---------
+
+{{ range . -}}
+  * {{ .Time | ftime }} [{{ .Source }}] {{ with .User.Name }}{{ . }}: {{ end }}{{ .Text }} — {{ .Outcome }}{{ with .Details }} ({{ . }}){{ end }}
+{{ else -}}
+  No actions in channel so far
+{{ end }}`)))
+
+	deploysOfTemplate = template.Must(
+		template.New("deploys_of").
+			Funcs(template.FuncMap{
+				"ftime": func(t time.Time) string { return t.Format(time.RFC822) },
+			}).
+			Parse(strings.TrimSpace(`
+Deploys of {{ .Ref }}
+
+{{ range .Deploys -}}
+  * {{ .StartedAt | ftime }} in {{ .ChannelID }} by {{ .User.Name }} — {{ .Outcome }}
+{{ else -}}
+  Not deployed so far
+{{ end }}`)))
 )
 
 type plainTextFormatter struct{}
@@ -39,6 +74,25 @@ func (plainTextFormatter) RespondWithHistory(w http.ResponseWriter, history []de
 	return dashboardTemplate.Execute(w, history)
 }
 
+func (plainTextFormatter) RespondWithAuditLog(w http.ResponseWriter, entries []audit.Entry) error {
+	w.Header().Set("Content-Type", "text/plain")
+	return auditLogTemplate.Execute(w, entries)
+}
+
+// RespondWithChangelog responds with changelog in Markdown, which is readable as plain text as well.
+func (plainTextFormatter) RespondWithChangelog(w http.ResponseWriter, cl changelog.Changelog) error {
+	w.Header().Set("Content-Type", "text/plain")
+	return changelog.Markdown(w, cl)
+}
+
+func (plainTextFormatter) RespondWithDeploysOf(w http.ResponseWriter, ref string, deploys []deploy.IndexedDeploy) error {
+	w.Header().Set("Content-Type", "text/plain")
+	return deploysOfTemplate.Execute(w, struct {
+		Ref     string
+		Deploys []deploy.IndexedDeploy
+	}{ref, deploys})
+}
+
 func (plainTextFormatter) RespondWithError(w http.ResponseWriter, err error, statusCode int) error {
 	w.Header().Set("Content-Type", "text/plain")
 	http.Error(w, err.Error(), statusCode)
@@ -3,10 +3,42 @@ package formatters
 import (
 	"net/http"
 
+	"github.com/andrewslotin/michael/audit"
+	"github.com/andrewslotin/michael/changelog"
 	"github.com/andrewslotin/michael/deploy"
 )
 
 type ResponseFormatter interface {
 	RespondWithHistory(http.ResponseWriter, []deploy.Deploy) error
+	RespondWithAuditLog(http.ResponseWriter, []audit.Entry) error
+	RespondWithChangelog(http.ResponseWriter, changelog.Changelog) error
+	RespondWithDeploysOf(w http.ResponseWriter, ref string, deploys []deploy.IndexedDeploy) error
 	RespondWithError(http.ResponseWriter, error, int) error
 }
+
+// references returns the list of pull requests, commits, tags, commit ranges and references recognized by reference
+// providers mentioned in deploy subject.
+func references(d deploy.Deploy) []string {
+	var refs []string
+	for _, ref := range d.PullRequests {
+		refs = append(refs, ref.String())
+	}
+
+	for _, ref := range d.Commits {
+		refs = append(refs, ref.String())
+	}
+
+	for _, ref := range d.Tags {
+		refs = append(refs, ref.String())
+	}
+
+	for _, ref := range d.Ranges {
+		refs = append(refs, ref.String())
+	}
+
+	for _, ref := range d.References {
+		refs = append(refs, ref.String())
+	}
+
+	return refs
+}
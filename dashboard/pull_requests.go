@@ -0,0 +1,98 @@
+package dashboard
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/andrewslotin/michael/deploy"
+)
+
+// ChannelAccessChecker is an interface that wraps CanAccess method.
+//
+// CanAccess is used to check whether the request grants access to the deploy history of channel.
+type ChannelAccessChecker interface {
+	CanAccess(r *http.Request, channelID string) (bool, error)
+}
+
+// PullRequests serves /prs/OWNER/REPO/NUMBER pages listing deploys that included a pull request from all channels
+// the requester has access to.
+type PullRequests struct {
+	index  deploy.ReferenceIndex
+	access ChannelAccessChecker
+}
+
+func NewPullRequests(index deploy.ReferenceIndex, access ChannelAccessChecker) *PullRequests {
+	return &PullRequests{
+		index:  index,
+		access: access,
+	}
+}
+
+func (h *PullRequests) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ref, ok := PullRequestFromRequest(r)
+	if !ok {
+		if err := Responder(r).RespondWithError(w, errors.New("Malformed pull request reference, expected /prs/OWNER/REPO/NUMBER"), http.StatusNotFound); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	deploys, err := h.accessibleDeploys(r, h.index.DeploysOf(ref.Key()))
+	if err != nil {
+		log.Printf("failed to check channel access: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	name := ref.Repository + "#" + ref.ID
+	if err := Responder(r).RespondWithDeploysOf(w, name, deploys); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// accessibleDeploys filters out deploys made in channels the request does not grant access to.
+func (h *PullRequests) accessibleDeploys(r *http.Request, deploys []deploy.IndexedDeploy) ([]deploy.IndexedDeploy, error) {
+	allowed := make(map[string]bool)
+
+	var filtered []deploy.IndexedDeploy
+	for _, d := range deploys {
+		ok, checked := allowed[d.ChannelID]
+		if !checked {
+			var err error
+			if ok, err = h.access.CanAccess(r, d.ChannelID); err != nil {
+				return nil, err
+			}
+
+			allowed[d.ChannelID] = ok
+		}
+
+		if ok {
+			filtered = append(filtered, d)
+		}
+	}
+
+	return filtered, nil
+}
+
+// PullRequestFromRequest extracts pull request reference from /prs/OWNER/REPO/NUMBER request URL. The second
+// value is false if URL path does not match this pattern.
+func PullRequestFromRequest(r *http.Request) (deploy.PullRequestReference, bool) {
+	fields := strings.Split(strings.TrimPrefix(r.URL.Path, "/prs/"), "/")
+	if len(fields) != 3 || fields[0] == "" || fields[1] == "" {
+		return deploy.PullRequestReference{}, false
+	}
+
+	number := fields[2]
+	if n := strings.IndexByte(number, '.'); n >= 0 {
+		number = number[:n]
+	}
+
+	if number == "" || strings.TrimLeft(number, "0123456789") != "" {
+		return deploy.PullRequestReference{}, false
+	}
+
+	return deploy.PullRequestReference{Repository: fields[0] + "/" + fields[1], ID: number}, true
+}
@@ -0,0 +1,118 @@
+package dashboard_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/dashboard"
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPullRequests(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	store := deploy.NewInMemoryStore()
+
+	d1 := deploy.New(slack.User{ID: "1", Name: "Test User"}, "octocat/helloworld#1")
+	d1.StartedAt = time.Date(2016, 8, 4, 9, 28, 0, 0, time.UTC)
+	d1.FinishedAt = time.Date(2016, 8, 4, 9, 30, 0, 0, time.UTC)
+	store.Set("C1", d1)
+
+	d2 := deploy.New(slack.User{ID: "2", Name: "Another User"}, "https://github.com/octocat/helloworld/pull/1 to staging")
+	d2.StartedAt = time.Date(2016, 8, 4, 10, 0, 0, 0, time.UTC)
+	store.Set("C2", d2)
+
+	mux.Handle("/prs/", dashboard.NewPullRequests(store, channelAccessStub{"C1": true, "C2": true}))
+
+	response, err := http.Get(baseURL + "/prs/octocat/helloworld/1")
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "Deploys of octocat/helloworld#1\n\n"+
+		"* 04 Aug 16 09:28 UTC in C1 by Test User — deployed\n"+
+		"* 04 Aug 16 10:00 UTC in C2 by Another User — in progress\n", string(body))
+
+	response, err = http.Get(baseURL + "/prs/octocat/helloworld/1.json")
+	require.NoError(t, err)
+
+	body, err = ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+	assert.JSONEq(t, `[
+		{"channel_id":"C1","author":"Test User","subject":"octocat/helloworld#1","started_at":"2016-08-04T09:28:00Z","finished_at":"2016-08-04T09:30:00Z","pull_requests":["octocat/helloworld#1"],"outcome":"deployed"},
+		{"channel_id":"C2","author":"Another User","subject":"https://github.com/octocat/helloworld/pull/1 to staging","started_at":"2016-08-04T10:00:00Z","finished_at":"0001-01-01T00:00:00Z","pull_requests":["octocat/helloworld#1"],"outcome":"in progress"}
+	]`, string(body))
+
+	response, err = http.Get(baseURL + "/prs/octocat/helloworld/2.txt")
+	require.NoError(t, err)
+
+	body, err = ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, string(body), "Not deployed so far")
+}
+
+func TestPullRequests_ChannelAccess(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	store := deploy.NewInMemoryStore()
+
+	d1 := deploy.New(slack.User{ID: "1", Name: "Test User"}, "octocat/helloworld#1")
+	d1.StartedAt = time.Date(2016, 8, 4, 9, 28, 0, 0, time.UTC)
+	store.Set("C1", d1)
+
+	d2 := deploy.New(slack.User{ID: "2", Name: "Another User"}, "octocat/helloworld#1 to staging")
+	d2.StartedAt = time.Date(2016, 8, 4, 10, 0, 0, 0, time.UTC)
+	store.Set("C2", d2)
+
+	mux.Handle("/prs/", dashboard.NewPullRequests(store, channelAccessStub{"C2": true}))
+
+	response, err := http.Get(baseURL + "/prs/octocat/helloworld/1")
+	require.NoError(t, err)
+
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "Deploys of octocat/helloworld#1\n\n"+
+		"* 04 Aug 16 10:00 UTC in C2 by Another User — in progress\n", string(body))
+}
+
+func TestPullRequests_MalformedReference(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	mux.Handle("/prs/", dashboard.NewPullRequests(deploy.NewInMemoryStore(), channelAccessStub{}))
+
+	for _, path := range [...]string{"/prs/octocat/helloworld", "/prs/octocat/helloworld/pulls", "/prs/octocat//1", "/prs/a/b/c/1"} {
+		response, err := http.Get(baseURL + path)
+		require.NoError(t, err)
+		response.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, response.StatusCode, path)
+	}
+}
+
+// channelAccessStub grants access to channels which IDs are set to true.
+type channelAccessStub map[string]bool
+
+func (s channelAccessStub) CanAccess(r *http.Request, channelID string) (bool, error) {
+	return s[channelID], nil
+}
@@ -0,0 +1,223 @@
+package deploy
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+const snapshotFilePrefix = "michael-"
+
+// WriteSnapshot writes a consistent copy of the database into w. Other readers and writers are not blocked
+// while the snapshot is being written.
+func (s *BoltDBStore) WriteSnapshot(w io.Writer) (n int64, err error) {
+	err = s.view(func(tx *bolt.Tx) error {
+		n, err = tx.WriteTo(w)
+		return err
+	})
+
+	return n, err
+}
+
+// ValidateBoltDBSnapshot checks that the file in path is a consistent BoltDB database with a layout version
+// supported by this build.
+func ValidateBoltDBSnapshot(path string) error {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 2 * time.Second, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot %s: %s", path, err)
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		version, err := readSchemaVersion(tx)
+		if err != nil {
+			return err
+		}
+
+		if version > BoltDBSchemaVersion {
+			return fmt.Errorf("%w (found %d, expected %d or less)", ErrUnsupportedSchemaVersion, version, BoltDBSchemaVersion)
+		}
+
+		for err := range tx.Check() {
+			return fmt.Errorf("snapshot %s is corrupted: %s", path, err)
+		}
+
+		return nil
+	})
+}
+
+// RestoreBoltDBSnapshot validates the snapshot in snapshotPath and replaces the database in dbPath with it.
+// The replaced database is kept next to it with .before-restore suffix. The database must not be in use while
+// it is being restored.
+func RestoreBoltDBSnapshot(snapshotPath, dbPath string) error {
+	if err := ValidateBoltDBSnapshot(snapshotPath); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dbPath); err == nil {
+		// Make sure there is no one holding the lock on the current database file
+		db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: 2 * time.Second})
+		if err != nil {
+			return fmt.Errorf("failed to lock db %s, make sure michael is not running: %s", dbPath, err)
+		}
+		db.Close()
+
+		if err := copyFile(dbPath, dbPath+".before-restore"); err != nil {
+			return fmt.Errorf("failed to keep a copy of %s: %s", dbPath, err)
+		}
+	}
+
+	return copyFile(snapshotPath, dbPath)
+}
+
+// BoltDBSnapshotter periodically writes snapshots of BoltDBStore into a directory keeping only a limited number
+// of latest ones.
+type BoltDBSnapshotter struct {
+	store *BoltDBStore
+	dir   string
+	keep  int
+}
+
+// NewBoltDBSnapshotter returns a snapshotter that writes snapshots of store into dir and removes all but keep
+// latest of them. Non-positive keep means that no snapshots are removed.
+func NewBoltDBSnapshotter(store *BoltDBStore, dir string, keep int) *BoltDBSnapshotter {
+	return &BoltDBSnapshotter{
+		store: store,
+		dir:   dir,
+		keep:  keep,
+	}
+}
+
+// Run writes a snapshot every interval until stop is closed.
+func (s *BoltDBSnapshotter) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			path, err := s.Snapshot()
+			if err != nil {
+				log.Printf("failed to snapshot deploy DB: %s", err)
+				continue
+			}
+
+			log.Printf("deploy DB snapshot written to %s", path)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Snapshot writes a new snapshot, removes outdated ones and returns the path to created file.
+func (s *BoltDBSnapshotter) Snapshot() (string, error) {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create snapshot dir %s: %s", s.dir, err)
+	}
+
+	fd, err := ioutil.TempFile(s.dir, ".snapshot")
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot file in %s: %s", s.dir, err)
+	}
+	defer os.Remove(fd.Name())
+
+	_, err = s.store.WriteSnapshot(fd)
+	if err == nil {
+		err = fd.Sync()
+	}
+	if closeErr := fd.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write snapshot: %s", err)
+	}
+
+	path := filepath.Join(s.dir, snapshotFilePrefix+time.Now().UTC().Format("20060102T150405.000000000Z")+".db")
+	if err := os.Rename(fd.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to write snapshot: %s", err)
+	}
+
+	if err := s.removeOutdated(); err != nil {
+		return path, fmt.Errorf("failed to remove outdated snapshots: %s", err)
+	}
+
+	return path, nil
+}
+
+// Snapshots returns paths to all snapshots in directory ordered from oldest to newest.
+func (s *BoltDBSnapshotter) Snapshots() ([]string, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if name := entry.Name(); !entry.IsDir() && strings.HasPrefix(name, snapshotFilePrefix) && strings.HasSuffix(name, ".db") {
+			paths = append(paths, filepath.Join(s.dir, name))
+		}
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+func (s *BoltDBSnapshotter) removeOutdated() error {
+	if s.keep <= 0 {
+		return nil
+	}
+
+	paths, err := s.Snapshots()
+	if err != nil {
+		return err
+	}
+
+	for len(paths) > s.keep {
+		if err := os.Remove(paths[0]); err != nil {
+			return err
+		}
+		paths = paths[1:]
+	}
+
+	return nil
+}
+
+// copyFile atomically replaces dst with the content of src.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(out.Name(), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(out.Name(), dst)
+}
@@ -0,0 +1,123 @@
+package deploy_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltDBStore_WriteSnapshot_Restore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "michael")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := deploy.NewBoltDBStore(filepath.Join(dir, "source.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	d := deploy.New(slack.User{ID: "U1", Name: "user1"}, "Deploy a/b#1")
+	d.Start()
+	store.Set("C1", d)
+
+	var buf bytes.Buffer
+	n, err := store.WriteSnapshot(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+
+	snapshotPath := filepath.Join(dir, "snapshot.db")
+	require.NoError(t, ioutil.WriteFile(snapshotPath, buf.Bytes(), 0600))
+
+	// Restore into an existing database
+	dbPath := filepath.Join(dir, "restored.db")
+	existing, err := deploy.NewBoltDBStore(dbPath)
+	require.NoError(t, err)
+	existing.Set("C2", deploy.New(slack.User{ID: "U2", Name: "user2"}, "Overwritten deploy"))
+	require.NoError(t, existing.Close())
+
+	require.NoError(t, deploy.RestoreBoltDBSnapshot(snapshotPath, dbPath))
+
+	_, err = os.Stat(dbPath + ".before-restore")
+	assert.NoError(t, err)
+
+	restored, err := deploy.NewBoltDBStore(dbPath)
+	require.NoError(t, err)
+	defer restored.Close()
+
+	if deploys := restored.All("C1"); assert.Len(t, deploys, 1) {
+		assert.True(t, d.Equal(deploys[0]))
+		assert.Equal(t, d.PullRequests, deploys[0].PullRequests)
+	}
+	assert.Empty(t, restored.All("C2"))
+}
+
+func TestRestoreBoltDBSnapshot_DatabaseInUse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "michael")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := deploy.NewBoltDBStore(filepath.Join(dir, "michael.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	snapshotPath := filepath.Join(dir, "snapshot.db")
+	fd, err := os.Create(snapshotPath)
+	require.NoError(t, err)
+	_, err = store.WriteSnapshot(fd)
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+
+	assert.Error(t, deploy.RestoreBoltDBSnapshot(snapshotPath, filepath.Join(dir, "michael.db")))
+}
+
+func TestValidateBoltDBSnapshot_Malformed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "michael")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	snapshotPath := filepath.Join(dir, "snapshot.db")
+	require.NoError(t, ioutil.WriteFile(snapshotPath, bytes.Repeat([]byte("not a bolt db"), 1024), 0600))
+
+	assert.Error(t, deploy.ValidateBoltDBSnapshot(snapshotPath))
+	assert.Error(t, deploy.RestoreBoltDBSnapshot(snapshotPath, filepath.Join(dir, "michael.db")))
+
+	_, err = os.Stat(filepath.Join(dir, "michael.db"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestBoltDBSnapshotter_Snapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "michael")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := deploy.NewBoltDBStore(filepath.Join(dir, "michael.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	d := deploy.New(slack.User{ID: "U1", Name: "user1"}, "Deploy")
+	d.Start()
+	store.Set("C1", d)
+
+	snapshotter := deploy.NewBoltDBSnapshotter(store, filepath.Join(dir, "snapshots"), 2)
+
+	var created []string
+	for i := 0; i < 3; i++ {
+		path, err := snapshotter.Snapshot()
+		require.NoError(t, err)
+		require.NoError(t, deploy.ValidateBoltDBSnapshot(path))
+
+		created = append(created, path)
+		time.Sleep(time.Millisecond)
+	}
+
+	snapshots, err := snapshotter.Snapshots()
+	require.NoError(t, err)
+	assert.Equal(t, created[1:], snapshots)
+}
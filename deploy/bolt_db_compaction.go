@@ -0,0 +1,84 @@
+package deploy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Compact copies all data into a fresh database file and replaces the current one with it. BoltDB never shrinks
+// its file, so this is the only way to reclaim the space taken by removed deploys. Store access is blocked while
+// the database is being compacted.
+func (s *BoltDBStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fd, err := ioutil.TempFile(filepath.Dir(s.path), "."+filepath.Base(s.path))
+	if err != nil {
+		return fmt.Errorf("failed to create compacted db file: %s", err)
+	}
+	fd.Close()
+
+	tmpPath := fd.Name()
+	defer os.Remove(tmpPath)
+
+	if err := compactBoltDB(s.db, tmpPath); err != nil {
+		return err
+	}
+
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("failed to close db %s: %s", s.path, err)
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		err = fmt.Errorf("failed to replace db %s with compacted one: %s", s.path, err)
+	}
+
+	db, openErr := bolt.Open(s.path, 0600, &bolt.Options{Timeout: 2 * time.Second})
+	if openErr != nil {
+		return fmt.Errorf("failed to reopen db %s: %s", s.path, openErr)
+	}
+	s.db = db
+
+	return err
+}
+
+func compactBoltDB(src *bolt.DB, dstPath string) error {
+	dst, err := bolt.Open(dstPath, 0600, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return fmt.Errorf("failed to open compacted db %s: %s", dstPath, err)
+	}
+	defer dst.Close()
+
+	return src.View(func(srcTx *bolt.Tx) error {
+		return dst.Update(func(dstTx *bolt.Tx) error {
+			return srcTx.ForEach(func(name []byte, srcBucket *bolt.Bucket) error {
+				dstBucket, err := dstTx.CreateBucket(name)
+				if err != nil {
+					return fmt.Errorf("failed to create bucket %s: %s", name, err)
+				}
+
+				return copyBucket(dstBucket, srcBucket)
+			})
+		})
+	})
+}
+
+func copyBucket(dst, src *bolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+
+		b, err := dst.CreateBucket(k)
+		if err != nil {
+			return fmt.Errorf("failed to create bucket %s: %s", k, err)
+		}
+
+		return copyBucket(b, src.Bucket(k))
+	})
+}
@@ -0,0 +1,290 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	metaBucketName   = "_meta"
+	schemaVersionKey = "schema_version"
+
+	// Buckets which names start with this prefix hold service data and are not channel histories.
+	serviceBucketPrefix = '_'
+)
+
+// ErrUnsupportedSchemaVersion is returned when the database has been written by a newer version of michael.
+var ErrUnsupportedSchemaVersion = errors.New("database schema version is newer than supported")
+
+type boltDBMigration struct {
+	Description string
+	// Migrate upgrades the layout to the next version and returns the number of affected records.
+	Migrate func(tx *bolt.Tx) (int, error)
+}
+
+// boltDBMigrations is the ordered list of BoltDB layout upgrades. A database of version N has all migrations
+// up to boltDBMigrations[N-1] applied, a database without version marker has version 0. New migrations should
+// only ever be appended to this list.
+var boltDBMigrations = []boltDBMigration{
+	{
+		Description: "key deploys by their start time with nanosecond precision",
+		Migrate:     migrateDeployKeysToStartTime,
+	},
+	{
+		Description: "index deploys by pull requests and commits mentioned in their subjects",
+		Migrate:     migrateIndexDeployReferences,
+	},
+	{
+		Description: "extract tag and commit range references from deploy subjects",
+		Migrate:     migrateTagAndRangeReferences,
+	},
+}
+
+// BoltDBSchemaVersion is the BoltDB layout version written by this build.
+var BoltDBSchemaVersion = len(boltDBMigrations)
+
+// MigrationResult describes a single applied migration.
+type MigrationResult struct {
+	Version     int
+	Description string
+	Changed     int
+}
+
+// MigrateBoltDB opens the BoltDB file in path and upgrades its layout to BoltDBSchemaVersion. If dryRun is true
+// all changes are rolled back and the returned results only report what would have been changed.
+func MigrateBoltDB(path string, dryRun bool) ([]MigrationResult, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db %s: %s", path, err)
+	}
+	defer db.Close()
+
+	return migrateBoltDB(db, dryRun)
+}
+
+func migrateBoltDB(db *bolt.DB, dryRun bool) ([]MigrationResult, error) {
+	tx, err := db.Begin(true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start migration: %s", err)
+	}
+	defer tx.Rollback()
+
+	version, err := readSchemaVersion(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if version > BoltDBSchemaVersion {
+		return nil, fmt.Errorf("%w (found %d, expected %d or less)", ErrUnsupportedSchemaVersion, version, BoltDBSchemaVersion)
+	}
+
+	var results []MigrationResult
+	for ; version < BoltDBSchemaVersion; version++ {
+		m := boltDBMigrations[version]
+
+		changed, err := m.Migrate(tx)
+		if err != nil {
+			return nil, fmt.Errorf("migration to version %d (%s) failed: %s", version+1, m.Description, err)
+		}
+
+		results = append(results, MigrationResult{Version: version + 1, Description: m.Description, Changed: changed})
+	}
+
+	if dryRun {
+		return results, nil
+	}
+
+	if err := writeSchemaVersion(tx, version); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit migrations: %s", err)
+	}
+
+	return results, nil
+}
+
+func readSchemaVersion(tx *bolt.Tx) (int, error) {
+	b := tx.Bucket([]byte(metaBucketName))
+	if b == nil {
+		return 0, nil
+	}
+
+	value := b.Get([]byte(schemaVersionKey))
+	if value == nil {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(string(value))
+	if err != nil {
+		return 0, fmt.Errorf("malformed schema version %q: %s", value, err)
+	}
+
+	return version, nil
+}
+
+func writeSchemaVersion(tx *bolt.Tx, version int) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(metaBucketName))
+	if err != nil {
+		return fmt.Errorf("failed to create metadata bucket: %s", err)
+	}
+
+	return b.Put([]byte(schemaVersionKey), []byte(strconv.Itoa(version)))
+}
+
+// channelBuckets calls fn for each top-level bucket that contains channel deploy history.
+func channelBuckets(tx *bolt.Tx, fn func(channelID []byte, b *bolt.Bucket) error) error {
+	return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		if len(name) > 0 && name[0] == serviceBucketPrefix {
+			return nil
+		}
+
+		return fn(name, b)
+	})
+}
+
+// migrateDeployKeysToStartTime replaces version 0 deploy keys that consisted of start time with second precision
+// and the user ID (i.e. 2016-08-04T09:28:00Z-U123) with fixed-width nanosecond start time keys. Version 0 keys
+// merged deploys started within the same second and created a duplicate whenever the deploy user was changed.
+// Deploys that share the same start time are kept apart by moving all but the first one by a nanosecond.
+func migrateDeployKeysToStartTime(tx *bolt.Tx) (int, error) {
+	var changed int
+
+	err := channelBuckets(tx, func(channelID []byte, channel *bolt.Bucket) error {
+		var oldKeys [][]byte
+
+		cur := channel.Cursor()
+		for k, v := cur.First(); k != nil; k, v = cur.Next() {
+			if v != nil {
+				continue
+			}
+
+			oldKeys = append(oldKeys, append([]byte(nil), k...))
+		}
+
+		for _, oldKey := range oldKeys {
+			src := channel.Bucket(oldKey)
+
+			startedAt, err := time.Parse(time.RFC3339Nano, string(src.Get([]byte(startedAtKey))))
+			if err != nil {
+				return fmt.Errorf("malformed started_at time in %s/%s: %s", channelID, oldKey, err)
+			}
+
+			newKey := []byte(deployKeyTimestamp(startedAt))
+			if string(newKey) == string(oldKey) {
+				continue
+			}
+
+			// Version 0 keys included the user ID, so deploys started at the same time by different users did
+			// not collide. Instead of overwriting such a deploy, the one migrated later is moved a nanosecond
+			// forward, so that its start time still matches the key.
+			moved := false
+			for channel.Bucket(newKey) != nil {
+				startedAt, moved = startedAt.Add(time.Nanosecond), true
+				newKey = []byte(deployKeyTimestamp(startedAt))
+			}
+
+			dst, err := channel.CreateBucket(newKey)
+			if err != nil {
+				return fmt.Errorf("failed to create %s/%s: %s", channelID, newKey, err)
+			}
+
+			if err := src.ForEach(func(k, v []byte) error {
+				return dst.Put(k, v)
+			}); err != nil {
+				return fmt.Errorf("failed to copy %s/%s: %s", channelID, oldKey, err)
+			}
+
+			if moved {
+				if err := dst.Put([]byte(startedAtKey), []byte(startedAt.Format(time.RFC3339Nano))); err != nil {
+					return fmt.Errorf("failed to update start time of %s/%s: %s", channelID, newKey, err)
+				}
+			}
+
+			if err := channel.DeleteBucket(oldKey); err != nil {
+				return fmt.Errorf("failed to delete %s/%s: %s", channelID, oldKey, err)
+			}
+
+			changed++
+		}
+
+		return nil
+	})
+
+	return changed, err
+}
+
+// migrateIndexDeployReferences extracts commit references from subjects of existing deploys and adds all deploys
+// that mention pull requests or commits to the reference index.
+func migrateIndexDeployReferences(tx *bolt.Tx) (int, error) {
+	return updateDeployReferences(tx, func(d *Deploy) bool {
+		d.Commits = defaultGitHubReferences.FindCommitReferences(d.Subject)
+		return len(d.PullRequests) > 0 || len(d.Commits) > 0
+	})
+}
+
+// migrateTagAndRangeReferences extracts tag and commit range references from subjects of existing deploys
+// and adds them to the reference index.
+func migrateTagAndRangeReferences(tx *bolt.Tx) (int, error) {
+	return updateDeployReferences(tx, func(d *Deploy) bool {
+		d.Tags, d.Ranges = defaultGitHubReferences.FindTagReferences(d.Subject), defaultGitHubReferences.FindRangeReferences(d.Subject)
+		return len(d.Tags) > 0 || len(d.Ranges) > 0
+	})
+}
+
+// updateDeployReferences calls fn for each stored deploy and writes back and indexes the ones fn returned true for.
+// It returns the number of updated deploys.
+func updateDeployReferences(tx *bolt.Tx, fn func(d *Deploy) bool) (int, error) {
+	var (
+		store   BoltDBStore
+		deploys []IndexedDeploy
+	)
+
+	err := channelBuckets(tx, func(channelID []byte, channel *bolt.Bucket) error {
+		var deployKeys [][]byte
+
+		cur := channel.Cursor()
+		for k, v := cur.First(); k != nil; k, v = cur.Next() {
+			if v == nil {
+				deployKeys = append(deployKeys, append([]byte(nil), k...))
+			}
+		}
+
+		for _, k := range deployKeys {
+			d, err := store.readDeploy(k, channel)
+			if err != nil {
+				return fmt.Errorf("failed to read %s/%s: %s", channelID, k, err)
+			}
+
+			if !fn(&d) {
+				continue
+			}
+
+			if err := store.writeDeploy(d, channel); err != nil {
+				return fmt.Errorf("failed to update %s/%s: %s", channelID, k, err)
+			}
+
+			deploys = append(deploys, IndexedDeploy{ChannelID: string(channelID), Deploy: d})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// The index bucket is created only after all channels have been iterated over, since adding top-level
+	// buckets while iterating over them is not safe
+	for _, entry := range deploys {
+		if err := indexDeploy(tx, entry.ChannelID, entry.Deploy); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(deploys), nil
+}
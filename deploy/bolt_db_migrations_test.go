@@ -0,0 +1,326 @@
+package deploy_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/deploy/storetest"
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// legacyDeploy is a deploy as it was stored by BoltDBStore before schema versioning has been introduced.
+type legacyDeploy struct {
+	UserID, UserName, Subject string
+	StartedAt, FinishedAt     time.Time
+	AbortReason               *string
+	PullRequests              []deploy.PullRequestReference
+}
+
+func TestBoltDBStore_Migration(t *testing.T) {
+	storetest.RunMigrationSuite(t, func(channels map[string][]deploy.Deploy) (storetest.Store, func(), error) {
+		path, err := tempDBFilePath()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		legacy := make(map[string][]legacyDeploy, len(channels))
+		for channelID, deploys := range channels {
+			for _, d := range deploys {
+				legacy[channelID] = append(legacy[channelID], legacyDeploy{
+					UserID:       d.User.ID,
+					UserName:     d.User.Name,
+					Subject:      d.Subject,
+					StartedAt:    d.StartedAt,
+					PullRequests: d.PullRequests,
+				})
+			}
+		}
+
+		if err := writeLegacyBoltDB(path, legacy); err != nil {
+			return nil, func() { os.Remove(path) }, err
+		}
+
+		if _, err := deploy.MigrateBoltDB(path, false); err != nil {
+			return nil, func() { os.Remove(path) }, err
+		}
+
+		store, err := deploy.NewBoltDBStore(path)
+		if err != nil {
+			return nil, func() { os.Remove(path) }, err
+		}
+
+		return store, func() {
+			store.Close()
+			os.Remove(path)
+		}, nil
+	})
+}
+
+func TestMigrateBoltDB_Version0(t *testing.T) {
+	path, err := tempDBFilePath()
+	require.NoError(t, err)
+	defer os.Remove(path)
+
+	reason := "something went wrong"
+	startTime := time.Date(2016, 8, 4, 9, 28, 0, 0, time.UTC)
+	fixture := map[string][]legacyDeploy{
+		"C1": {
+			{UserID: "U1", UserName: "user1", Subject: "first", StartedAt: startTime, FinishedAt: startTime.Add(time.Minute)},
+			{UserID: "U2", UserName: "user2", Subject: "second a/b#1", StartedAt: startTime.Add(2 * time.Minute), FinishedAt: startTime.Add(3 * time.Minute), AbortReason: &reason, PullRequests: []deploy.PullRequestReference{{ID: "1", Repository: "a/b"}}},
+			{UserID: "U1", UserName: "user1", Subject: "third a/b@7fd1a60", StartedAt: startTime.Add(5*time.Minute + 300*time.Millisecond)},
+		},
+		"C2": {
+			{UserID: "U3", UserName: "user3", Subject: "other channel a/b@v1.0...v1.1", StartedAt: startTime.Add(time.Hour)},
+		},
+	}
+	require.NoError(t, writeLegacyBoltDB(path, fixture))
+
+	results, err := deploy.MigrateBoltDB(path, false)
+	require.NoError(t, err)
+	if assert.Len(t, results, deploy.BoltDBSchemaVersion) {
+		assert.Equal(t, 1, results[0].Version)
+		assert.Equal(t, 4, results[0].Changed)
+
+		assert.Equal(t, 2, results[1].Version)
+		assert.Equal(t, 2, results[1].Changed)
+
+		assert.Equal(t, 3, results[2].Version)
+		assert.Equal(t, 1, results[2].Changed)
+	}
+	assert.Equal(t, deploy.BoltDBSchemaVersion, readSchemaVersion(t, path))
+
+	store, err := deploy.NewBoltDBStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	deploys := store.All("C1")
+	if assert.Len(t, deploys, 3) {
+		assert.Equal(t, "first", deploys[0].Subject)
+		assert.Equal(t, "U1", deploys[0].User.ID)
+		assert.True(t, deploys[0].StartedAt.Equal(startTime))
+
+		assert.Equal(t, "second a/b#1", deploys[1].Subject)
+		assert.True(t, deploys[1].Aborted)
+		assert.Equal(t, reason, deploys[1].AbortReason)
+		assert.Equal(t, []deploy.PullRequestReference{{ID: "1", Repository: "a/b"}}, deploys[1].PullRequests)
+
+		assert.Equal(t, "third a/b@7fd1a60", deploys[2].Subject)
+		assert.Equal(t, []deploy.CommitReference{{SHA: "7fd1a60", Repository: "a/b"}}, deploys[2].Commits)
+		assert.False(t, deploys[2].Finished())
+	}
+
+	if d, ok := store.Get("C2"); assert.True(t, ok) {
+		assert.Equal(t, "other channel a/b@v1.0...v1.1", d.Subject)
+		assert.Equal(t, []deploy.RangeReference{{Base: "v1.0", Head: "v1.1", Repository: "a/b"}}, d.Ranges)
+	}
+
+	if deploys := store.Since("C1", startTime.Add(2*time.Minute)); assert.Len(t, deploys, 2) {
+		assert.Equal(t, "second a/b#1", deploys[0].Subject)
+		assert.Equal(t, "third a/b@7fd1a60", deploys[1].Subject)
+	}
+
+	if deploys := store.DeploysOf("a/b#1"); assert.Len(t, deploys, 1) {
+		assert.Equal(t, "C1", deploys[0].ChannelID)
+		assert.Equal(t, "second a/b#1", deploys[0].Subject)
+	}
+
+	if deploys := store.DeploysOf("a/b@7fd1a60"); assert.Len(t, deploys, 1) {
+		assert.Equal(t, "third a/b@7fd1a60", deploys[0].Subject)
+	}
+
+	if deploys := store.DeploysOf("a/b@v1.1"); assert.Len(t, deploys, 1) {
+		assert.Equal(t, "C2", deploys[0].ChannelID)
+	}
+}
+
+func TestMigrateBoltDB_Version0_SameStartTime(t *testing.T) {
+	path, err := tempDBFilePath()
+	require.NoError(t, err)
+	defer os.Remove(path)
+
+	startTime := time.Date(2016, 8, 4, 9, 28, 0, 0, time.UTC)
+	require.NoError(t, writeLegacyBoltDB(path, map[string][]legacyDeploy{
+		"C1": {
+			{UserID: "U1", UserName: "user1", Subject: "first", StartedAt: startTime},
+			{UserID: "U2", UserName: "user2", Subject: "second", StartedAt: startTime, FinishedAt: startTime.Add(time.Minute)},
+			{UserID: "U3", UserName: "user3", Subject: "third", StartedAt: startTime.Add(time.Nanosecond)},
+		},
+	}))
+
+	results, err := deploy.MigrateBoltDB(path, false)
+	require.NoError(t, err)
+	if assert.NotEmpty(t, results) {
+		assert.Equal(t, 3, results[0].Changed)
+	}
+
+	store, err := deploy.NewBoltDBStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	deploys := store.All("C1")
+	require.Len(t, deploys, 3)
+
+	users := make(map[string]deploy.Deploy)
+	for i, d := range deploys {
+		users[d.User.ID] = d
+
+		if i > 0 {
+			assert.True(t, d.StartedAt.After(deploys[i-1].StartedAt), "expected deploys to have distinct start times")
+		}
+	}
+
+	if assert.Contains(t, users, "U1") {
+		assert.Equal(t, "first", users["U1"].Subject)
+		assert.False(t, users["U1"].Finished())
+	}
+
+	if assert.Contains(t, users, "U2") {
+		assert.Equal(t, "second", users["U2"].Subject)
+		assert.True(t, users["U2"].FinishedAt.Equal(startTime.Add(time.Minute)))
+	}
+
+	if assert.Contains(t, users, "U3") {
+		assert.Equal(t, "third", users["U3"].Subject)
+	}
+}
+
+func TestMigrateBoltDB_DryRun(t *testing.T) {
+	path, err := tempDBFilePath()
+	require.NoError(t, err)
+	defer os.Remove(path)
+
+	startTime := time.Date(2016, 8, 4, 9, 28, 0, 0, time.UTC)
+	require.NoError(t, writeLegacyBoltDB(path, map[string][]legacyDeploy{
+		"C1": {{UserID: "U1", UserName: "user1", Subject: "first", StartedAt: startTime}},
+	}))
+
+	results, err := deploy.MigrateBoltDB(path, true)
+	require.NoError(t, err)
+	if assert.Len(t, results, deploy.BoltDBSchemaVersion) {
+		assert.Equal(t, 1, results[0].Changed)
+	}
+
+	assert.Equal(t, 0, readSchemaVersion(t, path))
+
+	db, err := bolt.Open(path, 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.View(func(tx *bolt.Tx) error {
+		assert.NotNil(t, tx.Bucket([]byte("C1")).Bucket([]byte("2016-08-04T09:28:00Z-U1")))
+		return nil
+	}))
+}
+
+func TestMigrateBoltDB_UpToDate(t *testing.T) {
+	path, err := tempDBFilePath()
+	require.NoError(t, err)
+	defer os.Remove(path)
+
+	store, err := deploy.NewBoltDBStore(path)
+	require.NoError(t, err)
+	store.Close()
+
+	results, err := deploy.MigrateBoltDB(path, false)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	assert.Equal(t, deploy.BoltDBSchemaVersion, readSchemaVersion(t, path))
+}
+
+func TestNewBoltDBStore_NewerSchemaVersion(t *testing.T) {
+	path, err := tempDBFilePath()
+	require.NoError(t, err)
+	defer os.Remove(path)
+
+	db, err := bolt.Open(path, 0600, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("_meta"))
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte("schema_version"), []byte(strconv.Itoa(deploy.BoltDBSchemaVersion+1)))
+	}))
+	require.NoError(t, db.Close())
+
+	_, err = deploy.NewBoltDBStore(path)
+	assert.Error(t, err)
+
+	_, err = deploy.MigrateBoltDB(path, true)
+	assert.True(t, errors.Is(err, deploy.ErrUnsupportedSchemaVersion), "unexpected error %v", err)
+}
+
+func writeLegacyBoltDB(path string, channels map[string][]legacyDeploy) error {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		for channelID, deploys := range channels {
+			channel, err := tx.CreateBucketIfNotExists([]byte(channelID))
+			if err != nil {
+				return err
+			}
+
+			for _, d := range deploys {
+				b, err := channel.CreateBucket([]byte(d.StartedAt.UTC().Format(time.RFC3339) + "-" + d.UserID))
+				if err != nil {
+					return err
+				}
+
+				b.Put([]byte("subject"), []byte(d.Subject))
+				b.Put([]byte("user.id"), []byte(d.UserID))
+				b.Put([]byte("user.name"), []byte(d.UserName))
+				b.Put([]byte("started_at"), []byte(d.StartedAt.Format(time.RFC3339Nano)))
+
+				if !d.FinishedAt.IsZero() {
+					b.Put([]byte("finished_at"), []byte(d.FinishedAt.Format(time.RFC3339Nano)))
+				}
+
+				if d.AbortReason != nil {
+					b.Put([]byte("aborted"), []byte(*d.AbortReason))
+				}
+
+				if len(d.PullRequests) > 0 {
+					data, err := json.Marshal(d.PullRequests)
+					if err != nil {
+						return err
+					}
+
+					b.Put([]byte("prs"), data)
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func readSchemaVersion(t *testing.T, path string) int {
+	db, err := bolt.Open(path, 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var version int
+	require.NoError(t, db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("_meta"))
+		if b == nil {
+			return nil
+		}
+
+		version, err = strconv.Atoi(string(b.Get([]byte("schema_version"))))
+		return err
+	}))
+
+	return version
+}
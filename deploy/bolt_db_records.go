@@ -0,0 +1,186 @@
+package deploy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// recordsBucketName is the service bucket that holds RecordStore collections as nested buckets.
+const recordsBucketName = "_records"
+
+// PutRecord stores a record replacing an existing one with the same key.
+func (s *BoltDBStore) PutRecord(collection string, rec Record) error {
+	return s.update(func(tx *bolt.Tx) error {
+		b, err := recordsBucket(tx, collection)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(rec.Key), encodeRecord(rec))
+	})
+}
+
+// AddRecord stores a record only if there is no unexpired record with the same key.
+func (s *BoltDBStore) AddRecord(collection string, rec Record) (added bool, err error) {
+	err = s.update(func(tx *bolt.Tx) error {
+		b, err := recordsBucket(tx, collection)
+		if err != nil {
+			return err
+		}
+
+		if data := b.Get([]byte(rec.Key)); data != nil {
+			existing, err := decodeRecord(rec.Key, data)
+			if err == nil && !existing.Expired(time.Now()) {
+				return nil
+			}
+		}
+
+		added = true
+
+		return b.Put([]byte(rec.Key), encodeRecord(rec))
+	})
+
+	return added && err == nil, err
+}
+
+// GetRecord returns a record by its key.
+func (s *BoltDBStore) GetRecord(collection, key string) (rec Record, ok bool, err error) {
+	err = s.view(func(tx *bolt.Tx) error {
+		b := lookupRecordsBucket(tx, collection)
+		if b == nil {
+			return nil
+		}
+
+		data := b.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+
+		if rec, err = decodeRecord(key, data); err != nil {
+			return fmt.Errorf("failed to read %s/%s: %s", collection, key, err)
+		}
+		ok = !rec.Expired(time.Now())
+
+		return nil
+	})
+
+	return rec, ok, err
+}
+
+// DeleteRecord removes a record and returns its last value.
+func (s *BoltDBStore) DeleteRecord(collection, key string) (rec Record, ok bool, err error) {
+	err = s.update(func(tx *bolt.Tx) error {
+		b := lookupRecordsBucket(tx, collection)
+		if b == nil {
+			return nil
+		}
+
+		data := b.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+
+		if rec, err = decodeRecord(key, data); err != nil {
+			return fmt.Errorf("failed to read %s/%s: %s", collection, key, err)
+		}
+		ok = !rec.Expired(time.Now())
+
+		return b.Delete([]byte(key))
+	})
+
+	return rec, ok && err == nil, err
+}
+
+// Records returns all unexpired records in collection ordered by their keys.
+func (s *BoltDBStore) Records(collection string) (records []Record, err error) {
+	now := time.Now()
+
+	err = s.view(func(tx *bolt.Tx) error {
+		b := lookupRecordsBucket(tx, collection)
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			rec, err := decodeRecord(string(k), v)
+			if err != nil {
+				return fmt.Errorf("failed to read %s/%s: %s", collection, k, err)
+			}
+
+			if !rec.Expired(now) {
+				records = append(records, rec)
+			}
+
+			return nil
+		})
+	})
+
+	return records, err
+}
+
+// RemoveExpiredRecords removes expired records from collection.
+func (s *BoltDBStore) RemoveExpiredRecords(collection string) (n int, err error) {
+	now := time.Now()
+
+	err = s.update(func(tx *bolt.Tx) error {
+		records := tx.Bucket([]byte(recordsBucketName))
+		if records == nil {
+			return nil
+		}
+
+		b := records.Bucket([]byte(collection))
+		if b == nil {
+			return nil
+		}
+
+		var expired [][]byte
+		if err := b.ForEach(func(k, v []byte) error {
+			if rec, err := decodeRecord(string(k), v); err != nil || rec.Expired(now) {
+				expired = append(expired, k)
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return fmt.Errorf("failed to remove %s/%s: %s", collection, k, err)
+			}
+		}
+		n = len(expired)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func recordsBucket(tx *bolt.Tx, collection string) (*bolt.Bucket, error) {
+	b, err := tx.CreateBucketIfNotExists([]byte(recordsBucketName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create records bucket: %s", err)
+	}
+
+	if b, err = b.CreateBucketIfNotExists([]byte(collection)); err != nil {
+		return nil, fmt.Errorf("failed to create %s collection: %s", collection, err)
+	}
+
+	return b, nil
+}
+
+// lookupRecordsBucket returns the bucket of an existing collection or nil if there is no such collection.
+func lookupRecordsBucket(tx *bolt.Tx, collection string) *bolt.Bucket {
+	b := tx.Bucket([]byte(recordsBucketName))
+	if b == nil {
+		return nil
+	}
+
+	return b.Bucket([]byte(collection))
+}
@@ -1,9 +1,14 @@
 package deploy
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/andrewslotin/michael/slack"
@@ -18,7 +23,21 @@ const (
 	finishedAtKey   = "finished_at"
 	abortedKey      = "aborted"
 	pullRequestsKey = "prs"
-	subscribersKey  = "subscribers"
+	commitsKey      = "commits"
+	tagsKey         = "tags"
+	rangesKey       = "ranges"
+	// providerReferencesKey keeps references recognized by reference providers
+	providerReferencesKey = "references"
+	subscribersKey        = "subscribers"
+	finishedByKey         = "finished_by"
+	abortedByKey          = "aborted_by"
+	approvedByKey         = "approved_by"
+	approvedAtKey         = "approved_at"
+
+	deployKeyTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+	referencesBucketName  = "_references"
+	referenceKeySeparator = "\x00"
 )
 
 var (
@@ -26,6 +45,9 @@ var (
 )
 
 type BoltDBStore struct {
+	path string
+
+	mu sync.RWMutex // guards db while it is being replaced during compaction
 	db *bolt.DB
 }
 
@@ -35,11 +57,24 @@ func NewBoltDBStore(path string) (*BoltDBStore, error) {
 		return nil, fmt.Errorf("failed to open db %s: %s", path, err)
 	}
 
-	return &BoltDBStore{db: db}, nil
+	if _, err := migrateBoltDB(db, false); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate db %s: %s", path, err)
+	}
+
+	return &BoltDBStore{path: path, db: db}, nil
+}
+
+// Close releases the database file.
+func (s *BoltDBStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Close()
 }
 
 func (s *BoltDBStore) Get(key string) (deploy Deploy, ok bool) {
-	s.db.View(func(tx *bolt.Tx) error {
+	s.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(key))
 		if b == nil {
 			return nil
@@ -70,7 +105,7 @@ func (s *BoltDBStore) Get(key string) (deploy Deploy, ok bool) {
 }
 
 func (s *BoltDBStore) Set(key string, d Deploy) {
-	s.db.Update(func(tx *bolt.Tx) error {
+	s.update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte(key))
 		if err != nil {
 			return fmt.Errorf("failed to store deploy of %s by %s in channel %s: %s", d.Subject, d.User.Name, key, err)
@@ -78,14 +113,14 @@ func (s *BoltDBStore) Set(key string, d Deploy) {
 
 		s.writeDeploy(d, b)
 
-		return nil
+		return indexDeploy(tx, key, d)
 	})
 }
 
 func (s *BoltDBStore) All(key string) []Deploy {
 	var deploys []Deploy
 
-	s.db.View(func(tx *bolt.Tx) error {
+	s.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(key))
 		if b == nil {
 			return nil
@@ -117,14 +152,14 @@ func (s *BoltDBStore) All(key string) []Deploy {
 func (s *BoltDBStore) Since(key string, startTime time.Time) []Deploy {
 	var deploys []Deploy
 
-	s.db.View(func(tx *bolt.Tx) error {
+	s.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(key))
 		if b == nil {
 			return nil
 		}
 
 		cur := b.Cursor()
-		for k, v := cur.Seek([]byte(s.deployKeyTimestamp(startTime) + "-")); k != nil; k, v = cur.Next() {
+		for k, v := cur.Seek([]byte(deployKeyTimestamp(startTime))); k != nil; k, v = cur.Next() {
 			if v != nil {
 				continue
 			}
@@ -143,12 +178,140 @@ func (s *BoltDBStore) Since(key string, startTime time.Time) []Deploy {
 	return deploys
 }
 
+// Channels returns IDs of all channels that have deploy history.
+func (s *BoltDBStore) Channels() []string {
+	var channels []string
+
+	s.view(func(tx *bolt.Tx) error {
+		return channelBuckets(tx, func(channelID []byte, _ *bolt.Bucket) error {
+			channels = append(channels, string(channelID))
+			return nil
+		})
+	})
+
+	return channels
+}
+
+// Prune removes outdated deploys from channel history. See deploy.Pruner for details.
+func (s *BoltDBStore) Prune(key string, before time.Time, keep int) int {
+	var n int
+
+	err := s.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(key))
+		if b == nil {
+			return nil
+		}
+
+		var deployKeys [][]byte
+
+		// Keys returned by cursor are only valid until the bucket is modified, so they are copied before
+		// deploys get removed
+		cur := b.Cursor()
+		for k, v := cur.First(); k != nil; k, v = cur.Next() {
+			if v == nil {
+				deployKeys = append(deployKeys, append([]byte(nil), k...))
+			}
+		}
+
+		n = prunedCount(len(deployKeys), func(i int) time.Time {
+			startedAt, _ := time.Parse(deployKeyTimeFormat, string(deployKeys[i]))
+			return startedAt
+		}, before, keep)
+
+		for _, k := range deployKeys[:n] {
+			if d, err := s.readDeploy(k, b); err == nil {
+				if err := unindexDeploy(tx, key, d); err != nil {
+					return err
+				}
+			}
+
+			if err := b.DeleteBucket(k); err != nil {
+				return fmt.Errorf("failed to delete deploy %s in channel %s: %s", k, key, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Printf("failed to prune deploys in channel %s: %s", key, err)
+		return 0
+	}
+
+	return n
+}
+
+// DeploysOf returns deploys that mention the pull request or commit with given key. See deploy.ReferenceIndex
+// for details.
+func (s *BoltDBStore) DeploysOf(key string) []IndexedDeploy {
+	var deploys []IndexedDeploy
+
+	err := s.view(func(tx *bolt.Tx) error {
+		refs := tx.Bucket([]byte(referencesBucketName))
+		if refs == nil {
+			return nil
+		}
+
+		prefix := []byte(key + referenceKeySeparator)
+
+		cur := refs.Cursor()
+		for k, _ := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cur.Next() {
+			fields := strings.SplitN(string(k[len(prefix):]), referenceKeySeparator, 2)
+			if len(fields) != 2 {
+				continue
+			}
+
+			channel := tx.Bucket([]byte(fields[0]))
+			if channel == nil {
+				continue
+			}
+
+			d, err := s.readDeploy([]byte(fields[1]), channel)
+			if err != nil {
+				if err == ErrNoDeploy {
+					continue
+				}
+
+				return err
+			}
+
+			deploys = append(deploys, IndexedDeploy{ChannelID: fields[0], Deploy: d})
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Printf("failed to look up deploys of %s: %s", key, err)
+		return nil
+	}
+
+	sort.SliceStable(deploys, func(i, j int) bool {
+		return deploys[i].StartedAt.Before(deploys[j].StartedAt)
+	})
+
+	return deploys
+}
+
+func (s *BoltDBStore) view(fn func(*bolt.Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.View(fn)
+}
+
+func (s *BoltDBStore) update(fn func(*bolt.Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.db.Update(fn)
+}
+
 func (s *BoltDBStore) deployKey(deploy Deploy) []byte {
-	return []byte(s.deployKeyTimestamp(deploy.StartedAt) + "-" + deploy.User.ID)
+	return []byte(deployKeyTimestamp(deploy.StartedAt))
 }
 
-func (*BoltDBStore) deployKeyTimestamp(t time.Time) string {
-	return t.UTC().Format(time.RFC3339)
+// deployKeyTimestamp formats t as a fixed-width string, so that deploy keys are sorted by their start time.
+func deployKeyTimestamp(t time.Time) string {
+	return t.UTC().Format(deployKeyTimeFormat)
 }
 
 func (s *BoltDBStore) writeDeploy(deploy Deploy, channelBucket *bolt.Bucket) error {
@@ -162,12 +325,28 @@ func (s *BoltDBStore) writeDeploy(deploy Deploy, channelBucket *bolt.Bucket) err
 	b.Put([]byte(userNameKey), []byte(deploy.User.Name))
 	b.Put([]byte(startedAtKey), []byte(deploy.StartedAt.Format(time.RFC3339Nano)))
 
+	// Deploy bucket may already contain values of a previous version of this deploy, so optional fields
+	// that are not set need to be removed
 	if !deploy.FinishedAt.IsZero() {
 		b.Put([]byte(finishedAtKey), []byte(deploy.FinishedAt.Format(time.RFC3339Nano)))
+	} else {
+		b.Delete([]byte(finishedAtKey))
+	}
 
-		if deploy.Aborted {
-			b.Put([]byte(abortedKey), []byte(deploy.AbortReason))
-		}
+	if !deploy.FinishedAt.IsZero() && deploy.Aborted {
+		b.Put([]byte(abortedKey), []byte(deploy.AbortReason))
+	} else {
+		b.Delete([]byte(abortedKey))
+	}
+
+	putUser(b, finishedByKey, deploy.FinishedBy)
+	putUser(b, abortedByKey, deploy.AbortedBy)
+	putUser(b, approvedByKey, deploy.ApprovedBy)
+
+	if !deploy.ApprovedAt.IsZero() {
+		b.Put([]byte(approvedAtKey), []byte(deploy.ApprovedAt.Format(time.RFC3339Nano)))
+	} else {
+		b.Delete([]byte(approvedAtKey))
 	}
 
 	if len(deploy.PullRequests) != 0 {
@@ -177,6 +356,52 @@ func (s *BoltDBStore) writeDeploy(deploy Deploy, channelBucket *bolt.Bucket) err
 		}
 
 		b.Put([]byte(pullRequestsKey), data)
+	} else {
+		b.Delete([]byte(pullRequestsKey))
+	}
+
+	if len(deploy.Commits) != 0 {
+		data, err := json.Marshal(deploy.Commits)
+		if err != nil {
+			return err
+		}
+
+		b.Put([]byte(commitsKey), data)
+	} else {
+		b.Delete([]byte(commitsKey))
+	}
+
+	if len(deploy.Tags) != 0 {
+		data, err := json.Marshal(deploy.Tags)
+		if err != nil {
+			return err
+		}
+
+		b.Put([]byte(tagsKey), data)
+	} else {
+		b.Delete([]byte(tagsKey))
+	}
+
+	if len(deploy.Ranges) != 0 {
+		data, err := json.Marshal(deploy.Ranges)
+		if err != nil {
+			return err
+		}
+
+		b.Put([]byte(rangesKey), data)
+	} else {
+		b.Delete([]byte(rangesKey))
+	}
+
+	if len(deploy.References) != 0 {
+		data, err := json.Marshal(deploy.References)
+		if err != nil {
+			return err
+		}
+
+		b.Put([]byte(providerReferencesKey), data)
+	} else {
+		b.Delete([]byte(providerReferencesKey))
 	}
 
 	if len(deploy.Subscribers) != 0 {
@@ -186,6 +411,8 @@ func (s *BoltDBStore) writeDeploy(deploy Deploy, channelBucket *bolt.Bucket) err
 		}
 
 		b.Put([]byte(subscribersKey), data)
+	} else {
+		b.Delete([]byte(subscribersKey))
 	}
 
 	return nil
@@ -222,12 +449,48 @@ func (*BoltDBStore) readDeploy(key []byte, channelBucket *bolt.Bucket) (deploy D
 		deploy.AbortReason = string(value)
 	}
 
+	deploy.FinishedBy = readUser(b, finishedByKey)
+	deploy.AbortedBy = readUser(b, abortedByKey)
+	deploy.ApprovedBy = readUser(b, approvedByKey)
+
+	if value := b.Get([]byte(approvedAtKey)); value != nil {
+		if approvedAt, err := time.Parse(time.RFC3339Nano, string(value)); err != nil {
+			return deploy, fmt.Errorf("malformed approved_at time for deploy of %s by %s: %s", deploy.Subject, deploy.User.Name, err)
+		} else {
+			deploy.ApprovedAt = approvedAt
+		}
+	}
+
 	if value := b.Get([]byte(pullRequestsKey)); value != nil {
 		if err := json.Unmarshal(value, &deploy.PullRequests); err != nil {
 			return deploy, fmt.Errorf("malformed prs for deploy of %s by %s: %s", deploy.Subject, deploy.User.Name, err)
 		}
 	}
 
+	if value := b.Get([]byte(commitsKey)); value != nil {
+		if err := json.Unmarshal(value, &deploy.Commits); err != nil {
+			return deploy, fmt.Errorf("malformed commits for deploy of %s by %s: %s", deploy.Subject, deploy.User.Name, err)
+		}
+	}
+
+	if value := b.Get([]byte(tagsKey)); value != nil {
+		if err := json.Unmarshal(value, &deploy.Tags); err != nil {
+			return deploy, fmt.Errorf("malformed tags for deploy of %s by %s: %s", deploy.Subject, deploy.User.Name, err)
+		}
+	}
+
+	if value := b.Get([]byte(rangesKey)); value != nil {
+		if err := json.Unmarshal(value, &deploy.Ranges); err != nil {
+			return deploy, fmt.Errorf("malformed ranges for deploy of %s by %s: %s", deploy.Subject, deploy.User.Name, err)
+		}
+	}
+
+	if value := b.Get([]byte(providerReferencesKey)); value != nil {
+		if err := json.Unmarshal(value, &deploy.References); err != nil {
+			return deploy, fmt.Errorf("malformed references for deploy of %s by %s: %s", deploy.Subject, deploy.User.Name, err)
+		}
+	}
+
 	if value := b.Get([]byte(subscribersKey)); value != nil {
 		if err := json.Unmarshal(value, &deploy.Subscribers); err != nil {
 			return deploy, fmt.Errorf("malformed users for deploy of %s by %s: %s", deploy.Subject, deploy.User.Name, err)
@@ -236,3 +499,66 @@ func (*BoltDBStore) readDeploy(key []byte, channelBucket *bolt.Bucket) (deploy D
 
 	return deploy, nil
 }
+
+// indexDeploy adds pull requests, commits and tags mentioned in deploy to the reference index. Index entries are keyed
+// by <reference key>\x00<channel ID>\x00<deploy key>, so that all deploys of a reference can be found with
+// a prefix scan.
+func indexDeploy(tx *bolt.Tx, channelID string, d Deploy) error {
+	keys := d.ReferenceKeys()
+	if len(keys) == 0 {
+		return nil
+	}
+
+	refs, err := tx.CreateBucketIfNotExists([]byte(referencesBucketName))
+	if err != nil {
+		return fmt.Errorf("failed to create references bucket: %s", err)
+	}
+
+	for _, k := range keys {
+		if err := refs.Put(referenceIndexKey(k, channelID, d), []byte{}); err != nil {
+			return fmt.Errorf("failed to index deploy %s in channel %s: %s", deployKeyTimestamp(d.StartedAt), channelID, err)
+		}
+	}
+
+	return nil
+}
+
+// unindexDeploy removes deploy from the reference index.
+func unindexDeploy(tx *bolt.Tx, channelID string, d Deploy) error {
+	refs := tx.Bucket([]byte(referencesBucketName))
+	if refs == nil {
+		return nil
+	}
+
+	for _, k := range d.ReferenceKeys() {
+		if err := refs.Delete(referenceIndexKey(k, channelID, d)); err != nil {
+			return fmt.Errorf("failed to remove deploy %s in channel %s from index: %s", deployKeyTimestamp(d.StartedAt), channelID, err)
+		}
+	}
+
+	return nil
+}
+
+func referenceIndexKey(refKey, channelID string, d Deploy) []byte {
+	return []byte(refKey + referenceKeySeparator + channelID + referenceKeySeparator + deployKeyTimestamp(d.StartedAt))
+}
+
+// putUser stores user ID and name under prefix.id and prefix.name keys removing them if user is empty.
+func putUser(b *bolt.Bucket, prefix string, user slack.User) {
+	if user == (slack.User{}) {
+		b.Delete([]byte(prefix + ".id"))
+		b.Delete([]byte(prefix + ".name"))
+
+		return
+	}
+
+	b.Put([]byte(prefix+".id"), []byte(user.ID))
+	b.Put([]byte(prefix+".name"), []byte(user.Name))
+}
+
+func readUser(b *bolt.Bucket, prefix string) slack.User {
+	return slack.User{
+		ID:   string(b.Get([]byte(prefix + ".id"))),
+		Name: string(b.Get([]byte(prefix + ".name"))),
+	}
+}
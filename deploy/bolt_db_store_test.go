@@ -3,46 +3,73 @@ package deploy_test
 import (
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/andrewslotin/michael/deploy"
-	"github.com/stretchr/testify/suite"
+	"github.com/andrewslotin/michael/deploy/storetest"
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestBoltDBStore_AsStore(t *testing.T) {
-	suite.Run(t, &StoreSuite{Setup: func() (store deploy.Store, teardownFn func(), err error) {
+func TestBoltDBStore(t *testing.T) {
+	storetest.RunStoreSuite(t, func() (storetest.Store, func(), error) {
 		path, err := tempDBFilePath()
 		if err != nil {
 			return nil, nil, err
 		}
 
-		teardownFn = func() { os.Remove(path) }
-
-		store, err = deploy.NewBoltDBStore(path)
+		store, err := deploy.NewBoltDBStore(path)
 		if err != nil {
-			return nil, teardownFn, err
+			return nil, func() { os.Remove(path) }, err
 		}
 
-		return store, teardownFn, nil
-	}})
+		return store, func() {
+			store.Close()
+			os.Remove(path)
+		}, nil
+	})
 }
 
-func TestBoltDBStore_AsRepository(t *testing.T) {
-	suite.Run(t, &RepositorySuite{Setup: func() (repo deploy.Repository, setFn func(string, deploy.Deploy), teardownFn func(), err error) {
-		path, err := tempDBFilePath()
-		if err != nil {
-			return nil, nil, nil, err
-		}
+func TestBoltDBStore_Compact(t *testing.T) {
+	path, err := tempDBFilePath()
+	require.NoError(t, err)
+	defer os.Remove(path)
 
-		teardownFn = func() { os.Remove(path) }
+	store, err := deploy.NewBoltDBStore(path)
+	require.NoError(t, err)
+	defer store.Close()
 
-		r, err := deploy.NewBoltDBStore(path)
-		if err != nil {
-			return nil, nil, teardownFn, err
-		}
+	now := time.Now()
+	for i := 200; i >= 0; i-- {
+		d := deploy.New(slack.User{ID: "U1", Name: "user1"}, strings.Repeat("Deploy subject ", 20))
+		d.StartedAt = now.Add(-time.Duration(i) * time.Minute)
+		store.Set("key1", d)
+	}
+
+	require.Equal(t, 200, store.Prune("key1", time.Time{}, 1))
+
+	stat, err := os.Stat(path)
+	require.NoError(t, err)
+	sizeBefore := stat.Size()
+
+	require.NoError(t, store.Compact())
+
+	stat, err = os.Stat(path)
+	require.NoError(t, err)
+	assert.True(t, stat.Size() < sizeBefore, "expected db file to shrink after compaction (%d >= %d)", stat.Size(), sizeBefore)
+
+	if deploys := store.All("key1"); assert.Len(t, deploys, 1) {
+		assert.True(t, now.Equal(deploys[0].StartedAt))
+	}
 
-		return r, r.Set, teardownFn, nil
-	}})
+	// Check that the store is still writable
+	d := deploy.New(slack.User{ID: "U1", Name: "user1"}, "Deploy after compaction")
+	d.Start()
+	store.Set("key1", d)
+	assert.Len(t, store.All("key1"), 2)
 }
 
 func tempDBFilePath() (string, error) {
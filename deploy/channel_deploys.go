@@ -1,7 +1,15 @@
 package deploy
 
+import (
+	"log"
+	"sync"
+
+	"github.com/andrewslotin/michael/slack"
+)
+
 type ChannelDeploys struct {
 	store Store
+	mu    sync.Mutex // serializes updates of stores that are not TransactionalStore
 }
 
 func NewChannelDeploys(store Store) *ChannelDeploys {
@@ -13,46 +21,121 @@ func (repo *ChannelDeploys) Current(channelID string) (Deploy, bool) {
 	return d, ok && d.FinishedAt.IsZero()
 }
 
+// Start starts a deploy in channel unless there is another one running. If the deploy has not been started, Start
+// returns the running one, even if it was started by the same user.
 func (repo *ChannelDeploys) Start(channelID string, d Deploy) (Deploy, bool) {
-	for {
-		current, ok := repo.Current(channelID)
-		if !ok {
-			break
-		}
+	return repo.start(channelID, d, false)
+}
+
+// Replace finishes the deploy running in channel if it was started by the same user and starts d instead. Deploys
+// started by other users are not replaced, in this case Replace returns the running deploy.
+func (repo *ChannelDeploys) Replace(channelID string, d Deploy) (Deploy, bool) {
+	return repo.start(channelID, d, true)
+}
+
+func (repo *ChannelDeploys) start(channelID string, d Deploy, replaceOwn bool) (Deploy, bool) {
+	var (
+		result  Deploy
+		started bool
+	)
 
-		if current.User.ID != d.User.ID {
-			return current, false
+	updated := repo.update(channelID, func(last Deploy, ok bool) []Deploy {
+		var deploys []Deploy
+
+		if ok && !last.Finished() {
+			if !replaceOwn || last.User.ID != d.User.ID {
+				result, started = last, false
+				return nil
+			}
+
+			last.Finish()
+			last.FinishedBy = d.User
+			deploys = append(deploys, last)
 		}
 
-		repo.Finish(channelID)
+		result, started = d, true
+		result.Start()
+
+		return append(deploys, result)
+	})
+
+	if !updated {
+		return Deploy{}, false
 	}
 
-	d.Start()
-	repo.store.Set(channelID, d)
+	return result, started
+}
+
+// PermitFunc decides whether the running deploy can be finished or aborted. It is called within the same update
+// as the change itself, so the decision is made on the deploy being finished and not on a stale copy of it.
+type PermitFunc func(current Deploy) bool
 
-	return d, true
+// Finish finishes current deploy in channel on behalf of user if permit allows it. A nil permit allows finishing
+// any deploy.
+func (repo *ChannelDeploys) Finish(channelID string, user slack.User, permit PermitFunc) (Deploy, bool) {
+	return repo.finishCurrent(channelID, permit, func(d *Deploy) {
+		d.Finish()
+		d.FinishedBy = user
+	})
 }
 
-func (repo *ChannelDeploys) Finish(channelID string) (Deploy, bool) {
-	current, ok := repo.Current(channelID)
-	if !ok {
-		return current, false
-	}
+// Abort aborts current deploy in channel on behalf of user if permit allows it. A nil permit allows aborting
+// any deploy.
+func (repo *ChannelDeploys) Abort(channelID, reason string, user slack.User, permit PermitFunc) (Deploy, bool) {
+	return repo.finishCurrent(channelID, permit, func(d *Deploy) {
+		d.Abort(reason)
+		d.AbortedBy = user
+	})
+}
+
+func (repo *ChannelDeploys) finishCurrent(channelID string, permit PermitFunc, finish func(*Deploy)) (Deploy, bool) {
+	var (
+		current Deploy
+		found   bool
+	)
+
+	updated := repo.update(channelID, func(last Deploy, ok bool) []Deploy {
+		current, found = last, ok && !last.Finished()
+		if !found {
+			return nil
+		}
+
+		if permit != nil && !permit(current) {
+			found = false
+			return nil
+		}
+
+		finish(&current)
 
-	current.Finish()
-	repo.store.Set(channelID, current)
+		return []Deploy{current}
+	})
 
-	return current, true
+	if !updated {
+		return Deploy{}, false
+	}
+
+	return current, found
 }
 
-func (repo *ChannelDeploys) Abort(channelID, reason string) (Deploy, bool) {
-	current, ok := repo.Current(channelID)
-	if !ok {
-		return current, false
+// update atomically replaces the last deploy in channel history with deploys returned by fn. It returns false
+// if the store failed to apply changes.
+func (repo *ChannelDeploys) update(channelID string, fn func(last Deploy, ok bool) []Deploy) bool {
+	if s, ok := repo.store.(TransactionalStore); ok {
+		if err := s.Update(channelID, fn); err != nil {
+			log.Printf("failed to update deploys in channel %s: %s", channelID, err)
+			return false
+		}
+
+		return true
 	}
 
-	current.Abort(reason)
-	repo.store.Set(channelID, current)
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	last, ok := repo.store.Get(channelID)
+	for _, d := range fn(last, ok) {
+		repo.store.Set(channelID, d)
+	}
 
-	return current, true
+	return true
 }
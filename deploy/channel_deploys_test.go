@@ -8,6 +8,7 @@ import (
 	"github.com/andrewslotin/michael/slack"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 /*
@@ -84,21 +85,43 @@ func TestChannelDeploys_Start(t *testing.T) {
 	store.AssertExpectations(t)
 }
 
-func TestChannelDeploys_Start_UpdateCurrent(t *testing.T) {
+func TestChannelDeploys_Start_OwnDeployRunning(t *testing.T) {
+	current := deploy.New(slack.User{ID: "1", Name: "Test User"}, "Active deploy")
+	current.StartedAt = time.Now().Add(-2 * time.Minute)
+
+	store := new(StoreMock)
+	store.On("Get", "key1").Return(current, true)
+
+	repo := deploy.NewChannelDeploys(store)
+
+	d := deploy.New(slack.User{ID: "1", Name: "Test User"}, "Test subject")
+	if started, ok := repo.Start("key1", d); assert.False(t, ok) {
+		assert.Equal(t, current, started)
+	}
+
+	store.AssertExpectations(t)
+	store.AssertNotCalled(t, "Set", "key1", mock.Anything)
+}
+
+func TestChannelDeploys_Replace(t *testing.T) {
 	current := deploy.New(slack.User{ID: "1", Name: "Test User"}, "Active deploy")
 	current.StartedAt = time.Now().Add(-2 * time.Minute)
 
 	store := new(StoreMock)
 	store.
 		On("Get", "key1").Return(current, true).Once(). // return running deploy
-		On("Set", "key1", mock.AnythingOfType("deploy.Deploy")).Return(current, true).Once().
-		On("Get", "key1").Return(deploy.Deploy{}, false). // current deploy has already been finished
-		On("Set", "key1", mock.AnythingOfType("deploy.Deploy")).Return()
+		On("Set", "key1", mock.MatchedBy(func(d deploy.Deploy) bool {
+			// running deploy is expected to be finished first
+			return d.Subject == current.Subject && d.Finished() && d.FinishedBy == current.User
+		})).Return().Once().
+		On("Set", "key1", mock.MatchedBy(func(d deploy.Deploy) bool {
+			return d.Subject == "Test subject" && !d.Finished()
+		})).Return().Once()
 
 	repo := deploy.NewChannelDeploys(store)
 
 	d := deploy.New(slack.User{ID: "1", Name: "Test User"}, "Test subject")
-	if started, ok := repo.Start("key1", d); assert.True(t, ok) {
+	if started, ok := repo.Replace("key1", d); assert.True(t, ok) {
 		assert.Equal(t, d.User, started.User)
 		assert.Equal(t, d.Subject, started.Subject)
 		assert.WithinDuration(t, time.Now(), started.StartedAt, time.Second)
@@ -107,6 +130,24 @@ func TestChannelDeploys_Start_UpdateCurrent(t *testing.T) {
 	store.AssertExpectations(t)
 }
 
+func TestChannelDeploys_Replace_OthersDeploy(t *testing.T) {
+	current := deploy.New(slack.User{ID: "2", Name: "Another User"}, "Active deploy")
+	current.StartedAt = time.Now().Add(-2 * time.Minute)
+
+	store := new(StoreMock)
+	store.On("Get", "key1").Return(current, true)
+
+	repo := deploy.NewChannelDeploys(store)
+
+	d := deploy.New(slack.User{ID: "1", Name: "Test User"}, "Test subject")
+	if started, ok := repo.Replace("key1", d); assert.False(t, ok) {
+		assert.Equal(t, current, started)
+	}
+
+	store.AssertExpectations(t)
+	store.AssertNotCalled(t, "Set", "key1", mock.Anything)
+}
+
 func TestChannelDeploys_Finish(t *testing.T) {
 	current := deploy.New(slack.User{ID: "1", Name: "Test User"}, "Test subject")
 	current.StartedAt = time.Now().Add(-2 * time.Second)
@@ -119,17 +160,48 @@ func TestChannelDeploys_Finish(t *testing.T) {
 
 	repo := deploy.NewChannelDeploys(store)
 
-	if d, ok := repo.Finish("key1"); assert.True(t, ok) {
+	user := slack.User{ID: "2", Name: "Another User"}
+	if d, ok := repo.Finish("key1", user, nil); assert.True(t, ok) {
 		assert.Equal(t, current.User, d.User)
 		assert.Equal(t, current.Subject, d.Subject)
 		assert.WithinDuration(t, time.Now(), d.FinishedAt, time.Second)
 		assert.False(t, d.Aborted)
+		assert.Equal(t, user, d.FinishedBy)
+		assert.Equal(t, slack.User{}, d.AbortedBy)
 	}
 
-	_, ok := repo.Finish("key2")
+	_, ok := repo.Finish("key2", user, nil)
 	assert.False(t, ok)
 }
 
+func TestChannelDeploys_Finish_NotPermitted(t *testing.T) {
+	store := deploy.NewInMemoryStore()
+	repo := deploy.NewChannelDeploys(store)
+
+	current, ok := repo.Start("key1", deploy.New(slack.User{ID: "1", Name: "Test User"}, "Test subject"))
+	require.True(t, ok)
+
+	var permitted deploy.Deploy
+	_, ok = repo.Finish("key1", slack.User{ID: "2", Name: "Another User"}, func(d deploy.Deploy) bool {
+		permitted = d
+		return false
+	})
+	assert.False(t, ok)
+	assert.Equal(t, current.User, permitted.User)
+	assert.Equal(t, current.Subject, permitted.Subject)
+
+	d, ok := repo.Current("key1")
+	require.True(t, ok)
+	assert.Equal(t, current.Subject, d.Subject)
+
+	_, ok = repo.Abort("key1", "something went wrong", slack.User{ID: "2", Name: "Another User"}, func(deploy.Deploy) bool { return false })
+	assert.False(t, ok)
+
+	d, ok = repo.Current("key1")
+	require.True(t, ok)
+	assert.False(t, d.Aborted)
+}
+
 func TestChannelDeploys_Abort(t *testing.T) {
 	current := deploy.New(slack.User{ID: "1", Name: "Test User"}, "Test subject")
 	current.StartedAt = time.Now().Add(-2 * time.Second)
@@ -142,13 +214,15 @@ func TestChannelDeploys_Abort(t *testing.T) {
 
 	repo := deploy.NewChannelDeploys(store)
 
-	if d, ok := repo.Abort("key1", "something went wrong"); assert.True(t, ok) {
+	user := slack.User{ID: "2", Name: "Another User"}
+	if d, ok := repo.Abort("key1", "something went wrong", user, nil); assert.True(t, ok) {
 		assert.Equal(t, current.User, d.User)
 		assert.Equal(t, current.Subject, d.Subject)
 		assert.WithinDuration(t, time.Now(), d.FinishedAt, time.Second)
 		assert.True(t, d.Aborted)
+		assert.Equal(t, user, d.AbortedBy)
 	}
 
-	_, ok := repo.Abort("key2", "something went wrong")
+	_, ok := repo.Abort("key2", "something went wrong", user, nil)
 	assert.False(t, ok)
 }
@@ -7,29 +7,102 @@ import (
 )
 
 type Deploy struct {
-	User         slack.User
-	Subject      string
-	StartedAt    time.Time
-	FinishedAt   time.Time
-	Aborted      bool
-	AbortReason  string
+	User        slack.User
+	Subject     string
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	Aborted     bool
+	AbortReason string
+	// FinishedBy is the user who has finished the deploy with /deploy done. It's empty for aborted deploys
+	// and deploys finished before this field has been introduced.
+	FinishedBy slack.User
+	// AbortedBy is the user who has aborted the deploy.
+	AbortedBy slack.User
+	// ApprovedBy is the user who has approved the deploy in a channel that requires approvals.
+	ApprovedBy   slack.User
+	ApprovedAt   time.Time
 	PullRequests []PullRequestReference
-	Subscribers  []UserReference
+	Commits      []CommitReference
+	Tags         []TagReference
+	Ranges       []RangeReference
+	// References are mentions of external systems recognized by registered reference providers.
+	References  []Reference
+	Subscribers []UserReference
 }
 
+// New returns a deploy of subject by user with references to github.com recognized in subject. Use
+// ReferenceProviders.New to recognize references to other systems as well.
 func New(user slack.User, subject string) Deploy {
-	return Deploy{
-		User:         user,
-		Subject:      subject,
-		PullRequests: FindPullRequestReferences(subject),
-		Subscribers:  FindUserReferences(subject),
+	d := Deploy{
+		User:        user,
+		Subject:     subject,
+		Subscribers: FindUserReferences(subject),
 	}
+	defaultGitHubReferences.ParseSubject(&d)
+
+	return d
+}
+
+// ReferenceKeys returns unique index keys of pull requests, commits, tags, commit ranges and references recognized
+// by reference providers mentioned in deploy subject.
+func (d Deploy) ReferenceKeys() []string {
+	var keys []string
+
+	seen := make(map[string]struct{}, len(d.PullRequests)+len(d.Commits)+len(d.Tags)+len(d.Ranges)+len(d.References))
+	add := func(k string) {
+		if _, ok := seen[k]; ok {
+			return
+		}
+
+		seen[k] = struct{}{}
+		keys = append(keys, k)
+	}
+
+	for _, ref := range d.PullRequests {
+		add(ref.Key())
+	}
+
+	for _, ref := range d.Commits {
+		add(ref.Key())
+	}
+
+	for _, ref := range d.Tags {
+		add(ref.Key())
+	}
+
+	for _, ref := range d.Ranges {
+		add(ref.Key())
+	}
+
+	for _, ref := range d.References {
+		add(ref.Key())
+	}
+
+	return keys
+}
+
+// Key returns the key that identifies the deploy in channel history. It is derived from the start time, which is
+// stored with nanosecond precision.
+func (d Deploy) Key() string {
+	return deployKeyTimestamp(d.StartedAt)
 }
 
 func (d Deploy) Finished() bool {
 	return !d.FinishedAt.IsZero()
 }
 
+// Outcome returns a human-readable deploy state: "in progress", "deployed" or "aborted".
+func (d Deploy) Outcome() string {
+	switch {
+	case d.Aborted:
+		return "aborted"
+	case d.Finished():
+		return "deployed"
+	default:
+		return "in progress"
+	}
+}
+
 func (d *Deploy) Start() bool {
 	if !d.StartedAt.IsZero() {
 		return false
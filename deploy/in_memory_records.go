@@ -0,0 +1,115 @@
+package deploy
+
+import (
+	"sort"
+	"time"
+)
+
+// PutRecord stores a record replacing an existing one with the same key.
+func (s *InMemoryStore) PutRecord(collection string, rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.putRecord(collection, rec)
+
+	return nil
+}
+
+// AddRecord stores a record only if there is no unexpired record with the same key.
+func (s *InMemoryStore) AddRecord(collection string, rec Record) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.records[collection][rec.Key]; ok && !existing.Expired(time.Now()) {
+		return false, nil
+	}
+
+	s.putRecord(collection, rec)
+
+	return true, nil
+}
+
+// GetRecord returns a record by its key.
+func (s *InMemoryStore) GetRecord(collection, key string) (Record, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rec, ok := s.records[collection][key]
+	if !ok || rec.Expired(time.Now()) {
+		return Record{}, false, nil
+	}
+
+	return copyRecord(rec), true, nil
+}
+
+// DeleteRecord removes a record and returns its last value.
+func (s *InMemoryStore) DeleteRecord(collection, key string) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[collection][key]
+	if !ok {
+		return Record{}, false, nil
+	}
+	delete(s.records[collection], key)
+
+	if rec.Expired(time.Now()) {
+		return Record{}, false, nil
+	}
+
+	return rec, true, nil
+}
+
+// Records returns all unexpired records in collection ordered by their keys.
+func (s *InMemoryStore) Records(collection string) ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+
+	var records []Record
+	for _, rec := range s.records[collection] {
+		if !rec.Expired(now) {
+			records = append(records, copyRecord(rec))
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Key < records[j].Key
+	})
+
+	return records, nil
+}
+
+// RemoveExpiredRecords removes expired records from collection.
+func (s *InMemoryStore) RemoveExpiredRecords(collection string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	var n int
+	for key, rec := range s.records[collection] {
+		if rec.Expired(now) {
+			delete(s.records[collection], key)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (s *InMemoryStore) putRecord(collection string, rec Record) {
+	records, ok := s.records[collection]
+	if !ok {
+		records = make(map[string]Record)
+		s.records[collection] = records
+	}
+
+	records[rec.Key] = copyRecord(rec)
+}
+
+func copyRecord(rec Record) Record {
+	rec.Value = append([]byte(nil), rec.Value...)
+	return rec
+}
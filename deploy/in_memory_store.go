@@ -1,18 +1,29 @@
 package deploy
 
 import (
+	"sort"
 	"sync"
 	"time"
 )
 
 type InMemoryStore struct {
-	mu sync.RWMutex
-	m  map[string][]Deploy
+	mu      sync.RWMutex
+	m       map[string][]Deploy
+	refs    map[string][]inMemoryIndexEntry
+	records map[string]map[string]Record
+}
+
+// inMemoryIndexEntry points to a deploy in channel history.
+type inMemoryIndexEntry struct {
+	ChannelID string
+	StartedAt time.Time
 }
 
 func NewInMemoryStore() *InMemoryStore {
 	return &InMemoryStore{
-		m: make(map[string][]Deploy),
+		m:       make(map[string][]Deploy),
+		refs:    make(map[string][]inMemoryIndexEntry),
+		records: make(map[string]map[string]Record),
 	}
 }
 
@@ -28,44 +39,158 @@ func (s *InMemoryStore) Get(key string) (d Deploy, ok bool) {
 	return d, ok
 }
 
+// Set adds d to key history keeping it sorted by deploy start time. If there already is a deploy started
+// at the same time, it gets replaced with d.
 func (s *InMemoryStore) Set(key string, d Deploy) {
 	s.mu.Lock()
-	history, ok := s.m[key]
-	if ok && len(history) > 0 && history[len(history)-1].StartedAt == d.StartedAt { // Update last deploy
-		history[len(history)-1] = d
-	} else { // Add new deploy
-		s.m[key] = append(s.m[key], d)
+	defer s.mu.Unlock()
+
+	s.index(key, d)
+
+	history := s.m[key]
+
+	i := len(history)
+	if i > 0 && !history[i-1].StartedAt.Before(d.StartedAt) { // Not a new deploy, look up its position
+		i = sort.Search(len(history), func(i int) bool {
+			return !history[i].StartedAt.Before(d.StartedAt)
+		})
+	}
+
+	if i < len(history) && history[i].StartedAt.Equal(d.StartedAt) { // Update existing deploy
+		history[i] = d
+		return
 	}
-	s.mu.Unlock()
+
+	history = append(history, Deploy{})
+	copy(history[i+1:], history[i:])
+	history[i] = d
+
+	s.m[key] = history
 }
 
 func (s *InMemoryStore) All(key string) []Deploy {
-	deploys := make([]Deploy, len(s.m[key]))
 	s.mu.RLock()
-	copy(deploys, s.m[key])
-	s.mu.RUnlock()
+	defer s.mu.RUnlock()
 
-	return deploys
+	return append([]Deploy(nil), s.m[key]...)
 }
 
-func (s *InMemoryStore) Since(key string, startTime time.Time) []Deploy {
+// Channels returns IDs of all channels that have deploy history.
+func (s *InMemoryStore) Channels() []string {
 	s.mu.RLock()
-	history, ok := s.m[key]
-	if !ok {
-		return nil
+	defer s.mu.RUnlock()
+
+	channels := make([]string, 0, len(s.m))
+	for key := range s.m {
+		channels = append(channels, key)
 	}
-	s.mu.RUnlock()
 
-	i := len(history)
-	for ; i > 0; i-- {
-		if history[i-1].StartedAt.Before(startTime) {
-			break
+	return channels
+}
+
+// Prune removes outdated deploys from channel history. See deploy.Pruner for details.
+func (s *InMemoryStore) Prune(key string, before time.Time, keep int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := s.m[key]
+
+	n := prunedCount(len(history), func(i int) time.Time {
+		return history[i].StartedAt
+	}, before, keep)
+	if n > 0 {
+		for _, d := range history[:n] {
+			s.unindex(key, d)
 		}
+
+		// Copy the rest of history so that removed deploys can be garbage collected
+		s.m[key] = append([]Deploy(nil), history[n:]...)
 	}
 
+	return n
+}
+
+// DeploysOf returns deploys that mention the pull request or commit with given key. See deploy.ReferenceIndex
+// for details.
+func (s *InMemoryStore) DeploysOf(key string) []IndexedDeploy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var deploys []IndexedDeploy
+	for _, entry := range s.refs[key] {
+		history := s.m[entry.ChannelID]
+
+		i := sort.Search(len(history), func(i int) bool {
+			return !history[i].StartedAt.Before(entry.StartedAt)
+		})
+		if i == len(history) || !history[i].StartedAt.Equal(entry.StartedAt) {
+			continue
+		}
+
+		deploys = append(deploys, IndexedDeploy{ChannelID: entry.ChannelID, Deploy: history[i]})
+	}
+
+	sort.SliceStable(deploys, func(i, j int) bool {
+		return deploys[i].StartedAt.Before(deploys[j].StartedAt)
+	})
+
+	return deploys
+}
+
+// index adds d to the reference index unless it's already there.
+func (s *InMemoryStore) index(channelID string, d Deploy) {
+	entry := inMemoryIndexEntry{ChannelID: channelID, StartedAt: d.StartedAt}
+
+	for _, k := range d.ReferenceKeys() {
+		if indexOfEntry(s.refs[k], entry) < 0 {
+			s.refs[k] = append(s.refs[k], entry)
+		}
+	}
+}
+
+// unindex removes d from the reference index.
+func (s *InMemoryStore) unindex(channelID string, d Deploy) {
+	entry := inMemoryIndexEntry{ChannelID: channelID, StartedAt: d.StartedAt}
+
+	for _, k := range d.ReferenceKeys() {
+		entries := s.refs[k]
+
+		i := indexOfEntry(entries, entry)
+		if i < 0 {
+			continue
+		}
+
+		if len(entries) == 1 {
+			delete(s.refs, k)
+			continue
+		}
+
+		s.refs[k] = append(entries[:i:i], entries[i+1:]...)
+	}
+}
+
+func indexOfEntry(entries []inMemoryIndexEntry, entry inMemoryIndexEntry) int {
+	for i, e := range entries {
+		if e.ChannelID == entry.ChannelID && e.StartedAt.Equal(entry.StartedAt) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s *InMemoryStore) Since(key string, startTime time.Time) []Deploy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := s.m[key]
+	i := sort.Search(len(history), func(i int) bool {
+		return !history[i].StartedAt.Before(startTime)
+	})
+
 	if i == len(history) {
 		return nil
 	}
 
-	return history[i:]
+	return append([]Deploy(nil), history[i:]...)
 }
@@ -4,18 +4,11 @@ import (
 	"testing"
 
 	"github.com/andrewslotin/michael/deploy"
-	"github.com/stretchr/testify/suite"
+	"github.com/andrewslotin/michael/deploy/storetest"
 )
 
-func TestInMemoryStore_AsStore(t *testing.T) {
-	suite.Run(t, &StoreSuite{Setup: func() (store deploy.Store, teardownFn func(), err error) {
+func TestInMemoryStore(t *testing.T) {
+	storetest.RunStoreSuite(t, func() (storetest.Store, func(), error) {
 		return deploy.NewInMemoryStore(), nil, nil
-	}})
-}
-
-func TestInMemoryStore_AsRepository(t *testing.T) {
-	suite.Run(t, &RepositorySuite{Setup: func() (repo deploy.Repository, setFn func(string, deploy.Deploy), teardownFn func(), err error) {
-		r := deploy.NewInMemoryStore()
-		return r, r.Set, nil, nil
-	}})
+	})
 }
@@ -0,0 +1,169 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/andrewslotin/michael/slack"
+)
+
+// DefaultApprovalTTL is the default period of time during which a pending deploy can be approved.
+const DefaultApprovalTTL = time.Hour
+
+const pendingDeploysCollection = "pending_deploys"
+
+// PendingDeploy is a deploy waiting for approval.
+type PendingDeploy struct {
+	// ID distinguishes subsequent requests of the same user.
+	ID          string
+	Deploy      Deploy
+	RequestedAt time.Time
+	ExpiresAt   time.Time
+}
+
+type pendingDeployRecord struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	UserName    string    `json:"user_name"`
+	Subject     string    `json:"subject"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// PendingDeploys keeps deploys waiting for approval in a RecordStore. There can be only one pending deploy
+// per channel.
+type PendingDeploys struct {
+	// TTL is the period of time after which a pending deploy expires unless approved.
+	TTL time.Duration
+
+	records RecordStore
+}
+
+// NewPendingDeploys returns an instance of *PendingDeploys that keeps pending deploys in records.
+func NewPendingDeploys(records RecordStore) *PendingDeploys {
+	return &PendingDeploys{
+		TTL:     DefaultApprovalTTL,
+		records: records,
+	}
+}
+
+// Request adds a deploy to the approval queue of the channel. If there is a pending deploy requested by
+// the same user, it gets replaced. If the pending deploy has been requested by another user, Request
+// returns it along with false.
+func (p *PendingDeploys) Request(channelID string, d Deploy) (PendingDeploy, bool, error) {
+	now := time.Now().UTC()
+
+	pending := PendingDeploy{
+		ID:          strconv.FormatInt(now.UnixNano(), 36),
+		Deploy:      d,
+		RequestedAt: now,
+		ExpiresAt:   now.Add(p.TTL),
+	}
+
+	rec, err := newPendingDeployRecord(channelID, pending)
+	if err != nil {
+		return PendingDeploy{}, false, err
+	}
+
+	added, err := p.records.AddRecord(pendingDeploysCollection, rec)
+	if err != nil {
+		return PendingDeploy{}, false, fmt.Errorf("failed to store pending deploy in %s: %s", channelID, err)
+	}
+
+	if added {
+		return pending, true, nil
+	}
+
+	existing, ok, err := p.Get(channelID)
+	if err != nil {
+		return PendingDeploy{}, false, err
+	}
+
+	if ok && existing.Deploy.User.ID != d.User.ID {
+		return existing, false, nil
+	}
+
+	if err := p.records.PutRecord(pendingDeploysCollection, rec); err != nil {
+		return PendingDeploy{}, false, fmt.Errorf("failed to store pending deploy in %s: %s", channelID, err)
+	}
+
+	return pending, true, nil
+}
+
+// Get returns pending deploy in channel.
+func (p *PendingDeploys) Get(channelID string) (PendingDeploy, bool, error) {
+	rec, ok, err := p.records.GetRecord(pendingDeploysCollection, channelID)
+	if err != nil {
+		return PendingDeploy{}, false, fmt.Errorf("failed to get pending deploy in %s: %s", channelID, err)
+	}
+
+	if !ok {
+		return PendingDeploy{}, false, nil
+	}
+
+	pending, err := decodePendingDeploy(rec)
+	if err != nil {
+		return PendingDeploy{}, false, err
+	}
+
+	return pending, true, nil
+}
+
+// Take removes pending deploy with given ID from the approval queue of the channel and returns it. Only one
+// of concurrent callers receives the deploy.
+func (p *PendingDeploys) Take(channelID, id string) (PendingDeploy, bool, error) {
+	rec, ok, err := p.records.DeleteRecord(pendingDeploysCollection, channelID)
+	if err != nil {
+		return PendingDeploy{}, false, fmt.Errorf("failed to remove pending deploy in %s: %s", channelID, err)
+	}
+
+	if !ok || rec.Expired(time.Now()) {
+		return PendingDeploy{}, false, nil
+	}
+
+	pending, err := decodePendingDeploy(rec)
+	if err != nil {
+		return PendingDeploy{}, false, err
+	}
+
+	if pending.ID != id {
+		// The deploy has been replaced with a newer request in the meantime, so it needs to be put back
+		if _, err := p.records.AddRecord(pendingDeploysCollection, rec); err != nil {
+			return PendingDeploy{}, false, fmt.Errorf("failed to restore pending deploy in %s: %s", channelID, err)
+		}
+
+		return PendingDeploy{}, false, nil
+	}
+
+	return pending, true, nil
+}
+
+func newPendingDeployRecord(channelID string, pending PendingDeploy) (Record, error) {
+	data, err := json.Marshal(pendingDeployRecord{
+		ID:          pending.ID,
+		UserID:      pending.Deploy.User.ID,
+		UserName:    pending.Deploy.User.Name,
+		Subject:     pending.Deploy.Subject,
+		RequestedAt: pending.RequestedAt,
+	})
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to marshal pending deploy: %s", err)
+	}
+
+	return Record{Key: channelID, Value: data, ExpiresAt: pending.ExpiresAt}, nil
+}
+
+func decodePendingDeploy(rec Record) (PendingDeploy, error) {
+	var v pendingDeployRecord
+	if err := json.Unmarshal(rec.Value, &v); err != nil {
+		return PendingDeploy{}, fmt.Errorf("malformed pending deploy in %s: %s", rec.Key, err)
+	}
+
+	return PendingDeploy{
+		ID:          v.ID,
+		Deploy:      New(slack.User{ID: v.UserID, Name: v.UserName}, v.Subject),
+		RequestedAt: v.RequestedAt,
+		ExpiresAt:   rec.ExpiresAt,
+	}, nil
+}
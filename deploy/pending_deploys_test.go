@@ -0,0 +1,105 @@
+package deploy_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPendingDeploys_RequestTake(t *testing.T) {
+	pending := deploy.NewPendingDeploys(deploy.NewInMemoryStore())
+
+	requested, ok, err := pending.Request("C1", deploy.New(slack.User{ID: "U1", Name: "user1"}, "a/b#1"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(deploy.DefaultApprovalTTL), requested.ExpiresAt, time.Second)
+
+	found, ok, err := pending.Get("C1")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	assert.Equal(t, requested.ID, found.ID)
+	assert.Equal(t, slack.User{ID: "U1", Name: "user1"}, found.Deploy.User)
+	assert.Equal(t, "a/b#1", found.Deploy.Subject)
+	assert.Equal(t, []deploy.PullRequestReference{{ID: "1", Repository: "a/b"}}, found.Deploy.PullRequests)
+
+	_, ok, err = pending.Take("C1", "another ID")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	taken, ok, err := pending.Take("C1", requested.ID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "a/b#1", taken.Deploy.Subject)
+
+	_, ok, err = pending.Take("C1", requested.ID)
+	require.NoError(t, err)
+	assert.False(t, ok, "expected pending deploy to be taken only once")
+}
+
+func TestPendingDeploys_Request_AnotherUser(t *testing.T) {
+	pending := deploy.NewPendingDeploys(deploy.NewInMemoryStore())
+
+	first, ok, err := pending.Request("C1", deploy.New(slack.User{ID: "U1", Name: "user1"}, "first"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	existing, ok, err := pending.Request("C1", deploy.New(slack.User{ID: "U2", Name: "user2"}, "second"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, first.ID, existing.ID)
+
+	// Requests in other channels are independent
+	_, ok, err = pending.Request("C2", deploy.New(slack.User{ID: "U2", Name: "user2"}, "second"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestPendingDeploys_Request_SameUser(t *testing.T) {
+	pending := deploy.NewPendingDeploys(deploy.NewInMemoryStore())
+
+	_, ok, err := pending.Request("C1", deploy.New(slack.User{ID: "U1", Name: "user1"}, "first"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	time.Sleep(time.Millisecond)
+
+	second, ok, err := pending.Request("C1", deploy.New(slack.User{ID: "U1", Name: "user1"}, "second"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	found, ok, err := pending.Get("C1")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	assert.Equal(t, second.ID, found.ID)
+	assert.Equal(t, "second", found.Deploy.Subject)
+}
+
+func TestPendingDeploys_Expiration(t *testing.T) {
+	pending := deploy.NewPendingDeploys(deploy.NewInMemoryStore())
+	pending.TTL = 10 * time.Millisecond
+
+	requested, ok, err := pending.Request("C1", deploy.New(slack.User{ID: "U1", Name: "user1"}, "first"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	time.Sleep(20 * time.Millisecond)
+
+	_, ok, err = pending.Get("C1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, ok, err = pending.Take("C1", requested.ID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Expired requests of other users do not block new ones
+	_, ok, err = pending.Request("C1", deploy.New(slack.User{ID: "U2", Name: "user2"}, "second"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,91 @@
+package deploy
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// Record is an arbitrary value kept by RecordStore.
+type Record struct {
+	Key   string
+	Value []byte
+	// ExpiresAt is the time after which the record is considered removed. Zero value means that the record
+	// never expires.
+	ExpiresAt time.Time
+}
+
+// Expired returns true if the record has expired by given time.
+func (rec Record) Expired(now time.Time) bool {
+	return !rec.ExpiresAt.IsZero() && !now.Before(rec.ExpiresAt)
+}
+
+// RecordStore is an interface implemented by stores that are able to keep other data besides deploy history,
+// such as issued tokens or settings. Records are grouped into collections and identified by their keys within
+// a collection. Expired records are never returned, however they may still occupy space until RemoveExpiredRecords
+// is called for their collection.
+//
+// PutRecord stores a record replacing an existing one with the same key.
+//
+// AddRecord stores a record only if there is no unexpired record with the same key and returns false otherwise.
+//
+// GetRecord returns a record by its key.
+//
+// DeleteRecord removes a record and returns its last value.
+//
+// Records returns all unexpired records in collection ordered by their keys.
+//
+// RemoveExpiredRecords removes expired records from collection and returns their number. Other collections are left
+// intact, so that the cost of removal does not depend on the size of unrelated ones, such as audit log.
+type RecordStore interface {
+	PutRecord(collection string, rec Record) error
+	AddRecord(collection string, rec Record) (bool, error)
+	GetRecord(collection, key string) (Record, bool, error)
+	DeleteRecord(collection, key string) (Record, bool, error)
+	Records(collection string) ([]Record, error)
+	RemoveExpiredRecords(collection string) (int, error)
+}
+
+// TransactionalRecordStore is an interface implemented by record stores that can be shared between multiple processes.
+//
+// UpdateRecord reads a record by its key, passes it to fn and atomically stores the record returned by fn unless fn
+// returns an error. If the record has been changed by someone else in the meantime, the update is retried, so fn may be
+// called more than once and should not have side effects.
+type TransactionalRecordStore interface {
+	RecordStore
+	UpdateRecord(collection, key string, fn func(rec Record, ok bool) (Record, error)) error
+}
+
+var errMalformedRecord = errors.New("malformed record")
+
+// encodeRecord serializes record value along with its expiration time for stores that can only keep
+// plain byte strings.
+func encodeRecord(rec Record) []byte {
+	var expiresAt int64
+	if !rec.ExpiresAt.IsZero() {
+		expiresAt = rec.ExpiresAt.UnixNano()
+	}
+
+	data := make([]byte, 8+len(rec.Value))
+	binary.BigEndian.PutUint64(data, uint64(expiresAt))
+	copy(data[8:], rec.Value)
+
+	return data
+}
+
+func decodeRecord(key string, data []byte) (Record, error) {
+	if len(data) < 8 {
+		return Record{}, errMalformedRecord
+	}
+
+	rec := Record{
+		Key:   key,
+		Value: append([]byte(nil), data[8:]...),
+	}
+
+	if expiresAt := int64(binary.BigEndian.Uint64(data)); expiresAt != 0 {
+		rec.ExpiresAt = time.Unix(0, expiresAt)
+	}
+
+	return rec, nil
+}
@@ -0,0 +1,250 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// PutRecord stores a record replacing an existing one with the same key.
+func (s *RedisStore) PutRecord(collection string, rec Record) error {
+	ctx := context.Background()
+
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, recordsKey(collection), rec.Key, encodeRecord(rec))
+		pipe.SAdd(ctx, redisKeyPrefix+"collections", collection)
+
+		return nil
+	})
+
+	return err
+}
+
+// AddRecord stores a record only if there is no unexpired record with the same key.
+func (s *RedisStore) AddRecord(collection string, rec Record) (bool, error) {
+	ctx := context.Background()
+
+	var added bool
+	txFn := func(tx *redis.Tx) error {
+		added = false
+
+		data, err := tx.HGet(ctx, recordsKey(collection), rec.Key).Bytes()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+
+		if err == nil {
+			if existing, err := decodeRecord(rec.Key, data); err == nil && !existing.Expired(time.Now()) {
+				return nil
+			}
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, recordsKey(collection), rec.Key, encodeRecord(rec))
+			pipe.SAdd(ctx, redisKeyPrefix+"collections", collection)
+
+			return nil
+		})
+		added = err == nil
+
+		return err
+	}
+
+	for i := 0; i < redisMaxUpdateAttempts; i++ {
+		err := s.client.Watch(ctx, txFn, recordsKey(collection))
+		if err != redis.TxFailedErr {
+			return added, err
+		}
+	}
+
+	return false, ErrTooManyConcurrentUpdates
+}
+
+// UpdateRecord atomically replaces a record with the one returned by fn. See deploy.TransactionalRecordStore
+// for details.
+func (s *RedisStore) UpdateRecord(collection, key string, fn func(rec Record, ok bool) (Record, error)) error {
+	ctx := context.Background()
+
+	txFn := func(tx *redis.Tx) error {
+		var (
+			rec Record
+			ok  bool
+		)
+
+		data, err := tx.HGet(ctx, recordsKey(collection), key).Bytes()
+		switch {
+		case err == redis.Nil:
+		case err != nil:
+			return err
+		default:
+			if rec, err = decodeRecord(key, data); err != nil {
+				return fmt.Errorf("failed to read %s/%s: %s", collection, key, err)
+			}
+
+			if ok = !rec.Expired(time.Now()); !ok {
+				rec = Record{}
+			}
+		}
+
+		updated, err := fn(rec, ok)
+		if err != nil {
+			return err
+		}
+		updated.Key = key
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, recordsKey(collection), key, encodeRecord(updated))
+			pipe.SAdd(ctx, redisKeyPrefix+"collections", collection)
+
+			return nil
+		})
+
+		return err
+	}
+
+	for i := 0; i < redisMaxUpdateAttempts; i++ {
+		err := s.client.Watch(ctx, txFn, recordsKey(collection))
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+
+	return ErrTooManyConcurrentUpdates
+}
+
+// GetRecord returns a record by its key.
+func (s *RedisStore) GetRecord(collection, key string) (Record, bool, error) {
+	data, err := s.client.HGet(context.Background(), recordsKey(collection), key).Bytes()
+	if err == redis.Nil {
+		return Record{}, false, nil
+	}
+
+	if err != nil {
+		return Record{}, false, err
+	}
+
+	rec, err := decodeRecord(key, data)
+	if err != nil {
+		return Record{}, false, fmt.Errorf("failed to read %s/%s: %s", collection, key, err)
+	}
+
+	if rec.Expired(time.Now()) {
+		return Record{}, false, nil
+	}
+
+	return rec, true, nil
+}
+
+// DeleteRecord removes a record and returns its last value.
+func (s *RedisStore) DeleteRecord(collection, key string) (Record, bool, error) {
+	ctx := context.Background()
+
+	var get *redis.StringCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.HGet(ctx, recordsKey(collection), key)
+		pipe.HDel(ctx, recordsKey(collection), key)
+
+		return nil
+	})
+	if err == redis.Nil {
+		return Record{}, false, nil
+	}
+
+	if err != nil {
+		return Record{}, false, err
+	}
+
+	rec, err := decodeRecord(key, []byte(get.Val()))
+	if err != nil {
+		return Record{}, false, fmt.Errorf("failed to read %s/%s: %s", collection, key, err)
+	}
+
+	if rec.Expired(time.Now()) {
+		return Record{}, false, nil
+	}
+
+	return rec, true, nil
+}
+
+// Records returns all unexpired records in collection ordered by their keys.
+func (s *RedisStore) Records(collection string) ([]Record, error) {
+	values, err := s.client.HGetAll(context.Background(), recordsKey(collection)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	var records []Record
+	for k, v := range values {
+		rec, err := decodeRecord(k, []byte(v))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s/%s: %s", collection, k, err)
+		}
+
+		if !rec.Expired(now) {
+			records = append(records, rec)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Key < records[j].Key
+	})
+
+	return records, nil
+}
+
+// RemoveExpiredRecords removes expired records from collection.
+func (s *RedisStore) RemoveExpiredRecords(collection string) (int, error) {
+	return s.removeExpiredRecords(context.Background(), collection)
+}
+
+func (s *RedisStore) removeExpiredRecords(ctx context.Context, collection string) (int, error) {
+	var expired []string
+	txFn := func(tx *redis.Tx) error {
+		values, err := tx.HGetAll(ctx, recordsKey(collection)).Result()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		expired = expired[:0]
+		for k, v := range values {
+			if rec, err := decodeRecord(k, []byte(v)); err != nil || rec.Expired(now) {
+				expired = append(expired, k)
+			}
+		}
+
+		if len(expired) == 0 {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HDel(ctx, recordsKey(collection), expired...)
+			return nil
+		})
+
+		return err
+	}
+
+	for i := 0; i < redisMaxUpdateAttempts; i++ {
+		err := s.client.Watch(ctx, txFn, recordsKey(collection))
+		if err == nil {
+			return len(expired), nil
+		}
+
+		if err != redis.TxFailedErr {
+			return 0, err
+		}
+	}
+
+	return 0, ErrTooManyConcurrentUpdates
+}
+
+func recordsKey(collection string) string {
+	return redisKeyPrefix + "records:" + collection
+}
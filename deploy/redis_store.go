@@ -0,0 +1,459 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/andrewslotin/michael/slack"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	redisKeyPrefix = "michael:"
+
+	// redisMaxUpdateAttempts is the number of times RedisStore.Update retries a transaction that failed
+	// because of concurrent changes.
+	redisMaxUpdateAttempts = 10
+)
+
+// ErrTooManyConcurrentUpdates is returned when the store failed to apply an update because of other
+// processes changing the same channel history.
+var ErrTooManyConcurrentUpdates = errors.New("too many concurrent updates")
+
+// RedisStore keeps deploy history in Redis, so that it can be shared between several instances of michael.
+//
+// Channel history is stored in a sorted set (michael:history:<channel ID>) with deploy start times used
+// as scores and fixed-width start timestamps as members. Deploys themselves are stored as JSON in a hash
+// (michael:deploys:<channel ID>) under the same keys. IDs of all channels with deploy history are kept in
+// michael:channels set. Deploys that mention pull requests, commits or tags are indexed in sorted sets
+// (michael:refs:<reference key>) with start times used as scores and <channel ID> <deploy key> as members.
+// Records of each RecordStore collection are kept in a hash (michael:records:<collection>).
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore connects to Redis server specified by URL in redis://[:password@]host:port[/db] format.
+func NewRedisStore(redisURL string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("malformed redis URL: %s", err)
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to %s: %s", opts.Addr, err)
+	}
+
+	return &RedisStore{client: client}, nil
+}
+
+// Close closes the connection to Redis.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+func (s *RedisStore) Get(key string) (Deploy, bool) {
+	d, ok, err := s.last(context.Background(), s.client, key)
+	if err != nil {
+		log.Printf("failed to read latest deploy in channel %s: %s", key, err)
+		return Deploy{}, false
+	}
+
+	return d, ok
+}
+
+func (s *RedisStore) Set(key string, d Deploy) {
+	ctx := context.Background()
+
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		return s.write(ctx, pipe, key, d)
+	})
+	if err != nil {
+		log.Printf("failed to store deploy of %s by %s in channel %s: %s", d.Subject, d.User.Name, key, err)
+	}
+}
+
+// Update atomically replaces the latest deploy in key history. See deploy.TransactionalStore for details.
+//
+// Finishing a deploy only changes its record in the deploys hash, so both history and deploys keys are watched
+// for concurrent changes.
+func (s *RedisStore) Update(key string, fn func(last Deploy, ok bool) []Deploy) error {
+	ctx := context.Background()
+
+	txFn := func(tx *redis.Tx) error {
+		last, ok, err := s.last(ctx, tx, key)
+		if err != nil {
+			return err
+		}
+
+		deploys := fn(last, ok)
+		if len(deploys) == 0 {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, d := range deploys {
+				if err := s.write(ctx, pipe, key, d); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+
+		return err
+	}
+
+	for i := 0; i < redisMaxUpdateAttempts; i++ {
+		err := s.client.Watch(ctx, txFn, historyKey(key), deploysKey(key))
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+
+	return ErrTooManyConcurrentUpdates
+}
+
+func (s *RedisStore) All(key string) []Deploy {
+	ctx := context.Background()
+
+	deploys, err := s.read(ctx, s.client, key, s.client.ZRange(ctx, historyKey(key), 0, -1))
+	if err != nil {
+		log.Printf("failed to read deploys in channel %s: %s", key, err)
+		return nil
+	}
+
+	return deploys
+}
+
+func (s *RedisStore) Since(key string, startTime time.Time) []Deploy {
+	ctx := context.Background()
+
+	// Scores have microsecond precision, so deploys started within the same microsecond before startTime
+	// need to be filtered out by their keys
+	cmd := s.client.ZRangeByScore(ctx, historyKey(key), &redis.ZRangeBy{
+		Min: fmt.Sprintf("%d", startTime.UnixMicro()),
+		Max: "+inf",
+	})
+
+	since := deployKeyTimestamp(startTime)
+
+	var keys []string
+	for _, k := range cmd.Val() {
+		if k >= since {
+			keys = append(keys, k)
+		}
+	}
+
+	deploys, err := s.read(ctx, s.client, key, redis.NewStringSliceResult(keys, cmd.Err()))
+	if err != nil {
+		log.Printf("failed to read deploys in channel %s since %s: %s", key, startTime, err)
+		return nil
+	}
+
+	return deploys
+}
+
+// Channels returns IDs of all channels that have deploy history.
+func (s *RedisStore) Channels() []string {
+	channels, err := s.client.SMembers(context.Background(), redisKeyPrefix+"channels").Result()
+	if err != nil {
+		log.Printf("failed to read channels: %s", err)
+		return nil
+	}
+
+	return channels
+}
+
+// Prune removes outdated deploys from channel history. See deploy.Pruner for details.
+func (s *RedisStore) Prune(key string, before time.Time, keep int) int {
+	ctx := context.Background()
+
+	var n int
+	txFn := func(tx *redis.Tx) error {
+		deployKeys, err := tx.ZRange(ctx, historyKey(key), 0, -1).Result()
+		if err != nil {
+			return err
+		}
+
+		n = prunedCount(len(deployKeys), func(i int) time.Time {
+			startedAt, _ := time.Parse(deployKeyTimeFormat, deployKeys[i])
+			return startedAt
+		}, before, keep)
+		if n == 0 {
+			return nil
+		}
+
+		members := make([]interface{}, n)
+		for i, k := range deployKeys[:n] {
+			members[i] = k
+		}
+
+		pruned, err := s.read(ctx, tx, key, redis.NewStringSliceResult(deployKeys[:n], nil))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZRem(ctx, historyKey(key), members...)
+			pipe.HDel(ctx, deploysKey(key), deployKeys[:n]...)
+
+			for _, d := range pruned {
+				for _, ref := range d.ReferenceKeys() {
+					pipe.ZRem(ctx, referencesKey(ref), referenceMember(key, d))
+				}
+			}
+
+			return nil
+		})
+
+		return err
+	}
+
+	for i := 0; i < redisMaxUpdateAttempts; i++ {
+		err := s.client.Watch(ctx, txFn, historyKey(key), deploysKey(key))
+		if err == nil {
+			return n
+		}
+
+		if err != redis.TxFailedErr {
+			log.Printf("failed to prune deploys in channel %s: %s", key, err)
+			return 0
+		}
+	}
+
+	log.Printf("failed to prune deploys in channel %s: %s", key, ErrTooManyConcurrentUpdates)
+
+	return 0
+}
+
+// DeploysOf returns deploys that mention the pull request or commit with given key. See deploy.ReferenceIndex
+// for details.
+func (s *RedisStore) DeploysOf(key string) []IndexedDeploy {
+	ctx := context.Background()
+
+	members, err := s.client.ZRange(ctx, referencesKey(key), 0, -1).Result()
+	if err != nil {
+		log.Printf("failed to look up deploys of %s: %s", key, err)
+		return nil
+	}
+
+	if len(members) == 0 {
+		return nil
+	}
+
+	channelIDs := make([]string, len(members))
+	cmds := make([]*redis.StringCmd, len(members))
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, m := range members {
+			var deployKey string
+			if n := strings.IndexByte(m, ' '); n > 0 {
+				channelIDs[i], deployKey = m[:n], m[n+1:]
+			}
+
+			cmds[i] = pipe.HGet(ctx, deploysKey(channelIDs[i]), deployKey)
+		}
+
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		log.Printf("failed to look up deploys of %s: %s", key, err)
+		return nil
+	}
+
+	var deploys []IndexedDeploy
+	for i, cmd := range cmds {
+		data, err := cmd.Result()
+		if err != nil { // the deploy has been removed from history
+			continue
+		}
+
+		var rec redisDeploy
+		if err := json.Unmarshal([]byte(data), &rec); err != nil {
+			log.Printf("malformed deploy %s: %s", members[i], err)
+			continue
+		}
+
+		deploys = append(deploys, IndexedDeploy{ChannelID: channelIDs[i], Deploy: rec.Deploy()})
+	}
+
+	return deploys
+}
+
+// last returns the latest deploy in key history.
+func (s *RedisStore) last(ctx context.Context, c redis.Cmdable, key string) (Deploy, bool, error) {
+	deploys, err := s.read(ctx, c, key, c.ZRange(ctx, historyKey(key), -1, -1))
+	if err != nil || len(deploys) == 0 {
+		return Deploy{}, false, err
+	}
+
+	return deploys[0], true, nil
+}
+
+// read fetches deploys listed by cmd from key history.
+func (*RedisStore) read(ctx context.Context, c redis.Cmdable, key string, cmd *redis.StringSliceCmd) ([]Deploy, error) {
+	deployKeys, err := cmd.Result()
+	if err != nil || len(deployKeys) == 0 {
+		return nil, err
+	}
+
+	values, err := c.HMGet(ctx, deploysKey(key), deployKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	deploys := make([]Deploy, 0, len(values))
+	for i, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("missing deploy %s", deployKeys[i])
+		}
+
+		var rec redisDeploy
+		if err := json.Unmarshal([]byte(data), &rec); err != nil {
+			return nil, fmt.Errorf("malformed deploy %s: %s", deployKeys[i], err)
+		}
+
+		deploys = append(deploys, rec.Deploy())
+	}
+
+	return deploys, nil
+}
+
+func (*RedisStore) write(ctx context.Context, pipe redis.Pipeliner, key string, d Deploy) error {
+	data, err := json.Marshal(newRedisDeploy(d))
+	if err != nil {
+		return err
+	}
+
+	deployKey := deployKeyTimestamp(d.StartedAt)
+
+	pipe.ZAdd(ctx, historyKey(key), &redis.Z{Score: float64(d.StartedAt.UnixMicro()), Member: deployKey})
+	pipe.HSet(ctx, deploysKey(key), deployKey, data)
+	pipe.SAdd(ctx, redisKeyPrefix+"channels", key)
+
+	for _, ref := range d.ReferenceKeys() {
+		pipe.ZAdd(ctx, referencesKey(ref), &redis.Z{Score: float64(d.StartedAt.UnixMicro()), Member: referenceMember(key, d)})
+	}
+
+	return nil
+}
+
+func historyKey(channelID string) string {
+	return redisKeyPrefix + "history:" + channelID
+}
+
+func deploysKey(channelID string) string {
+	return redisKeyPrefix + "deploys:" + channelID
+}
+
+func referencesKey(refKey string) string {
+	return redisKeyPrefix + "refs:" + refKey
+}
+
+// referenceMember returns the member of reference index sorted set that points to d in channel history.
+func referenceMember(channelID string, d Deploy) string {
+	return channelID + " " + deployKeyTimestamp(d.StartedAt)
+}
+
+// redisDeploy is the JSON representation of a deploy stored in Redis.
+type redisDeploy struct {
+	UserID       string                 `json:"user_id"`
+	UserName     string                 `json:"user_name"`
+	Subject      string                 `json:"subject"`
+	StartedAt    time.Time              `json:"started_at"`
+	FinishedAt   time.Time              `json:"finished_at"`
+	Aborted      bool                   `json:"aborted,omitempty"`
+	AbortReason  string                 `json:"abort_reason,omitempty"`
+	FinishedBy   *redisUser             `json:"finished_by,omitempty"`
+	AbortedBy    *redisUser             `json:"aborted_by,omitempty"`
+	ApprovedBy   *redisUser             `json:"approved_by,omitempty"`
+	ApprovedAt   *time.Time             `json:"approved_at,omitempty"`
+	PullRequests []PullRequestReference `json:"prs,omitempty"`
+	Commits      []CommitReference      `json:"commits,omitempty"`
+	Tags         []TagReference         `json:"tags,omitempty"`
+	Ranges       []RangeReference       `json:"ranges,omitempty"`
+	References   []Reference            `json:"references,omitempty"`
+	Subscribers  []UserReference        `json:"subscribers,omitempty"`
+}
+
+func newRedisDeploy(d Deploy) redisDeploy {
+	var approvedAt *time.Time
+	if !d.ApprovedAt.IsZero() {
+		approvedAt = &d.ApprovedAt
+	}
+
+	return redisDeploy{
+		UserID:       d.User.ID,
+		UserName:     d.User.Name,
+		Subject:      d.Subject,
+		StartedAt:    d.StartedAt,
+		FinishedAt:   d.FinishedAt,
+		Aborted:      d.Aborted,
+		AbortReason:  d.AbortReason,
+		FinishedBy:   newRedisUser(d.FinishedBy),
+		AbortedBy:    newRedisUser(d.AbortedBy),
+		ApprovedBy:   newRedisUser(d.ApprovedBy),
+		ApprovedAt:   approvedAt,
+		PullRequests: d.PullRequests,
+		Commits:      d.Commits,
+		Tags:         d.Tags,
+		Ranges:       d.Ranges,
+		References:   d.References,
+		Subscribers:  d.Subscribers,
+	}
+}
+
+func (rec redisDeploy) Deploy() Deploy {
+	var approvedAt time.Time
+	if rec.ApprovedAt != nil {
+		approvedAt = *rec.ApprovedAt
+	}
+
+	d := Deploy{
+		Subject:      rec.Subject,
+		StartedAt:    rec.StartedAt,
+		FinishedAt:   rec.FinishedAt,
+		Aborted:      rec.Aborted,
+		AbortReason:  rec.AbortReason,
+		PullRequests: rec.PullRequests,
+		Commits:      rec.Commits,
+		Tags:         rec.Tags,
+		Ranges:       rec.Ranges,
+		References:   rec.References,
+		Subscribers:  rec.Subscribers,
+	}
+	d.User.ID, d.User.Name = rec.UserID, rec.UserName
+	d.FinishedBy, d.AbortedBy = rec.FinishedBy.User(), rec.AbortedBy.User()
+	d.ApprovedBy, d.ApprovedAt = rec.ApprovedBy.User(), approvedAt
+
+	return d
+}
+
+type redisUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// newRedisUser returns nil for an empty user, so that it's omitted from JSON.
+func newRedisUser(user slack.User) *redisUser {
+	if user == (slack.User{}) {
+		return nil
+	}
+
+	return &redisUser{ID: user.ID, Name: user.Name}
+}
+
+func (u *redisUser) User() slack.User {
+	if u == nil {
+		return slack.User{}
+	}
+
+	return slack.User{ID: u.ID, Name: u.Name}
+}
@@ -0,0 +1,217 @@
+package deploy_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/andrewslotin/michael/auth"
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/deploy/storetest"
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisStore(t *testing.T) {
+	storetest.RunStoreSuite(t, func() (storetest.Store, func(), error) {
+		srv, err := miniredis.Run()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		store, err := deploy.NewRedisStore("redis://" + srv.Addr())
+		if err != nil {
+			return nil, srv.Close, err
+		}
+
+		return store, func() {
+			store.Close()
+			srv.Close()
+		}, nil
+	})
+}
+
+func TestRedisStore_ConcurrentStart(t *testing.T) {
+	srv, err := miniredis.Run()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Each replica has its own connection to Redis
+	var replicas []*deploy.ChannelDeploys
+	for i := 0; i < 3; i++ {
+		store, err := deploy.NewRedisStore("redis://" + srv.Addr())
+		require.NoError(t, err)
+		defer store.Close()
+
+		replicas = append(replicas, deploy.NewChannelDeploys(store))
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		started []string
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			user := slack.User{ID: fmt.Sprintf("U%d", i), Name: fmt.Sprintf("user%d", i)}
+			if _, ok := replicas[i%len(replicas)].Start("C1", deploy.New(user, "Deploy")); ok {
+				mu.Lock()
+				started = append(started, user.ID)
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	require.Len(t, started, 1, "expected only one user to start a deploy")
+
+	if d, ok := replicas[0].Current("C1"); assert.True(t, ok) {
+		assert.Equal(t, started[0], d.User.ID)
+	}
+
+	// Deploy started on one replica can be finished on another one
+	if d, ok := replicas[1].Finish("C1", slack.User{ID: "U0", Name: "user0"}, nil); assert.True(t, ok) {
+		assert.Equal(t, started[0], d.User.ID)
+		assert.True(t, d.Finished())
+	}
+
+	_, ok := replicas[2].Current("C1")
+	assert.False(t, ok)
+}
+
+func TestRedisStore_ConcurrentFinish(t *testing.T) {
+	srv, err := miniredis.Run()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Each replica has its own connection to Redis
+	store1, err := deploy.NewRedisStore("redis://" + srv.Addr())
+	require.NoError(t, err)
+	defer store1.Close()
+
+	store2, err := deploy.NewRedisStore("redis://" + srv.Addr())
+	require.NoError(t, err)
+	defer store2.Close()
+
+	replica1, replica2 := deploy.NewChannelDeploys(store1), deploy.NewChannelDeploys(store2)
+
+	_, ok := replica1.Start("C1", deploy.New(slack.User{ID: "U1", Name: "user1"}, "Deploy"))
+	require.True(t, ok)
+
+	// The deploy is finished on the second replica while the first one is aborting it
+	var finished, aborted bool
+	_, aborted = replica1.Abort("C1", "reason", slack.User{ID: "U1", Name: "user1"}, func(deploy.Deploy) bool {
+		if !finished {
+			_, finished = replica2.Finish("C1", slack.User{ID: "U2", Name: "user2"}, nil)
+		}
+
+		return true
+	})
+
+	assert.True(t, finished)
+	assert.False(t, aborted)
+
+	if d, ok := store1.Get("C1"); assert.True(t, ok) {
+		assert.False(t, d.Aborted)
+		assert.Equal(t, "U2", d.FinishedBy.ID)
+		assert.Empty(t, d.AbortedBy.ID)
+	}
+}
+
+func TestRedisStore_ConcurrentUpdateRecord(t *testing.T) {
+	srv, err := miniredis.Run()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Each replica has its own connection to Redis
+	store1, err := deploy.NewRedisStore("redis://" + srv.Addr())
+	require.NoError(t, err)
+	defer store1.Close()
+
+	store2, err := deploy.NewRedisStore("redis://" + srv.Addr())
+	require.NoError(t, err)
+	defer store2.Close()
+
+	require.NoError(t, store1.PutRecord("settings", deploy.Record{Key: "C1", Value: []byte("a")}))
+
+	// The record is updated on the second replica while the first one is updating it
+	var calls int
+	err = store1.UpdateRecord("settings", "C1", func(rec deploy.Record, ok bool) (deploy.Record, error) {
+		calls++
+		if calls == 1 {
+			require.NoError(t, store2.UpdateRecord("settings", "C1", func(rec deploy.Record, ok bool) (deploy.Record, error) {
+				return deploy.Record{Value: append(rec.Value, 'b')}, nil
+			}))
+		}
+
+		return deploy.Record{Value: append(rec.Value, 'c')}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	if rec, ok, err := store1.GetRecord("settings", "C1"); assert.NoError(t, err) && assert.True(t, ok) {
+		assert.Equal(t, "abc", string(rec.Value))
+	}
+
+	// Records are left intact if fn fails
+	err = store1.UpdateRecord("settings", "C1", func(rec deploy.Record, ok bool) (deploy.Record, error) {
+		return deploy.Record{Value: []byte("d")}, fmt.Errorf("failed")
+	})
+	assert.Error(t, err)
+
+	if rec, ok, err := store1.GetRecord("settings", "C1"); assert.NoError(t, err) && assert.True(t, ok) {
+		assert.Equal(t, "abc", string(rec.Value))
+	}
+
+	// Missing records are created
+	require.NoError(t, store1.UpdateRecord("settings", "C2", func(rec deploy.Record, ok bool) (deploy.Record, error) {
+		assert.False(t, ok)
+		return deploy.Record{Value: []byte("e")}, nil
+	}))
+
+	if rec, ok, err := store2.GetRecord("settings", "C2"); assert.NoError(t, err) && assert.True(t, ok) {
+		assert.Equal(t, "e", string(rec.Value))
+	}
+}
+
+func TestRedisStore_AsTokenStore(t *testing.T) {
+	srv, err := miniredis.Run()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	store1, err := deploy.NewRedisStore("redis://" + srv.Addr())
+	require.NoError(t, err)
+	defer store1.Close()
+
+	store2, err := deploy.NewRedisStore("redis://" + srv.Addr())
+	require.NoError(t, err)
+	defer store2.Close()
+
+	replica1 := auth.NewOneTimeTokenAuthenticatorWithStore(auth.CryptoTokenSource{}, auth.NewRecordTokenStore(store1))
+	replica2 := auth.NewOneTimeTokenAuthenticatorWithStore(auth.CryptoTokenSource{}, auth.NewRecordTokenStore(store2))
+
+	token, err := replica1.IssueToken("key1", auth.DefaultTokenLength)
+	require.NoError(t, err)
+
+	assert.True(t, replica2.Authenticate("key1", token))
+	assert.False(t, replica1.Authenticate("key1", token))
+	assert.False(t, replica2.Authenticate("key1", "unknown token"))
+}
+
+func TestNewRedisStore_Unavailable(t *testing.T) {
+	srv, err := miniredis.Run()
+	require.NoError(t, err)
+	addr := srv.Addr()
+	srv.Close()
+
+	_, err = deploy.NewRedisStore("redis://" + addr)
+	assert.Error(t, err)
+
+	_, err = deploy.NewRedisStore("http://" + addr)
+	assert.Error(t, err)
+}
@@ -0,0 +1,17 @@
+package deploy
+
+// ReferenceIndex is an interface implemented by stores that can look up deploys by pull requests, commits and
+// tags mentioned in their subjects.
+//
+// DeploysOf returns deploys from all channels that mention the pull request, commit or tag identified by key
+// ordered by their start time. The key is expected to be one of the values returned by Deploy.ReferenceKeys(),
+// see also ReferenceKey. Deploys removed from channel history are not returned.
+type ReferenceIndex interface {
+	DeploysOf(key string) []IndexedDeploy
+}
+
+// IndexedDeploy is a deploy found in ReferenceIndex along with the channel it belongs to.
+type IndexedDeploy struct {
+	ChannelID string
+	Deploy
+}
@@ -0,0 +1,171 @@
+package deploy
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/andrewslotin/michael/slack"
+)
+
+// Reference is an entity mentioned in deploy subject that has been recognized by a ReferenceProvider,
+// i.e. a Jira issue or a GitLab merge request. GitHub pull requests, commits, tags and commit ranges are
+// kept in dedicated fields of Deploy, see DeployParser.
+type Reference struct {
+	// Provider is the name of ReferenceProvider that has recognized this reference.
+	Provider string
+	// ID is the provider-specific identifier of referenced entity, i.e. OPS-1234 for a Jira issue.
+	ID  string
+	URL string
+}
+
+// Key returns the key of reference in deploy reference index. Reference IDs are case-insensitive.
+func (ref Reference) Key() string {
+	return ref.Provider + ":" + strings.ToLower(ref.ID)
+}
+
+func (ref Reference) String() string {
+	return ref.ID
+}
+
+// ReferenceDetails are the details of referenced entity fetched by a ReferenceProvider.
+type ReferenceDetails struct {
+	Title       string
+	Description string
+	// Author is the user responsible for referenced entity, i.e. the assignee of an issue or the author
+	// of a merge request.
+	Author string
+	// State is the provider-specific state of referenced entity, i.e. "In Progress" or "merged".
+	State string
+	// Done is true if referenced entity is completed, i.e. an issue is resolved or a merge request is merged.
+	Done bool
+	URL  string
+	// Raw is the provider-specific representation of referenced entity passed back to its Attachment method.
+	Raw interface{}
+}
+
+// ReferenceProvider recognizes references to an external system in deploy subjects, fetches their details and
+// renders them as deploy announcement attachments.
+type ReferenceProvider interface {
+	// Name returns a unique name of provider, which is also used as a prefix of its reference index keys.
+	Name() string
+	// FindReferences returns references to this provider mentioned in s. Returned references are expected
+	// to have their ID normalized, so that different spellings of the same entity have the same index key.
+	FindReferences(s string) []Reference
+	// Resolve fetches the details of referenced entity.
+	Resolve(ref Reference) (ReferenceDetails, error)
+	// Attachment renders the details of reference to be attached to a deploy announcement.
+	Attachment(ref Reference, details ReferenceDetails) slack.Attachment
+}
+
+// DeployParser is implemented by reference providers that keep references they recognize in dedicated fields
+// of Deploy instead of Deploy.References, i.e. the GitHub one.
+type DeployParser interface {
+	// ParseSubject fills the dedicated fields of d with references mentioned in deploy subject.
+	ParseSubject(d *Deploy)
+	// DeployReferences returns references kept in the dedicated fields of d.
+	DeployReferences(d Deploy) []Reference
+}
+
+// ReferenceProviders is a registry of reference providers used to recognize references in deploy subjects
+// and to look up providers of stored references. A registry is not safe to modify concurrently with reference
+// lookups and is meant to be populated on startup.
+type ReferenceProviders struct {
+	providers []ReferenceProvider
+}
+
+// NewReferenceProviders returns a registry of given reference providers.
+func NewReferenceProviders(providers ...ReferenceProvider) *ReferenceProviders {
+	r := &ReferenceProviders{}
+	for _, p := range providers {
+		r.Register(p)
+	}
+
+	return r
+}
+
+// Register adds p to the registry. A provider registered with the same name before is replaced.
+func (r *ReferenceProviders) Register(p ReferenceProvider) {
+	for i, registered := range r.providers {
+		if registered.Name() == p.Name() {
+			r.providers[i] = p
+			return
+		}
+	}
+
+	r.providers = append(r.providers, p)
+}
+
+// Lookup returns the registered reference provider with given name. The second value is false if there is
+// no such provider, i.e. it has been removed from configuration since the deploy was started.
+func (r *ReferenceProviders) Lookup(name string) (ReferenceProvider, bool) {
+	for _, p := range r.providers {
+		if p.Name() == name {
+			return p, true
+		}
+	}
+
+	return nil, false
+}
+
+// FindReferences returns references mentioned in s that were recognized by registered reference providers
+// in the order they are mentioned.
+func (r *ReferenceProviders) FindReferences(s string) []Reference {
+	var refs []Reference
+	for _, word := range strings.Fields(s) {
+		for _, p := range r.providers {
+			refs = append(refs, p.FindReferences(word)...)
+		}
+	}
+
+	return refs
+}
+
+// DeployReferences returns references of d kept in the dedicated fields by registered providers followed
+// by the ones stored in d.References.
+func (r *ReferenceProviders) DeployReferences(d Deploy) []Reference {
+	var refs []Reference
+	for _, p := range r.providers {
+		if parser, ok := p.(DeployParser); ok {
+			refs = append(refs, parser.DeployReferences(d)...)
+		}
+	}
+
+	return append(refs, d.References...)
+}
+
+// New returns a deploy of subject by user with references recognized by registered providers.
+func (r *ReferenceProviders) New(user slack.User, subject string) Deploy {
+	d := Deploy{
+		User:        user,
+		Subject:     subject,
+		Subscribers: FindUserReferences(subject),
+	}
+
+	for _, p := range r.providers {
+		if parser, ok := p.(DeployParser); ok {
+			parser.ParseSubject(&d)
+			continue
+		}
+
+		d.References = append(d.References, p.FindReferences(subject)...)
+	}
+
+	return d
+}
+
+// ReferenceKey returns the index key of the first reference recognized by registered providers in s, see also
+// Deploy.ReferenceKeys. The second value is false if s does not contain any references.
+func (r *ReferenceProviders) ReferenceKey(s string) (string, bool) {
+	keys := r.New(slack.User{}, s).ReferenceKeys()
+	if len(keys) == 0 {
+		return "", false
+	}
+
+	return keys[0], true
+}
+
+// MatchReferences calls f with named submatches of each word in s that matches any of regexes. It's meant to be
+// used by ReferenceProvider implementations to scan deploy subjects the same way GitHub references are found.
+func MatchReferences(s string, regexes []*regexp.Regexp, f func(matches map[string]string)) {
+	findReferences(s, regexes, f)
+}
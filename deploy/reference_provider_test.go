@@ -0,0 +1,123 @@
+package deploy_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+)
+
+type ticketProviderStub struct {
+	name    string
+	baseURL string
+}
+
+var ticketRegexes = []*regexp.Regexp{regexp.MustCompile("^(?i)(?P<key>TICKET-\\d+)[^A-Za-z0-9]?$")}
+
+func (p ticketProviderStub) Name() string {
+	return p.name
+}
+
+func (p ticketProviderStub) FindReferences(s string) []deploy.Reference {
+	var refs []deploy.Reference
+	deploy.MatchReferences(s, ticketRegexes, func(matches map[string]string) {
+		key := strings.ToUpper(matches["key"])
+		refs = append(refs, deploy.Reference{Provider: p.name, ID: key, URL: p.baseURL + "/" + key})
+	})
+
+	return refs
+}
+
+func (ticketProviderStub) Resolve(ref deploy.Reference) (deploy.ReferenceDetails, error) {
+	return deploy.ReferenceDetails{}, nil
+}
+
+func (ticketProviderStub) Attachment(ref deploy.Reference, details deploy.ReferenceDetails) slack.Attachment {
+	return slack.Attachment{}
+}
+
+// githubProviderStub recognizes GitHub references the same way the bot does without fetching them.
+type githubProviderStub struct {
+	*deploy.GitHubReferences
+}
+
+func (githubProviderStub) Name() string {
+	return deploy.GitHubReferenceProviderName
+}
+
+func (githubProviderStub) FindReferences(s string) []deploy.Reference {
+	return nil
+}
+
+func (githubProviderStub) DeployReferences(d deploy.Deploy) []deploy.Reference {
+	var refs []deploy.Reference
+	for _, ref := range d.PullRequests {
+		refs = append(refs, deploy.Reference{Provider: deploy.GitHubReferenceProviderName, ID: ref.String()})
+	}
+
+	return refs
+}
+
+func (githubProviderStub) Resolve(ref deploy.Reference) (deploy.ReferenceDetails, error) {
+	return deploy.ReferenceDetails{}, nil
+}
+
+func (githubProviderStub) Attachment(ref deploy.Reference, details deploy.ReferenceDetails) slack.Attachment {
+	return slack.Attachment{}
+}
+
+func TestReferenceProviders_Register(t *testing.T) {
+	providers := deploy.NewReferenceProviders(
+		githubProviderStub{deploy.NewGitHubReferences()},
+		ticketProviderStub{name: "tickets", baseURL: "https://old.example.com"},
+	)
+	providers.Register(ticketProviderStub{name: "tickets", baseURL: "https://tickets.example.com"})
+
+	p, ok := providers.Lookup("tickets")
+	if assert.True(t, ok) {
+		assert.Equal(t, "tickets", p.Name())
+	}
+
+	_, ok = providers.Lookup("unknown")
+	assert.False(t, ok)
+
+	d := providers.New(slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1 fixes ticket-12, TICKET-13 and TICKET-")
+	assert.Equal(t, []deploy.PullRequestReference{{ID: "1", Repository: "octocat/helloworld"}}, d.PullRequests)
+	assert.Equal(t, []deploy.Reference{
+		{Provider: "tickets", ID: "TICKET-12", URL: "https://tickets.example.com/TICKET-12"},
+		{Provider: "tickets", ID: "TICKET-13", URL: "https://tickets.example.com/TICKET-13"},
+	}, d.References)
+	assert.Equal(t, []string{"octocat/helloworld#1", "tickets:ticket-12", "tickets:ticket-13"}, d.ReferenceKeys())
+
+	assert.Equal(t, []deploy.Reference{
+		{Provider: "github", ID: "octocat/helloworld#1"},
+		{Provider: "tickets", ID: "TICKET-12", URL: "https://tickets.example.com/TICKET-12"},
+		{Provider: "tickets", ID: "TICKET-13", URL: "https://tickets.example.com/TICKET-13"},
+	}, providers.DeployReferences(d))
+
+	key, ok := providers.ReferenceKey("Ticket-12")
+	if assert.True(t, ok) {
+		assert.Equal(t, "tickets:ticket-12", key)
+	}
+
+	// references recognized by another registry are not visible to this one
+	assert.Empty(t, deploy.NewReferenceProviders().New(slack.User{}, "TICKET-12").References)
+	assert.Empty(t, deploy.New(slack.User{}, "TICKET-12").References)
+}
+
+func TestReferenceProviders_FindReferences(t *testing.T) {
+	providers := deploy.NewReferenceProviders(
+		ticketProviderStub{name: "tickets", baseURL: "https://tickets.example.com"},
+		ticketProviderStub{name: "issues", baseURL: "https://issues.example.com"},
+	)
+
+	assert.Equal(t, []deploy.Reference{
+		{Provider: "tickets", ID: "TICKET-2", URL: "https://tickets.example.com/TICKET-2"},
+		{Provider: "issues", ID: "TICKET-2", URL: "https://issues.example.com/TICKET-2"},
+		{Provider: "tickets", ID: "TICKET-1", URL: "https://tickets.example.com/TICKET-1"},
+		{Provider: "issues", ID: "TICKET-1", URL: "https://issues.example.com/TICKET-1"},
+	}, providers.FindReferences("TICKET-2 and TICKET-1"))
+}
@@ -7,10 +7,8 @@ import (
 )
 
 var (
-	pullRequestReferenceRegexes = []*regexp.Regexp{
-		regexp.MustCompile("^(?P<repository>[A-Za-z0-9\\._-]+/[A-Za-z0-9\\._-]+)#(?P<number>\\d+)[^A-Za-z]?$"),    // octocat/helloworld#12
-		regexp.MustCompile("^<?https?://github.com/(?P<repository>\\S+/\\S+)/pull/(?P<number>\\d+)(?:[\\?#>]|$)"), // https://github.com/octocat/helloworld/pull/12
-	}
+	commitSHARegex       = regexp.MustCompile("^[0-9a-f]{7,40}$")
+	shaLikeRegex         = regexp.MustCompile("^[0-9a-f]{6,40}$")
 	userReferenceRegexes = []*regexp.Regexp{
 		// Usernames can be up to 21 characters long. They can contain lowercase letters a to z (without accents),
 		// numbers 0 to 9, hyphens, periods, and underscores.
@@ -21,18 +19,208 @@ var (
 	}
 )
 
+// GitHubReferenceProviderName is the name of reference provider that recognizes GitHub pull requests, commits,
+// tags and commit ranges.
+const GitHubReferenceProviderName = "github"
+
+// defaultGitHubReferences recognizes references to github.com and is used by New and storage migrations.
+var defaultGitHubReferences = NewGitHubReferences()
+
+// GitHubReferences recognizes GitHub pull requests, commits, tags and commit ranges mentioned in deploy subjects
+// either in the short owner/repo form or as links to github.com or a GitHub Enterprise Server installation.
+type GitHubReferences struct {
+	pullRequests, commits, tags, ranges []*regexp.Regexp
+}
+
+// NewGitHubReferences returns GitHubReferences that recognize links to github.com and given GitHub Enterprise
+// Server hosts, i.e. github.example.com.
+func NewGitHubReferences(hosts ...string) *GitHubReferences {
+	refs := &GitHubReferences{
+		pullRequests: []*regexp.Regexp{
+			regexp.MustCompile("^(?P<repository>[A-Za-z0-9\\._-]+/[A-Za-z0-9\\._-]+)#(?P<number>\\d+)[^A-Za-z]?$"), // octocat/helloworld#12
+		},
+		commits: []*regexp.Regexp{
+			regexp.MustCompile("^(?P<repository>[A-Za-z0-9\\._-]+/[A-Za-z0-9\\._-]+)@(?P<sha>[0-9a-f]{7,40})[^A-Za-z0-9]?$"), // octocat/helloworld@7fd1a60
+		},
+		tags: []*regexp.Regexp{
+			regexp.MustCompile("^(?P<repository>[A-Za-z0-9\\._-]+/[A-Za-z0-9\\._-]+)@(?P<tag>[A-Za-z0-9][A-Za-z0-9\\._/+-]*)[,;:!?)]?$"), // octocat/helloworld@v1.2.3
+		},
+		ranges: []*regexp.Regexp{
+			regexp.MustCompile("^(?P<repository>[A-Za-z0-9\\._-]+/[A-Za-z0-9\\._-]+)@(?P<base>[A-Za-z0-9][A-Za-z0-9\\._/+-]*?)\\.\\.\\.?(?P<head>[A-Za-z0-9][A-Za-z0-9\\._/+-]*?)\\.?[,;:!?)]?$"), // octocat/helloworld@v1.2...v1.3
+		},
+	}
+
+	for _, host := range append([]string{"github.com"}, hosts...) {
+		refs.pullRequests = append(refs.pullRequests, pullRequestURLRegex(host)) // https://github.com/octocat/helloworld/pull/12
+		refs.commits = append(refs.commits, commitURLRegex(host))                // https://github.com/octocat/helloworld/commit/7fd1a60b01f91b314f59955a4e4d4e80d8edf11d
+		refs.tags = append(refs.tags, tagURLRegex(host))                         // https://github.com/octocat/helloworld/releases/tag/v1.2.3
+		refs.ranges = append(refs.ranges, rangeURLRegex(host))                   // https://github.com/octocat/helloworld/compare/v1.2...v1.3
+	}
+
+	return refs
+}
+
+// ParseSubject fills d.PullRequests, d.Commits, d.Tags and d.Ranges with references mentioned in deploy subject.
+func (refs *GitHubReferences) ParseSubject(d *Deploy) {
+	d.PullRequests = refs.FindPullRequestReferences(d.Subject)
+	d.Commits = refs.FindCommitReferences(d.Subject)
+	d.Tags = refs.FindTagReferences(d.Subject)
+	d.Ranges = refs.FindRangeReferences(d.Subject)
+}
+
+func pullRequestURLRegex(host string) *regexp.Regexp {
+	return regexp.MustCompile("^<?https?://" + regexp.QuoteMeta(host) + "/(?P<repository>\\S+/\\S+)/pull/(?P<number>\\d+)(?:[\\?#>]|$)")
+}
+
+func commitURLRegex(host string) *regexp.Regexp {
+	return regexp.MustCompile("^<?https?://" + regexp.QuoteMeta(host) + "/(?P<repository>\\S+/\\S+)/commit/(?P<sha>[0-9a-f]{7,40})(?:[\\?#>]|$)")
+}
+
+func tagURLRegex(host string) *regexp.Regexp {
+	return regexp.MustCompile("^<?https?://" + regexp.QuoteMeta(host) + "/(?P<repository>\\S+/\\S+)/releases/tag/(?P<release>[^\\s\\?#>]+)(?:[\\?#>]|$)")
+}
+
+func rangeURLRegex(host string) *regexp.Regexp {
+	return regexp.MustCompile("^<?https?://" + regexp.QuoteMeta(host) + "/(?P<repository>\\S+/\\S+)/compare/(?P<base>[^\\s\\?#>]+?)\\.\\.\\.?(?P<head>[^\\s\\?#>]+)(?:[\\?#>]|$)")
+}
+
 type PullRequestReference struct {
 	ID         string
 	Repository string
 }
 
-func FindPullRequestReferences(s string) []PullRequestReference {
-	var refs []PullRequestReference
-	findReferences(s, pullRequestReferenceRegexes, func(matches map[string]string) {
-		refs = append(refs, PullRequestReference{Repository: matches["repository"], ID: matches["number"]})
+// Key returns the key of pull request in deploy reference index. Repository names are case-insensitive.
+func (ref PullRequestReference) Key() string {
+	return strings.ToLower(ref.Repository) + "#" + ref.ID
+}
+
+func (ref PullRequestReference) String() string {
+	return ref.Repository + "#" + ref.ID
+}
+
+func (refs *GitHubReferences) FindPullRequestReferences(s string) []PullRequestReference {
+	var found []PullRequestReference
+	findReferences(s, refs.pullRequests, func(matches map[string]string) {
+		found = append(found, PullRequestReference{Repository: matches["repository"], ID: matches["number"]})
 	})
 
-	return refs
+	return found
+}
+
+// shortSHALength is the length of abbreviated commit SHA used by GitHub.
+const shortSHALength = 7
+
+// CommitReference is a commit mentioned in deploy subject either as owner/repo@sha or as a link to GitHub.
+type CommitReference struct {
+	SHA        string
+	Repository string
+}
+
+// Key returns the key of commit in deploy reference index. Commits are indexed by their abbreviated SHA,
+// so that a short SHA matches the full one and vice versa.
+func (ref CommitReference) Key() string {
+	return strings.ToLower(ref.Repository) + "@" + ref.ShortSHA()
+}
+
+func (ref CommitReference) String() string {
+	return ref.Repository + "@" + ref.SHA
+}
+
+// ShortSHA returns the abbreviated commit SHA.
+func (ref CommitReference) ShortSHA() string {
+	if len(ref.SHA) > shortSHALength {
+		return ref.SHA[:shortSHALength]
+	}
+
+	return ref.SHA
+}
+
+func (refs *GitHubReferences) FindCommitReferences(s string) []CommitReference {
+	var found []CommitReference
+	findReferences(s, refs.commits, func(matches map[string]string) {
+		found = append(found, CommitReference{Repository: matches["repository"], SHA: matches["sha"]})
+	})
+
+	return found
+}
+
+// TagReference is a tag mentioned in deploy subject either as owner/repo@tag or as a link to GitHub release.
+type TagReference struct {
+	Name       string
+	Repository string
+}
+
+// Key returns the key of tag in deploy reference index. Unlike repository names, tag names are case-sensitive.
+func (ref TagReference) Key() string {
+	return strings.ToLower(ref.Repository) + "@" + ref.Name
+}
+
+func (ref TagReference) String() string {
+	return ref.Repository + "@" + ref.Name
+}
+
+// FindTagReferences returns tags mentioned in s either as links to GitHub releases or as owner/repo@tag. In the latter
+// case only refs that look like version tags are considered to be tags, see isTagName.
+func (refs *GitHubReferences) FindTagReferences(s string) []TagReference {
+	var found []TagReference
+	findReferences(s, refs.tags, func(matches map[string]string) {
+		name := matches["release"]
+		if name == "" {
+			if name = strings.TrimRight(matches["tag"], "."); !isTagName(name) {
+				return
+			}
+		}
+
+		found = append(found, TagReference{Repository: matches["repository"], Name: name})
+	})
+
+	return found
+}
+
+// RangeReference is a range of commits mentioned in deploy subject either as owner/repo@base...head or as a link
+// to GitHub comparison. Base and Head can be commit SHAs, tags or branch names.
+type RangeReference struct {
+	Base       string
+	Head       string
+	Repository string
+}
+
+// Key returns the key of range in deploy reference index. Ranges are indexed by their head, so that deploys of
+// a range can be found by the tag or the commit it ends with. Ranges that end with a branch are indexed as a whole.
+func (ref RangeReference) Key() string {
+	switch {
+	case isCommitSHA(ref.Head):
+		return CommitReference{Repository: ref.Repository, SHA: ref.Head}.Key()
+	case isTagName(ref.Head):
+		return TagReference{Repository: ref.Repository, Name: ref.Head}.Key()
+	default:
+		return strings.ToLower(ref.Repository) + "@" + ref.Base + "..." + ref.Head
+	}
+}
+
+func (ref RangeReference) String() string {
+	return ref.Repository + "@" + ref.Base + "..." + ref.Head
+}
+
+func (refs *GitHubReferences) FindRangeReferences(s string) []RangeReference {
+	var found []RangeReference
+	findReferences(s, refs.ranges, func(matches map[string]string) {
+		found = append(found, RangeReference{Repository: matches["repository"], Base: matches["base"], Head: matches["head"]})
+	})
+
+	return found
+}
+
+// isCommitSHA returns true if s looks like a full or an abbreviated commit SHA. SHAs shorter than shortSHALength
+// are not considered to be commits, since they can't be matched against the index keys.
+func isCommitSHA(s string) bool {
+	return commitSHARegex.MatchString(s)
+}
+
+// isTagName returns true if s looks like a version tag, i.e. v1.2.3 or release-2018.03.01, rather than a branch name
+// or an abbreviated commit SHA.
+func isTagName(s string) bool {
+	return s != "" && strings.ContainsAny(s, "0123456789") && !shaLikeRegex.MatchString(s) && !strings.Contains(s, "..")
 }
 
 type UserReference struct {
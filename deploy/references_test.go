@@ -1,16 +1,19 @@
 package deploy_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/andrewslotin/michael/deploy"
 	"github.com/stretchr/testify/assert"
 )
 
+var githubReferences = deploy.NewGitHubReferences()
+
 func TestFindPullRequestReferences_Short(t *testing.T) {
 	s := "user project 123 user/ /project user/#123 /project#123 /# #/123 use/project user/project#123 user/project#1a"
 
-	refs := deploy.FindPullRequestReferences(s)
+	refs := githubReferences.FindPullRequestReferences(s)
 	if assert.Len(t, refs, 1) {
 		assert.Contains(t, refs, deploy.PullRequestReference{ID: "123", Repository: "user/project"})
 	}
@@ -23,16 +26,34 @@ func TestFindPullRequestReferences_GitHubLink(t *testing.T) {
 		"https://github.com/user/project/pulls " +
 		"https://bitbucket.org/user/project/pull/3"
 
-	refs := deploy.FindPullRequestReferences(s)
+	refs := githubReferences.FindPullRequestReferences(s)
 	if assert.Len(t, refs, 1) {
 		assert.Contains(t, refs, deploy.PullRequestReference{ID: "1", Repository: "user/project"})
 	}
 }
 
+func TestFindPullRequestReferences_GitHubEnterpriseLink(t *testing.T) {
+	s := "" +
+		"https://github.example.com/user/project/pull/1 " +
+		"<https://github.example.com/user/project/pull/2> " +
+		"https://github.example.com/user/project/issues/3 " +
+		"https://githubXexample.com/user/project/pull/4 " +
+		"https://github.com/user/project/pull/5"
+
+	refs := deploy.NewGitHubReferences("github.example.com").FindPullRequestReferences(s)
+	if assert.Len(t, refs, 3) {
+		assert.Contains(t, refs, deploy.PullRequestReference{ID: "1", Repository: "user/project"})
+		assert.Contains(t, refs, deploy.PullRequestReference{ID: "2", Repository: "user/project"})
+		assert.Contains(t, refs, deploy.PullRequestReference{ID: "5", Repository: "user/project"})
+	}
+
+	assert.Empty(t, githubReferences.FindPullRequestReferences(s[:strings.Index(s, "https://github.com")]))
+}
+
 func TestFindPullRequestReferences_Escaped(t *testing.T) {
 	s := "<https://github.com/user/project/pull/1?w=1#comment-123> <user/project#123>"
 
-	refs := deploy.FindPullRequestReferences(s)
+	refs := githubReferences.FindPullRequestReferences(s)
 	if assert.Len(t, refs, 1) {
 		assert.Contains(t, refs, deploy.PullRequestReference{ID: "1", Repository: "user/project"})
 	}
@@ -44,7 +65,7 @@ func TestFindPullRequestReferences_Mixed_Multiple(t *testing.T) {
 		"https://github.com/userB/projectB/pull/2 " +
 		"and userC/projectC#3"
 
-	refs := deploy.FindPullRequestReferences(s)
+	refs := githubReferences.FindPullRequestReferences(s)
 	if assert.Len(t, refs, 3) {
 		// userA/projectA#1
 		assert.Contains(t, refs, deploy.PullRequestReference{ID: "1", Repository: "userA/projectA"})
@@ -57,6 +78,88 @@ func TestFindPullRequestReferences_Mixed_Multiple(t *testing.T) {
 	}
 }
 
+func TestFindCommitReferences(t *testing.T) {
+	s := "" +
+		"user/project@7fd1a60, " +
+		"https://github.com/user/project/commit/553c2077f0edc3d5dc5d17262f6aa498e69d6f8e " +
+		"<https://github.com/user/project/commit/762941318ee16e59dabbacb1b4049eec22f0d303> " +
+		"user/project@abc123 user/project@7fd1a user/project@xyz1234 @7fd1a60 " +
+		"https://github.com/user/project/commits/master"
+
+	refs := githubReferences.FindCommitReferences(s)
+	assert.Equal(t, []deploy.CommitReference{
+		{SHA: "7fd1a60", Repository: "user/project"},
+		{SHA: "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", Repository: "user/project"},
+		{SHA: "762941318ee16e59dabbacb1b4049eec22f0d303", Repository: "user/project"},
+	}, refs)
+}
+
+func TestFindTagReferences(t *testing.T) {
+	s := "" +
+		"user/project@v1.2.3, " +
+		"user/project@release-2018.03.01. " +
+		"https://github.com/user/project/releases/tag/v2.0-rc1 " +
+		"https://github.com/user/project/releases/tag/stable " +
+		"user/project@7fd1a60 user/project@v1.2...v1.3 @v1.0 user/project " +
+		"user/project@main user/project@feature/login user/project@abc123"
+
+	refs := githubReferences.FindTagReferences(s)
+	assert.Equal(t, []deploy.TagReference{
+		{Name: "v1.2.3", Repository: "user/project"},
+		{Name: "release-2018.03.01", Repository: "user/project"},
+		{Name: "v2.0-rc1", Repository: "user/project"},
+		{Name: "stable", Repository: "user/project"},
+	}, refs)
+}
+
+func TestFindRangeReferences(t *testing.T) {
+	s := "" +
+		"user/project@v1.2...v1.3, " +
+		"user/project@7fd1a60..553c207 " +
+		"https://github.com/user/project/compare/v1.2...master " +
+		"<https://github.com/user/project/compare/7fd1a60...553c207?diff=split> " +
+		"https://github.com/user/project/compare/v1.2 user/project@v1.2"
+
+	refs := githubReferences.FindRangeReferences(s)
+	assert.Equal(t, []deploy.RangeReference{
+		{Base: "v1.2", Head: "v1.3", Repository: "user/project"},
+		{Base: "7fd1a60", Head: "553c207", Repository: "user/project"},
+		{Base: "v1.2", Head: "master", Repository: "user/project"},
+		{Base: "7fd1a60", Head: "553c207", Repository: "user/project"},
+	}, refs)
+}
+
+func TestReferenceProviders_ReferenceKey(t *testing.T) {
+	providers := deploy.NewReferenceProviders(githubProviderStub{deploy.NewGitHubReferences()})
+
+	for s, expected := range map[string]string{
+		"Octocat/Helloworld#12":                         "octocat/helloworld#12",
+		"https://github.com/octocat/helloworld/pull/12": "octocat/helloworld#12",
+		"octocat/helloworld@7fd1a60":                    "octocat/helloworld@7fd1a60",
+		"https://github.com/octocat/helloworld/commit/7fd1a60b01f91b314f59955a4e4d4e80d8edf11d": "octocat/helloworld@7fd1a60",
+		"octocat/helloworld@7fd1a60b":         "octocat/helloworld@7fd1a60",
+		"octocat/helloworld@v1.2":             "octocat/helloworld@v1.2",
+		"octocat/helloworld@v1.2...7fd1a60b0": "octocat/helloworld@7fd1a60",
+		"octocat/helloworld@v1.2...main":      "octocat/helloworld@v1.2...main",
+	} {
+		key, ok := providers.ReferenceKey(s)
+		if assert.True(t, ok, s) {
+			assert.Equal(t, expected, key, s)
+		}
+	}
+
+	for _, s := range []string{
+		"octocat/helloworld",
+		// abbreviated SHAs are indexed by their first 7 characters
+		"octocat/helloworld@7fd1a6",
+		// branches are not tags
+		"octocat/helloworld@main",
+	} {
+		_, ok := providers.ReferenceKey(s)
+		assert.False(t, ok, s)
+	}
+}
+
 func TestFindUserReferences_Short(t *testing.T) {
 	s := "" +
 		"hello @person_1, my email is writeme@gmail.com, see you @ the bar. " +
@@ -0,0 +1,240 @@
+package deploy
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCompactionThreshold is the number of pruned deploys after which HistoryPruner compacts the store.
+const DefaultCompactionThreshold = 1000
+
+// Pruner is an interface implemented by stores that support removing old deploys from channel history.
+//
+// Channels returns the list of keys that have deploy history.
+//
+// Prune removes deploys in key history that were started before given time (zero time means no age limit)
+// as well as the oldest ones that exceed keep number of deploys (non-positive keep means no count limit).
+// The latest deploy in history is always kept. Prune returns the number of removed deploys.
+type Pruner interface {
+	Channels() []string
+	Prune(key string, before time.Time, keep int) int
+}
+
+// Compacter is an interface implemented by stores that need to reclaim the space taken by removed deploys.
+type Compacter interface {
+	Compact() error
+}
+
+// RetentionPolicy limits the age and the number of deploys kept in channel history. Zero values mean no limit.
+type RetentionPolicy struct {
+	MaxAge   time.Duration
+	MaxCount int
+}
+
+// ParseRetentionPolicy parses a retention policy in max-age=<duration>,max-count=<number> format. Both parameters
+// are optional.
+func ParseRetentionPolicy(s string) (policy RetentionPolicy, err error) {
+	for _, param := range strings.Split(s, ",") {
+		param = strings.TrimSpace(param)
+		if param == "" {
+			continue
+		}
+
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return policy, fmt.Errorf("malformed retention policy parameter %q", param)
+		}
+
+		switch kv[0] {
+		case "max-age":
+			if policy.MaxAge, err = time.ParseDuration(kv[1]); err != nil || policy.MaxAge < 0 {
+				return policy, fmt.Errorf("malformed max-age %q", kv[1])
+			}
+		case "max-count":
+			if policy.MaxCount, err = strconv.Atoi(kv[1]); err != nil || policy.MaxCount < 0 {
+				return policy, fmt.Errorf("malformed max-count %q", kv[1])
+			}
+		default:
+			return policy, fmt.Errorf("unknown retention policy parameter %q", kv[0])
+		}
+	}
+
+	return policy, nil
+}
+
+// Unlimited returns true if the policy does not limit deploy history.
+func (p RetentionPolicy) Unlimited() bool {
+	return p.MaxAge <= 0 && p.MaxCount <= 0
+}
+
+func (p RetentionPolicy) String() string {
+	if p.Unlimited() {
+		return "unlimited"
+	}
+
+	var params []string
+	if p.MaxAge > 0 {
+		params = append(params, "max-age="+p.MaxAge.String())
+	}
+
+	if p.MaxCount > 0 {
+		params = append(params, "max-count="+strconv.Itoa(p.MaxCount))
+	}
+
+	return strings.Join(params, ",")
+}
+
+// RetentionPolicies holds the default retention policy and its per-channel overrides.
+type RetentionPolicies struct {
+	Default  RetentionPolicy
+	Channels map[string]RetentionPolicy
+}
+
+// For returns the retention policy for given channel.
+func (p RetentionPolicies) For(channelID string) RetentionPolicy {
+	if policy, ok := p.Channels[channelID]; ok {
+		return policy
+	}
+
+	return p.Default
+}
+
+// HistoryPruner removes deploys from store according to retention policies and compacts the store once
+// the number of removed deploys exceeds the compaction threshold. Compaction runs in background, so that
+// callers do not have to wait until the whole database is rewritten.
+type HistoryPruner struct {
+	store    Pruner
+	policies RetentionPolicies
+
+	// CompactionThreshold is the number of removed deploys after which the store gets compacted if
+	// it implements Compacter.
+	CompactionThreshold int
+
+	mu         sync.Mutex
+	pruned     int
+	compacting bool
+	wg         sync.WaitGroup
+}
+
+// NewHistoryPruner returns an instance of *HistoryPruner that enforces policies in store.
+func NewHistoryPruner(store Pruner, policies RetentionPolicies) *HistoryPruner {
+	return &HistoryPruner{
+		store:               store,
+		policies:            policies,
+		CompactionThreshold: DefaultCompactionThreshold,
+	}
+}
+
+// Run enforces retention policies every interval until stop is closed.
+func (p *HistoryPruner) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if n := p.Enforce(); n > 0 {
+				log.Printf("removed %d deploys according to history retention policies", n)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Enforce removes deploys that are not retained by policies from all channels and returns their number.
+func (p *HistoryPruner) Enforce() int {
+	now := time.Now()
+
+	var n int
+	for _, channelID := range p.store.Channels() {
+		policy := p.policies.For(channelID)
+		if policy.Unlimited() {
+			continue
+		}
+
+		var before time.Time
+		if policy.MaxAge > 0 {
+			before = now.Add(-policy.MaxAge)
+		}
+
+		n += p.store.Prune(channelID, before, policy.MaxCount)
+	}
+
+	p.removed(n)
+
+	return n
+}
+
+// Purge removes deploys started before given time from channel history and returns their number.
+func (p *HistoryPruner) Purge(channelID string, before time.Time) int {
+	n := p.store.Prune(channelID, before, 0)
+	p.removed(n)
+
+	return n
+}
+
+// Wait blocks until the running compaction, if any, is finished. It should be called before closing the store.
+func (p *HistoryPruner) Wait() {
+	p.wg.Wait()
+}
+
+// removed adds n to the number of pruned deploys and starts compaction in background once it reaches
+// the threshold. Only one compaction runs at a time, deploys removed meanwhile are counted towards the next one.
+func (p *HistoryPruner) removed(n int) {
+	compacter, ok := p.store.(Compacter)
+	if !ok {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pruned += n
+	if p.pruned < p.CompactionThreshold || p.compacting {
+		return
+	}
+
+	p.compacting = true
+	p.wg.Add(1)
+
+	go p.compact(compacter, p.pruned)
+}
+
+func (p *HistoryPruner) compact(compacter Compacter, pruned int) {
+	defer p.wg.Done()
+
+	err := compacter.Compact()
+	if err != nil {
+		log.Printf("failed to compact deploy history after removing %d deploys: %s", pruned, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.compacting = false
+	if err == nil {
+		p.pruned -= pruned
+	}
+}
+
+// prunedCount returns the number of deploys to remove from the beginning of a history of n deploys ordered
+// by their start time.
+func prunedCount(n int, startedAt func(i int) time.Time, before time.Time, keep int) int {
+	var pruned int
+	if !before.IsZero() {
+		for pruned < n-1 && startedAt(pruned).Before(before) {
+			pruned++
+		}
+	}
+
+	if keep > 0 && n-pruned > keep {
+		pruned = n - keep
+	}
+
+	return pruned
+}
@@ -0,0 +1,132 @@
+package deploy_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseRetentionPolicy(t *testing.T) {
+	examples := map[string]deploy.RetentionPolicy{
+		"":                           {},
+		"max-age=720h":               {MaxAge: 720 * time.Hour},
+		"max-count=100":              {MaxCount: 100},
+		"max-age=24h, max-count=10":  {MaxAge: 24 * time.Hour, MaxCount: 10},
+		"max-count=0,max-age=0s":     {},
+		"max-count=5,max-age=1h30m,": {MaxAge: 90 * time.Minute, MaxCount: 5},
+	}
+
+	for s, expected := range examples {
+		policy, err := deploy.ParseRetentionPolicy(s)
+		if assert.NoError(t, err, s) {
+			assert.Equal(t, expected, policy, s)
+		}
+	}
+}
+
+func TestParseRetentionPolicy_Malformed(t *testing.T) {
+	for _, s := range [...]string{"max-age", "max-age=forever", "max-count=-1", "max-count=ten", "min-count=1"} {
+		_, err := deploy.ParseRetentionPolicy(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestRetentionPolicies_For(t *testing.T) {
+	policies := deploy.RetentionPolicies{
+		Default: deploy.RetentionPolicy{MaxAge: time.Hour},
+		Channels: map[string]deploy.RetentionPolicy{
+			"key1": {MaxCount: 10},
+		},
+	}
+
+	assert.Equal(t, deploy.RetentionPolicy{MaxCount: 10}, policies.For("key1"))
+	assert.Equal(t, deploy.RetentionPolicy{MaxAge: time.Hour}, policies.For("key2"))
+}
+
+type prunerMock struct {
+	mock.Mock
+}
+
+func (m *prunerMock) Channels() []string {
+	return m.Called().Get(0).([]string)
+}
+
+func (m *prunerMock) Prune(key string, before time.Time, keep int) int {
+	return m.Called(key, before, keep).Int(0)
+}
+
+func (m *prunerMock) Compact() error {
+	return m.Called().Error(0)
+}
+
+func TestHistoryPruner_Enforce(t *testing.T) {
+	store := new(prunerMock)
+	store.On("Channels").Return([]string{"key1", "key2", "key3"})
+	store.On("Prune", "key1", mock.MatchedBy(func(before time.Time) bool {
+		return before.Before(time.Now().Add(-time.Hour+time.Second)) && before.After(time.Now().Add(-time.Hour-time.Second))
+	}), 0).Return(2)
+	store.On("Prune", "key2", time.Time{}, 5).Return(1)
+
+	pruner := deploy.NewHistoryPruner(store, deploy.RetentionPolicies{
+		Default: deploy.RetentionPolicy{MaxAge: time.Hour},
+		Channels: map[string]deploy.RetentionPolicy{
+			"key2": {MaxCount: 5},
+			"key3": {},
+		},
+	})
+	pruner.CompactionThreshold = 5
+
+	assert.Equal(t, 3, pruner.Enforce())
+	store.AssertExpectations(t)
+	store.AssertNotCalled(t, "Compact")
+
+	store.On("Compact").Return(nil).Once()
+	assert.Equal(t, 3, pruner.Enforce())
+	pruner.Wait()
+	store.AssertExpectations(t)
+}
+
+func TestHistoryPruner_Purge_CompactsInBackground(t *testing.T) {
+	before := time.Now().Add(-24 * time.Hour)
+
+	compacting, done := make(chan struct{}), make(chan struct{})
+
+	store := new(prunerMock)
+	store.On("Prune", "key1", before, 0).Return(3)
+	store.On("Compact").Return(nil).Run(func(mock.Arguments) {
+		close(compacting)
+		<-done
+	}).Once()
+
+	pruner := deploy.NewHistoryPruner(store, deploy.RetentionPolicies{})
+	pruner.CompactionThreshold = 5
+
+	assert.Equal(t, 3, pruner.Purge("key1", before))
+	assert.Equal(t, 3, pruner.Purge("key1", before))
+
+	// purges do not wait for the running compaction and do not start another one
+	<-compacting
+	assert.Equal(t, 3, pruner.Purge("key1", before))
+	assert.Equal(t, 3, pruner.Purge("key1", before))
+
+	close(done)
+	pruner.Wait()
+
+	store.AssertExpectations(t)
+	store.AssertNumberOfCalls(t, "Compact", 1)
+}
+
+func TestHistoryPruner_Purge(t *testing.T) {
+	before := time.Now().Add(-24 * time.Hour)
+
+	store := new(prunerMock)
+	store.On("Prune", "key1", before, 0).Return(3)
+
+	pruner := deploy.NewHistoryPruner(store, deploy.RetentionPolicies{})
+	assert.Equal(t, 3, pruner.Purge("key1", before))
+
+	store.AssertExpectations(t)
+}
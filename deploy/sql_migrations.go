@@ -0,0 +1,246 @@
+package deploy
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+type sqlMigration struct {
+	Schema string
+	// Migrate is an optional data upgrade applied after the schema change within the same transaction.
+	Migrate func(tx *sql.Tx) error
+}
+
+// sqlMigrations is the ordered list of SQL schema upgrades. A database of version N has all migrations up to
+// sqlMigrations[N-1] applied. The version is kept in SQLite user_version pragma. New migrations should only ever
+// be appended to this list.
+var sqlMigrations = []sqlMigration{
+	{
+		Schema: `CREATE TABLE deploys (
+			id           INTEGER PRIMARY KEY AUTOINCREMENT,
+			channel_id   TEXT NOT NULL,
+			user_id      TEXT NOT NULL,
+			user_name    TEXT NOT NULL,
+			subject      TEXT NOT NULL,
+			started_at   TEXT NOT NULL,
+			finished_at  TEXT,
+			aborted      BOOLEAN NOT NULL DEFAULT FALSE,
+			abort_reason TEXT NOT NULL DEFAULT '',
+			UNIQUE (channel_id, started_at)
+		);
+		CREATE INDEX deploys_user_id ON deploys (user_id, started_at);
+		CREATE INDEX deploys_started_at ON deploys (started_at);
+
+		CREATE TABLE deploy_pull_requests (
+			deploy_id  INTEGER NOT NULL REFERENCES deploys (id) ON DELETE CASCADE,
+			position   INTEGER NOT NULL,
+			repository TEXT NOT NULL,
+			number     TEXT NOT NULL,
+			PRIMARY KEY (deploy_id, position)
+		);
+		CREATE INDEX deploy_pull_requests_repository ON deploy_pull_requests (repository, number);
+
+		CREATE TABLE deploy_subscribers (
+			deploy_id INTEGER NOT NULL REFERENCES deploys (id) ON DELETE CASCADE,
+			position  INTEGER NOT NULL,
+			user_id   TEXT NOT NULL,
+			user_name TEXT NOT NULL,
+			PRIMARY KEY (deploy_id, position)
+		);`,
+	},
+	{
+		Schema: `CREATE TABLE records (
+			collection TEXT NOT NULL,
+			key        TEXT NOT NULL,
+			value      BLOB NOT NULL,
+			expires_at TEXT,
+			PRIMARY KEY (collection, key)
+		);
+		CREATE INDEX records_expires_at ON records (expires_at) WHERE expires_at IS NOT NULL;`,
+	},
+	{
+		Schema: `ALTER TABLE deploys ADD COLUMN finished_by_id TEXT NOT NULL DEFAULT '';
+		ALTER TABLE deploys ADD COLUMN finished_by_name TEXT NOT NULL DEFAULT '';
+		ALTER TABLE deploys ADD COLUMN aborted_by_id TEXT NOT NULL DEFAULT '';
+		ALTER TABLE deploys ADD COLUMN aborted_by_name TEXT NOT NULL DEFAULT '';`,
+	},
+	{
+		Schema: `ALTER TABLE deploys ADD COLUMN approved_by_id TEXT NOT NULL DEFAULT '';
+		ALTER TABLE deploys ADD COLUMN approved_by_name TEXT NOT NULL DEFAULT '';
+		ALTER TABLE deploys ADD COLUMN approved_at TEXT;`,
+	},
+	{
+		Schema: `CREATE TABLE deploy_commits (
+			deploy_id  INTEGER NOT NULL REFERENCES deploys (id) ON DELETE CASCADE,
+			position   INTEGER NOT NULL,
+			repository TEXT NOT NULL,
+			sha        TEXT NOT NULL,
+			PRIMARY KEY (deploy_id, position)
+		);
+
+		CREATE TABLE deploy_references (
+			key       TEXT NOT NULL,
+			deploy_id INTEGER NOT NULL REFERENCES deploys (id) ON DELETE CASCADE,
+			PRIMARY KEY (key, deploy_id)
+		);
+		CREATE INDEX deploy_references_deploy_id ON deploy_references (deploy_id);
+
+		INSERT OR IGNORE INTO deploy_references (key, deploy_id)
+			SELECT lower(repository) || '#' || number, deploy_id FROM deploy_pull_requests;`,
+		Migrate: migrateSQLCommitReferences,
+	},
+	{
+		Schema: `CREATE TABLE deploy_tags (
+			deploy_id  INTEGER NOT NULL REFERENCES deploys (id) ON DELETE CASCADE,
+			position   INTEGER NOT NULL,
+			repository TEXT NOT NULL,
+			name       TEXT NOT NULL,
+			PRIMARY KEY (deploy_id, position)
+		);
+
+		CREATE TABLE deploy_ranges (
+			deploy_id  INTEGER NOT NULL REFERENCES deploys (id) ON DELETE CASCADE,
+			position   INTEGER NOT NULL,
+			repository TEXT NOT NULL,
+			base       TEXT NOT NULL,
+			head       TEXT NOT NULL,
+			PRIMARY KEY (deploy_id, position)
+		);`,
+		Migrate: migrateSQLTagAndRangeReferences,
+	},
+	{
+		Schema: `CREATE TABLE deploy_provider_references (
+			deploy_id INTEGER NOT NULL REFERENCES deploys (id) ON DELETE CASCADE,
+			position  INTEGER NOT NULL,
+			provider  TEXT NOT NULL,
+			ref_id    TEXT NOT NULL,
+			url       TEXT NOT NULL,
+			PRIMARY KEY (deploy_id, position)
+		);`,
+	},
+}
+
+// SQLSchemaVersion is the SQL schema version written by this build.
+var SQLSchemaVersion = len(sqlMigrations)
+
+func migrateSQLDB(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start migration: %s", err)
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %s", err)
+	}
+
+	if version > SQLSchemaVersion {
+		return fmt.Errorf("%w (found %d, expected %d or less)", ErrUnsupportedSchemaVersion, version, SQLSchemaVersion)
+	}
+
+	if version == SQLSchemaVersion {
+		return nil
+	}
+
+	for ; version < SQLSchemaVersion; version++ {
+		m := sqlMigrations[version]
+		if _, err := tx.Exec(m.Schema); err != nil {
+			return fmt.Errorf("failed to migrate to v%d: %s", version+1, err)
+		}
+
+		if m.Migrate == nil {
+			continue
+		}
+
+		if err := m.Migrate(tx); err != nil {
+			return fmt.Errorf("failed to migrate data to v%d: %s", version+1, err)
+		}
+	}
+
+	// PRAGMA does not support placeholders
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		return fmt.Errorf("failed to write schema version: %s", err)
+	}
+
+	return tx.Commit()
+}
+
+// migrateSQLCommitReferences extracts commit references from subjects of existing deploys and adds them to
+// the reference index.
+func migrateSQLCommitReferences(tx *sql.Tx) error {
+	return forEachSQLDeploySubject(tx, func(id int64, subject string) error {
+		for i, ref := range defaultGitHubReferences.FindCommitReferences(subject) {
+			if _, err := tx.Exec("INSERT INTO deploy_commits (deploy_id, position, repository, sha) VALUES (?, ?, ?, ?)", id, i, ref.Repository, ref.SHA); err != nil {
+				return err
+			}
+
+			if _, err := tx.Exec("INSERT OR IGNORE INTO deploy_references (key, deploy_id) VALUES (?, ?)", ref.Key(), id); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// migrateSQLTagAndRangeReferences extracts tag and commit range references from subjects of existing deploys
+// and adds them to the reference index.
+func migrateSQLTagAndRangeReferences(tx *sql.Tx) error {
+	return forEachSQLDeploySubject(tx, func(id int64, subject string) error {
+		for i, ref := range defaultGitHubReferences.FindTagReferences(subject) {
+			if _, err := tx.Exec("INSERT INTO deploy_tags (deploy_id, position, repository, name) VALUES (?, ?, ?, ?)", id, i, ref.Repository, ref.Name); err != nil {
+				return err
+			}
+
+			if _, err := tx.Exec("INSERT OR IGNORE INTO deploy_references (key, deploy_id) VALUES (?, ?)", ref.Key(), id); err != nil {
+				return err
+			}
+		}
+
+		for i, ref := range defaultGitHubReferences.FindRangeReferences(subject) {
+			if _, err := tx.Exec("INSERT INTO deploy_ranges (deploy_id, position, repository, base, head) VALUES (?, ?, ?, ?, ?)", id, i, ref.Repository, ref.Base, ref.Head); err != nil {
+				return err
+			}
+
+			if _, err := tx.Exec("INSERT OR IGNORE INTO deploy_references (key, deploy_id) VALUES (?, ?)", ref.Key(), id); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// forEachSQLDeploySubject calls fn with the ID and the subject of each stored deploy. All subjects are read before
+// fn is called, so that fn is free to write to the database.
+func forEachSQLDeploySubject(tx *sql.Tx, fn func(id int64, subject string) error) error {
+	var (
+		ids      []int64
+		subjects []string
+	)
+	err := scanRows(tx, "SELECT id, subject FROM deploys ORDER BY id", nil, func(rows *sql.Rows) error {
+		var (
+			id      int64
+			subject string
+		)
+		if err := rows.Scan(&id, &subject); err != nil {
+			return err
+		}
+
+		ids, subjects = append(ids, id), append(subjects, subject)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		if err := fn(id, subjects[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
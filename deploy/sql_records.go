@@ -0,0 +1,140 @@
+package deploy
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PutRecord stores a record replacing an existing one with the same key.
+func (s *SQLStore) PutRecord(collection string, rec Record) error {
+	_, err := s.db.Exec("INSERT OR REPLACE INTO records (collection, key, value, expires_at) VALUES (?, ?, ?, ?)",
+		collection, rec.Key, recordValue(rec), recordExpiresAt(rec))
+
+	return err
+}
+
+// AddRecord stores a record only if there is no unexpired record with the same key.
+func (s *SQLStore) AddRecord(collection string, rec Record) (bool, error) {
+	res, err := s.db.Exec(`INSERT INTO records (collection, key, value, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (collection, key) DO UPDATE SET
+			value = excluded.value,
+			expires_at = excluded.expires_at
+		WHERE records.expires_at IS NOT NULL AND records.expires_at <= ?`,
+		collection, rec.Key, recordValue(rec), recordExpiresAt(rec), sqlNow())
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+
+	return n > 0, err
+}
+
+// GetRecord returns a record by its key.
+func (s *SQLStore) GetRecord(collection, key string) (Record, bool, error) {
+	var records []Record
+
+	err := scanRows(s.db, "SELECT key, value, expires_at FROM records WHERE collection = ? AND key = ? AND "+unexpiredRecordCond, []interface{}{collection, key, sqlNow()}, func(rows *sql.Rows) error {
+		rec, err := scanRecord(rows)
+		if err != nil {
+			return err
+		}
+
+		records = append(records, rec)
+
+		return nil
+	})
+	if err != nil || len(records) == 0 {
+		return Record{}, false, err
+	}
+
+	return records[0], true, nil
+}
+
+// DeleteRecord removes a record and returns its last value.
+func (s *SQLStore) DeleteRecord(collection, key string) (rec Record, ok bool, err error) {
+	err = scanRows(s.db, "DELETE FROM records WHERE collection = ? AND key = ? RETURNING key, value, expires_at", []interface{}{collection, key}, func(rows *sql.Rows) error {
+		var err error
+		rec, err = scanRecord(rows)
+		ok = err == nil && !rec.Expired(time.Now())
+
+		return err
+	})
+	if err != nil || !ok {
+		return Record{}, false, err
+	}
+
+	return rec, true, nil
+}
+
+// Records returns all unexpired records in collection ordered by their keys.
+func (s *SQLStore) Records(collection string) ([]Record, error) {
+	var records []Record
+
+	err := scanRows(s.db, "SELECT key, value, expires_at FROM records WHERE collection = ? AND "+unexpiredRecordCond+" ORDER BY key", []interface{}{collection, sqlNow()}, func(rows *sql.Rows) error {
+		rec, err := scanRecord(rows)
+		if err != nil {
+			return err
+		}
+
+		records = append(records, rec)
+
+		return nil
+	})
+
+	return records, err
+}
+
+// RemoveExpiredRecords removes expired records from collection.
+func (s *SQLStore) RemoveExpiredRecords(collection string) (int, error) {
+	res, err := s.db.Exec("DELETE FROM records WHERE collection = ? AND expires_at <= ?", collection, sqlNow())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+
+	return int(n), err
+}
+
+const unexpiredRecordCond = "(expires_at IS NULL OR expires_at > ?)"
+
+func scanRecord(rows *sql.Rows) (rec Record, err error) {
+	var expiresAt sql.NullString
+	if err := rows.Scan(&rec.Key, &rec.Value, &expiresAt); err != nil {
+		return rec, err
+	}
+
+	if len(rec.Value) == 0 {
+		rec.Value = nil
+	}
+
+	if expiresAt.Valid {
+		if rec.ExpiresAt, err = time.Parse(deployKeyTimeFormat, expiresAt.String); err != nil {
+			return rec, fmt.Errorf("malformed expires_at time for record %s: %s", rec.Key, err)
+		}
+	}
+
+	return rec, nil
+}
+
+func recordValue(rec Record) []byte {
+	if rec.Value == nil {
+		return []byte{}
+	}
+
+	return rec.Value
+}
+
+func recordExpiresAt(rec Record) sql.NullString {
+	if rec.ExpiresAt.IsZero() {
+		return sql.NullString{}
+	}
+
+	return sql.NullString{String: deployKeyTimestamp(rec.ExpiresAt), Valid: true}
+}
+
+func sqlNow() string {
+	return deployKeyTimestamp(time.Now())
+}
@@ -0,0 +1,490 @@
+package deploy
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	_ "modernc.org/sqlite" // registers sqlite database/sql driver
+)
+
+const deployColumns = "id, channel_id, user_id, user_name, subject, started_at, finished_at, aborted, abort_reason, finished_by_id, finished_by_name, aborted_by_id, aborted_by_name, approved_by_id, approved_by_name, approved_at"
+
+// SQLStore keeps deploy history in an SQLite database. Unlike BoltDB the database file is not locked exclusively
+// and can be queried with any SQLite client while deploy bot is running.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore opens or creates an SQLite database in path and upgrades its schema to SQLSchemaVersion.
+func NewSQLStore(path string) (*SQLStore, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db %s: %s", path, err)
+	}
+
+	// SQLite allows only one writer at a time, so there is no point in having more connections than that
+	db.SetMaxOpenConns(1)
+
+	if err := migrateSQLDB(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate db %s: %w", path, err)
+	}
+
+	return &SQLStore{db: db}, nil
+}
+
+// Close closes the database.
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLStore) Get(key string) (Deploy, bool) {
+	deploys, err := s.selectDeploys("channel_id = ? ORDER BY started_at DESC LIMIT 1", key)
+	if err != nil {
+		log.Printf("failed to read latest deploy in channel %s: %s", key, err)
+		return Deploy{}, false
+	}
+
+	if len(deploys) == 0 {
+		return Deploy{}, false
+	}
+
+	return deploys[0], true
+}
+
+func (s *SQLStore) Set(key string, d Deploy) {
+	err := s.withTx(func(tx *sql.Tx) error {
+		var finishedAt sql.NullString
+		if d.Finished() {
+			finishedAt = sql.NullString{String: deployKeyTimestamp(d.FinishedAt), Valid: true}
+		}
+
+		var approvedAt sql.NullString
+		if !d.ApprovedAt.IsZero() {
+			approvedAt = sql.NullString{String: deployKeyTimestamp(d.ApprovedAt), Valid: true}
+		}
+
+		var id int64
+		err := tx.QueryRow(`INSERT INTO deploys (channel_id, user_id, user_name, subject, started_at, finished_at, aborted, abort_reason, finished_by_id, finished_by_name, aborted_by_id, aborted_by_name, approved_by_id, approved_by_name, approved_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (channel_id, started_at) DO UPDATE SET
+				user_id = excluded.user_id,
+				user_name = excluded.user_name,
+				subject = excluded.subject,
+				finished_at = excluded.finished_at,
+				aborted = excluded.aborted,
+				abort_reason = excluded.abort_reason,
+				finished_by_id = excluded.finished_by_id,
+				finished_by_name = excluded.finished_by_name,
+				aborted_by_id = excluded.aborted_by_id,
+				aborted_by_name = excluded.aborted_by_name,
+				approved_by_id = excluded.approved_by_id,
+				approved_by_name = excluded.approved_by_name,
+				approved_at = excluded.approved_at
+			RETURNING id`,
+			key, d.User.ID, d.User.Name, d.Subject, deployKeyTimestamp(d.StartedAt), finishedAt, d.Aborted, d.AbortReason,
+			d.FinishedBy.ID, d.FinishedBy.Name, d.AbortedBy.ID, d.AbortedBy.Name, d.ApprovedBy.ID, d.ApprovedBy.Name, approvedAt,
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM deploy_pull_requests WHERE deploy_id = ?", id); err != nil {
+			return err
+		}
+
+		for i, ref := range d.PullRequests {
+			if _, err := tx.Exec("INSERT INTO deploy_pull_requests (deploy_id, position, repository, number) VALUES (?, ?, ?, ?)", id, i, ref.Repository, ref.ID); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec("DELETE FROM deploy_commits WHERE deploy_id = ?", id); err != nil {
+			return err
+		}
+
+		for i, ref := range d.Commits {
+			if _, err := tx.Exec("INSERT INTO deploy_commits (deploy_id, position, repository, sha) VALUES (?, ?, ?, ?)", id, i, ref.Repository, ref.SHA); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec("DELETE FROM deploy_tags WHERE deploy_id = ?", id); err != nil {
+			return err
+		}
+
+		for i, ref := range d.Tags {
+			if _, err := tx.Exec("INSERT INTO deploy_tags (deploy_id, position, repository, name) VALUES (?, ?, ?, ?)", id, i, ref.Repository, ref.Name); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec("DELETE FROM deploy_ranges WHERE deploy_id = ?", id); err != nil {
+			return err
+		}
+
+		for i, ref := range d.Ranges {
+			if _, err := tx.Exec("INSERT INTO deploy_ranges (deploy_id, position, repository, base, head) VALUES (?, ?, ?, ?, ?)", id, i, ref.Repository, ref.Base, ref.Head); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec("DELETE FROM deploy_provider_references WHERE deploy_id = ?", id); err != nil {
+			return err
+		}
+
+		for i, ref := range d.References {
+			if _, err := tx.Exec("INSERT INTO deploy_provider_references (deploy_id, position, provider, ref_id, url) VALUES (?, ?, ?, ?, ?)", id, i, ref.Provider, ref.ID, ref.URL); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec("DELETE FROM deploy_references WHERE deploy_id = ?", id); err != nil {
+			return err
+		}
+
+		for _, k := range d.ReferenceKeys() {
+			if _, err := tx.Exec("INSERT INTO deploy_references (key, deploy_id) VALUES (?, ?)", k, id); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec("DELETE FROM deploy_subscribers WHERE deploy_id = ?", id); err != nil {
+			return err
+		}
+
+		for i, ref := range d.Subscribers {
+			if _, err := tx.Exec("INSERT INTO deploy_subscribers (deploy_id, position, user_id, user_name) VALUES (?, ?, ?, ?)", id, i, ref.ID, ref.Name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Printf("failed to store deploy of %s by %s in channel %s: %s", d.Subject, d.User.Name, key, err)
+	}
+}
+
+func (s *SQLStore) All(key string) []Deploy {
+	deploys, err := s.selectDeploys("channel_id = ? ORDER BY started_at", key)
+	if err != nil {
+		log.Printf("failed to read deploys in channel %s: %s", key, err)
+		return nil
+	}
+
+	return deploys
+}
+
+func (s *SQLStore) Since(key string, startTime time.Time) []Deploy {
+	deploys, err := s.selectDeploys("channel_id = ? AND started_at >= ? ORDER BY started_at", key, deployKeyTimestamp(startTime))
+	if err != nil {
+		log.Printf("failed to read deploys in channel %s since %s: %s", key, startTime, err)
+		return nil
+	}
+
+	return deploys
+}
+
+// Channels returns IDs of all channels that have deploy history.
+func (s *SQLStore) Channels() []string {
+	rows, err := s.db.Query("SELECT DISTINCT channel_id FROM deploys")
+	if err != nil {
+		log.Printf("failed to read channels: %s", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var channels []string
+	for rows.Next() {
+		var channelID string
+		if err := rows.Scan(&channelID); err != nil {
+			log.Printf("failed to read channels: %s", err)
+			return nil
+		}
+
+		channels = append(channels, channelID)
+	}
+
+	return channels
+}
+
+// Prune removes outdated deploys from channel history. See deploy.Pruner for details.
+func (s *SQLStore) Prune(key string, before time.Time, keep int) int {
+	var n int
+
+	err := s.withTx(func(tx *sql.Tx) error {
+		var startTimes []string
+		err := scanRows(tx, "SELECT started_at FROM deploys WHERE channel_id = ? ORDER BY started_at", []interface{}{key}, func(rows *sql.Rows) error {
+			var startedAt string
+			if err := rows.Scan(&startedAt); err != nil {
+				return err
+			}
+
+			startTimes = append(startTimes, startedAt)
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		n = prunedCount(len(startTimes), func(i int) time.Time {
+			startedAt, _ := time.Parse(deployKeyTimeFormat, startTimes[i])
+			return startedAt
+		}, before, keep)
+		if n == 0 {
+			return nil
+		}
+
+		// References, subscribers and index entries are removed by foreign key cascade
+		_, err = tx.Exec("DELETE FROM deploys WHERE channel_id = ? AND started_at <= ?", key, startTimes[n-1])
+
+		return err
+	})
+	if err != nil {
+		log.Printf("failed to prune deploys in channel %s: %s", key, err)
+		return 0
+	}
+
+	return n
+}
+
+// DeploysOf returns deploys that mention the pull request or commit with given key. See deploy.ReferenceIndex
+// for details.
+func (s *SQLStore) DeploysOf(key string) []IndexedDeploy {
+	deploys, err := s.selectIndexedDeploys("id IN (SELECT deploy_id FROM deploy_references WHERE key = ?) ORDER BY started_at", key)
+	if err != nil {
+		log.Printf("failed to look up deploys of %s: %s", key, err)
+		return nil
+	}
+
+	return deploys
+}
+
+// Compact rebuilds the database file to reclaim the space taken by removed deploys.
+func (s *SQLStore) Compact() error {
+	_, err := s.db.Exec("VACUUM")
+	return err
+}
+
+func (s *SQLStore) withTx(fn func(*sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// selectDeploys returns deploys matching the query together with their references and subscribers.
+func (s *SQLStore) selectDeploys(query string, args ...interface{}) ([]Deploy, error) {
+	indexed, err := s.selectIndexedDeploys(query, args...)
+	if err != nil || len(indexed) == 0 {
+		return nil, err
+	}
+
+	deploys := make([]Deploy, len(indexed))
+	for i, d := range indexed {
+		deploys[i] = d.Deploy
+	}
+
+	return deploys, nil
+}
+
+// selectIndexedDeploys is the same as selectDeploys but also returns channel IDs of selected deploys.
+func (s *SQLStore) selectIndexedDeploys(query string, args ...interface{}) (deploys []IndexedDeploy, err error) {
+	err = s.withTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT "+deployColumns+" FROM deploys WHERE "+query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		index := make(map[int64]int)
+		for rows.Next() {
+			id, d, err := scanDeploy(rows)
+			if err != nil {
+				return err
+			}
+
+			index[id] = len(deploys)
+			deploys = append(deploys, d)
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		if len(deploys) == 0 {
+			return nil
+		}
+
+		subquery := "SELECT id FROM deploys WHERE " + query
+
+		err = scanRows(tx, "SELECT deploy_id, repository, number FROM deploy_pull_requests WHERE deploy_id IN ("+subquery+") ORDER BY deploy_id, position", args, func(rows *sql.Rows) error {
+			var (
+				id  int64
+				ref PullRequestReference
+			)
+			if err := rows.Scan(&id, &ref.Repository, &ref.ID); err != nil {
+				return err
+			}
+
+			d := &deploys[index[id]]
+			d.PullRequests = append(d.PullRequests, ref)
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = scanRows(tx, "SELECT deploy_id, repository, sha FROM deploy_commits WHERE deploy_id IN ("+subquery+") ORDER BY deploy_id, position", args, func(rows *sql.Rows) error {
+			var (
+				id  int64
+				ref CommitReference
+			)
+			if err := rows.Scan(&id, &ref.Repository, &ref.SHA); err != nil {
+				return err
+			}
+
+			d := &deploys[index[id]]
+			d.Commits = append(d.Commits, ref)
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = scanRows(tx, "SELECT deploy_id, repository, name FROM deploy_tags WHERE deploy_id IN ("+subquery+") ORDER BY deploy_id, position", args, func(rows *sql.Rows) error {
+			var (
+				id  int64
+				ref TagReference
+			)
+			if err := rows.Scan(&id, &ref.Repository, &ref.Name); err != nil {
+				return err
+			}
+
+			d := &deploys[index[id]]
+			d.Tags = append(d.Tags, ref)
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = scanRows(tx, "SELECT deploy_id, repository, base, head FROM deploy_ranges WHERE deploy_id IN ("+subquery+") ORDER BY deploy_id, position", args, func(rows *sql.Rows) error {
+			var (
+				id  int64
+				ref RangeReference
+			)
+			if err := rows.Scan(&id, &ref.Repository, &ref.Base, &ref.Head); err != nil {
+				return err
+			}
+
+			d := &deploys[index[id]]
+			d.Ranges = append(d.Ranges, ref)
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = scanRows(tx, "SELECT deploy_id, provider, ref_id, url FROM deploy_provider_references WHERE deploy_id IN ("+subquery+") ORDER BY deploy_id, position", args, func(rows *sql.Rows) error {
+			var (
+				id  int64
+				ref Reference
+			)
+			if err := rows.Scan(&id, &ref.Provider, &ref.ID, &ref.URL); err != nil {
+				return err
+			}
+
+			d := &deploys[index[id]]
+			d.References = append(d.References, ref)
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return scanRows(tx, "SELECT deploy_id, user_id, user_name FROM deploy_subscribers WHERE deploy_id IN ("+subquery+") ORDER BY deploy_id, position", args, func(rows *sql.Rows) error {
+			var (
+				id  int64
+				ref UserReference
+			)
+			if err := rows.Scan(&id, &ref.ID, &ref.Name); err != nil {
+				return err
+			}
+
+			d := &deploys[index[id]]
+			d.Subscribers = append(d.Subscribers, ref)
+
+			return nil
+		})
+	})
+
+	return deploys, err
+}
+
+func scanDeploy(rows *sql.Rows) (id int64, d IndexedDeploy, err error) {
+	var startedAt string
+	var finishedAt, approvedAt sql.NullString
+
+	err = rows.Scan(&id, &d.ChannelID, &d.User.ID, &d.User.Name, &d.Subject, &startedAt, &finishedAt, &d.Aborted, &d.AbortReason,
+		&d.FinishedBy.ID, &d.FinishedBy.Name, &d.AbortedBy.ID, &d.AbortedBy.Name, &d.ApprovedBy.ID, &d.ApprovedBy.Name, &approvedAt)
+	if err != nil {
+		return id, d, err
+	}
+
+	if d.StartedAt, err = time.Parse(deployKeyTimeFormat, startedAt); err != nil {
+		return id, d, fmt.Errorf("malformed started_at time for deploy %d: %s", id, err)
+	}
+
+	if finishedAt.Valid {
+		if d.FinishedAt, err = time.Parse(deployKeyTimeFormat, finishedAt.String); err != nil {
+			return id, d, fmt.Errorf("malformed finished_at time for deploy %d: %s", id, err)
+		}
+	}
+
+	if approvedAt.Valid {
+		if d.ApprovedAt, err = time.Parse(deployKeyTimeFormat, approvedAt.String); err != nil {
+			return id, d, fmt.Errorf("malformed approved_at time for deploy %d: %s", id, err)
+		}
+	}
+
+	return id, d, nil
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func scanRows(q queryer, query string, args []interface{}, fn func(*sql.Rows) error) error {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
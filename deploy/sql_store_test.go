@@ -0,0 +1,191 @@
+package deploy_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/deploy/storetest"
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLStore(t *testing.T) {
+	storetest.RunStoreSuite(t, func() (storetest.Store, func(), error) {
+		path, err := tempDBFilePath()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		store, err := deploy.NewSQLStore(path)
+		if err != nil {
+			return nil, func() { os.Remove(path) }, err
+		}
+
+		return store, func() {
+			store.Close()
+			os.Remove(path)
+		}, nil
+	})
+}
+
+func TestSQLStore_Migration(t *testing.T) {
+	storetest.RunMigrationSuite(t, func(channels map[string][]deploy.Deploy) (storetest.Store, func(), error) {
+		path, err := tempDBFilePath()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := writeLegacySQLDB(path, channels); err != nil {
+			return nil, func() { os.Remove(path) }, err
+		}
+
+		store, err := deploy.NewSQLStore(path)
+		if err != nil {
+			return nil, func() { os.Remove(path) }, err
+		}
+
+		return store, func() {
+			store.Close()
+			os.Remove(path)
+		}, nil
+	})
+}
+
+func TestSQLStore_AdHocQueries(t *testing.T) {
+	path, err := tempDBFilePath()
+	require.NoError(t, err)
+	defer os.Remove(path)
+
+	store, err := deploy.NewSQLStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	now := time.Now()
+	for i := 3; i > 0; i-- {
+		d := deploy.New(slack.User{ID: "U1", Name: "user1"}, fmt.Sprintf("Deploy a/b#%d for @user2", i))
+		d.StartedAt = now.Add(-time.Duration(i) * time.Hour)
+		store.Set("C1", d)
+	}
+	require.Equal(t, 2, store.Prune("C1", time.Time{}, 1))
+
+	// The database can be queried while the store is open
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var n int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM deploy_pull_requests WHERE repository = ?", "a/b").Scan(&n))
+	assert.Equal(t, 1, n, "expected PR references of pruned deploys to be removed")
+
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM deploy_subscribers").Scan(&n))
+	assert.Equal(t, 1, n, "expected subscribers of pruned deploys to be removed")
+}
+
+func TestNewSQLStore_NewerSchemaVersion(t *testing.T) {
+	path, err := tempDBFilePath()
+	require.NoError(t, err)
+	defer os.Remove(path)
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	_, err = db.Exec(fmt.Sprintf("PRAGMA user_version = %d", deploy.SQLSchemaVersion+1))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	_, err = deploy.NewSQLStore(path)
+	assert.True(t, errors.Is(err, deploy.ErrUnsupportedSchemaVersion), "unexpected error %v", err)
+}
+
+func TestNewSQLStore_Version1(t *testing.T) {
+	path, err := tempDBFilePath()
+	require.NoError(t, err)
+	defer os.Remove(path)
+
+	d := deploy.New(slack.User{ID: "U1", Name: "user1"}, "a/b#1 and https://github.com/a/b/commit/7fd1a60b01f91b314f59955a4e4d4e80d8edf11d")
+	d.StartedAt = time.Date(2016, 8, 4, 9, 28, 0, 0, time.UTC)
+	require.NoError(t, writeLegacySQLDB(path, map[string][]deploy.Deploy{"C1": {d}}))
+
+	store, err := deploy.NewSQLStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	if deploys := store.DeploysOf("a/b@7fd1a60"); assert.Len(t, deploys, 1) {
+		assert.Equal(t, "C1", deploys[0].ChannelID)
+		assert.Equal(t, d.Commits, deploys[0].Commits)
+	}
+
+	assert.Len(t, store.DeploysOf("a/b#1"), 1)
+}
+
+// writeLegacySQLDB creates an SQLite database of the first schema version and writes the user, subject, start time
+// and pull requests of deploys into it.
+func writeLegacySQLDB(path string, channels map[string][]deploy.Deploy) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE deploys (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		channel_id   TEXT NOT NULL,
+		user_id      TEXT NOT NULL,
+		user_name    TEXT NOT NULL,
+		subject      TEXT NOT NULL,
+		started_at   TEXT NOT NULL,
+		finished_at  TEXT,
+		aborted      BOOLEAN NOT NULL DEFAULT FALSE,
+		abort_reason TEXT NOT NULL DEFAULT '',
+		UNIQUE (channel_id, started_at)
+	);
+
+	CREATE TABLE deploy_pull_requests (
+		deploy_id  INTEGER NOT NULL REFERENCES deploys (id) ON DELETE CASCADE,
+		position   INTEGER NOT NULL,
+		repository TEXT NOT NULL,
+		number     TEXT NOT NULL,
+		PRIMARY KEY (deploy_id, position)
+	);
+
+	CREATE TABLE deploy_subscribers (
+		deploy_id INTEGER NOT NULL REFERENCES deploys (id) ON DELETE CASCADE,
+		position  INTEGER NOT NULL,
+		user_id   TEXT NOT NULL,
+		user_name TEXT NOT NULL,
+		PRIMARY KEY (deploy_id, position)
+	);
+
+	PRAGMA user_version = 1;`)
+	if err != nil {
+		return err
+	}
+
+	for channelID, deploys := range channels {
+		for _, d := range deploys {
+			res, err := db.Exec("INSERT INTO deploys (channel_id, user_id, user_name, subject, started_at) VALUES (?, ?, ?, ?, ?)",
+				channelID, d.User.ID, d.User.Name, d.Subject, d.StartedAt.UTC().Format("2006-01-02T15:04:05.000000000Z07:00"))
+			if err != nil {
+				return err
+			}
+
+			id, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+
+			for i, ref := range d.PullRequests {
+				if _, err := db.Exec("INSERT INTO deploy_pull_requests (deploy_id, position, repository, number) VALUES (?, ?, ?, ?)", id, i, ref.Repository, ref.ID); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -4,3 +4,13 @@ type Store interface {
 	Get(key string) (d Deploy, ok bool)
 	Set(key string, d Deploy)
 }
+
+// TransactionalStore is an interface implemented by stores that can be shared between multiple processes.
+//
+// Update reads the latest deploy in key history, passes it to fn and atomically stores deploys returned by fn.
+// If key history has been changed by someone else in the meantime, the update is retried, so fn may be called
+// more than once and should not have side effects.
+type TransactionalStore interface {
+	Store
+	Update(key string, fn func(last Deploy, ok bool) []Deploy) error
+}
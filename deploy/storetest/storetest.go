@@ -0,0 +1,787 @@
+// Package storetest provides a conformance test suite for deploy store implementations.
+package storetest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// Store is the set of methods every deploy store is expected to implement.
+type Store interface {
+	deploy.Store
+	deploy.Repository
+}
+
+// Factory returns a new empty store along with a function that releases it. The teardown function may be nil.
+type Factory func() (store Store, teardownFn func(), err error)
+
+// RunStoreSuite runs the conformance test suite against stores returned by factory. Pruning, record and reference
+// index test cases are skipped if the store does not implement deploy.Pruner, deploy.RecordStore or
+// deploy.ReferenceIndex respectively.
+func RunStoreSuite(t *testing.T, factory Factory) {
+	suite.Run(t, &storeSuite{factory: factory})
+}
+
+// LegacyFactory writes deploys into a new store of the oldest schema version its migrations support keeping only
+// the user, subject, start time and pull requests of each deploy, migrates the store to the current version and
+// returns it along with a function that releases it. The teardown function may be nil.
+type LegacyFactory func(channels map[string][]deploy.Deploy) (store Store, teardownFn func(), err error)
+
+// RunMigrationSuite checks that deploys stored before a store has been migrated are found by the references
+// mentioned in their subjects once the migration is complete.
+func RunMigrationSuite(t *testing.T, factory LegacyFactory) {
+	suite.Run(t, &migrationSuite{factory: factory})
+}
+
+type storeSuite struct {
+	suite.Suite
+	factory Factory
+}
+
+func (suite *storeSuite) setup() Store {
+	store, teardown, err := suite.factory()
+	if teardown != nil {
+		suite.T().Cleanup(teardown)
+	}
+	require.NoError(suite.T(), err)
+
+	return store
+}
+
+func (suite *storeSuite) setupPruner() (Store, deploy.Pruner) {
+	store := suite.setup()
+
+	pruner, ok := store.(deploy.Pruner)
+	if !ok {
+		suite.T().Skipf("%T does not implement deploy.Pruner", store)
+	}
+
+	return store, pruner
+}
+
+func (suite *storeSuite) setupRecordStore() deploy.RecordStore {
+	store := suite.setup()
+
+	records, ok := store.(deploy.RecordStore)
+	if !ok {
+		suite.T().Skipf("%T does not implement deploy.RecordStore", store)
+	}
+
+	return records
+}
+
+func (suite *storeSuite) setupReferenceIndex() (Store, deploy.ReferenceIndex) {
+	store := suite.setup()
+
+	index, ok := store.(deploy.ReferenceIndex)
+	if !ok {
+		suite.T().Skipf("%T does not implement deploy.ReferenceIndex", store)
+	}
+
+	return store, index
+}
+
+func (suite *storeSuite) TestGet_EmptyHistory() {
+	store := suite.setup()
+
+	_, ok := store.Get("key1")
+	assert.False(suite.T(), ok)
+
+	assert.Empty(suite.T(), store.All("key1"))
+	assert.Empty(suite.T(), store.Since("key1", time.Time{}))
+}
+
+func (suite *storeSuite) TestRoundTrip() {
+	store := suite.setup()
+
+	startedAt := time.Date(2016, 8, 4, 9, 28, 13, 123456789, time.UTC)
+	expected := deploy.Deploy{
+		User:        slack.User{ID: "U1", Name: "Test User"},
+		Subject:     "Deploy subject a/b#1 and c/d#2 with e/f@7fd1a60, g/h@v1.2...v1.3 and i/j@v2.0 fixing OPS-1 for <@U2|user1> and @user2",
+		StartedAt:   startedAt,
+		FinishedAt:  startedAt.Add(5*time.Minute + time.Nanosecond),
+		Aborted:     true,
+		AbortReason: "something went wrong",
+		AbortedBy:   slack.User{ID: "U3", Name: "Another User"},
+		ApprovedBy:  slack.User{ID: "U4", Name: "Approver"},
+		ApprovedAt:  startedAt.Add(-time.Minute),
+		PullRequests: []deploy.PullRequestReference{
+			{ID: "1", Repository: "a/b"},
+			{ID: "2", Repository: "c/d"},
+		},
+		Commits: []deploy.CommitReference{
+			{SHA: "7fd1a60", Repository: "e/f"},
+		},
+		Tags: []deploy.TagReference{
+			{Name: "v2.0", Repository: "i/j"},
+		},
+		Ranges: []deploy.RangeReference{
+			{Base: "v1.2", Head: "v1.3", Repository: "g/h"},
+		},
+		References: []deploy.Reference{
+			{Provider: "jira", ID: "OPS-1", URL: "https://jira.example.com/browse/OPS-1"},
+		},
+		Subscribers: []deploy.UserReference{
+			{ID: "U2", Name: "user1"},
+			{Name: "user2"},
+		},
+	}
+	store.Set("key1", expected)
+
+	if d, ok := store.Get("key1"); assert.True(suite.T(), ok) {
+		assertDeploy(suite.T(), expected, d)
+	}
+
+	if deploys := store.All("key1"); assert.Len(suite.T(), deploys, 1) {
+		assertDeploy(suite.T(), expected, deploys[0])
+	}
+
+	if deploys := store.Since("key1", startedAt); assert.Len(suite.T(), deploys, 1) {
+		assertDeploy(suite.T(), expected, deploys[0])
+	}
+}
+
+func (suite *storeSuite) TestRoundTrip_RunningDeploy() {
+	store := suite.setup()
+
+	expected := deploy.New(slack.User{ID: "U1", Name: "Test User"}, "Deploy subject")
+	expected.Start()
+	store.Set("key1", expected)
+
+	if d, ok := store.Get("key1"); assert.True(suite.T(), ok) {
+		assertDeploy(suite.T(), expected, d)
+		assert.False(suite.T(), d.Finished())
+	}
+}
+
+func (suite *storeSuite) TestGetSet_MultipleKeys() {
+	store := suite.setup()
+
+	channel1Deploy := deploy.Deploy{
+		User:        slack.User{ID: "1", Name: "Test User"},
+		Subject:     "Deploy subject a/b#1 and c/d#2 for @user1 and @user2",
+		StartedAt:   time.Now().Add(-5 * time.Minute),
+		FinishedAt:  time.Now().Add(-1 * time.Minute),
+		Aborted:     true,
+		AbortReason: "something went wrong",
+		PullRequests: []deploy.PullRequestReference{
+			{ID: "1", Repository: "a/b"},
+			{ID: "2", Repository: "c/d"},
+		},
+		Subscribers: []deploy.UserReference{
+			{Name: "user1"},
+			{Name: "user2"},
+		},
+	}
+	store.Set("key1", channel1Deploy)
+
+	channel2Deploy := deploy.Deploy{
+		User:      slack.User{ID: "2", Name: "Second User"},
+		Subject:   "Another deploy c/d#2 for @another_user",
+		StartedAt: time.Now().Add(-4 * time.Minute),
+		PullRequests: []deploy.PullRequestReference{
+			{ID: "2", Repository: "c/d"},
+		},
+		Subscribers: []deploy.UserReference{
+			{Name: "another_user"},
+		},
+	}
+	store.Set("key2", channel2Deploy)
+
+	if d, ok := store.Get("key2"); assert.True(suite.T(), ok) {
+		assertDeploy(suite.T(), channel2Deploy, d)
+	}
+
+	// Check that another record wasn't changed
+	if d, ok := store.Get("key1"); assert.True(suite.T(), ok) {
+		assertDeploy(suite.T(), channel1Deploy, d)
+	}
+}
+
+func (suite *storeSuite) TestSet_UpdatesLastDeploy() {
+	store := suite.setup()
+
+	previous := deploy.New(slack.User{ID: "1", Name: "First User"}, "Previous deploy")
+	previous.StartedAt = time.Now().Add(-time.Hour)
+	previous.Finish()
+	previous.FinishedBy = slack.User{ID: "2", Name: "Another User"}
+	store.Set("key1", previous)
+
+	d := deploy.New(slack.User{ID: "1", Name: "First User"}, "Deploy subject a/b#1 for @user1")
+	d.Start()
+	store.Set("key1", d)
+
+	d, ok := store.Get("key1")
+	require.True(suite.T(), ok)
+
+	d.Subject = "Updated subject"
+	d.User = slack.User{ID: "2", Name: "Updated User"}
+	d.PullRequests, d.Subscribers = nil, nil
+	d.Abort("changed my mind")
+	d.AbortedBy = slack.User{ID: "3", Name: "Third User"}
+	// Same moment in a different time zone still refers to the same deploy
+	d.StartedAt = d.StartedAt.In(time.FixedZone("UTC+3", 3*60*60))
+	store.Set("key1", d)
+
+	if updated, ok := store.Get("key1"); assert.True(suite.T(), ok) {
+		assertDeploy(suite.T(), d, updated)
+	}
+
+	if deploys := store.All("key1"); assert.Len(suite.T(), deploys, 2) {
+		assertDeploy(suite.T(), previous, deploys[0])
+		assertDeploy(suite.T(), d, deploys[1])
+	}
+}
+
+func (suite *storeSuite) TestAll_Ordering() {
+	store := suite.setup()
+
+	now := time.Now()
+	user := slack.User{ID: "1", Name: "User 1"}
+
+	var deploys []deploy.Deploy
+	for delta := -10 * time.Minute; delta < 0; delta += time.Minute {
+		d := deploy.New(user, fmt.Sprintf("Deploy from %s ago", delta))
+		d.StartedAt = now.Add(delta)
+		if delta+time.Minute < 0 {
+			d.FinishedAt = now.Add(delta + time.Minute)
+		}
+
+		deploys = append(deploys, d)
+	}
+
+	// Store deploys out of order, they are still expected to be returned sorted by their start time
+	for _, i := range [...]int{2, 0, 1, 3, 4, 5, 9, 6, 7, 8} {
+		store.Set("key1", deploys[i])
+	}
+
+	if history := store.All("key1"); assert.Len(suite.T(), history, len(deploys)) {
+		for i, d := range history {
+			assertDeploy(suite.T(), deploys[i], d)
+		}
+	}
+
+	if d, ok := store.Get("key1"); assert.True(suite.T(), ok) {
+		assertDeploy(suite.T(), deploys[len(deploys)-1], d)
+	}
+}
+
+func (suite *storeSuite) TestSince() {
+	store := suite.setup()
+
+	now := time.Now()
+	history := populateHistory(store, "key1", now, 4)
+	populateHistory(store, "key2", now, 2)
+
+	examples := map[time.Time][]deploy.Deploy{
+		time.Time{}:                history,
+		now.Add(-4 * time.Hour):    history,
+		now.Add(-2*time.Hour - 1):  history[1:],
+		now.Add(-2 * time.Hour):    history[1:],
+		now.Add(-2*time.Hour + 1):  history[2:],
+		now.Add(-90 * time.Minute): history[2:],
+		now:                        history[3:],
+		now.Add(time.Nanosecond):   nil,
+		now.Add(24 * time.Hour):    nil,
+		now.Add(-time.Hour).In(time.FixedZone("UTC-5", -5*60*60)): history[2:],
+	}
+
+	for startTime, expected := range examples {
+		deploys := store.Since("key1", startTime)
+		if assert.Len(suite.T(), deploys, len(expected), "since %s", startTime) {
+			for i, d := range deploys {
+				assertDeploy(suite.T(), expected[i], d)
+			}
+		}
+	}
+
+	assert.Empty(suite.T(), store.Since("key3", time.Time{}))
+}
+
+func (suite *storeSuite) TestReturnedHistoryIsACopy() {
+	store := suite.setup()
+
+	now := time.Now()
+	history := populateHistory(store, "key1", now, 3)
+
+	since := store.Since("key1", time.Time{})
+	require.Len(suite.T(), since, 3)
+	since[2].Subject = "Changed subject"
+
+	all := store.All("key1")
+	require.Len(suite.T(), all, 3)
+	all[1].Subject = "Changed subject"
+
+	// Adding a deploy should not change previously returned slices
+	d := deploy.New(slack.User{ID: "1", Name: "User 1"}, "Next deploy")
+	d.StartedAt = now.Add(time.Hour)
+	store.Set("key1", d)
+
+	if deploys := store.All("key1"); assert.Len(suite.T(), deploys, 4) {
+		for i := range history {
+			assertDeploy(suite.T(), history[i], deploys[i])
+		}
+	}
+	assert.Equal(suite.T(), "Changed subject", since[2].Subject)
+}
+
+func (suite *storeSuite) TestConcurrentAccess() {
+	store := suite.setup()
+
+	const (
+		writers          = 4
+		deploysPerWriter = 10
+	)
+
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(2)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < deploysPerWriter; i++ {
+				d := deploy.New(slack.User{ID: fmt.Sprintf("U%d", w)}, fmt.Sprintf("Deploy %d by writer %d", i, w))
+				d.StartedAt = now.Add(time.Duration(i*writers+w) * time.Second)
+				store.Set("shared", d)
+				store.Set(fmt.Sprintf("key%d", w), d)
+
+				d.Finish()
+				store.Set("shared", d)
+			}
+		}(w)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < deploysPerWriter; i++ {
+				store.Get("shared")
+				store.All("shared")
+				store.Since("shared", now.Add(time.Duration(i)*time.Second))
+				store.Get(fmt.Sprintf("key%d", w))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	deploys := store.All("shared")
+	if assert.Len(suite.T(), deploys, writers*deploysPerWriter) {
+		assert.True(suite.T(), sort.SliceIsSorted(deploys, func(i, j int) bool {
+			return deploys[i].StartedAt.Before(deploys[j].StartedAt)
+		}), "expected deploys to be sorted by their start time")
+
+		for _, d := range deploys {
+			assert.True(suite.T(), d.Finished(), "expected %s to be finished", d.Subject)
+		}
+	}
+
+	for w := 0; w < writers; w++ {
+		assert.Len(suite.T(), store.All(fmt.Sprintf("key%d", w)), deploysPerWriter)
+	}
+}
+
+func (suite *storeSuite) TestChannels() {
+	store, pruner := suite.setupPruner()
+
+	assert.Empty(suite.T(), pruner.Channels())
+
+	store.Set("key1", deploy.Deploy{StartedAt: time.Now()})
+	store.Set("key2", deploy.Deploy{StartedAt: time.Now()})
+
+	channels := pruner.Channels()
+	sort.Strings(channels)
+	assert.Equal(suite.T(), []string{"key1", "key2"}, channels)
+}
+
+func (suite *storeSuite) TestPrune_Before() {
+	store, pruner := suite.setupPruner()
+
+	now := time.Now()
+	history := populateHistory(store, "key1", now, 5)
+	populateHistory(store, "key2", now, 5)
+
+	assert.Equal(suite.T(), 3, pruner.Prune("key1", now.Add(-2*time.Hour+time.Minute), 0))
+
+	if deploys := store.All("key1"); assert.Len(suite.T(), deploys, 2) {
+		assertDeploy(suite.T(), history[3], deploys[0])
+		assertDeploy(suite.T(), history[4], deploys[1])
+	}
+	assert.Len(suite.T(), store.All("key2"), 5)
+}
+
+func (suite *storeSuite) TestPrune_Keep() {
+	store, pruner := suite.setupPruner()
+
+	now := time.Now()
+	history := populateHistory(store, "key1", now, 5)
+
+	assert.Equal(suite.T(), 0, pruner.Prune("key1", time.Time{}, 10))
+	assert.Equal(suite.T(), 3, pruner.Prune("key1", time.Time{}, 2))
+
+	if deploys := store.All("key1"); assert.Len(suite.T(), deploys, 2) {
+		assertDeploy(suite.T(), history[3], deploys[0])
+		assertDeploy(suite.T(), history[4], deploys[1])
+	}
+}
+
+func (suite *storeSuite) TestPrune_KeepsLatestDeploy() {
+	store, pruner := suite.setupPruner()
+
+	now := time.Now()
+	history := populateHistory(store, "key1", now, 3)
+
+	assert.Equal(suite.T(), 2, pruner.Prune("key1", now.Add(time.Hour), 0))
+
+	if deploys := store.All("key1"); assert.Len(suite.T(), deploys, 1) {
+		assertDeploy(suite.T(), history[2], deploys[0])
+	}
+
+	if d, ok := store.Get("key1"); assert.True(suite.T(), ok) {
+		assertDeploy(suite.T(), history[2], d)
+	}
+
+	assert.Equal(suite.T(), 0, pruner.Prune("key2", now, 1))
+}
+
+func (suite *storeSuite) TestDeploysOf() {
+	store, index := suite.setupReferenceIndex()
+
+	now := time.Now()
+	user := slack.User{ID: "U1", Name: "user1"}
+
+	d1 := deploy.New(user, "Octocat/Helloworld#1 and https://github.com/octocat/helloworld/commit/7fd1a60b01f91b314f59955a4e4d4e80d8edf11d")
+	d1.StartedAt, d1.FinishedAt = now.Add(-2*time.Hour), now.Add(-2*time.Hour+time.Minute)
+	store.Set("key1", d1)
+
+	d2 := deploy.New(user, "octocat/helloworld#1 octocat/helloworld#2")
+	d2.StartedAt, d2.FinishedAt = now.Add(-time.Hour), now.Add(-time.Hour+time.Minute)
+	d2.Abort("failed")
+	store.Set("key2", d2)
+
+	d3 := deploy.New(user, "octocat/helloworld#1 again")
+	d3.StartedAt = now
+	store.Set("key1", d3)
+
+	deploys := index.DeploysOf(deploy.PullRequestReference{Repository: "octocat/helloworld", ID: "1"}.Key())
+	if assert.Len(suite.T(), deploys, 3) {
+		assert.Equal(suite.T(), "key1", deploys[0].ChannelID)
+		assertDeploy(suite.T(), d1, deploys[0].Deploy)
+
+		assert.Equal(suite.T(), "key2", deploys[1].ChannelID)
+		assertDeploy(suite.T(), d2, deploys[1].Deploy)
+
+		assert.Equal(suite.T(), "key1", deploys[2].ChannelID)
+		assertDeploy(suite.T(), d3, deploys[2].Deploy)
+	}
+
+	if deploys := index.DeploysOf(deploy.CommitReference{Repository: "octocat/helloworld", SHA: "7fd1a60"}.Key()); assert.Len(suite.T(), deploys, 1) {
+		assert.Equal(suite.T(), "key1", deploys[0].ChannelID)
+		assertDeploy(suite.T(), d1, deploys[0].Deploy)
+	}
+
+	assert.Empty(suite.T(), index.DeploysOf(deploy.PullRequestReference{Repository: "octocat/helloworld", ID: "3"}.Key()))
+}
+
+func (suite *storeSuite) TestDeploysOf_Tags() {
+	store, index := suite.setupReferenceIndex()
+
+	now := time.Now()
+	user := slack.User{ID: "U1", Name: "user1"}
+
+	d1 := deploy.New(user, "octocat/helloworld@v1.3")
+	d1.StartedAt, d1.FinishedAt = now.Add(-time.Hour), now.Add(-time.Hour+time.Minute)
+	store.Set("key1", d1)
+
+	d2 := deploy.New(user, "https://github.com/octocat/helloworld/compare/v1.2...v1.3")
+	d2.StartedAt = now
+	store.Set("key2", d2)
+
+	if deploys := index.DeploysOf(deploy.TagReference{Repository: "octocat/helloworld", Name: "v1.3"}.Key()); assert.Len(suite.T(), deploys, 2) {
+		assertDeploy(suite.T(), d1, deploys[0].Deploy)
+		assertDeploy(suite.T(), d2, deploys[1].Deploy)
+	}
+
+	assert.Empty(suite.T(), index.DeploysOf(deploy.TagReference{Repository: "octocat/helloworld", Name: "v1.2"}.Key()))
+}
+
+func (suite *storeSuite) TestDeploysOf_ProviderReferences() {
+	store, index := suite.setupReferenceIndex()
+
+	ref := deploy.Reference{Provider: "jira", ID: "OPS-1", URL: "https://jira.example.com/browse/OPS-1"}
+
+	d := deploy.New(slack.User{ID: "U1", Name: "user1"}, "OPS-1")
+	d.References = []deploy.Reference{ref}
+	d.Start()
+	store.Set("key1", d)
+
+	if deploys := index.DeploysOf(ref.Key()); assert.Len(suite.T(), deploys, 1) {
+		assert.Equal(suite.T(), "key1", deploys[0].ChannelID)
+		assertDeploy(suite.T(), d, deploys[0].Deploy)
+	}
+
+	assert.Empty(suite.T(), index.DeploysOf(deploy.Reference{Provider: "jira", ID: "OPS-2"}.Key()))
+}
+
+func (suite *storeSuite) TestDeploysOf_UpdatedDeploy() {
+	store, index := suite.setupReferenceIndex()
+
+	d := deploy.New(slack.User{ID: "U1", Name: "user1"}, "octocat/helloworld#1")
+	d.Start()
+	store.Set("key1", d)
+
+	d.Finish()
+	store.Set("key1", d)
+
+	if deploys := index.DeploysOf("octocat/helloworld#1"); assert.Len(suite.T(), deploys, 1) {
+		assertDeploy(suite.T(), d, deploys[0].Deploy)
+	}
+}
+
+func (suite *storeSuite) TestDeploysOf_Pruned() {
+	store, index := suite.setupReferenceIndex()
+
+	pruner, ok := store.(deploy.Pruner)
+	if !ok {
+		suite.T().Skipf("%T does not implement deploy.Pruner", store)
+	}
+
+	now := time.Now()
+	history := populateHistory(store, "key1", now, 3)
+
+	require.Equal(suite.T(), 2, pruner.Prune("key1", time.Time{}, 1))
+
+	assert.Empty(suite.T(), index.DeploysOf("a/b#2"))
+	assert.Empty(suite.T(), index.DeploysOf("a/b#1"))
+
+	if deploys := index.DeploysOf("a/b#0"); assert.Len(suite.T(), deploys, 1) {
+		assertDeploy(suite.T(), history[2], deploys[0].Deploy)
+	}
+}
+
+func (suite *storeSuite) TestRecords_PutGet() {
+	store := suite.setupRecordStore()
+
+	_, ok, err := store.GetRecord("collection1", "key1")
+	require.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	expiresAt := time.Now().Add(time.Hour)
+	require.NoError(suite.T(), store.PutRecord("collection1", deploy.Record{Key: "key1", Value: []byte("value1"), ExpiresAt: expiresAt}))
+	require.NoError(suite.T(), store.PutRecord("collection2", deploy.Record{Key: "key1", Value: []byte("another value")}))
+
+	if rec, ok, err := store.GetRecord("collection1", "key1"); assert.NoError(suite.T(), err) && assert.True(suite.T(), ok) {
+		assert.Equal(suite.T(), "key1", rec.Key)
+		assert.Equal(suite.T(), []byte("value1"), rec.Value)
+		assert.True(suite.T(), expiresAt.Equal(rec.ExpiresAt), "expected record to expire at %s, got %s", expiresAt, rec.ExpiresAt)
+	}
+
+	// Overwrite the value
+	require.NoError(suite.T(), store.PutRecord("collection1", deploy.Record{Key: "key1", Value: []byte("value2")}))
+
+	if rec, ok, err := store.GetRecord("collection1", "key1"); assert.NoError(suite.T(), err) && assert.True(suite.T(), ok) {
+		assert.Equal(suite.T(), []byte("value2"), rec.Value)
+		assert.True(suite.T(), rec.ExpiresAt.IsZero())
+	}
+
+	if rec, ok, err := store.GetRecord("collection2", "key1"); assert.NoError(suite.T(), err) && assert.True(suite.T(), ok) {
+		assert.Equal(suite.T(), []byte("another value"), rec.Value)
+	}
+}
+
+func (suite *storeSuite) TestRecords_Add() {
+	store := suite.setupRecordStore()
+
+	added, err := store.AddRecord("collection1", deploy.Record{Key: "key1", Value: []byte("value1")})
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), added)
+
+	added, err = store.AddRecord("collection1", deploy.Record{Key: "key1", Value: []byte("value2")})
+	require.NoError(suite.T(), err)
+	assert.False(suite.T(), added)
+
+	if rec, ok, err := store.GetRecord("collection1", "key1"); assert.NoError(suite.T(), err) && assert.True(suite.T(), ok) {
+		assert.Equal(suite.T(), []byte("value1"), rec.Value)
+	}
+
+	// Expired records can be replaced
+	require.NoError(suite.T(), store.PutRecord("collection1", deploy.Record{Key: "key2", Value: []byte("value1"), ExpiresAt: time.Now().Add(-time.Second)}))
+
+	added, err = store.AddRecord("collection1", deploy.Record{Key: "key2", Value: []byte("value2")})
+	require.NoError(suite.T(), err)
+	assert.True(suite.T(), added)
+
+	if rec, ok, err := store.GetRecord("collection1", "key2"); assert.NoError(suite.T(), err) && assert.True(suite.T(), ok) {
+		assert.Equal(suite.T(), []byte("value2"), rec.Value)
+	}
+}
+
+func (suite *storeSuite) TestRecords_Delete() {
+	store := suite.setupRecordStore()
+
+	require.NoError(suite.T(), store.PutRecord("collection1", deploy.Record{Key: "key1", Value: []byte("value1")}))
+	require.NoError(suite.T(), store.PutRecord("collection1", deploy.Record{Key: "key2", Value: []byte("value2"), ExpiresAt: time.Now().Add(-time.Second)}))
+
+	if rec, ok, err := store.DeleteRecord("collection1", "key1"); assert.NoError(suite.T(), err) && assert.True(suite.T(), ok) {
+		assert.Equal(suite.T(), []byte("value1"), rec.Value)
+	}
+
+	_, ok, err := store.DeleteRecord("collection1", "key1")
+	require.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	_, ok, err = store.DeleteRecord("collection1", "key2")
+	require.NoError(suite.T(), err)
+	assert.False(suite.T(), ok, "expected expired record to be reported as missing")
+
+	_, ok, err = store.DeleteRecord("collection2", "key1")
+	require.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+}
+
+func (suite *storeSuite) TestRecords_Expiration() {
+	store := suite.setupRecordStore()
+
+	now := time.Now()
+	require.NoError(suite.T(), store.PutRecord("collection1", deploy.Record{Key: "key3", Value: []byte("value3")}))
+	require.NoError(suite.T(), store.PutRecord("collection1", deploy.Record{Key: "key1", Value: []byte("value1"), ExpiresAt: now.Add(time.Hour)}))
+	require.NoError(suite.T(), store.PutRecord("collection1", deploy.Record{Key: "key2", Value: []byte("value2"), ExpiresAt: now.Add(-time.Second)}))
+	require.NoError(suite.T(), store.PutRecord("collection2", deploy.Record{Key: "key1", Value: []byte("value1"), ExpiresAt: now.Add(-time.Second)}))
+
+	_, ok, err := store.GetRecord("collection1", "key2")
+	require.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+
+	if records, err := store.Records("collection1"); assert.NoError(suite.T(), err) && assert.Len(suite.T(), records, 2) {
+		assert.Equal(suite.T(), "key1", records[0].Key)
+		assert.Equal(suite.T(), []byte("value1"), records[0].Value)
+		assert.Equal(suite.T(), "key3", records[1].Key)
+		assert.Equal(suite.T(), []byte("value3"), records[1].Value)
+	}
+
+	n, err := store.RemoveExpiredRecords("collection1")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, n)
+
+	n, err = store.RemoveExpiredRecords("collection1")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, n)
+
+	records, err := store.Records("collection1")
+	require.NoError(suite.T(), err)
+	assert.Len(suite.T(), records, 2)
+
+	// expired records of other collections are kept until they are removed explicitly
+	n, err = store.RemoveExpiredRecords("collection2")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, n)
+
+	n, err = store.RemoveExpiredRecords("collection3")
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, n)
+
+	records, err = store.Records("collection2")
+	require.NoError(suite.T(), err)
+	assert.Empty(suite.T(), records)
+}
+
+// populateHistory adds n deploys into key history, started an hour apart and finishing with the one running at now.
+func populateHistory(store deploy.Store, key string, now time.Time, n int) []deploy.Deploy {
+	var history []deploy.Deploy
+	for i := n - 1; i >= 0; i-- {
+		d := deploy.New(slack.User{ID: "1", Name: "User 1"}, fmt.Sprintf("Deploy %d hours ago a/b#%d for @user%d", i, i, i))
+		d.StartedAt = now.Add(-time.Duration(i) * time.Hour)
+		if i > 0 {
+			d.FinishedAt = d.StartedAt.Add(time.Minute)
+		}
+
+		store.Set(key, d)
+		history = append(history, d)
+	}
+
+	return history
+}
+
+// assertDeploy checks that actual deploy has the same field values as expected one. Times are compared with
+// time.Time.Equal, so that stores are free to change their location and drop the monotonic clock reading.
+func assertDeploy(t *testing.T, expected, actual deploy.Deploy) bool {
+	t.Helper()
+
+	return assert.Equal(t, expected.User, actual.User, "user") &&
+		assert.Equal(t, expected.Subject, actual.Subject, "subject") &&
+		assert.True(t, expected.StartedAt.Equal(actual.StartedAt), "expected deploy to be started at %s, got %s", expected.StartedAt, actual.StartedAt) &&
+		assert.True(t, expected.FinishedAt.Equal(actual.FinishedAt), "expected deploy to be finished at %s, got %s", expected.FinishedAt, actual.FinishedAt) &&
+		assert.Equal(t, expected.Aborted, actual.Aborted, "aborted") &&
+		assert.Equal(t, expected.AbortReason, actual.AbortReason, "abort reason") &&
+		assert.Equal(t, expected.FinishedBy, actual.FinishedBy, "finished by") &&
+		assert.Equal(t, expected.AbortedBy, actual.AbortedBy, "aborted by") &&
+		assert.Equal(t, expected.ApprovedBy, actual.ApprovedBy, "approved by") &&
+		assert.True(t, expected.ApprovedAt.Equal(actual.ApprovedAt), "expected deploy to be approved at %s, got %s", expected.ApprovedAt, actual.ApprovedAt) &&
+		assert.Equal(t, expected.PullRequests, actual.PullRequests, "pull requests") &&
+		assert.Equal(t, expected.Commits, actual.Commits, "commits") &&
+		assert.Equal(t, expected.Tags, actual.Tags, "tags") &&
+		assert.Equal(t, expected.Ranges, actual.Ranges, "ranges") &&
+		assert.Equal(t, expected.References, actual.References, "references") &&
+		assert.Equal(t, expected.Subscribers, actual.Subscribers, "subscribers")
+}
+
+type migrationSuite struct {
+	suite.Suite
+	factory LegacyFactory
+}
+
+func (suite *migrationSuite) TestDeploysOf() {
+	startTime := time.Date(2016, 8, 4, 9, 28, 0, 0, time.UTC)
+	user := slack.User{ID: "U1", Name: "user1"}
+
+	d1 := deploy.New(user, "octocat/helloworld#1 and octocat/helloworld@7fd1a60")
+	d1.StartedAt = startTime
+
+	d2 := deploy.New(user, "https://github.com/octocat/helloworld/compare/v1.2...v1.3")
+	d2.StartedAt = startTime.Add(time.Hour)
+
+	d3 := deploy.New(user, "octocat/helloworld@v1.3 https://github.com/octocat/helloworld/commit/7fd1a60b01f91b314f59955a4e4d4e80d8edf11d")
+	d3.StartedAt = startTime.Add(2 * time.Hour)
+
+	store, teardown, err := suite.factory(map[string][]deploy.Deploy{
+		"key1": {d1, d2},
+		"key2": {d3},
+	})
+	if teardown != nil {
+		suite.T().Cleanup(teardown)
+	}
+	require.NoError(suite.T(), err)
+
+	index, ok := store.(deploy.ReferenceIndex)
+	if !ok {
+		suite.T().Skipf("%T does not implement deploy.ReferenceIndex", store)
+	}
+
+	if deploys := index.DeploysOf(deploy.PullRequestReference{Repository: "octocat/helloworld", ID: "1"}.Key()); assert.Len(suite.T(), deploys, 1) {
+		assert.Equal(suite.T(), "key1", deploys[0].ChannelID)
+		assertDeploy(suite.T(), d1, deploys[0].Deploy)
+	}
+
+	if deploys := index.DeploysOf(deploy.CommitReference{Repository: "octocat/helloworld", SHA: "7fd1a60"}.Key()); assert.Len(suite.T(), deploys, 2) {
+		assertDeploy(suite.T(), d1, deploys[0].Deploy)
+		assertDeploy(suite.T(), d3, deploys[1].Deploy)
+	}
+
+	if deploys := index.DeploysOf(deploy.TagReference{Repository: "octocat/helloworld", Name: "v1.3"}.Key()); assert.Len(suite.T(), deploys, 2) {
+		assert.Equal(suite.T(), "key1", deploys[0].ChannelID)
+		assertDeploy(suite.T(), d2, deploys[0].Deploy)
+
+		assert.Equal(suite.T(), "key2", deploys[1].ChannelID)
+		assertDeploy(suite.T(), d3, deploys[1].Deploy)
+	}
+}
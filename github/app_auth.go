@@ -0,0 +1,135 @@
+package github
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// appJWTLifetime is the lifetime of JWT used to authenticate as a GitHub App. GitHub does not accept
+	// tokens that expire more than 10 minutes in the future.
+	appJWTLifetime = 9 * time.Minute
+	// installationTokenRefreshMargin is the time before installation token expiration when it is
+	// considered stale and gets replaced with a new one.
+	installationTokenRefreshMargin = 5 * time.Minute
+)
+
+// TokenSource provides the value of Authorization header sent with GitHub API requests.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+type staticToken string
+
+func (t staticToken) Token() (string, error) {
+	return string(t), nil
+}
+
+// AppInstallationTokenSource authenticates requests as a GitHub App installation. It signs a JWT with the app
+// private key to exchange it for an installation access token, which is cached and refreshed before it expires.
+type AppInstallationTokenSource struct {
+	BaseURL string // to use with GitHub Enterprise Server and in tests
+
+	appID          string
+	installationID string
+	key            *rsa.PrivateKey
+	client         *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewAppInstallationTokenSource returns a token source for an app installation. The privateKey is
+// a PEM-encoded RSA key generated in the GitHub App settings.
+func NewAppInstallationTokenSource(appID, installationID string, privateKey []byte, client *http.Client) (*AppInstallationTokenSource, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %s", err)
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	return &AppInstallationTokenSource{
+		BaseURL:        "https://api.github.com",
+		appID:          appID,
+		installationID: installationID,
+		key:            key,
+		client:         client,
+	}, nil
+}
+
+// Token returns the Authorization header value with a cached installation token, requesting a new one
+// if the cached token is about to expire.
+func (s *AppInstallationTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.token != "" && now.Add(installationTokenRefreshMargin).Before(s.expiresAt) {
+		return "token " + s.token, nil
+	}
+
+	token, expiresAt, err := s.requestInstallationToken(now)
+	if err != nil {
+		return "", err
+	}
+
+	s.token, s.expiresAt = token, expiresAt
+
+	return "token " + s.token, nil
+}
+
+func (s *AppInstallationTokenSource) requestInstallationToken(now time.Time) (string, time.Time, error) {
+	appToken, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		Issuer: s.appID,
+		// allow for clock drift between us and GitHub
+		IssuedAt:  now.Add(-1 * time.Minute).Unix(),
+		ExpiresAt: now.Add(appJWTLifetime).Unix(),
+	}).SignedString(s.key)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign GitHub App JWT: %s", err)
+	}
+
+	url := s.BaseURL + "/app/installations/" + s.installationID + "/access_tokens"
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to build a request to %s (%s)", url, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+appToken)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("request to %s failed (%s)", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to read %s response body (%s)", url, err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", time.Time{}, fmt.Errorf("got HTTP %d response from %s: %q", resp.StatusCode, url, body)
+	}
+
+	var v struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse installation token response (%s)", err)
+	}
+
+	return v.Token, v.ExpiresAt, nil
+}
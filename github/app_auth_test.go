@@ -0,0 +1,128 @@
+package github_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/github"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppInstallationTokenSource_Token(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	key, keyPEM := generateAppPrivateKey(t)
+
+	var tokenRequests int
+	mux.HandleFunc("/app/installations/42/access_tokens", func(w http.ResponseWriter, req *http.Request) {
+		tokenRequests++
+
+		assert.Equal(t, "POST", req.Method)
+		assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "Bearer "))
+
+		var claims jwt.StandardClaims
+		_, err := jwt.ParseWithClaims(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "), &claims, func(token *jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		})
+		if assert.NoError(t, err) {
+			assert.Equal(t, "1234", claims.Issuer)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":"ghs_installation%d","expires_at":%q}`, tokenRequests, time.Now().Add(time.Hour).Format(time.RFC3339))
+	})
+
+	mux.HandleFunc("/repos/user1/repo1/pulls/123", func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "token ghs_installation1", req.Header.Get("Authorization"))
+		w.Write([]byte(`{"title":"Test PR","number":123}`))
+	})
+
+	tokens, err := github.NewAppInstallationTokenSource("1234", "42", keyPEM, nil)
+	require.NoError(t, err)
+	tokens.BaseURL = baseURL
+
+	c := github.NewClientWithTokenSource(tokens, nil)
+	c.BaseURL = baseURL
+	c.SetCacheSize(0)
+
+	for i := 0; i < 3; i++ {
+		pr, err := c.GetPullRequest("user1/repo1", "123")
+		require.NoError(t, err)
+		assert.Equal(t, "Test PR", pr.Title)
+	}
+
+	assert.Equal(t, 1, tokenRequests)
+}
+
+func TestAppInstallationTokenSource_Token_RefreshesBeforeExpiry(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	_, keyPEM := generateAppPrivateKey(t)
+
+	var tokenRequests int
+	mux.HandleFunc("/app/installations/42/access_tokens", func(w http.ResponseWriter, req *http.Request) {
+		tokenRequests++
+
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":"ghs_installation%d","expires_at":%q}`, tokenRequests, time.Now().Add(time.Minute).Format(time.RFC3339))
+	})
+
+	tokens, err := github.NewAppInstallationTokenSource("1234", "42", keyPEM, nil)
+	require.NoError(t, err)
+	tokens.BaseURL = baseURL
+
+	token, err := tokens.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token ghs_installation1", token)
+
+	token, err = tokens.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token ghs_installation2", token)
+}
+
+func TestAppInstallationTokenSource_Token_Error(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	_, keyPEM := generateAppPrivateKey(t)
+
+	mux.HandleFunc("/app/installations/42/access_tokens", func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, `{"message":"A JSON web token could not be decoded"}`, http.StatusUnauthorized)
+	})
+
+	tokens, err := github.NewAppInstallationTokenSource("1234", "42", keyPEM, nil)
+	require.NoError(t, err)
+	tokens.BaseURL = baseURL
+
+	c := github.NewClientWithTokenSource(tokens, nil)
+	c.BaseURL = baseURL
+
+	_, err = c.GetPullRequest("user1/repo1", "123")
+	assert.Error(t, err)
+}
+
+func TestNewAppInstallationTokenSource_MalformedKey(t *testing.T) {
+	_, err := github.NewAppInstallationTokenSource("1234", "42", []byte("not a key"), nil)
+	assert.Error(t, err)
+}
+
+func generateAppPrivateKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	return key, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+}
@@ -1,66 +1,250 @@
 package github
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultTimeout limits the time the client waits for GitHub API response unless a custom *http.Client is used.
+	DefaultTimeout = 10 * time.Second
+	// DefaultCacheSize is the number of GitHub API responses kept by the client to revalidate them with
+	// conditional requests.
+	DefaultCacheSize = 512
 )
 
 type Client struct {
-	BaseURL string // to use in tests
+	BaseURL string // API URL, to use with GitHub Enterprise Server and in tests
+	WebURL  string // web interface URL to link pull requests to
 
-	authHeader string
-	client     *http.Client
+	tokens  TokenSource
+	client  *http.Client
+	cache   *lruCache
+	limiter *rateLimiter
 }
 
+// NewClient returns a client that authenticates with a personal access token. Requests are sent unauthenticated
+// if the token is empty.
 func NewClient(token string, client *http.Client) *Client {
-	c := &Client{
-		BaseURL: "https://api.github.com",
+	var tokens TokenSource
+	if token != "" {
+		tokens = staticToken("token " + token)
 	}
 
-	if token != "" {
-		c.authHeader = "token " + token
+	return NewClientWithTokenSource(tokens, client)
+}
+
+// NewClientWithTokenSource returns a client that uses tokens to authenticate requests, i.e. as a GitHub App
+// installation.
+func NewClientWithTokenSource(tokens TokenSource, client *http.Client) *Client {
+	c := &Client{
+		BaseURL: "https://api.github.com",
+		WebURL:  "https://github.com",
+		tokens:  tokens,
+		cache:   newLRUCache(DefaultCacheSize),
+		limiter: &rateLimiter{},
 	}
 
 	if client != nil {
 		c.client = client
 	} else {
-		c.client = http.DefaultClient
+		c.client = &http.Client{Timeout: DefaultTimeout}
 	}
 
 	return c
 }
 
+// SetCacheSize replaces response cache with the one that keeps up to n responses. Non-positive n disables caching.
+func (c *Client) SetCacheSize(n int) {
+	if n <= 0 {
+		c.cache = nil
+		return
+	}
+
+	c.cache = newLRUCache(n)
+}
+
+// RateLimit returns the state of GitHub API rate limit reported in the latest response. The second value is false
+// if there were no responses with rate limit headers so far.
+func (c *Client) RateLimit() (RateLimit, bool) {
+	return c.limiter.RateLimit()
+}
+
 func (c *Client) GetPullRequest(repo string, number string) (pr PullRequest, err error) {
-	url := c.BaseURL + "/repos/" + repo + "/pulls/" + number
-	req, err := http.NewRequest("GET", url, nil)
+	err = c.get("/repos/"+repo+"/pulls/"+number, &pr)
+	return pr, err
+}
+
+// GetCombinedStatus returns statuses reported for a commit. The ref can be either a commit SHA, a branch or a tag name.
+func (c *Client) GetCombinedStatus(repo, ref string) (CombinedStatus, error) {
+	var status CombinedStatus
+	err := c.get("/repos/"+repo+"/commits/"+ref+"/status", &status)
+
+	return status, err
+}
+
+// GetCheckRuns returns check runs reported for a commit. The ref can be either a commit SHA, a branch or a tag name.
+func (c *Client) GetCheckRuns(repo, ref string) ([]CheckRun, error) {
+	var v struct {
+		CheckRuns []CheckRun `json:"check_runs"`
+	}
+	err := c.get("/repos/"+repo+"/commits/"+ref+"/check-runs?per_page=100", &v)
+
+	return v.CheckRuns, err
+}
+
+// GetPullRequestChecks populates pr.Status and pr.CheckRuns with statuses and check runs reported for the head
+// commit of a pull request.
+func (c *Client) GetPullRequestChecks(repo string, pr *PullRequest) (err error) {
+	if pr.Status, err = c.GetCombinedStatus(repo, pr.Head.SHA); err != nil {
+		return err
+	}
+
+	if pr.CheckRuns, err = c.GetCheckRuns(repo, pr.Head.SHA); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CompareCommits returns commits between base and head refs. Refs can be commit SHAs, branch or tag names.
+func (c *Client) CompareCommits(repo, base, head string) (Comparison, error) {
+	var cmp Comparison
+	err := c.get("/repos/"+repo+"/compare/"+base+"..."+head+"?per_page=100", &cmp)
+
+	return cmp, err
+}
+
+// CreateDeployment creates a deployment of a commit, branch or tag.
+func (c *Client) CreateDeployment(repo string, d DeploymentRequest) (Deployment, error) {
+	var deployment Deployment
+	err := c.do("POST", "/repos/"+repo+"/deployments", d, &deployment)
+
+	return deployment, err
+}
+
+// CreateDeploymentStatus updates the status of a deployment.
+func (c *Client) CreateDeploymentStatus(repo string, deploymentID int64, st DeploymentStatusRequest) error {
+	return c.do("POST", "/repos/"+repo+"/deployments/"+strconv.FormatInt(deploymentID, 10)+"/statuses", st, nil)
+}
+
+// CreateIssueComment adds a comment to an issue or a pull request.
+func (c *Client) CreateIssueComment(repo, number, body string) error {
+	return c.do("POST", "/repos/"+repo+"/issues/"+number+"/comments", struct {
+		Body string `json:"body"`
+	}{body}, nil)
+}
+
+func (c *Client) get(path string, v interface{}) error {
+	return c.do("GET", path, nil, v)
+}
+
+// do sends a request with JSON-encoded payload to GitHub API and unmarshals the response into v unless it's nil.
+//
+// Responses to GET requests are cached and revalidated with If-None-Match header. When the rate limit is exceeded,
+// the client serves cached responses without revalidating them and returns RateLimitError for the rest.
+func (c *Client) do(method, path string, payload, v interface{}) error {
+	var (
+		cached    cacheEntry
+		hasCached bool
+	)
+	if method == "GET" && c.cache != nil {
+		cached, hasCached = c.cache.Get(path)
+	}
+
+	if err := c.limiter.Check(time.Now()); err != nil {
+		if hasCached {
+			metrics.Add("cache_stale_hits", 1)
+			return unmarshalResponse(cached.Body, v)
+		}
+
+		return err
+	}
+
+	var reqBody io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s %s request payload (%s)", method, path, err)
+		}
+
+		reqBody = bytes.NewReader(data)
+	}
+
+	url := c.BaseURL + path
+	req, err := http.NewRequest(method, url, reqBody)
 	if err != nil {
-		return pr, fmt.Errorf("failed to build a request to %s (%s)", url, err)
+		return fmt.Errorf("failed to build a request to %s (%s)", url, err)
+	}
+
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.tokens != nil {
+		authHeader, err := c.tokens.Token()
+		if err != nil {
+			return fmt.Errorf("failed to authenticate a request to %s (%s)", url, err)
+		}
+
+		req.Header.Set("Authorization", authHeader)
 	}
 
-	if c.authHeader != "" {
-		req.Header.Set("Authorization", c.authHeader)
+	if hasCached && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
 	}
 
+	metrics.Add("requests", 1)
+
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return pr, fmt.Errorf("request to %s failed (%s)", url, err)
+		return fmt.Errorf("request to %s failed (%s)", url, err)
 	}
 	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return pr, fmt.Errorf("failed to read %s response body (%s)", url, err)
+		return fmt.Errorf("failed to read %s response body (%s)", url, err)
+	}
+
+	if err := c.limiter.Update(resp, time.Now()); err != nil {
+		if hasCached {
+			metrics.Add("cache_stale_hits", 1)
+			return unmarshalResponse(cached.Body, v)
+		}
+
+		return err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && hasCached {
+		metrics.Add("cache_hits", 1)
+		return unmarshalResponse(cached.Body, v)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return pr, fmt.Errorf("got HTTP %d response from %s: %q", resp.StatusCode, url, body)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("got HTTP %d response from %s: %q", resp.StatusCode, url, body)
 	}
 
-	if err = json.Unmarshal(body, &pr); err != nil {
-		return pr, err
+	if method == "GET" && c.cache != nil {
+		metrics.Add("cache_misses", 1)
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			c.cache.Add(cacheEntry{Key: path, ETag: etag, Body: body})
+		}
+	}
+
+	return unmarshalResponse(body, v)
+}
+
+func unmarshalResponse(body []byte, v interface{}) error {
+	if v == nil {
+		return nil
 	}
 
-	return pr, nil
+	return json.Unmarshal(body, v)
 }
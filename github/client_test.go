@@ -1,6 +1,7 @@
 package github_test
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -76,6 +77,291 @@ func TestClientGetPullRequest_NoSuchRepository(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestClientGetPullRequest_State(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/repos/user1/repo1/pulls/123", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"number":123,"state":"closed","merged":true,"draft":false,"head":{"ref":"feature","sha":"abc123"}}`))
+	})
+
+	c := github.NewClient("", nil)
+	c.BaseURL = baseURL
+
+	pr, err := c.GetPullRequest("user1/repo1", "123")
+	require.NoError(t, err)
+
+	assert.Equal(t, "closed", pr.State)
+	assert.True(t, pr.Merged)
+	assert.False(t, pr.Draft)
+	assert.False(t, pr.Closed())
+	assert.Equal(t, "feature", pr.Head.Ref)
+	assert.Equal(t, "abc123", pr.Head.SHA)
+}
+
+func TestClientGetPullRequestChecks(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/repos/user1/repo1/commits/abc123/status", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"state":"failure","statuses":[
+			{"context":"ci/build","state":"success"},
+			{"context":"ci/lint","state":"error","description":"Lint failed","target_url":"https://ci.example.com/1"},
+			{"context":"ci/deploy","state":"pending"}
+		]}`))
+	})
+	mux.HandleFunc("/repos/user1/repo1/commits/abc123/check-runs", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"total_count":3,"check_runs":[
+			{"name":"test","status":"completed","conclusion":"failure","html_url":"https://github.com/user1/repo1/runs/1"},
+			{"name":"vet","status":"completed","conclusion":"success"},
+			{"name":"e2e","status":"in_progress"}
+		]}`))
+	})
+
+	c := github.NewClient("", nil)
+	c.BaseURL = baseURL
+
+	var pr github.PullRequest
+	pr.Head.SHA = "abc123"
+
+	require.NoError(t, c.GetPullRequestChecks("user1/repo1", &pr))
+
+	assert.Equal(t, "failure", pr.Status.State)
+	if assert.Len(t, pr.Status.Statuses, 3) {
+		assert.Equal(t, github.CommitStatus{Context: "ci/lint", State: "error", Description: "Lint failed", URL: "https://ci.example.com/1"}, pr.Status.Statuses[1])
+	}
+
+	if assert.Len(t, pr.CheckRuns, 3) {
+		assert.Equal(t, github.CheckRun{Name: "test", Status: "completed", Conclusion: "failure", URL: "https://github.com/user1/repo1/runs/1"}, pr.CheckRuns[0])
+	}
+
+	assert.Equal(t, 2, pr.FailingChecks())
+	assert.Equal(t, 2, pr.PendingChecks())
+}
+
+func TestClientGetPullRequestChecks_Error(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/repos/user1/repo1/commits/abc123/status", func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	})
+
+	c := github.NewClient("", nil)
+	c.BaseURL = baseURL
+
+	var pr github.PullRequest
+	pr.Head.SHA = "abc123"
+
+	assert.Error(t, c.GetPullRequestChecks("user1/repo1", &pr))
+}
+
+func TestClientCreateDeployment(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/repos/user1/repo1/deployments", func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "POST", req.Method)
+		assert.Equal(t, "token abc123", req.Header.Get("Authorization"))
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+
+		var payload map[string]interface{}
+		if assert.NoError(t, json.NewDecoder(req.Body).Decode(&payload)) {
+			assert.Equal(t, map[string]interface{}{
+				"ref":               "abc123",
+				"environment":       "production",
+				"description":       "Deploy",
+				"auto_merge":        false,
+				"required_contexts": []interface{}{},
+			}, payload)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":42,"sha":"abc123","ref":"abc123","environment":"production","url":"https://api.github.com/repos/user1/repo1/deployments/42"}`))
+	})
+
+	c := github.NewClient("abc123", nil)
+	c.BaseURL = baseURL
+
+	deployment, err := c.CreateDeployment("user1/repo1", github.DeploymentRequest{
+		Ref:              "abc123",
+		Environment:      "production",
+		Description:      "Deploy",
+		RequiredContexts: []string{},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(42), deployment.ID)
+	assert.Equal(t, "abc123", deployment.SHA)
+	assert.Equal(t, "production", deployment.Environment)
+}
+
+func TestClientCreateDeploymentStatus(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	var payload map[string]interface{}
+	mux.HandleFunc("/repos/user1/repo1/deployments/42/statuses", func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "POST", req.Method)
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1,"state":"success"}`))
+	})
+
+	c := github.NewClient("", nil)
+	c.BaseURL = baseURL
+
+	require.NoError(t, c.CreateDeploymentStatus("user1/repo1", 42, github.DeploymentStatusRequest{
+		State:  "success",
+		LogURL: "https://deploy.example.com/C1",
+	}))
+	assert.Equal(t, map[string]interface{}{"state": "success", "log_url": "https://deploy.example.com/C1"}, payload)
+}
+
+func TestClientCreateIssueComment(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	var payload map[string]interface{}
+	mux.HandleFunc("/repos/user1/repo1/issues/123/comments", func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "POST", req.Method)
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	})
+
+	c := github.NewClient("", nil)
+	c.BaseURL = baseURL
+
+	require.NoError(t, c.CreateIssueComment("user1/repo1", "123", "Deployed"))
+	assert.Equal(t, map[string]interface{}{"body": "Deployed"}, payload)
+}
+
+func TestClientCreateIssueComment_Forbidden(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/repos/user1/repo1/issues/123/comments", func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, `{"message":"Resource not accessible by integration"}`, http.StatusForbidden)
+	})
+
+	c := github.NewClient("", nil)
+	c.BaseURL = baseURL
+
+	assert.Error(t, c.CreateIssueComment("user1/repo1", "123", "Deployed"))
+}
+
+func TestClientCompareCommits(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/repos/user1/repo1/compare/v1.2...v1.3", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{
+			"html_url": "https://github.com/user1/repo1/compare/v1.2...v1.3",
+			"status": "ahead",
+			"total_commits": 3,
+			"commits": [
+				{"sha": "7fd1a60b01f91b314f59955a4e4d4e80d8edf11d", "html_url": "https://github.com/user1/repo1/commit/7fd1a60b01f91b314f59955a4e4d4e80d8edf11d", "commit": {"message": "Fix typo", "author": {"name": "Author One"}}, "author": {"login": "author1"}},
+				{"sha": "553c2077f0edc3d5dc5d17262f6aa498e69d6f8e", "commit": {"message": "Merge pull request #12 from user1/feature\n\nAdd feature", "author": {"name": "Author Two"}}, "author": null},
+				{"sha": "762941318ee16e59dabbacb1b4049eec22f0d303", "commit": {"message": "Update docs (#13)\n\n* Update README", "author": {"name": "Author One"}}, "author": {"login": "author1"}}
+			]
+		}`))
+	})
+
+	c := github.NewClient("", nil)
+	c.BaseURL = baseURL
+
+	cmp, err := c.CompareCommits("user1/repo1", "v1.2", "v1.3")
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://github.com/user1/repo1/compare/v1.2...v1.3", cmp.URL)
+	assert.Equal(t, 3, cmp.TotalCommits)
+	require.Len(t, cmp.Commits, 3)
+
+	assert.Equal(t, "Fix typo", cmp.Commits[0].Title())
+	assert.Equal(t, "author1", cmp.Commits[0].AuthorName())
+	_, ok := cmp.Commits[0].PullRequestNumber()
+	assert.False(t, ok)
+
+	assert.Equal(t, "Add feature", cmp.Commits[1].Title())
+	assert.Equal(t, "Author Two", cmp.Commits[1].AuthorName())
+	if n, ok := cmp.Commits[1].PullRequestNumber(); assert.True(t, ok) {
+		assert.Equal(t, 12, n)
+	}
+
+	assert.Equal(t, "Update docs (#13)", cmp.Commits[2].Title())
+	if n, ok := cmp.Commits[2].PullRequestNumber(); assert.True(t, ok) {
+		assert.Equal(t, 13, n)
+	}
+}
+
+func TestClientGetPullRequest_ConditionalRequest(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	var requests, notModified int
+	mux.HandleFunc("/repos/user1/repo1/pulls/123", func(w http.ResponseWriter, req *http.Request) {
+		requests++
+
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"title":"Test PR","number":123}`))
+	})
+
+	c := github.NewClient("", nil)
+	c.BaseURL = baseURL
+
+	for i := 0; i < 3; i++ {
+		pr, err := c.GetPullRequest("user1/repo1", "123")
+		require.NoError(t, err)
+
+		assert.Equal(t, "Test PR", pr.Title)
+		assert.Equal(t, 123, pr.Number)
+	}
+
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, 2, notModified)
+}
+
+func TestClientGetPullRequest_CacheEviction(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	var notModified int
+	mux.HandleFunc("/repos/user1/repo1/pulls/", func(w http.ResponseWriter, req *http.Request) {
+		etag := `"` + req.URL.Path + `"`
+		if req.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(`{"title":"Test PR"}`))
+	})
+
+	c := github.NewClient("", nil)
+	c.BaseURL = baseURL
+	c.SetCacheSize(1)
+
+	for _, number := range [...]string{"1", "2", "1"} {
+		_, err := c.GetPullRequest("user1/repo1", number)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 0, notModified, "expected the least recently used response to be evicted")
+
+	_, err := c.GetPullRequest("user1/repo1", "1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, notModified)
+}
+
 func setup() (baseURL string, mux *http.ServeMux, teardownFn func()) {
 	mux = http.NewServeMux()
 	server := httptest.NewServer(mux)
@@ -0,0 +1,86 @@
+package github
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Default messages of merge commits and squashed pull requests
+	mergeCommitRegex  = regexp.MustCompile(`^Merge pull request #(\d+) from `)
+	squashCommitRegex = regexp.MustCompile(`\(#(\d+)\)$`)
+)
+
+// Comparison is the list of commits between two refs.
+type Comparison struct {
+	URL string `json:"html_url"`
+	// Status is either "ahead", "behind", "identical" or "diverged"
+	Status string `json:"status"`
+	// TotalCommits is the number of commits in range, which may be greater than the number of returned commits
+	TotalCommits int      `json:"total_commits"`
+	Commits      []Commit `json:"commits"`
+}
+
+// Commit is a commit returned by GitHub API.
+type Commit struct {
+	SHA    string `json:"sha"`
+	URL    string `json:"html_url"`
+	Commit struct {
+		Message string `json:"message"`
+		Author  struct {
+			Name string `json:"name"`
+		} `json:"author"`
+	} `json:"commit"`
+	// Author is the GitHub user the commit is attributed to. It's empty if the commit author email
+	// does not belong to any GitHub account.
+	Author struct {
+		Name string `json:"login"`
+	} `json:"author"`
+}
+
+// Title returns the first line of commit message. For merge commits the title of merged pull request is
+// returned instead.
+func (c Commit) Title() string {
+	lines := strings.Split(strings.TrimSpace(c.Commit.Message), "\n")
+	if mergeCommitRegex.MatchString(lines[0]) {
+		for _, line := range lines[1:] {
+			if line = strings.TrimSpace(line); line != "" {
+				return line
+			}
+		}
+	}
+
+	return strings.TrimSpace(lines[0])
+}
+
+// AuthorName returns the GitHub login of commit author falling back to the name from commit metadata.
+func (c Commit) AuthorName() string {
+	if c.Author.Name != "" {
+		return c.Author.Name
+	}
+
+	return c.Commit.Author.Name
+}
+
+// PullRequestNumber returns the number of pull request merged by this commit. The second value is false if
+// the commit message does not look like the default message of a merge commit or a squashed pull request.
+func (c Commit) PullRequestNumber() (int, bool) {
+	title := strings.TrimSpace(strings.SplitN(c.Commit.Message, "\n", 2)[0])
+
+	m := mergeCommitRegex.FindStringSubmatch(title)
+	if m == nil {
+		m = squashCommitRegex.FindStringSubmatch(title)
+	}
+
+	if m == nil {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+
+	return n, true
+}
@@ -0,0 +1,31 @@
+package github
+
+// DeploymentRequest describes a deployment to create.
+type DeploymentRequest struct {
+	// Ref is either a commit SHA, a branch or a tag name
+	Ref         string `json:"ref"`
+	Environment string `json:"environment,omitempty"`
+	Description string `json:"description,omitempty"`
+	// AutoMerge makes GitHub merge the default branch into the ref before creating a deployment
+	AutoMerge bool `json:"auto_merge"`
+	// RequiredContexts lists the commit status contexts that are verified before creating a deployment,
+	// an empty slice bypasses the checks
+	RequiredContexts []string `json:"required_contexts"`
+}
+
+// Deployment is a request to deploy a specific ref.
+type Deployment struct {
+	ID          int64  `json:"id"`
+	SHA         string `json:"sha"`
+	Ref         string `json:"ref"`
+	Environment string `json:"environment"`
+	URL         string `json:"url"`
+}
+
+// DeploymentStatusRequest describes a deployment status to create.
+type DeploymentStatusRequest struct {
+	// State is either "error", "failure", "inactive", "in_progress", "queued", "pending" or "success"
+	State       string `json:"state"`
+	Description string `json:"description,omitempty"`
+	LogURL      string `json:"log_url,omitempty"`
+}
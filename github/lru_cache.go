@@ -0,0 +1,67 @@
+package github
+
+import (
+	"container/list"
+	"sync"
+)
+
+type cacheEntry struct {
+	Key  string
+	ETag string
+	Body []byte
+}
+
+// lruCache keeps a limited number of GitHub API responses evicting the least recently used ones.
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *lruCache) Get(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	c.ll.MoveToFront(el)
+
+	return el.Value.(cacheEntry), true
+}
+
+func (c *lruCache) Add(entry cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[entry.Key]; ok {
+		el.Value = entry
+		c.ll.MoveToFront(el)
+
+		return
+	}
+
+	c.items[entry.Key] = c.ll.PushFront(entry)
+	for c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(cacheEntry).Key)
+	}
+}
+
+func (c *lruCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
@@ -8,4 +8,102 @@ type PullRequest struct {
 	Author struct {
 		Name string `json:"login"`
 	} `json:"user"`
+	// State is either "open" or "closed"
+	State  string `json:"state"`
+	Merged bool   `json:"merged"`
+	Draft  bool   `json:"draft"`
+	Head   struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"head"`
+	Labels []Label `json:"labels"`
+
+	// Status and CheckRuns are populated by Client.GetPullRequestChecks
+	Status    CombinedStatus `json:"-"`
+	CheckRuns []CheckRun     `json:"-"`
+}
+
+type Label struct {
+	Name string `json:"name"`
+}
+
+// Closed returns true if the pull request has been closed without being merged.
+func (pr PullRequest) Closed() bool {
+	return pr.State == "closed" && !pr.Merged
+}
+
+// FailingChecks returns the number of commit statuses and check runs that have failed for the head commit.
+func (pr PullRequest) FailingChecks() int {
+	var n int
+	for _, st := range pr.Status.Statuses {
+		if st.Failed() {
+			n++
+		}
+	}
+
+	for _, run := range pr.CheckRuns {
+		if run.Failed() {
+			n++
+		}
+	}
+
+	return n
+}
+
+// PendingChecks returns the number of commit statuses and check runs that have not completed yet for the head commit.
+func (pr PullRequest) PendingChecks() int {
+	var n int
+	for _, st := range pr.Status.Statuses {
+		if st.State == "pending" {
+			n++
+		}
+	}
+
+	for _, run := range pr.CheckRuns {
+		if run.Status != "completed" {
+			n++
+		}
+	}
+
+	return n
+}
+
+// CombinedStatus is the combination of statuses reported for a commit by external services.
+type CombinedStatus struct {
+	// State is either "success", "pending" or "failure"
+	State    string         `json:"state"`
+	Statuses []CommitStatus `json:"statuses"`
+}
+
+// CommitStatus is the status reported for a commit by an external service.
+type CommitStatus struct {
+	Context     string `json:"context"`
+	State       string `json:"state"`
+	Description string `json:"description"`
+	URL         string `json:"target_url"`
+}
+
+// Failed returns true if the status is either "failure" or "error".
+func (st CommitStatus) Failed() bool {
+	return st.State == "failure" || st.State == "error"
+}
+
+// CheckRun is the result of a check performed by a GitHub App for a commit.
+type CheckRun struct {
+	Name string `json:"name"`
+	// Status is either "queued", "in_progress" or "completed"
+	Status string `json:"status"`
+	// Conclusion is only set for completed check runs
+	Conclusion string `json:"conclusion"`
+	URL        string `json:"html_url"`
+}
+
+// Failed returns true if the check run has completed unsuccessfully.
+func (run CheckRun) Failed() bool {
+	switch run.Conclusion {
+	case "failure", "timed_out", "cancelled", "action_required":
+		return true
+	default:
+		return false
+	}
 }
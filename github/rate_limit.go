@@ -0,0 +1,110 @@
+package github
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// metrics are published via expvar under "github" key.
+var metrics = expvar.NewMap("github")
+
+// RateLimit is the state of GitHub API rate limit as reported in the latest response.
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// RateLimitError is returned when GitHub API rate limit has been exceeded and the client backs off
+// until Reset.
+type RateLimitError struct {
+	Reset time.Time
+}
+
+func (e RateLimitError) Error() string {
+	return fmt.Sprintf("GitHub API rate limit exceeded, retry after %s", e.Reset.Format(time.RFC3339))
+}
+
+type rateLimiter struct {
+	mu         sync.Mutex
+	limit      RateLimit
+	known      bool
+	retryAfter time.Time
+}
+
+// Check returns an error if the client needs to back off until the rate limit is reset.
+func (l *rateLimiter) Check(now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Before(l.retryAfter) {
+		return RateLimitError{Reset: l.retryAfter}
+	}
+
+	if l.known && l.limit.Remaining <= 0 && now.Before(l.limit.Reset) {
+		return RateLimitError{Reset: l.limit.Reset}
+	}
+
+	return nil
+}
+
+// Update reads rate limit headers of a response and returns an error if the request has been rate limited.
+func (l *rateLimiter) Update(resp *http.Response, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		limit, _ := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+		reset, _ := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+
+		if remaining == 0 && (!l.known || l.limit.Remaining > 0) {
+			log.Printf("GitHub API rate limit of %d requests exhausted, backing off until %s", limit, time.Unix(reset, 0).UTC().Format(time.RFC3339))
+		}
+
+		l.limit = RateLimit{Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}
+		l.known = true
+
+		metrics.Set("rate_limit_limit", expvarInt(int64(limit)))
+		metrics.Set("rate_limit_remaining", expvarInt(int64(remaining)))
+		metrics.Set("rate_limit_reset", expvarInt(reset))
+	}
+
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+
+	// secondary rate limits are reported with Retry-After header
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		l.retryAfter = now.Add(time.Duration(secs) * time.Second)
+		log.Printf("GitHub API secondary rate limit exceeded, backing off until %s", l.retryAfter.UTC().Format(time.RFC3339))
+		metrics.Add("secondary_rate_limits", 1)
+
+		return RateLimitError{Reset: l.retryAfter}
+	}
+
+	if l.known && l.limit.Remaining <= 0 {
+		return RateLimitError{Reset: l.limit.Reset}
+	}
+
+	return nil
+}
+
+// RateLimit returns the state of rate limit reported by GitHub in the latest response.
+func (l *rateLimiter) RateLimit() (RateLimit, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limit, l.known
+}
+
+func expvarInt(n int64) *expvar.Int {
+	v := new(expvar.Int)
+	v.Set(n)
+
+	return v
+}
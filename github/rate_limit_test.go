@@ -0,0 +1,92 @@
+package github_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_RateLimit(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	var requests int
+	mux.HandleFunc("/repos/user1/repo1/pulls/", func(w http.ResponseWriter, req *http.Request) {
+		requests++
+
+		w.Header().Set("X-RateLimit-Limit", "60")
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(2-requests))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+		if req.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", `"`+req.URL.Path+`"`)
+		w.Write([]byte(`{"title":"Test PR"}`))
+	})
+
+	c := github.NewClient("", nil)
+	c.BaseURL = baseURL
+
+	_, ok := c.RateLimit()
+	assert.False(t, ok)
+
+	_, err := c.GetPullRequest("user1/repo1", "1")
+	require.NoError(t, err)
+
+	limit, ok := c.RateLimit()
+	require.True(t, ok)
+	assert.Equal(t, github.RateLimit{Limit: 60, Remaining: 1, Reset: reset}, limit)
+
+	_, err = c.GetPullRequest("user1/repo1", "2")
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+
+	// the rate limit is exhausted, so the client is expected to serve cached responses without revalidating them
+	pr, err := c.GetPullRequest("user1/repo1", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "Test PR", pr.Title)
+
+	_, err = c.GetPullRequest("user1/repo1", "3")
+	if assert.Error(t, err) {
+		assert.Equal(t, github.RateLimitError{Reset: reset}, err)
+	}
+
+	assert.Equal(t, 2, requests)
+}
+
+func TestClient_SecondaryRateLimit(t *testing.T) {
+	baseURL, mux, teardown := setup()
+	defer teardown()
+
+	var requests int
+	mux.HandleFunc("/repos/user1/repo1/pulls/1", func(w http.ResponseWriter, req *http.Request) {
+		requests++
+
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, `{"message":"You have exceeded a secondary rate limit"}`, http.StatusForbidden)
+	})
+
+	c := github.NewClient("", nil)
+	c.BaseURL = baseURL
+
+	_, err := c.GetPullRequest("user1/repo1", "1")
+	if assert.Error(t, err) {
+		require.IsType(t, github.RateLimitError{}, err)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), err.(github.RateLimitError).Reset, 5*time.Second)
+	}
+
+	_, err = c.GetPullRequest("user1/repo1", "1")
+	assert.IsType(t, github.RateLimitError{}, err)
+
+	assert.Equal(t, 1, requests, "expected client to back off")
+}
@@ -0,0 +1,83 @@
+// Package gitlab provides a minimal GitLab REST API client and a deploy reference provider for merge requests.
+package gitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultTimeout limits the time the client waits for GitLab API response unless a custom *http.Client is used.
+const DefaultTimeout = 10 * time.Second
+
+type Client struct {
+	BaseURL string // API URL, to use with self-managed GitLab and in tests
+	WebURL  string // web interface URL to link merge requests to
+
+	token  string
+	client *http.Client
+}
+
+// NewClient returns a client that authenticates with a personal, group or project access token. Requests are sent
+// unauthenticated if the token is empty.
+func NewClient(token string, client *http.Client) *Client {
+	c := &Client{
+		BaseURL: "https://gitlab.com/api/v4",
+		WebURL:  "https://gitlab.com",
+		token:   token,
+	}
+
+	if client != nil {
+		c.client = client
+	} else {
+		c.client = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	return c
+}
+
+// GetMergeRequest returns a merge request by its project-level ID. The project is the full path of a project,
+// i.e. group/subgroup/project.
+func (c *Client) GetMergeRequest(project, iid string) (MergeRequest, error) {
+	var mr MergeRequest
+	err := c.get("/projects/"+url.QueryEscape(project)+"/merge_requests/"+iid, &mr)
+
+	return mr, err
+}
+
+// MergeRequestURL returns the link to a merge request in GitLab web interface.
+func (c *Client) MergeRequestURL(project, iid string) string {
+	return c.WebURL + "/" + project + "/-/merge_requests/" + iid
+}
+
+func (c *Client) get(path string, v interface{}) error {
+	url := c.BaseURL + path
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build a request to %s (%s)", url, err)
+	}
+
+	if c.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed (%s)", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s response body (%s)", url, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got HTTP %d response from %s: %q", resp.StatusCode, url, body)
+	}
+
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,24 @@
+package gitlab
+
+type MergeRequest struct {
+	IID         int    `json:"iid"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"web_url"`
+	// State is either "opened", "closed", "locked" or "merged"
+	State  string `json:"state"`
+	Draft  bool   `json:"draft"`
+	Author struct {
+		Name string `json:"username"`
+	} `json:"author"`
+}
+
+// Merged returns true if the merge request has been merged.
+func (mr MergeRequest) Merged() bool {
+	return mr.State == "merged"
+}
+
+// Closed returns true if the merge request has been closed without being merged.
+func (mr MergeRequest) Closed() bool {
+	return mr.State == "closed"
+}
@@ -0,0 +1,110 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/slack"
+)
+
+// ReferenceProviderName is the name of GitLab reference provider used as a prefix of its index keys.
+const ReferenceProviderName = "gitlab"
+
+// ReferenceProvider recognizes GitLab merge requests mentioned in deploy subjects either as group/project!12
+// or as a link to GitLab.
+type ReferenceProvider struct {
+	client  *Client
+	regexes []*regexp.Regexp
+}
+
+// NewReferenceProvider returns a provider that recognizes merge requests hosted on client.WebURL.
+func NewReferenceProvider(client *Client) *ReferenceProvider {
+	host := client.WebURL
+	if u, err := url.Parse(client.WebURL); err == nil && u.Host != "" {
+		host = u.Host + strings.TrimRight(u.Path, "/")
+	}
+
+	return &ReferenceProvider{
+		client: client,
+		regexes: []*regexp.Regexp{
+			regexp.MustCompile("^(?P<project>[A-Za-z0-9\\._-]+(?:/[A-Za-z0-9\\._-]+)+)!(?P<iid>\\d+)[^A-Za-z0-9]?$"),                                      // group/project!12
+			regexp.MustCompile("^<?https?://" + regexp.QuoteMeta(host) + "/(?P<project>[^\\s\\?#>]+?)(?:/-)?/merge_requests/(?P<iid>\\d+)(?:[/\\?#>]|$)"), // https://gitlab.com/group/project/-/merge_requests/12
+		},
+	}
+}
+
+func (p *ReferenceProvider) Name() string {
+	return ReferenceProviderName
+}
+
+// FindReferences returns merge requests mentioned in s. Reference IDs are formatted as group/project!12.
+func (p *ReferenceProvider) FindReferences(s string) []deploy.Reference {
+	var refs []deploy.Reference
+	deploy.MatchReferences(s, p.regexes, func(matches map[string]string) {
+		project, iid := matches["project"], matches["iid"]
+		refs = append(refs, deploy.Reference{
+			Provider: ReferenceProviderName,
+			ID:       project + "!" + iid,
+			URL:      p.client.MergeRequestURL(project, iid),
+		})
+	})
+
+	return refs
+}
+
+func (p *ReferenceProvider) Resolve(ref deploy.Reference) (deploy.ReferenceDetails, error) {
+	n := strings.LastIndex(ref.ID, "!")
+	if n < 0 {
+		return deploy.ReferenceDetails{}, fmt.Errorf("malformed merge request reference %q", ref.ID)
+	}
+
+	mr, err := p.client.GetMergeRequest(ref.ID[:n], ref.ID[n+1:])
+	if err != nil {
+		return deploy.ReferenceDetails{}, err
+	}
+
+	details := deploy.ReferenceDetails{
+		Title:       mr.Title,
+		Description: mr.Description,
+		Author:      mr.Author.Name,
+		State:       mr.State,
+		Done:        mr.Merged(),
+		URL:         mr.URL,
+	}
+
+	if mr.Draft && !mr.Merged() && !mr.Closed() {
+		details.State = "draft"
+	}
+
+	if details.URL == "" {
+		details.URL = ref.URL
+	}
+
+	return details, nil
+}
+
+// Attachment renders a merge request the same way as GitHub pull requests are rendered in deploy announcement
+// converting its Markdown description into Slack mrkdwn.
+func (p *ReferenceProvider) Attachment(ref deploy.Reference, details deploy.ReferenceDetails) slack.Attachment {
+	attachment := slack.Attachment{
+		AuthorName: details.Author,
+		Title:      "MR " + ref.ID[strings.LastIndex(ref.ID, "!"):] + ": " + slack.EscapeMessage(details.Title),
+		TitleLink:  details.URL,
+		Text:       slack.ConvertMarkdown(details.Description),
+		Markdown:   true,
+	}
+
+	switch {
+	case details.Done:
+		attachment.Color = "good"
+	case details.State == "closed":
+		attachment.Color = "danger"
+	case details.State == "draft":
+		attachment.Color = "warning"
+	}
+
+	return attachment
+}
@@ -0,0 +1,93 @@
+package gitlab_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/gitlab"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReferenceProvider_FindReferences(t *testing.T) {
+	p := gitlab.NewReferenceProvider(gitlab.NewClient("", nil))
+
+	s := "group/project!12 group/sub/project!3, project!4 group/project!5a group/project#6 " +
+		"https://gitlab.com/group/project/-/merge_requests/7/diffs <https://gitlab.com/group/project/merge_requests/8> " +
+		"https://gitlab.example.com/group/project/-/merge_requests/9"
+
+	assert.Equal(t, []deploy.Reference{
+		{Provider: "gitlab", ID: "group/project!12", URL: "https://gitlab.com/group/project/-/merge_requests/12"},
+		{Provider: "gitlab", ID: "group/sub/project!3", URL: "https://gitlab.com/group/sub/project/-/merge_requests/3"},
+		{Provider: "gitlab", ID: "group/project!7", URL: "https://gitlab.com/group/project/-/merge_requests/7"},
+		{Provider: "gitlab", ID: "group/project!8", URL: "https://gitlab.com/group/project/-/merge_requests/8"},
+	}, p.FindReferences(s))
+}
+
+func TestReferenceProvider_Resolve(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/projects/", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("PRIVATE-TOKEN") != "secret" {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		switch req.URL.EscapedPath() {
+		case "/api/v4/projects/group%2Fproject/merge_requests/12":
+			w.Write([]byte(`{
+				"iid": 12,
+				"title": "Add feature",
+				"description": "MR description",
+				"state": "merged",
+				"web_url": "https://gitlab.example.com/group/project/-/merge_requests/12",
+				"author": {"username": "author1"}
+			}`))
+		case "/api/v4/projects/group%2Fproject/merge_requests/13":
+			w.Write([]byte(`{"iid": 13, "title": "Work in progress", "state": "opened", "draft": true, "author": {"username": "author2"}}`))
+		default:
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		}
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := gitlab.NewClient("secret", nil)
+	client.BaseURL, client.WebURL = srv.URL+"/api/v4", "https://gitlab.example.com"
+
+	p := gitlab.NewReferenceProvider(client)
+
+	refs := p.FindReferences("https://gitlab.example.com/group/project/-/merge_requests/12 group/project!13 group/project!14")
+	require.Len(t, refs, 3)
+
+	details, err := p.Resolve(refs[0])
+	require.NoError(t, err)
+
+	assert.Equal(t, deploy.ReferenceDetails{
+		Title:       "Add feature",
+		Description: "MR description",
+		Author:      "author1",
+		State:       "merged",
+		Done:        true,
+		URL:         "https://gitlab.example.com/group/project/-/merge_requests/12",
+	}, details)
+
+	attachment := p.Attachment(refs[0], details)
+	assert.Equal(t, "MR !12: Add feature", attachment.Title)
+	assert.Equal(t, "https://gitlab.example.com/group/project/-/merge_requests/12", attachment.TitleLink)
+	assert.Equal(t, "author1", attachment.AuthorName)
+	assert.Equal(t, "MR description", attachment.Text)
+	assert.Equal(t, "good", attachment.Color)
+
+	details, err = p.Resolve(refs[1])
+	require.NoError(t, err)
+
+	assert.Equal(t, "draft", details.State)
+	assert.Equal(t, "https://gitlab.example.com/group/project/-/merge_requests/13", details.URL)
+	assert.Equal(t, "warning", p.Attachment(refs[1], details).Color)
+
+	_, err = p.Resolve(refs[2])
+	assert.Error(t, err)
+}
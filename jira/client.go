@@ -0,0 +1,88 @@
+// Package jira provides a minimal Jira REST API client and a deploy reference provider for Jira issue keys.
+package jira
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout limits the time the client waits for Jira API response unless a custom *http.Client is used.
+const DefaultTimeout = 10 * time.Second
+
+type Client struct {
+	BaseURL string // Jira URL, i.e. https://example.atlassian.net
+
+	user, token string
+	client      *http.Client
+}
+
+// NewClient returns a client for Jira installation at baseURL. Requests are authenticated with basic auth if user
+// is not empty, i.e. with an Atlassian account email and API token, or with a personal access token otherwise.
+// Requests are sent unauthenticated if the token is empty.
+func NewClient(baseURL, user, token string, client *http.Client) *Client {
+	c := &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		user:    user,
+		token:   token,
+	}
+
+	if client != nil {
+		c.client = client
+	} else {
+		c.client = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	return c
+}
+
+// GetIssue returns the issue with given key, i.e. OPS-1234.
+func (c *Client) GetIssue(key string) (Issue, error) {
+	var issue Issue
+	err := c.get("/rest/api/2/issue/"+url.PathEscape(key)+"?fields=summary,description,status,assignee", &issue)
+
+	return issue, err
+}
+
+// IssueURL returns the link to issue in Jira web interface.
+func (c *Client) IssueURL(key string) string {
+	return c.BaseURL + "/browse/" + key
+}
+
+func (c *Client) get(path string, v interface{}) error {
+	url := c.BaseURL + path
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build a request to %s (%s)", url, err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	switch {
+	case c.user != "":
+		req.SetBasicAuth(c.user, c.token)
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed (%s)", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s response body (%s)", url, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got HTTP %d response from %s: %q", resp.StatusCode, url, body)
+	}
+
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,25 @@
+package jira
+
+type Issue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary     string `json:"summary"`
+		Description string `json:"description"`
+		Status      struct {
+			Name     string `json:"name"`
+			Category struct {
+				// Key is either "new", "indeterminate" or "done"
+				Key string `json:"key"`
+			} `json:"statusCategory"`
+		} `json:"status"`
+		// Assignee is nil for unassigned issues
+		Assignee *struct {
+			Name string `json:"displayName"`
+		} `json:"assignee"`
+	} `json:"fields"`
+}
+
+// Done returns true if the issue is in one of the statuses that belong to "Done" category, i.e. resolved or closed.
+func (issue Issue) Done() bool {
+	return issue.Fields.Status.Category.Key == "done"
+}
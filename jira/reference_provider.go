@@ -0,0 +1,104 @@
+package jira
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/slack"
+)
+
+// ReferenceProviderName is the name of Jira reference provider used as a prefix of its index keys.
+const ReferenceProviderName = "jira"
+
+// anyProjectKey matches keys of issues in any project. Unlike the listed project keys, it's case-sensitive to avoid
+// mistaking words like utf-8 for issue keys.
+const anyProjectKey = "[A-Z][A-Z0-9_]+"
+
+// ReferenceProvider recognizes Jira issue keys and links to issues in deploy subjects.
+type ReferenceProvider struct {
+	client  *Client
+	regexes []*regexp.Regexp
+}
+
+// NewReferenceProvider returns a provider that recognizes keys of issues in given projects, i.e. OPS-1234 for OPS
+// project, and links to them in Jira. Keys of issues in any project are recognized if no projects are given.
+func NewReferenceProvider(client *Client, projects []string) *ReferenceProvider {
+	key := anyProjectKey
+	if len(projects) > 0 {
+		quoted := make([]string, len(projects))
+		for i, project := range projects {
+			quoted[i] = regexp.QuoteMeta(project)
+		}
+
+		key = "(?i:" + strings.Join(quoted, "|") + ")"
+	}
+	key = "(?P<key>" + key + "-\\d+)"
+
+	host := client.BaseURL
+	if u, err := url.Parse(client.BaseURL); err == nil && u.Host != "" {
+		host = u.Host + u.Path
+	}
+
+	return &ReferenceProvider{
+		client: client,
+		regexes: []*regexp.Regexp{
+			regexp.MustCompile("^" + key + "[^A-Za-z0-9]?$"),                                                 // OPS-1234
+			regexp.MustCompile("^<?https?://" + regexp.QuoteMeta(host) + "/browse/" + key + "(?:[\\?#>]|$)"), // https://example.atlassian.net/browse/OPS-1234
+		},
+	}
+}
+
+func (p *ReferenceProvider) Name() string {
+	return ReferenceProviderName
+}
+
+// FindReferences returns Jira issues mentioned in s. Issue keys are converted to upper case.
+func (p *ReferenceProvider) FindReferences(s string) []deploy.Reference {
+	var refs []deploy.Reference
+	deploy.MatchReferences(s, p.regexes, func(matches map[string]string) {
+		key := strings.ToUpper(matches["key"])
+		refs = append(refs, deploy.Reference{Provider: ReferenceProviderName, ID: key, URL: p.client.IssueURL(key)})
+	})
+
+	return refs
+}
+
+func (p *ReferenceProvider) Resolve(ref deploy.Reference) (deploy.ReferenceDetails, error) {
+	issue, err := p.client.GetIssue(ref.ID)
+	if err != nil {
+		return deploy.ReferenceDetails{}, err
+	}
+
+	details := deploy.ReferenceDetails{
+		Title:       issue.Fields.Summary,
+		Description: issue.Fields.Description,
+		State:       issue.Fields.Status.Name,
+		Done:        issue.Done(),
+		URL:         p.client.IssueURL(issue.Key),
+	}
+
+	if issue.Fields.Assignee != nil {
+		details.Author = issue.Fields.Assignee.Name
+	}
+
+	return details, nil
+}
+
+// Attachment renders a Jira issue along with its status and assignee. Issue description is omitted, since it's
+// written in Jira markup and tends to be too long for a deploy announcement.
+func (p *ReferenceProvider) Attachment(ref deploy.Reference, details deploy.ReferenceDetails) slack.Attachment {
+	attachment := slack.Attachment{
+		AuthorName: details.Author,
+		Title:      ref.ID + ": " + slack.EscapeMessage(details.Title),
+		TitleLink:  details.URL,
+		Text:       details.State,
+	}
+
+	if details.Done {
+		attachment.Color = "good"
+	}
+
+	return attachment
+}
@@ -0,0 +1,112 @@
+package jira_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/jira"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReferenceProvider_FindReferences(t *testing.T) {
+	p := jira.NewReferenceProvider(jira.NewClient("https://example.atlassian.net/", "", "", nil), []string{"OPS", "DEV"})
+
+	s := "ops-12 DEV-3, OPS- OPS-x QA-1 OPS-12a UTF-8 https://example.atlassian.net/browse/OPS-42?focusedCommentId=1 " +
+		"https://jira.example.com/browse/OPS-43 <https://example.atlassian.net/browse/DEV-44>"
+
+	assert.Equal(t, []deploy.Reference{
+		{Provider: "jira", ID: "OPS-12", URL: "https://example.atlassian.net/browse/OPS-12"},
+		{Provider: "jira", ID: "DEV-3", URL: "https://example.atlassian.net/browse/DEV-3"},
+		{Provider: "jira", ID: "OPS-42", URL: "https://example.atlassian.net/browse/OPS-42"},
+		{Provider: "jira", ID: "DEV-44", URL: "https://example.atlassian.net/browse/DEV-44"},
+	}, p.FindReferences(s))
+}
+
+func TestReferenceProvider_FindReferences_AnyProject(t *testing.T) {
+	p := jira.NewReferenceProvider(jira.NewClient("https://jira.example.com/jira", "", "", nil), nil)
+
+	s := "OPS-12 qa-1 Q-2 https://jira.example.com/jira/browse/QA_TEAM-5"
+
+	assert.Equal(t, []deploy.Reference{
+		{Provider: "jira", ID: "OPS-12", URL: "https://jira.example.com/jira/browse/OPS-12"},
+		{Provider: "jira", ID: "QA_TEAM-5", URL: "https://jira.example.com/jira/browse/QA_TEAM-5"},
+	}, p.FindReferences(s))
+}
+
+func TestReferenceProvider_Resolve(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/api/2/issue/OPS-12", func(w http.ResponseWriter, req *http.Request) {
+		user, token, ok := req.BasicAuth()
+		if !ok || user != "bot@example.com" || token != "secret" {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		w.Write([]byte(`{
+			"key": "OPS-12",
+			"fields": {
+				"summary": "Rotate certificates",
+				"description": "h1. Steps",
+				"status": {"name": "Resolved", "statusCategory": {"key": "done"}},
+				"assignee": {"displayName": "Jane Doe"}
+			}
+		}`))
+	})
+	mux.HandleFunc("/rest/api/2/issue/OPS-13", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"key": "OPS-13", "fields": {"summary": "Unassigned", "status": {"name": "To Do", "statusCategory": {"key": "new"}}, "assignee": null}}`))
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := jira.NewReferenceProvider(jira.NewClient(srv.URL, "bot@example.com", "secret", nil), []string{"OPS"})
+
+	refs := p.FindReferences("OPS-12 OPS-13 OPS-14")
+	require.Len(t, refs, 3)
+
+	details, err := p.Resolve(refs[0])
+	require.NoError(t, err)
+
+	assert.Equal(t, deploy.ReferenceDetails{
+		Title:       "Rotate certificates",
+		Description: "h1. Steps",
+		Author:      "Jane Doe",
+		State:       "Resolved",
+		Done:        true,
+		URL:         srv.URL + "/browse/OPS-12",
+	}, details)
+
+	attachment := p.Attachment(refs[0], details)
+	assert.Equal(t, "OPS-12: Rotate certificates", attachment.Title)
+	assert.Equal(t, srv.URL+"/browse/OPS-12", attachment.TitleLink)
+	assert.Equal(t, "Jane Doe", attachment.AuthorName)
+	assert.Equal(t, "Resolved", attachment.Text)
+	assert.Equal(t, "good", attachment.Color)
+
+	details, err = p.Resolve(refs[1])
+	require.NoError(t, err)
+
+	assert.Empty(t, details.Author)
+	assert.False(t, details.Done)
+	assert.Empty(t, p.Attachment(refs[1], details).Color)
+
+	_, err = p.Resolve(refs[2])
+	assert.Error(t, err)
+}
+
+func TestClient_GetIssue_PersonalAccessToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+		w.Write([]byte(`{"key": "OPS-1", "fields": {"summary": "Test issue"}}`))
+	}))
+	defer srv.Close()
+
+	issue, err := jira.NewClient(srv.URL, "", "secret", nil).GetIssue("OPS-1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "OPS-1", issue.Key)
+	assert.Equal(t, "Test issue", issue.Fields.Summary)
+}
@@ -1,20 +1,31 @@
 package main
 
 import (
+	"errors"
+	"expvar"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
-	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/andrewslotin/michael/admin"
+	"github.com/andrewslotin/michael/audit"
 	"github.com/andrewslotin/michael/auth"
 	"github.com/andrewslotin/michael/bot"
+	"github.com/andrewslotin/michael/changelog"
 	"github.com/andrewslotin/michael/dashboard"
 	"github.com/andrewslotin/michael/deploy"
+	"github.com/andrewslotin/michael/github"
+	"github.com/andrewslotin/michael/gitlab"
+	"github.com/andrewslotin/michael/jira"
 	"github.com/andrewslotin/michael/server"
 	"github.com/andrewslotin/michael/slack"
 )
@@ -22,6 +33,8 @@ import (
 const (
 	DefaultHost = "0.0.0.0"
 	DefaultPort = 8081
+
+	slackSignInPath = "/auth/slack"
 )
 
 var (
@@ -33,18 +46,164 @@ var (
 	builder        = "n/a"
 
 	args struct {
-		host         string
-		port         int
-		printVersion bool
+		host          string
+		port          int
+		printVersion  bool
+		migrateDryRun bool
+
+		snapshotDir      string
+		snapshotInterval time.Duration
+		snapshotKeep     int
+
+		retentionMaxAge   time.Duration
+		retentionMaxCount int
+		retention         channelRetentionPolicies
+		retentionInterval time.Duration
+
+		historyLinkTTL time.Duration
+
+		secureCookies     auth.SecureCookies
+		trustProxyHeaders bool
+
+		defaultRole bot.Role
+		approvalTTL time.Duration
+
+		deployGates []bot.DeployGate
+
+		githubURL           string
+		prLookupTimeout     time.Duration
+		prGateTimeout       time.Duration
+		prGateOnTimeout     bot.GateDecision
+		prDescriptionLength int
+		changelogTimeout    time.Duration
+		updateAnnouncements bool
+		releaseNotes        bool
+		releaseNotesOptions changelog.Options
+		githubDeployments   string
+		githubPRComments    bool
+		dashboardURL        string
+
+		jiraURL      string
+		jiraProjects string
+		gitlabURL    string
 	}
 )
 
+// channelRetentionPolicies is a flag.Value that collects per-channel retention policies
+// in CHANNEL_ID:max-age=<duration>,max-count=<number> format.
+type channelRetentionPolicies map[string]deploy.RetentionPolicy
+
+func (p channelRetentionPolicies) String() string {
+	var s []string
+	for channelID, policy := range p {
+		s = append(s, channelID+":"+policy.String())
+	}
+
+	return strings.Join(s, " ")
+}
+
+func (p *channelRetentionPolicies) Set(s string) error {
+	fields := strings.SplitN(s, ":", 2)
+	if len(fields) != 2 || fields[0] == "" {
+		return fmt.Errorf("expected CHANNEL_ID:max-age=<duration>,max-count=<number>, got %q", s)
+	}
+
+	policy, err := deploy.ParseRetentionPolicy(fields[1])
+	if err != nil {
+		return err
+	}
+
+	if *p == nil {
+		*p = make(channelRetentionPolicies)
+	}
+	(*p)[fields[0]] = policy
+
+	return nil
+}
+
+// deployGateFlag is a flag.Value that adds a deploy gate configured in CHANNEL_ID:<spec> format. Gates with *
+// as CHANNEL_ID apply to all channels.
+type deployGateFlag struct {
+	gates  *[]bot.DeployGate
+	format string
+	parse  func(spec string) (bot.DeployGate, error)
+}
+
+func (f deployGateFlag) String() string {
+	return ""
+}
+
+func (f deployGateFlag) Set(s string) error {
+	fields := strings.SplitN(s, ":", 2)
+	if len(fields) != 2 || fields[0] == "" {
+		return fmt.Errorf("expected CHANNEL_ID:%s, got %q", f.format, s)
+	}
+
+	gate, err := f.parse(fields[1])
+	if err != nil {
+		return err
+	}
+
+	if fields[0] != "*" {
+		gate = bot.ForChannels(gate, strings.Split(fields[0], ",")...)
+	}
+	*f.gates = append(*f.gates, gate)
+
+	return nil
+}
+
+func parseBusinessHoursGate(spec string) (bot.DeployGate, error) {
+	return bot.ParseBusinessHours(spec)
+}
+
+func parseHTTPCheckGate(spec string) (bot.DeployGate, error) {
+	u, err := url.Parse(spec)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("malformed deploy check URL %q", spec)
+	}
+
+	return bot.NewHTTPCheckGate(spec, nil), nil
+}
+
 func init() {
 	flag.BoolVar(&args.printVersion, "version", false, "Print version and exit")
 	flag.StringVar(&args.host, "h", DefaultHost, "Host or address to listen on")
 	flag.IntVar(&args.port, "p", DefaultPort, "Port to listen on")
+	flag.BoolVar(&args.migrateDryRun, "migrate-dry-run", false, "Report pending BoltDB migrations without applying them and exit")
+	flag.StringVar(&args.snapshotDir, "snapshot-dir", "", "Directory to periodically write BoltDB snapshots to")
+	flag.DurationVar(&args.snapshotInterval, "snapshot-interval", 24*time.Hour, "Interval between BoltDB snapshots")
+	flag.IntVar(&args.snapshotKeep, "snapshot-keep", 7, "Number of latest BoltDB snapshots to keep, 0 to keep all")
+	flag.DurationVar(&args.retentionMaxAge, "retention-max-age", 0, "Remove deploys older than this from channel history, 0 to keep all")
+	flag.IntVar(&args.retentionMaxCount, "retention-max-count", 0, "Number of latest deploys to keep in channel history, 0 to keep all")
+	flag.Var(&args.retention, "retention", "Channel-specific retention policy in CHANNEL_ID:max-age=<duration>,max-count=<number> format, can be repeated")
+	flag.DurationVar(&args.retentionInterval, "retention-interval", time.Hour, "Interval between history retention policy checks")
+	flag.DurationVar(&args.historyLinkTTL, "history-link-ttl", auth.DefaultTokenTTL, "Period of time during which a link sent by /deploy history can be used")
+	flag.Var(&args.secureCookies, "secure-cookies", "When to mark dashboard cookies as Secure: auto (for HTTPS requests), always or never")
+	flag.BoolVar(&args.trustProxyHeaders, "trust-proxy-headers", false, "Rely on X-Forwarded-Proto header set by reverse proxy to detect HTTPS requests")
+	args.defaultRole = bot.RoleDeployer
+	flag.Var(&args.defaultRole, "default-role", "Role of users who have not been granted any role in channel: none, deployer, maintainer or admin")
+	flag.Var(deployGateFlag{&args.deployGates, "<days>,<hh:mm>-<hh:mm>[,<time zone>]", parseBusinessHoursGate}, "business-hours", "Deny deploys outside of business hours in CHANNEL_ID:Mon-Fri,09:00-18:00[,<time zone>] format, can be repeated")
+	flag.Var(deployGateFlag{&args.deployGates, "<url>", parseHTTPCheckGate}, "deploy-check", "Ask an HTTP endpoint whether a deploy is allowed in CHANNEL_ID:<url> format, can be repeated")
+	flag.DurationVar(&args.approvalTTL, "approval-ttl", deploy.DefaultApprovalTTL, "Period of time during which a deploy can be approved in channels that require approval")
+	flag.StringVar(&args.githubURL, "github-url", "https://github.com", "GitHub Enterprise Server URL, i.e. https://github.example.com")
+	flag.DurationVar(&args.prLookupTimeout, "pr-lookup-timeout", bot.DefaultPullRequestLookupTimeout, "Time to wait for pull request details before sending a deploy announcement with bare links to the rest")
+	flag.DurationVar(&args.prGateTimeout, "pr-check-timeout", bot.DefaultPullRequestGateTimeout, "Time to wait for pull request details in channels that require PRs to be ready to deploy")
+	args.prGateOnTimeout = bot.GateDeny
+	flag.Var(&args.prGateOnTimeout, "pr-check-on-timeout", "Decision to make if pull request details have not been fetched within -pr-check-timeout: warn or deny")
+	flag.IntVar(&args.prDescriptionLength, "pr-description-length", bot.DefaultMaxDescriptionLength, "Number of characters of PR description to include into deploy announcement, 0 to include full description")
+	flag.BoolVar(&args.updateAnnouncements, "update-announcements", false, "Post deploy announcements via Slack Web API to update them with pull request details that arrived late, requires SLACK_WEBAPI_TOKEN")
+	flag.DurationVar(&args.changelogTimeout, "changelog-timeout", bot.DefaultChangelogTimeout, "Time to wait for PR details when building a changelog or release notes before listing the rest as bare links")
+	flag.BoolVar(&args.releaseNotes, "release-notes", false, "Reply to deploy announcement with the list of deployed PRs once the deploy is done, requires SLACK_WEBAPI_TOKEN")
+	flag.BoolVar(&args.releaseNotesOptions.Labels, "release-notes-labels", false, "Include PR labels into release notes")
+	flag.BoolVar(&args.releaseNotesOptions.Authors, "release-notes-authors", false, "Include PR authors into release notes")
+	flag.StringVar(&args.githubDeployments, "github-deployments", "", "Create GitHub deployments for this environment when PRs are deployed, requires GitHub credentials")
+	flag.BoolVar(&args.githubPRComments, "github-pr-comments", false, "Comment on deployed PRs, requires -github-deployments")
+	flag.StringVar(&args.dashboardURL, "dashboard-url", "", "Public URL of deploy history dashboard to link GitHub deployments to, i.e. https://deploy.example.com")
+	flag.StringVar(&args.jiraURL, "jira-url", "", "Jira URL to recognize issue keys in deploy subjects, i.e. https://example.atlassian.net")
+	flag.StringVar(&args.jiraProjects, "jira-projects", "", "Comma-separated list of Jira project keys to recognize, i.e. OPS,DEV, all projects if empty")
+	flag.StringVar(&args.gitlabURL, "gitlab-url", "", "GitLab URL to recognize merge requests in deploy subjects, i.e. https://gitlab.com")
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\nOptions:\n", binPath)
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n       %s [options] restore <snapshot file>\n\nOptions:\n", binPath, binPath)
 		flag.PrintDefaults()
 	}
 }
@@ -56,6 +215,45 @@ func printVersion() {
 	os.Exit(0)
 }
 
+func migrateDryRun(boltDBPath string) {
+	if boltDBPath == "" {
+		log.Fatal("Missing BOLTDB_PATH env variable")
+	}
+
+	results, err := deploy.MigrateBoltDB(boltDBPath, true)
+	if err != nil {
+		log.Fatalf("failed to migrate deploy DB: %s", err)
+	}
+
+	if len(results) == 0 {
+		fmt.Printf("%s is up to date (schema version %d)\n", boltDBPath, deploy.BoltDBSchemaVersion)
+		os.Exit(0)
+	}
+
+	for _, res := range results {
+		fmt.Printf("v%d: %s (%d records would be changed)\n", res.Version, res.Description, res.Changed)
+	}
+	os.Exit(0)
+}
+
+func restoreSnapshot(snapshotPath, boltDBPath string) {
+	if snapshotPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if boltDBPath == "" {
+		log.Fatal("Missing BOLTDB_PATH env variable")
+	}
+
+	if err := deploy.RestoreBoltDBSnapshot(snapshotPath, boltDBPath); err != nil {
+		log.Fatalf("failed to restore deploy DB: %s", err)
+	}
+
+	fmt.Printf("%s has been restored from %s\n", boltDBPath, snapshotPath)
+	os.Exit(0)
+}
+
 func main() {
 	flag.Parse()
 
@@ -63,6 +261,14 @@ func main() {
 		printVersion()
 	}
 
+	if args.migrateDryRun {
+		migrateDryRun(os.Getenv("BOLTDB_PATH"))
+	}
+
+	if flag.Arg(0) == "restore" {
+		restoreSnapshot(flag.Arg(1), os.Getenv("BOLTDB_PATH"))
+	}
+
 	slackToken := os.Getenv("SLACK_TOKEN")
 	if slackToken == "" {
 		log.Fatal("Missing SLACK_TOKEN env variable")
@@ -71,16 +277,44 @@ func main() {
 	log.SetOutput(os.Stderr)
 	log.SetFlags(5)
 
-	githubToken := os.Getenv("GITHUB_TOKEN")
-	if githubToken == "" {
-		log.Printf("GITHUB_TOKEN env variable not set, only public PRs details will be displayed in deploy announcements")
+	githubClient, githubAuthenticated := newGitHubClient(args.githubURL)
+	if !githubAuthenticated {
+		log.Printf("neither GITHUB_TOKEN nor GITHUB_APP_ID env variable is set, only public PRs details will be displayed in deploy announcements")
 	}
 
 	var (
 		slackBot        *bot.Bot
 		deployDashboard *dashboard.Dashboard
+		boltDBStore     *deploy.BoltDBStore
+		historyStore    deploy.Pruner
 	)
-	if boltDBPath := os.Getenv("BOLTDB_PATH"); boltDBPath != "" {
+	switch databaseURL, boltDBPath := os.Getenv("DATABASE_URL"), os.Getenv("BOLTDB_PATH"); {
+	case strings.HasPrefix(databaseURL, "redis://"), strings.HasPrefix(databaseURL, "rediss://"):
+		log.Println("writing deploy history into Redis")
+
+		store, err := deploy.NewRedisStore(databaseURL)
+		if err != nil {
+			log.Fatalf("failed to open deploy DB: %s", err)
+		}
+
+		deployDashboard = dashboard.New(store)
+		slackBot = bot.New(slackToken, "", store)
+		historyStore = store
+	case strings.HasPrefix(databaseURL, "sqlite://"):
+		sqlitePath := strings.TrimPrefix(databaseURL, "sqlite://")
+		log.Printf("writing deploy history into an SQLite database in %s", sqlitePath)
+
+		store, err := deploy.NewSQLStore(sqlitePath)
+		if err != nil {
+			log.Fatalf("failed to open deploy DB: %s", err)
+		}
+
+		deployDashboard = dashboard.New(store)
+		slackBot = bot.New(slackToken, "", store)
+		historyStore = store
+	case databaseURL != "":
+		log.Fatalf("unsupported DATABASE_URL, only sqlite:///path/to/db and redis://host:port/db URLs are supported")
+	case boltDBPath != "":
 		log.Printf("writing deploy history into a BoltDB in %s", boltDBPath)
 
 		store, err := deploy.NewBoltDBStore(boltDBPath)
@@ -89,39 +323,247 @@ func main() {
 		}
 
 		deployDashboard = dashboard.New(store)
-		slackBot = bot.New(slackToken, githubToken, store)
-	} else {
-		log.Println("BOLTDB_PATH env variable not set, keeping deploy history in memory")
+		slackBot = bot.New(slackToken, "", store)
+		boltDBStore = store
+		historyStore = store
+	default:
+		log.Println("neither DATABASE_URL nor BOLTDB_PATH env variable is set, keeping deploy history in memory")
 
 		store := deploy.NewInMemoryStore()
 		deployDashboard = dashboard.New(store)
-		slackBot = bot.New(slackToken, githubToken, store)
+		slackBot = bot.New(slackToken, "", store)
+		historyStore = store
 	}
 
+	slackBot.SetGitHubClient(githubClient)
+	registerReferenceProviders(slackBot, args.jiraURL, args.jiraProjects, args.gitlabURL)
+	slackBot.SetPullRequestLookupTimeout(args.prLookupTimeout)
+	slackBot.SetPullRequestGateTimeout(args.prGateTimeout, args.prGateOnTimeout)
+	slackBot.SetPullRequestDescriptionLength(args.prDescriptionLength)
+
+	if history, ok := historyStore.(deploy.Repository); ok {
+		changelogBuilder := changelog.NewBuilder(githubClient)
+		slackBot.SetChangelog(history, changelogBuilder)
+		slackBot.SetChangelogTimeout(args.changelogTimeout)
+		deployDashboard.SetChangelog(changelogBuilder)
+	}
+
+	referenceIndex, _ := historyStore.(deploy.ReferenceIndex)
+	if referenceIndex != nil {
+		slackBot.SetReferenceIndex(referenceIndex)
+	}
+
+	for _, gate := range args.deployGates {
+		slackBot.AddDeployGate(gate)
+	}
+
+	if adminUsers := os.Getenv("ADMIN_USERS"); adminUsers != "" {
+		slackBot.SetAdmins(strings.Split(adminUsers, ",")...)
+	} else {
+		log.Printf("ADMIN_USERS env variable not set, administrative commands are disabled")
+	}
+
+	if args.githubDeployments != "" {
+		if !githubAuthenticated {
+			log.Fatalf("-github-deployments requires either GITHUB_TOKEN or GITHUB_APP_ID to be set")
+		}
+
+		notifier := bot.NewGitHubDeploymentsNotifier(githubClient)
+		notifier.Environment = args.githubDeployments
+		notifier.CommentOnPullRequests = args.githubPRComments
+		notifier.DashboardURL = args.dashboardURL
+
+		slackBot.AddDeployEventHandler(notifier)
+	}
+
+	var (
+		slackAPI       *slack.WebAPI
+		channelMembers *slack.ChannelMembers
+	)
 	if slackWebAPIToken := os.Getenv("SLACK_WEBAPI_TOKEN"); slackWebAPIToken != "" {
-		api := slack.NewWebAPI(slackWebAPIToken, nil)
+		slackAPI = slack.NewWebAPI(slackWebAPIToken, nil)
+		channelMembers = slack.NewChannelMembers(slackAPI)
+
+		// List deploys from other channels the user is a member of in /deploy where replies
+		slackBot.SetChannelMembers(channelMembers)
 		// Update channel topic to reflect current deploy status
-		slackBot.AddDeployEventHandler(bot.NewSlackTopicManager(api))
+		slackBot.AddDeployEventHandler(bot.NewSlackTopicManager(slackAPI))
 		// Send direct messages to users mentioned in deploy subject
-		slackBot.AddDeployEventHandler(bot.NewSlackIMNotifier(api))
+		slackBot.AddDeployEventHandler(bot.NewSlackIMNotifier(slackAPI))
+
+		// Release notes are posted in the thread of deploy announcement, so it needs to be posted via Web API as well
+		if args.updateAnnouncements || args.releaseNotes {
+			slackBot.SetMessagePoster(slackAPI)
+		}
+
+		if args.releaseNotes {
+			slackBot.SetReleaseNotes(args.releaseNotesOptions)
+		}
 	} else {
 		log.Printf("SLACK_WEBAPI_TOKEN env variable not set, channel topic notifications are disabled")
+		if args.updateAnnouncements || args.releaseNotes {
+			log.Fatalf("-update-announcements and -release-notes require SLACK_WEBAPI_TOKEN to be set")
+		}
+	}
+
+	if args.historyLinkTTL <= 0 {
+		log.Fatalf("-history-link-ttl should be positive, got %s", args.historyLinkTTL)
+	}
+
+	if args.approvalTTL <= 0 {
+		log.Fatalf("-approval-ttl should be positive, got %s", args.approvalTTL)
 	}
 
-	tokenSource := auth.RandomTokenSource{Src: rand.NewSource(time.Now().UnixNano())}
-	authenticator := auth.NewOneTimeTokenAuthenticator(&tokenSource)
+	var (
+		tokenStore  auth.TokenStore     = auth.NewInMemoryTokenStore()
+		revocations auth.RevocationList = auth.NewRecordRevocationList(deploy.NewInMemoryStore())
+		roles       bot.RoleStore       = bot.NewRecordRoleStore(deploy.NewInMemoryStore())
+		settings    bot.SettingsStore   = bot.NewRecordSettingsStore(deploy.NewInMemoryStore())
+		pending                         = deploy.NewPendingDeploys(deploy.NewInMemoryStore())
+		auditLog                        = audit.NewRecordLog(deploy.NewInMemoryStore())
+	)
+	records, persistent := historyStore.(deploy.RecordStore)
+	if persistent {
+		tokenStore = auth.NewRecordTokenStore(records)
+		revocations = auth.NewRecordRevocationList(records)
+		roles = bot.NewRecordRoleStore(records)
+		settings = bot.NewRecordSettingsStore(records)
+		pending = deploy.NewPendingDeploys(records)
+		auditLog = audit.NewRecordLog(records)
+	}
+
+	pending.TTL = args.approvalTTL
+	slackBot.SetChannelSettings(settings)
+	slackBot.SetPendingDeploys(pending)
+
+	slackBot.SetAuditLog(auditLog)
+	deployDashboard.SetAuditLog(auditLog)
+
+	permissions := bot.NewPermissions(roles)
+	permissions.DefaultRole = args.defaultRole
+	slackBot.SetPermissions(permissions)
+
+	var tokenSource auth.CryptoTokenSource
+	authenticator := auth.NewOneTimeTokenAuthenticatorWithStore(tokenSource, tokenStore)
+	authenticator.TTL = args.historyLinkTTL
+
+	// Tokens signed with HISTORY_AUTH_SECRET before switching to a keyset do not have key ID
+	var legacyAuthKeys []auth.Key
+	if authSecret := os.Getenv("HISTORY_AUTH_SECRET"); authSecret != "" {
+		legacyAuthKeys = append(legacyAuthKeys, auth.Key{Secret: []byte(authSecret)})
+	}
+
+	var authKeys *auth.Keyset
+	switch keysetPath := os.Getenv("HISTORY_AUTH_KEYSET"); {
+	case keysetPath != "":
+		keys, err := auth.LoadKeysetFile(keysetPath, legacyAuthKeys...)
+		if err != nil {
+			log.Fatalf("failed to load history auth keyset: %s", err)
+		}
+
+		log.Printf("signing dashboard tokens with key %s from %s", keys.ActiveKeyID(), keysetPath)
+		authKeys = keys
+	case len(legacyAuthKeys) > 0:
+		authKeys = auth.NewKeyset(legacyAuthKeys[0])
+	case persistent:
+		authSecret, err := generatedAuthSecret(records, tokenSource)
+		if err != nil {
+			log.Fatalf("failed to generate history auth secret: %s", err)
+		}
 
-	authSecret := os.Getenv("HISTORY_AUTH_SECRET")
-	if authSecret == "" {
-		authSecret = tokenSource.Generate(128)
+		log.Printf("neither HISTORY_AUTH_KEYSET nor HISTORY_AUTH_SECRET is set, using generated secret stored in deploy DB")
+		authKeys = auth.StaticKeyset([]byte(authSecret))
+	default:
+		authSecret := tokenSource.Generate(128)
 		log.Printf("HISTORY_AUTH_SECRET is not set, using randomly generated %q", authSecret)
+		authKeys = auth.StaticKeyset([]byte(authSecret))
 	}
 
 	slackBot.SetDashboardAuth(authenticator)
 
+	stop := make(chan struct{})
+
+	// Expired tokens are rejected anyway, removing them only frees up space
+	go authenticator.Run(time.Hour, stop)
+
+	retentionPolicies := deploy.RetentionPolicies{
+		Default:  deploy.RetentionPolicy{MaxAge: args.retentionMaxAge, MaxCount: args.retentionMaxCount},
+		Channels: args.retention,
+	}
+
+	historyPruner := deploy.NewHistoryPruner(historyStore, retentionPolicies)
+	slackBot.SetHistoryPruner(historyPruner)
+
+	if !retentionPolicies.Default.Unlimited() || len(retentionPolicies.Channels) > 0 {
+		log.Printf("enforcing deploy history retention policy %s every %s", retentionPolicies.Default, args.retentionInterval)
+		go historyPruner.Run(args.retentionInterval, stop)
+	}
+
 	mux := http.NewServeMux()
 	mux.Handle("/deploy", slackBot)
-	mux.Handle("/", auth.TokenAuthenticationMiddleware(auth.ChannelAuthorizerMiddleware(deployDashboard, []byte(authSecret)), authenticator, []byte(authSecret)))
+
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken != "" {
+		mux.Handle("/admin/revoke", audit.APIMiddleware(auth.AdminTokenMiddleware(admin.NewRevocationHandler(revocations, auth.ChannelAccessTokenExpirationPeriod), adminToken), auditLog))
+		// GitHub API rate limit and response cache metrics, scraped too often to be audited
+		mux.Handle("/admin/metrics", auth.AdminTokenMiddleware(expvar.Handler(), adminToken))
+	} else {
+		log.Printf("ADMIN_TOKEN env variable not set, online backups, token revocation and metrics are disabled")
+	}
+
+	if boltDBStore != nil {
+		if adminToken != "" {
+			mux.Handle("/admin/backup", audit.APIMiddleware(auth.AdminTokenMiddleware(admin.NewBackupHandler(boltDBStore), adminToken), auditLog))
+		}
+
+		if args.snapshotDir != "" {
+			log.Printf("writing deploy DB snapshots into %s every %s", args.snapshotDir, args.snapshotInterval)
+			go deploy.NewBoltDBSnapshotter(boltDBStore, args.snapshotDir, args.snapshotKeep).Run(args.snapshotInterval, stop)
+		}
+	} else if args.snapshotDir != "" {
+		log.Printf("-snapshot-dir is ignored since deploy history is not kept in BoltDB")
+	}
+
+	cookies := auth.DefaultCookiePolicy
+	cookies.Secure = args.secureCookies
+	cookies.TrustProxyHeaders = args.trustProxyHeaders
+
+	channelAuthorizer := auth.ChannelAuthorizerMiddleware(deployDashboard, authKeys)
+	channelAuthorizer.SetRevocationList(revocations)
+
+	switch clientID, clientSecret := os.Getenv("SLACK_CLIENT_ID"), os.Getenv("SLACK_CLIENT_SECRET"); {
+	case clientID == "" || clientSecret == "":
+		log.Printf("SLACK_CLIENT_ID or SLACK_CLIENT_SECRET env variable not set, Sign in with Slack is disabled")
+	case slackAPI == nil:
+		log.Printf("Sign in with Slack requires SLACK_WEBAPI_TOKEN env variable to check channel membership and is disabled")
+	default:
+		signIn := auth.NewSlackSignIn(slackAPI, clientID, clientSecret, authKeys)
+		signIn.TeamID = os.Getenv("SLACK_TEAM_ID")
+		signIn.Cookies = cookies
+
+		mux.Handle(slackSignInPath, signIn)
+		channelAuthorizer.AllowSessions(channelMembers, slackSignInPath)
+	}
+
+	channelAuthenticator := auth.TokenAuthenticationMiddleware(channelAuthorizer, authenticator, authKeys)
+	channelAuthenticator.SetRevocationList(revocations)
+	channelAuthenticator.SetAuditLog(auditLog)
+	channelAuthenticator.Cookies = cookies
+
+	sessionsHandler := auth.NewSessionsHandler(authKeys, revocations)
+	sessionsHandler.Cookies = cookies
+
+	logoutHandler := auth.NewLogoutHandler(authKeys, revocations)
+	logoutHandler.Cookies = cookies
+
+	// Pull request pages list deploys from all channels, leaving out the ones the user has no access to
+	if referenceIndex != nil {
+		mux.Handle("/prs/", csrfProtected(channelAuthorizer.RequireCredentials(dashboard.NewPullRequests(referenceIndex, channelAuthorizer)), cookies))
+	}
+
+	mux.Handle("/sessions", csrfProtected(sessionsHandler, cookies))
+	mux.Handle("/logout", csrfProtected(logoutHandler, cookies))
+	mux.Handle("/", csrfProtected(channelAuthenticator, cookies))
 
 	srv := server.New(args.host, args.port)
 	if err := srv.Start(mux); err != nil {
@@ -130,12 +572,169 @@ func main() {
 
 	log.Printf("Michael Buffer v%s is listening on %s", version, srv.Addr)
 
-	signals := make(chan os.Signal)
-	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			reloadAuthKeyset(authKeys, os.Getenv("HISTORY_AUTH_KEYSET"), legacyAuthKeys)
+			continue
+		}
 
-	select {
-	case <-signals:
 		log.Println("signal received, shutting down...")
+		close(stop)
 		srv.Shutdown()
+		historyPruner.Wait()
+
+		if closer, ok := historyStore.(io.Closer); ok {
+			closer.Close()
+		}
+
+		return
+	}
+}
+
+// generatedAuthSecret returns a random secret to sign dashboard tokens with. The secret is generated once and
+// kept in records, so that issued tokens remain valid after restart and are accepted by all instances sharing
+// the same database.
+func generatedAuthSecret(records deploy.RecordStore, src auth.TokenGenerator) (string, error) {
+	const collection, key = "settings", "history_auth_secret"
+
+	if _, err := records.AddRecord(collection, deploy.Record{Key: key, Value: []byte(src.Generate(128))}); err != nil {
+		return "", err
 	}
+
+	rec, ok, err := records.GetRecord(collection, key)
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return "", errors.New("generated secret has not been stored")
+	}
+
+	return string(rec.Value), nil
+}
+
+// newGitHubClient returns GitHub API client that authenticates as a GitHub App installation if GITHUB_APP_ID is set
+// or with GITHUB_TOKEN otherwise. The second value is false if neither is set and requests are sent unauthenticated.
+// For GitHub Enterprise Server webURL is used to derive API URL and to recognize links to pull requests.
+func newGitHubClient(webURL string) (*github.Client, bool) {
+	webURL = strings.TrimSuffix(webURL, "/")
+
+	apiURL := "https://api.github.com"
+	if webURL != "https://github.com" {
+		u, err := url.Parse(webURL)
+		if err != nil || u.Host == "" {
+			log.Fatalf("malformed -github-url %q, expected an absolute URL, i.e. https://github.example.com", webURL)
+		}
+
+		apiURL = webURL + "/api/v3"
+	}
+
+	var (
+		client        *github.Client
+		authenticated bool
+	)
+	switch appID, token := os.Getenv("GITHUB_APP_ID"), os.Getenv("GITHUB_TOKEN"); {
+	case appID != "":
+		installationID := os.Getenv("GITHUB_APP_INSTALLATION_ID")
+		if installationID == "" {
+			log.Fatal("GITHUB_APP_ID requires GITHUB_APP_INSTALLATION_ID env variable to be set")
+		}
+
+		privateKey := []byte(os.Getenv("GITHUB_APP_PRIVATE_KEY"))
+		if keyPath := os.Getenv("GITHUB_APP_PRIVATE_KEY_PATH"); len(privateKey) == 0 && keyPath != "" {
+			var err error
+			if privateKey, err = ioutil.ReadFile(keyPath); err != nil {
+				log.Fatalf("failed to read GitHub App private key: %s", err)
+			}
+		}
+
+		if len(privateKey) == 0 {
+			log.Fatal("GITHUB_APP_ID requires either GITHUB_APP_PRIVATE_KEY or GITHUB_APP_PRIVATE_KEY_PATH env variable to be set")
+		}
+
+		tokens, err := github.NewAppInstallationTokenSource(appID, installationID, privateKey, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tokens.BaseURL = apiURL
+
+		log.Printf("authenticating GitHub API requests as app %s installation %s", appID, installationID)
+		client, authenticated = github.NewClientWithTokenSource(tokens, nil), true
+	default:
+		client, authenticated = github.NewClient(token, nil), token != ""
+	}
+
+	client.BaseURL, client.WebURL = apiURL, webURL
+
+	return client, authenticated
+}
+
+// registerReferenceProviders makes deploy bot recognize Jira issues and GitLab merge requests in deploy subjects
+// in addition to GitHub references if their URLs are configured.
+func registerReferenceProviders(slackBot *bot.Bot, jiraURL, jiraProjects, gitlabURL string) {
+	if jiraURL != "" {
+		if u, err := url.Parse(jiraURL); err != nil || u.Host == "" {
+			log.Fatalf("malformed -jira-url %q, expected an absolute URL, i.e. https://example.atlassian.net", jiraURL)
+		}
+
+		var projects []string
+		for _, project := range strings.Split(jiraProjects, ",") {
+			if project = strings.TrimSpace(project); project != "" {
+				projects = append(projects, project)
+			}
+		}
+
+		user, token := os.Getenv("JIRA_USER"), os.Getenv("JIRA_TOKEN")
+		if token == "" {
+			log.Printf("JIRA_TOKEN env variable is not set, only public Jira issues details will be displayed in deploy announcements")
+		}
+
+		slackBot.AddReferenceProvider(jira.NewReferenceProvider(jira.NewClient(jiraURL, user, token, nil), projects))
+	}
+
+	if gitlabURL != "" {
+		gitlabURL = strings.TrimSuffix(gitlabURL, "/")
+		if u, err := url.Parse(gitlabURL); err != nil || u.Host == "" {
+			log.Fatalf("malformed -gitlab-url %q, expected an absolute URL, i.e. https://gitlab.com", gitlabURL)
+		}
+
+		token := os.Getenv("GITLAB_TOKEN")
+		if token == "" {
+			log.Printf("GITLAB_TOKEN env variable is not set, only public merge requests details will be displayed in deploy announcements")
+		}
+
+		client := gitlab.NewClient(token, nil)
+		client.BaseURL, client.WebURL = gitlabURL+"/api/v4", gitlabURL
+
+		slackBot.AddReferenceProvider(gitlab.NewReferenceProvider(client))
+	}
+}
+
+// reloadAuthKeyset replaces keys with ones from keyset file in path keeping the old ones if the file
+// can't be loaded.
+func reloadAuthKeyset(keys *auth.Keyset, path string, legacyKeys []auth.Key) {
+	if path == "" {
+		log.Printf("HISTORY_AUTH_KEYSET env variable not set, nothing to reload")
+		return
+	}
+
+	reloaded, err := auth.LoadKeysetFile(path, legacyKeys...)
+	if err != nil {
+		log.Printf("failed to reload history auth keyset, keeping the current one: %s", err)
+		return
+	}
+
+	keys.Replace(reloaded)
+	log.Printf("reloaded history auth keyset from %s, signing dashboard tokens with key %s", path, keys.ActiveKeyID())
+}
+
+// csrfProtected requires state-changing requests to h to contain a CSRF token.
+func csrfProtected(h http.Handler, cookies auth.CookiePolicy) http.Handler {
+	csrf := auth.CSRFMiddleware(h)
+	csrf.Cookies = cookies
+
+	return csrf
 }
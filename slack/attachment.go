@@ -8,14 +8,39 @@ type Attachment struct {
 	TitleLink  string
 	Text       string
 	Markdown   bool
+	// Color is either "good", "warning", "danger" or a hex color code, i.e. #439FE0.
+	Color string
+	// CallbackID identifies the attachment in interaction payloads sent by Slack when a user clicks
+	// one of its Actions.
+	CallbackID string
+	Actions    []Action
+}
+
+// Action is an interactive button attached to a message.
+type Action struct {
+	Name  string `json:"name"`
+	Text  string `json:"text"`
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+	// Style is either "default", "primary" or "danger".
+	Style string `json:"style,omitempty"`
+}
+
+// NewButton returns a button Action.
+func NewButton(name, text, value string) Action {
+	return Action{Name: name, Text: text, Type: "button", Value: value}
 }
 
 type internalAttachment struct {
-	AuthorName *string  `json:"author_name,omitempty"`
-	Title      *string  `json:"title"`
-	TitleLink  *string  `json:"title_link,omitempty"`
-	Text       *string  `json:"text,omitempty"`
-	MarkdownIn []string `json:"mrkdwn_in"`
+	AuthorName *string   `json:"author_name,omitempty"`
+	Title      *string   `json:"title"`
+	TitleLink  *string   `json:"title_link,omitempty"`
+	Text       *string   `json:"text,omitempty"`
+	MarkdownIn []string  `json:"mrkdwn_in"`
+	Color      *string   `json:"color,omitempty"`
+	Fallback   string    `json:"fallback,omitempty"`
+	CallbackID *string   `json:"callback_id,omitempty"`
+	Actions    *[]Action `json:"actions,omitempty"`
 }
 
 func (a Attachment) MarshalJSON() ([]byte, error) {
@@ -30,6 +55,16 @@ func (a Attachment) MarshalJSON() ([]byte, error) {
 		v.MarkdownIn = []string{"text"}
 	}
 
+	if a.Color != "" {
+		v.Color = &a.Color
+	}
+
+	if len(a.Actions) > 0 {
+		// Slack requires a plain text summary of attachments with actions
+		v.Fallback = a.Title
+		v.CallbackID, v.Actions = &a.CallbackID, &a.Actions
+	}
+
 	return json.Marshal(v)
 }
 
@@ -43,6 +78,9 @@ func (a *Attachment) UnmarshalJSON(data []byte) error {
 		Title:      &a.Title,
 		TitleLink:  &a.TitleLink,
 		Text:       &a.Text,
+		Color:      &a.Color,
+		CallbackID: &a.CallbackID,
+		Actions:    &a.Actions,
 	}
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
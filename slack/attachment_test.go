@@ -23,6 +23,23 @@ func TestAttachment_MarshalJSON(t *testing.T) {
 	assert.Equal(t, attachment.TitleLink, m["title_link"])
 	assert.Equal(t, attachment.Text, m["text"])
 	assert.Nil(t, m["mrkdwn_in"])
+	assert.NotContains(t, m, "color")
+}
+
+func TestAttachment_MarshalJSON_Color(t *testing.T) {
+	attachment := sampleAttachment()
+	attachment.Color = "danger"
+
+	data, err := json.Marshal(attachment)
+	require.NoError(t, err)
+
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &m), string(data))
+	assert.Equal(t, "danger", m["color"])
+
+	var unmarshaledAttachment slack.Attachment
+	require.NoError(t, json.Unmarshal(data, &unmarshaledAttachment), string(data))
+	assert.Equal(t, attachment, unmarshaledAttachment)
 }
 
 func TestAttachment_MarshalJSON_Markdown(t *testing.T) {
@@ -69,6 +86,40 @@ func TestAttachment_UnmarshalJSON_Pointer(t *testing.T) {
 	}
 }
 
+func TestAttachment_MarshalJSON_Actions(t *testing.T) {
+	attachment := sampleAttachment()
+	attachment.CallbackID = "test_callback"
+	attachment.Actions = []slack.Action{slack.NewButton("approve", "Approve", "123")}
+
+	data, err := json.Marshal(attachment)
+	require.NoError(t, err)
+
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &m), string(data))
+
+	assert.Equal(t, attachment.Title, m["fallback"])
+	assert.Equal(t, "test_callback", m["callback_id"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "approve", "text": "Approve", "type": "button", "value": "123"},
+	}, m["actions"])
+
+	var unmarshaledAttachment slack.Attachment
+	require.NoError(t, json.Unmarshal(data, &unmarshaledAttachment), string(data))
+	assert.Equal(t, attachment, unmarshaledAttachment)
+}
+
+func TestAttachment_MarshalJSON_NoActions(t *testing.T) {
+	data, err := json.Marshal(sampleAttachment())
+	require.NoError(t, err)
+
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &m), string(data))
+
+	assert.NotContains(t, m, "fallback")
+	assert.NotContains(t, m, "callback_id")
+	assert.NotContains(t, m, "actions")
+}
+
 func sampleAttachment() slack.Attachment {
 	return slack.Attachment{
 		AuthorName: "test user",
@@ -0,0 +1,71 @@
+package slack
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultChannelMembersCacheTTL is the default period of time channel member lists are cached for.
+const DefaultChannelMembersCacheTTL = 5 * time.Minute
+
+type memberLister interface {
+	ListChannelMembers(channelID string) ([]string, error)
+}
+
+type channelMembersCacheEntry struct {
+	members   map[string]struct{}
+	fetchedAt time.Time
+}
+
+// ChannelMembers checks whether a user is a member of a channel. Member lists are fetched from Slack Web API
+// and cached for CacheTTL.
+type ChannelMembers struct {
+	// CacheTTL is the period of time after which channel member list is fetched again.
+	CacheTTL time.Duration
+
+	api memberLister
+
+	mu    sync.Mutex
+	cache map[string]channelMembersCacheEntry
+}
+
+// NewChannelMembers returns an instance of *ChannelMembers that uses api to fetch channel member lists.
+func NewChannelMembers(api memberLister) *ChannelMembers {
+	return &ChannelMembers{
+		CacheTTL: DefaultChannelMembersCacheTTL,
+		api:      api,
+		cache:    make(map[string]channelMembersCacheEntry),
+	}
+}
+
+// IsMember returns true if user with given ID is a member of channel. The cache is not locked while member
+// list is being fetched, so that a slow response for one channel does not hold up checks for the others.
+func (cm *ChannelMembers) IsMember(channelID, userID string) (bool, error) {
+	cm.mu.Lock()
+	entry, ok := cm.cache[channelID]
+	cm.mu.Unlock()
+
+	if !ok || time.Since(entry.fetchedAt) >= cm.CacheTTL {
+		members, err := cm.api.ListChannelMembers(channelID)
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch members of %s: %s", channelID, err)
+		}
+
+		entry = channelMembersCacheEntry{
+			members:   make(map[string]struct{}, len(members)),
+			fetchedAt: time.Now(),
+		}
+		for _, id := range members {
+			entry.members[id] = struct{}{}
+		}
+
+		cm.mu.Lock()
+		cm.cache[channelID] = entry
+		cm.mu.Unlock()
+	}
+
+	_, ok = entry.members[userID]
+
+	return ok, nil
+}
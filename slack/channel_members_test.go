@@ -0,0 +1,137 @@
+package slack_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestChannelMembers_IsMember(t *testing.T) {
+	api := new(memberListerMock)
+	api.On("ListChannelMembers", "channel1").Return([]string{"U1", "U2"}, nil).Once()
+	api.On("ListChannelMembers", "channel2").Return([]string{"U3"}, nil).Once()
+
+	members := slack.NewChannelMembers(api)
+
+	for _, userID := range [...]string{"U1", "U2"} {
+		ok, err := members.IsMember("channel1", userID)
+		if assert.NoError(t, err) {
+			assert.True(t, ok, userID)
+		}
+	}
+
+	ok, err := members.IsMember("channel1", "U3")
+	if assert.NoError(t, err) {
+		assert.False(t, ok)
+	}
+
+	ok, err = members.IsMember("channel2", "U3")
+	if assert.NoError(t, err) {
+		assert.True(t, ok)
+	}
+
+	api.AssertExpectations(t)
+}
+
+func TestChannelMembers_IsMember_CacheExpiration(t *testing.T) {
+	api := new(memberListerMock)
+	api.On("ListChannelMembers", "channel1").Return([]string{"U1"}, nil).Once()
+	api.On("ListChannelMembers", "channel1").Return([]string{"U2"}, nil).Once()
+
+	members := slack.NewChannelMembers(api)
+	members.CacheTTL = 10 * time.Millisecond
+
+	ok, err := members.IsMember("channel1", "U2")
+	if assert.NoError(t, err) {
+		assert.False(t, ok)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	ok, err = members.IsMember("channel1", "U2")
+	if assert.NoError(t, err) {
+		assert.True(t, ok)
+	}
+
+	api.AssertExpectations(t)
+}
+
+func TestChannelMembers_IsMember_SlowChannel(t *testing.T) {
+	api := &slowMemberLister{
+		Channel:  "channel1",
+		Fetching: make(chan struct{}),
+		Release:  make(chan struct{}),
+	}
+
+	members := slack.NewChannelMembers(api)
+
+	done := make(chan struct{})
+	go func() {
+		members.IsMember("channel1", "U1")
+		close(done)
+	}()
+
+	<-api.Fetching
+
+	checked := make(chan struct{})
+	go func() {
+		ok, err := members.IsMember("channel2", "U1")
+		if assert.NoError(t, err) {
+			assert.True(t, ok)
+		}
+		close(checked)
+	}()
+
+	select {
+	case <-checked:
+	case <-time.After(time.Second):
+		t.Fatal("membership check is blocked by another channel")
+	}
+
+	close(api.Release)
+	<-done
+}
+
+func TestChannelMembers_IsMember_WebAPIError(t *testing.T) {
+	api := new(memberListerMock)
+	api.On("ListChannelMembers", "channel1").Return(nil, errors.New("channel_not_found"))
+
+	members := slack.NewChannelMembers(api)
+
+	_, err := members.IsMember("channel1", "U1")
+	assert.EqualError(t, err, "failed to fetch members of channel1: channel_not_found")
+}
+
+type memberListerMock struct {
+	mock.Mock
+}
+
+func (m *memberListerMock) ListChannelMembers(channelID string) ([]string, error) {
+	args := m.Called(channelID)
+
+	if err := args.Error(1); err != nil {
+		return nil, err
+	}
+
+	return args.Get(0).([]string), nil
+}
+
+// slowMemberLister lists U1 as the only member of any channel. Fetching the members of Channel is reported to Fetching
+// and waits until Release is closed.
+type slowMemberLister struct {
+	Channel           string
+	Fetching, Release chan struct{}
+}
+
+func (l *slowMemberLister) ListChannelMembers(channelID string) ([]string, error) {
+	if channelID == l.Channel {
+		close(l.Fetching)
+		<-l.Release
+	}
+
+	return []string{"U1"}, nil
+}
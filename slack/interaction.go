@@ -0,0 +1,30 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// InteractionPayload is sent by Slack when a user clicks a button attached to a message.
+type InteractionPayload struct {
+	Type        string `json:"type"`
+	CallbackID  string `json:"callback_id"`
+	Token       string `json:"token"`
+	ResponseURL string `json:"response_url"`
+	Channel     struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"channel"`
+	User    User     `json:"user"`
+	Actions []Action `json:"actions"`
+}
+
+// ParseInteractionPayload parses the payload form value of an interactive message request.
+func ParseInteractionPayload(s string) (InteractionPayload, error) {
+	var p InteractionPayload
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		return InteractionPayload{}, fmt.Errorf("malformed interaction payload: %s", err)
+	}
+
+	return p, nil
+}
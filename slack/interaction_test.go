@@ -0,0 +1,38 @@
+package slack_test
+
+import (
+	"testing"
+
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInteractionPayload(t *testing.T) {
+	p, err := slack.ParseInteractionPayload(`{
+		"type": "interactive_message",
+		"actions": [{"name": "approve", "type": "button", "value": "123"}],
+		"callback_id": "deploy_approval",
+		"team": {"id": "T1", "domain": "example"},
+		"channel": {"id": "C1", "name": "general"},
+		"user": {"id": "U1", "name": "user1"},
+		"action_ts": "1476222591.343452",
+		"message_ts": "1476222549.000008",
+		"token": "verification-token",
+		"response_url": "https://hooks.slack.com/actions/T1/1/xxx"
+	}`)
+	require.NoError(t, err)
+
+	assert.Equal(t, "interactive_message", p.Type)
+	assert.Equal(t, "deploy_approval", p.CallbackID)
+	assert.Equal(t, "verification-token", p.Token)
+	assert.Equal(t, "https://hooks.slack.com/actions/T1/1/xxx", p.ResponseURL)
+	assert.Equal(t, "C1", p.Channel.ID)
+	assert.Equal(t, slack.User{ID: "U1", Name: "user1"}, p.User)
+	assert.Equal(t, []slack.Action{{Name: "approve", Type: "button", Value: "123"}}, p.Actions)
+}
+
+func TestParseInteractionPayload_Malformed(t *testing.T) {
+	_, err := slack.ParseInteractionPayload("payload")
+	assert.Error(t, err)
+}
@@ -0,0 +1,294 @@
+package slack
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	htmlComment      = regexp.MustCompile("(?s)<!--.*?(?:-->|$)")
+	codeFence        = regexp.MustCompile("^\\s*(```|~~~)")
+	atxHeading       = regexp.MustCompile("^\\s{0,3}#{1,6}\\s+(.*?)(?:\\s+#+)?\\s*$")
+	setextUnderline  = regexp.MustCompile("^\\s{0,3}(?:=+|-+)\\s*$")
+	thematicBreak    = regexp.MustCompile("^\\s{0,3}(?:(?:\\*\\s*){3,}|(?:-\\s*){3,}|(?:_\\s*){3,})$")
+	taskListItem     = regexp.MustCompile("^(\\s*)[-*+]\\s+\\[([ xX])\\]\\s+(.*)$")
+	bulletListItem   = regexp.MustCompile("^(\\s*)[-*+]\\s+(.*)$")
+	blockquote       = regexp.MustCompile("^\\s{0,3}>\\s?(.*)$")
+	tableRow         = regexp.MustCompile("^\\s*\\|.*\\|\\s*$")
+	tableDelimiter   = regexp.MustCompile("^\\s*\\|?(?:\\s*:?-+:?\\s*\\|)+\\s*(?::?-+:?\\s*)?$")
+	inlineCode       = regexp.MustCompile("`+[^`]*?`+")
+	inlineLink       = regexp.MustCompile(`!?\[((?:[^\[\]]|\[[^\[\]]*\])*)\]\(\s*<?([^\s()<>]+)>?(?:\s+(?:"[^"]*"|'[^']*'))?\s*\)|<(https?://[^\s<>]+)>|<br\s*/?>|</?[A-Za-z][A-Za-z0-9-]*(?:\s[^<>]*)?/?>`)
+	emphasis         = regexp.MustCompile(`\*\*([^*\s](?:.*?[^*\s])?)\*\*|__([^_\s](?:.*?[^_\s])?)__|~~([^~\s](?:.*?[^~\s])?)~~|\*([^*\s](?:[^*]*?[^*\s])?)\*`)
+	multipleNewlines = regexp.MustCompile("\n{3,}")
+)
+
+// ConvertMarkdown translates CommonMark and GitHub-flavored Markdown, i.e. a pull request description, into Slack
+// mrkdwn. Links become <url|text>, headings become bold lines, task list items are prefixed with checkbox emoji and
+// tables are rendered as preformatted text. HTML comments and tags are stripped, and the rest of text is escaped.
+func ConvertMarkdown(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimRight(htmlComment.ReplaceAllString(s, ""), " \t\n")
+
+	var (
+		lines   []string
+		table   [][]string
+		inFence string
+		prev    string
+	)
+
+	flushTable := func() {
+		if len(table) > 0 {
+			lines = append(lines, renderTable(table)...)
+			table = nil
+		}
+	}
+
+	for _, line := range strings.Split(s, "\n") {
+		previous := prev
+		prev = line
+
+		if inFence != "" {
+			if m := codeFence.FindStringSubmatch(line); m != nil && m[1] == inFence {
+				lines = append(lines, "```")
+				inFence = ""
+
+				continue
+			}
+
+			lines = append(lines, replacer.Replace(line))
+			continue
+		}
+
+		if m := codeFence.FindStringSubmatch(line); m != nil {
+			flushTable()
+			lines = append(lines, "```")
+			inFence = m[1]
+
+			continue
+		}
+
+		if tableRow.MatchString(line) {
+			if !tableDelimiter.MatchString(line) {
+				table = append(table, tableCells(line))
+			}
+
+			continue
+		}
+		flushTable()
+
+		switch {
+		case setextUnderline.MatchString(line) && isParagraphLine(previous):
+			// a paragraph line followed by === or --- is a heading
+			lines[len(lines)-1] = "*" + strings.Trim(lines[len(lines)-1], "*") + "*"
+		case thematicBreak.MatchString(line):
+			lines = append(lines, "")
+		default:
+			lines = append(lines, strings.TrimRight(convertMarkdownLine(line), " \t"))
+		}
+	}
+
+	// close the fence that was left open till the end of text
+	if inFence != "" {
+		lines = append(lines, "```")
+	}
+	flushTable()
+
+	return strings.TrimSpace(multipleNewlines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// isParagraphLine returns true if line is a non-empty line of text that is not a part of another block.
+func isParagraphLine(line string) bool {
+	if strings.TrimSpace(line) == "" {
+		return false
+	}
+
+	for _, re := range []*regexp.Regexp{codeFence, atxHeading, thematicBreak, bulletListItem, blockquote, tableRow} {
+		if re.MatchString(line) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func convertMarkdownLine(line string) string {
+	if m := atxHeading.FindStringSubmatch(line); m != nil {
+		if m[1] == "" {
+			return ""
+		}
+
+		// Slack does not support nested formatting, so the heading is made bold as a whole
+		return "*" + strings.Trim(convertInlineMarkdown(m[1]), "*") + "*"
+	}
+
+	if m := taskListItem.FindStringSubmatch(line); m != nil {
+		checkbox := ":white_large_square:"
+		if m[2] != " " {
+			checkbox = ":white_check_mark:"
+		}
+
+		return m[1] + checkbox + " " + convertInlineMarkdown(m[3])
+	}
+
+	if m := bulletListItem.FindStringSubmatch(line); m != nil {
+		return m[1] + "• " + convertInlineMarkdown(m[2])
+	}
+
+	if m := blockquote.FindStringSubmatch(line); m != nil {
+		return strings.TrimSpace("> " + convertInlineMarkdown(m[1]))
+	}
+
+	return convertInlineMarkdown(line)
+}
+
+// convertInlineMarkdown converts links and emphasis leaving code spans as is.
+func convertInlineMarkdown(s string) string {
+	var (
+		buf  strings.Builder
+		last int
+	)
+	for _, loc := range inlineCode.FindAllStringIndex(s, -1) {
+		buf.WriteString(convertInlineText(s[last:loc[0]]))
+
+		code := strings.Trim(s[loc[0]:loc[1]], "`")
+		if strings.TrimSpace(code) == "" {
+			buf.WriteString(replacer.Replace(s[loc[0]:loc[1]]))
+		} else {
+			buf.WriteString("`" + replacer.Replace(strings.TrimSpace(code)) + "`")
+		}
+
+		last = loc[1]
+	}
+	buf.WriteString(convertInlineText(s[last:]))
+
+	return buf.String()
+}
+
+func convertInlineText(s string) string {
+	var (
+		buf  strings.Builder
+		last int
+	)
+	for _, m := range inlineLink.FindAllStringSubmatchIndex(s, -1) {
+		buf.WriteString(convertEmphasis(replacer.Replace(s[last:m[0]])))
+		last = m[1]
+
+		switch {
+		case m[4] >= 0: // [text](url) or ![alt](url)
+			text, url := s[m[2]:m[3]], s[m[4]:m[5]]
+			if text = strings.TrimSpace(text); text == "" {
+				buf.WriteString("<" + url + ">")
+				continue
+			}
+
+			// strip nested images and links leaving their text only, since Slack does not support nested links
+			text = inlineLink.ReplaceAllStringFunc(text, func(nested string) string {
+				if sm := inlineLink.FindStringSubmatch(nested); sm[2] != "" {
+					return sm[1]
+				}
+
+				return ""
+			})
+			buf.WriteString("<" + url + "|" + convertEmphasis(replacer.Replace(strings.ReplaceAll(text, "|", "¦"))) + ">")
+		case m[6] >= 0: // <https://example.com>
+			buf.WriteString("<" + s[m[6]:m[7]] + ">")
+		case strings.HasPrefix(strings.ToLower(s[m[0]:m[1]]), "<br"):
+			buf.WriteString("\n")
+		default:
+			// other HTML tags are dropped
+		}
+	}
+	buf.WriteString(convertEmphasis(replacer.Replace(s[last:])))
+
+	return buf.String()
+}
+
+// convertEmphasis replaces **bold**, __bold__, *italic* and ~~strikethrough~~ with their mrkdwn counterparts.
+// Since _italic_ has the same meaning in both formats, it's left as is.
+func convertEmphasis(s string) string {
+	return emphasis.ReplaceAllStringFunc(s, func(m string) string {
+		sm := emphasis.FindStringSubmatch(m)
+		switch {
+		case sm[1] != "":
+			return "*" + sm[1] + "*"
+		case sm[2] != "":
+			return "*" + sm[2] + "*"
+		case sm[3] != "":
+			return "~" + sm[3] + "~"
+		default:
+			return "_" + sm[4] + "_"
+		}
+	})
+}
+
+func tableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+
+	cells := strings.Split(line, "|")
+	for i, cell := range cells {
+		cells[i] = strings.TrimSpace(cell)
+	}
+
+	return cells
+}
+
+// renderTable formats table rows as preformatted text with aligned columns, since Slack does not support tables.
+func renderTable(rows [][]string) []string {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	lines := []string{"```"}
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = cell + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+		}
+
+		lines = append(lines, replacer.Replace(strings.TrimRight(strings.Join(cells, " | "), " ")))
+	}
+
+	return append(lines, "```")
+}
+
+// TruncateMessage shortens mrkdwn text to at most maxLen characters not counting the "read more" link to moreURL that
+// is appended to truncated text. The text is cut at a whitespace without breaking links and code blocks. Text is
+// returned as is if maxLen is not positive.
+func TruncateMessage(s string, maxLen int, moreURL string) string {
+	if maxLen <= 0 || utf8.RuneCountInString(s) <= maxLen {
+		return s
+	}
+
+	cut := string([]rune(s)[:maxLen])
+
+	// avoid cutting a link or an HTML entity in the middle
+	if n := strings.LastIndexAny(cut, "<&"); n >= 0 && !strings.ContainsAny(cut[n:], ">;") {
+		cut = cut[:n]
+	}
+
+	if n := strings.LastIndexAny(cut, " \n\t"); n > 0 {
+		cut = cut[:n]
+	}
+	cut = strings.TrimSpace(cut)
+
+	if strings.Count(cut, "```")%2 == 1 {
+		cut += "\n```"
+	}
+
+	if moreURL == "" {
+		return cut + "…"
+	}
+
+	return cut + "… <" + moreURL + "|read more>"
+}
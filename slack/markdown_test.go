@@ -0,0 +1,71 @@
+package slack_test
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrewslotin/michael/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "Update golden files in testdata")
+
+func TestConvertMarkdown(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "markdown", "*.md"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, path := range files {
+		path := path
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".md"), func(t *testing.T) {
+			src, err := ioutil.ReadFile(path)
+			require.NoError(t, err)
+
+			actual := slack.ConvertMarkdown(string(src)) + "\n"
+
+			goldenPath := strings.TrimSuffix(path, ".md") + ".mrkdwn"
+			if *updateGolden {
+				require.NoError(t, ioutil.WriteFile(goldenPath, []byte(actual), 0644))
+			}
+
+			expected, err := ioutil.ReadFile(goldenPath)
+			require.NoError(t, err)
+
+			assert.Equal(t, string(expected), actual)
+		})
+	}
+}
+
+func TestConvertMarkdown_CRLF(t *testing.T) {
+	assert.Equal(t, "*Summary*\n• item", slack.ConvertMarkdown("## Summary\r\n- item\r\n"))
+}
+
+func TestTruncateMessage(t *testing.T) {
+	examples := map[string]struct {
+		Value    string
+		MaxLen   int
+		Expected string
+	}{
+		"short":     {"Hello, world", 20, "Hello, world"},
+		"no limit":  {"Hello, world", 0, "Hello, world"},
+		"word":      {"Hello, wonderful world", 12, "Hello,… <https://example.com/pr/1|read more>"},
+		"link":      {"See <https://example.com/very/long/link|this link> for details", 20, "See… <https://example.com/pr/1|read more>"},
+		"entity":    {"Tom &amp; Jerry", 7, "Tom… <https://example.com/pr/1|read more>"},
+		"code":      {"Run\n```\nmake test\nmake lint\n```", 18, "Run\n```\nmake test\n```… <https://example.com/pr/1|read more>"},
+		"multibyte": {"Привет, мир и все остальные", 10, "Привет,… <https://example.com/pr/1|read more>"},
+	}
+
+	for name, example := range examples {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, example.Expected, slack.TruncateMessage(example.Value, example.MaxLen, "https://example.com/pr/1"))
+		})
+	}
+}
+
+func TestTruncateMessage_NoURL(t *testing.T) {
+	assert.Equal(t, "Hello,…", slack.TruncateMessage("Hello, wonderful world", 12, ""))
+}
@@ -3,4 +3,6 @@ package slack
 type Message struct {
 	Text        string       `json:"text"`
 	Attachments []Attachment `json:"attachments,omitempty"`
+	// ThreadTS is the timestamp of the message to post this one as a reply to
+	ThreadTS string `json:"thread_ts,omitempty"`
 }
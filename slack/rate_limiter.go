@@ -0,0 +1,71 @@
+package slack
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultRetryAfter is the period of time a rate-limited method is paused for if Slack did not specify it in
+// the Retry-After header.
+const DefaultRetryAfter = time.Second
+
+// rateLimiter pauses calls to Web API methods that have been rate-limited by Slack. Since Slack applies its
+// limits per method, other methods can still be called meanwhile.
+type rateLimiter struct {
+	mu     sync.Mutex
+	blocks map[string]time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{blocks: make(map[string]time.Time)}
+}
+
+// Wait blocks until method is allowed to be called again or ctx is done.
+func (rl *rateLimiter) Wait(ctx context.Context, method string) error {
+	rl.mu.Lock()
+	until, ok := rl.blocks[method]
+	rl.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	d := time.Until(until)
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Block pauses calls to method for the period of time d.
+func (rl *rateLimiter) Block(method string, d time.Duration) {
+	until := time.Now().Add(d)
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if until.After(rl.blocks[method]) {
+		rl.blocks[method] = until
+	}
+}
+
+// retryAfter returns the delay requested by Slack in the Retry-After header of an HTTP 429 response.
+func retryAfter(resp *http.Response) time.Duration {
+	if n, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second
+	}
+
+	return DefaultRetryAfter
+}
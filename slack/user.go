@@ -8,3 +8,10 @@ type User struct {
 func (u User) String() string {
 	return "<@" + u.ID + "|" + u.Name + ">"
 }
+
+// OpenIDIdentity is the identity of a user who has signed in with Slack.
+type OpenIDIdentity struct {
+	UserID string `json:"https://slack.com/user_id"`
+	TeamID string `json:"https://slack.com/team_id"`
+	Name   string `json:"name"`
+}
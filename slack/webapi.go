@@ -1,36 +1,72 @@
 package slack
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 )
 
 const SlackWebAPIEndpoint = "https://slack.com/api"
 
+const (
+	// DefaultTimeout limits the time WebAPI waits for a response to a single request.
+	DefaultTimeout = 10 * time.Second
+	// DefaultMaxRetries is the number of times a rate-limited call is retried before giving up.
+	DefaultMaxRetries = 3
+)
+
+// ErrorCodeRateLimited is the error code returned for calls that exceeded the Web API rate limit.
+const ErrorCodeRateLimited = "ratelimited"
+
+// WebAPIError is returned for failed Web API calls. Code contains the error code returned by Slack,
+// i.e. channel_not_found, and is empty if the call failed for another reason.
 type WebAPIError struct {
 	Method, URL, Response string
+	Code                  string
 }
 
 func (e *WebAPIError) Error() string {
 	return fmt.Sprintf("%s (method: %s, url: %s)", e.Response, e.Method, e.URL)
 }
 
+// ErrorCode returns the Slack error code of a failed Web API call or an empty string if err is not a *WebAPIError.
+func ErrorCode(err error) string {
+	var e *WebAPIError
+	if errors.As(err, &e) {
+		return e.Code
+	}
+
+	return ""
+}
+
 type WebAPI struct {
-	c     *http.Client
-	token string
+	c       *http.Client
+	token   string
+	limiter *rateLimiter
 
 	BaseURL string
+	// Timeout limits the time to wait for a response to a single request. Calls to rate-limited methods may take
+	// longer, since they are retried after the period of time requested by Slack. Use context-aware methods to
+	// limit the total time of a call.
+	Timeout time.Duration
+	// MaxRetries is the number of times a call is retried if Slack responds with HTTP 429 Too Many Requests.
+	MaxRetries int
 }
 
 func NewWebAPI(token string, httpClient *http.Client) *WebAPI {
 	api := &WebAPI{
-		token:   token,
-		c:       httpClient,
-		BaseURL: SlackWebAPIEndpoint,
+		token:      token,
+		c:          httpClient,
+		limiter:    newRateLimiter(),
+		BaseURL:    SlackWebAPIEndpoint,
+		Timeout:    DefaultTimeout,
+		MaxRetries: DefaultMaxRetries,
 	}
 
 	if api.c == nil {
@@ -41,23 +77,33 @@ func NewWebAPI(token string, httpClient *http.Client) *WebAPI {
 }
 
 func (api *WebAPI) SetChannelTopic(channelID, topic string) error {
-	const method = "channels.setTopic"
+	return api.SetChannelTopicContext(context.Background(), channelID, topic)
+}
+
+// SetChannelTopicContext sets the topic of a public or private channel.
+func (api *WebAPI) SetChannelTopicContext(ctx context.Context, channelID, topic string) error {
+	const method = "conversations.setTopic"
 
 	params := url.Values{}
 	params.Add("channel", channelID)
 	params.Add("topic", topic)
 
-	_, _, err := api.Call(method, params)
+	_, _, err := api.CallContext(ctx, method, params)
 	return err
 }
 
 func (api *WebAPI) GetChannelTopic(channelID string) (string, error) {
-	const method = "channels.info"
+	return api.GetChannelTopicContext(context.Background(), channelID)
+}
+
+// GetChannelTopicContext returns the topic of a public or private channel.
+func (api *WebAPI) GetChannelTopicContext(ctx context.Context, channelID string) (string, error) {
+	const method = "conversations.info"
 
 	params := url.Values{}
 	params.Add("channel", channelID)
 
-	resp, requestURL, err := api.Call(method, params)
+	resp, requestURL, err := api.CallContext(ctx, method, params)
 	if err != nil {
 		return "", err
 	}
@@ -77,9 +123,14 @@ func (api *WebAPI) GetChannelTopic(channelID string) (string, error) {
 }
 
 func (api *WebAPI) ListUsers() ([]User, error) {
+	return api.ListUsersContext(context.Background())
+}
+
+// ListUsersContext returns all users of the team.
+func (api *WebAPI) ListUsersContext(ctx context.Context) ([]User, error) {
 	const method = "users.list"
 
-	resp, requestURL, err := api.Call(method, nil)
+	resp, requestURL, err := api.CallContext(ctx, method, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -95,40 +146,105 @@ func (api *WebAPI) ListUsers() ([]User, error) {
 }
 
 func (api *WebAPI) PostMessage(channelID string, message Message) error {
+	return api.PostMessageContext(context.Background(), channelID, message)
+}
+
+// PostMessageContext posts a message to the channel.
+func (api *WebAPI) PostMessageContext(ctx context.Context, channelID string, message Message) error {
+	_, err := api.PostChannelMessageContext(ctx, channelID, message)
+	return err
+}
+
+// PostChannelMessage posts a message to the channel and returns its timestamp that can be used to update it later.
+func (api *WebAPI) PostChannelMessage(channelID string, message Message) (string, error) {
+	return api.PostChannelMessageContext(context.Background(), channelID, message)
+}
+
+// PostChannelMessageContext is a context-aware variant of PostChannelMessage.
+func (api *WebAPI) PostChannelMessageContext(ctx context.Context, channelID string, message Message) (string, error) {
 	const method = "chat.postMessage"
 
+	params, err := messageParams(channelID, message)
+	if err != nil {
+		return "", err
+	}
+	params.Set("link_names", "1")
+	params.Set("as_user", "true")
+
+	resp, requestURL, err := api.CallContext(ctx, method, params)
+	if err != nil {
+		return "", wrapError(fmt.Errorf("failed to post message %v to channel %s: %w", message, channelID, err), method, requestURL)
+	}
+
+	var v struct {
+		TS string `json:"ts"`
+	}
+	if err := json.Unmarshal(resp, &v); err != nil {
+		return "", wrapError(fmt.Errorf("failed to decode response body %q (%s)", resp, err), method, requestURL)
+	}
+
+	return v.TS, nil
+}
+
+// UpdateMessage replaces the text and attachments of a message previously posted to the channel.
+func (api *WebAPI) UpdateMessage(channelID, ts string, message Message) error {
+	return api.UpdateMessageContext(context.Background(), channelID, ts, message)
+}
+
+// UpdateMessageContext is a context-aware variant of UpdateMessage.
+func (api *WebAPI) UpdateMessageContext(ctx context.Context, channelID, ts string, message Message) error {
+	const method = "chat.update"
+
+	params, err := messageParams(channelID, message)
+	if err != nil {
+		return err
+	}
+	params.Set("ts", ts)
+	params.Set("link_names", "1")
+
+	_, requestURL, err := api.CallContext(ctx, method, params)
+	if err != nil {
+		return wrapError(fmt.Errorf("failed to update message %s in channel %s: %w", ts, channelID, err), method, requestURL)
+	}
+
+	return nil
+}
+
+func messageParams(channelID string, message Message) (url.Values, error) {
 	params := url.Values{}
 	params.Set("channel", channelID)
 	params.Set("text", message.Text)
-	params.Set("link_names", "1")
-	params.Set("as_user", "true")
+
+	if message.ThreadTS != "" {
+		params.Set("thread_ts", message.ThreadTS)
+	}
 
 	if len(message.Attachments) > 0 {
 		attachments, err := json.Marshal(message.Attachments)
 		if err != nil {
-			return fmt.Errorf("failed to encode attachments for message %s: %s", message.Text, err)
+			return nil, fmt.Errorf("failed to encode attachments for message %s: %s", message.Text, err)
 		}
 
 		params.Set("attachments", string(attachments))
 	}
 
-	_, requestURL, err := api.Call(method, params)
-	if err != nil {
-		return wrapError(fmt.Errorf("failed to post message %v to channel %s: %s", message, channelID, err), method, requestURL)
-	}
-
-	return nil
+	return params, nil
 }
 
 func (api *WebAPI) OpenIMChannel(user User) (string, error) {
-	const method = "im.open"
+	return api.OpenIMChannelContext(context.Background(), user)
+}
+
+// OpenIMChannelContext opens a direct message channel with user and returns its ID.
+func (api *WebAPI) OpenIMChannelContext(ctx context.Context, user User) (string, error) {
+	const method = "conversations.open"
 
 	params := url.Values{}
-	params.Set("user", user.ID)
+	params.Set("users", user.ID)
 
-	resp, requestURL, err := api.Call(method, params)
+	resp, requestURL, err := api.CallContext(ctx, method, params)
 	if err != nil {
-		return "", fmt.Errorf("failed to open an IM message with %s: %s", user, err)
+		return "", wrapError(fmt.Errorf("failed to open an IM message with %s: %w", user, err), method, requestURL)
 	}
 
 	var v struct {
@@ -143,62 +259,235 @@ func (api *WebAPI) OpenIMChannel(user User) (string, error) {
 	return v.Channel.ID, nil
 }
 
+// ListChannelMembers returns IDs of all users that are members of a channel.
+func (api *WebAPI) ListChannelMembers(channelID string) ([]string, error) {
+	return api.ListChannelMembersContext(context.Background(), channelID)
+}
+
+// ListChannelMembersContext is a context-aware variant of ListChannelMembers.
+func (api *WebAPI) ListChannelMembersContext(ctx context.Context, channelID string) ([]string, error) {
+	const method = "conversations.members"
+
+	var members []string
+	for cursor := ""; ; {
+		params := url.Values{}
+		params.Set("channel", channelID)
+		params.Set("limit", "1000")
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+
+		resp, requestURL, err := api.CallContext(ctx, method, params)
+		if err != nil {
+			return nil, err
+		}
+
+		var v struct {
+			Members          []string `json:"members"`
+			ResponseMetadata struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"response_metadata"`
+		}
+		if err := json.Unmarshal(resp, &v); err != nil {
+			return nil, wrapError(fmt.Errorf("failed to decode response body %q (%s)", resp, err), method, requestURL)
+		}
+
+		members = append(members, v.Members...)
+
+		if cursor = v.ResponseMetadata.NextCursor; cursor == "" {
+			return members, nil
+		}
+	}
+}
+
+// ExchangeOpenIDCode exchanges an authorization code returned by "Sign in with Slack" flow for a user access token.
+// This method does not require WebAPI token.
+func (api *WebAPI) ExchangeOpenIDCode(clientID, clientSecret, code, redirectURI string) (string, error) {
+	return api.ExchangeOpenIDCodeContext(context.Background(), clientID, clientSecret, code, redirectURI)
+}
+
+// ExchangeOpenIDCodeContext is a context-aware variant of ExchangeOpenIDCode.
+func (api *WebAPI) ExchangeOpenIDCodeContext(ctx context.Context, clientID, clientSecret, code, redirectURI string) (string, error) {
+	const method = "openid.connect.token"
+
+	params := url.Values{}
+	params.Set("client_id", clientID)
+	params.Set("client_secret", clientSecret)
+	params.Set("code", code)
+	params.Set("redirect_uri", redirectURI)
+
+	resp, requestURL, err := api.withToken("").CallContext(ctx, method, params)
+	if err != nil {
+		return "", err
+	}
+
+	var v struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(resp, &v); err != nil {
+		return "", wrapError(fmt.Errorf("failed to decode response body %q (%s)", resp, err), method, requestURL)
+	}
+
+	if v.AccessToken == "" {
+		return "", wrapError(errors.New("WebAPI returned an empty access token"), method, requestURL)
+	}
+
+	return v.AccessToken, nil
+}
+
+// OpenIDUserInfo returns the identity of a user who has signed in with Slack and obtained accessToken.
+func (api *WebAPI) OpenIDUserInfo(accessToken string) (OpenIDIdentity, error) {
+	return api.OpenIDUserInfoContext(context.Background(), accessToken)
+}
+
+// OpenIDUserInfoContext is a context-aware variant of OpenIDUserInfo.
+func (api *WebAPI) OpenIDUserInfoContext(ctx context.Context, accessToken string) (OpenIDIdentity, error) {
+	const method = "openid.connect.userInfo"
+
+	resp, requestURL, err := api.withToken(accessToken).CallContext(ctx, method, nil)
+	if err != nil {
+		return OpenIDIdentity{}, err
+	}
+
+	var identity OpenIDIdentity
+	if err := json.Unmarshal(resp, &identity); err != nil {
+		return OpenIDIdentity{}, wrapError(fmt.Errorf("failed to decode response body %q (%s)", resp, err), method, requestURL)
+	}
+
+	return identity, nil
+}
+
+// withToken returns a copy of api that uses another token to authenticate requests. The copy shares rate limits
+// with api.
+func (api *WebAPI) withToken(token string) *WebAPI {
+	return &WebAPI{
+		c:          api.c,
+		token:      token,
+		limiter:    api.limiter,
+		BaseURL:    api.BaseURL,
+		Timeout:    api.Timeout,
+		MaxRetries: api.MaxRetries,
+	}
+}
+
+// Call sends a POST request to Web API method authenticated with the bearer token and returns the response body.
 func (api *WebAPI) Call(method string, params url.Values) (response []byte, u *url.URL, err error) {
-	req, err := http.NewRequest("GET", api.BaseURL+"/"+method, nil)
+	return api.CallContext(context.Background(), method, params)
+}
+
+// CallContext is a context-aware variant of Call. Calls to a method that has been rate-limited are paused until
+// the time requested by Slack in Retry-After header and retried up to api.MaxRetries times.
+func (api *WebAPI) CallContext(ctx context.Context, method string, params url.Values) (response []byte, u *url.URL, err error) {
+	u, err = url.Parse(api.BaseURL + "/" + method)
 	if err != nil {
 		return nil, &url.URL{Opaque: api.BaseURL + "/" + method}, wrapError(fmt.Errorf("failed to build WebAPI request (%s)", err), method, nil)
 	}
 
-	if params == nil {
-		params = url.Values{}
+	var lastErr *WebAPIError
+	for attempt := 0; ; attempt++ {
+		if err := api.limiter.Wait(ctx, method); err != nil {
+			if lastErr != nil {
+				return nil, u, lastErr
+			}
+
+			e := wrapError(fmt.Errorf("method is rate-limited (%s)", err), method, u)
+			e.Code = ErrorCodeRateLimited
+
+			return nil, u, e
+		}
+
+		body, err := api.do(ctx, method, u, params)
+		if err == nil {
+			return body, u, nil
+		}
+
+		if err.Code != ErrorCodeRateLimited || attempt >= api.MaxRetries {
+			return nil, u, err
+		}
+
+		lastErr = err
+	}
+}
+
+func (api *WebAPI) do(ctx context.Context, method string, u *url.URL, params url.Values) ([]byte, *WebAPIError) {
+	if api.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, api.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, wrapError(fmt.Errorf("failed to build WebAPI request (%s)", err), method, u)
 	}
 
-	params.Add("token", api.token)
-	req.URL.RawQuery = params.Encode()
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if api.token != "" {
+		req.Header.Set("Authorization", "Bearer "+api.token)
+	}
 
 	resp, err := api.c.Do(req)
 	if err != nil {
-		return nil, req.URL, wrapError(fmt.Errorf("failed to call method (%s)", err), method, req.URL)
+		return nil, wrapError(fmt.Errorf("failed to call method (%s)", err), method, u)
 	}
 	defer resp.Body.Close()
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, req.URL, wrapError(fmt.Errorf("failed to read response body (%s)", err), method, req.URL)
-	}
-
-	if resp.StatusCode >= http.StatusBadRequest {
-		return nil, req.URL, wrapError(fmt.Errorf("WebAPI responded with HTTP %d %q", resp.StatusCode, body), method, req.URL)
+		return nil, wrapError(fmt.Errorf("failed to read response body (%s)", err), method, u)
 	}
 
 	var v struct {
 		Ok    bool   `json:"ok"`
 		Error string `json:"error"`
 	}
-	if err := json.Unmarshal(body, &v); err != nil {
-		return nil, req.URL, wrapError(fmt.Errorf("failed to decode response body %q (%s)", body, err), method, req.URL)
+	decodeErr := json.Unmarshal(body, &v)
+
+	if resp.StatusCode == http.StatusTooManyRequests || v.Error == ErrorCodeRateLimited {
+		d := retryAfter(resp)
+		api.limiter.Block(method, d)
+
+		e := wrapError(fmt.Errorf("WebAPI rate limit exceeded, retry after %s", d), method, u)
+		e.Code = ErrorCodeRateLimited
+
+		return nil, e
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := wrapError(fmt.Errorf("WebAPI responded with HTTP %d %q", resp.StatusCode, body), method, u)
+		e.Code = v.Error
+
+		return nil, e
+	}
+
+	if decodeErr != nil {
+		return nil, wrapError(fmt.Errorf("failed to decode response body %q (%s)", body, decodeErr), method, u)
 	}
 
 	if !v.Ok {
 		if v.Error != "" {
-			return nil, req.URL, wrapError(fmt.Errorf("WebAPI returned error (%s)", v.Error), method, req.URL)
-		} else {
-			return nil, req.URL, wrapError(errors.New("WebAPI returned unknown error"), method, req.URL)
+			e := wrapError(fmt.Errorf("WebAPI returned error (%s)", v.Error), method, u)
+			e.Code = v.Error
+
+			return nil, e
 		}
+
+		return nil, wrapError(errors.New("WebAPI returned unknown error"), method, u)
 	}
 
-	return body, req.URL, nil
+	return body, nil
 }
 
+// wrapError returns a *WebAPIError for a failed call to method. The Slack error code is preserved if err wraps
+// another *WebAPIError.
 func wrapError(err error, method string, url *url.URL) *WebAPIError {
 	e := &WebAPIError{
 		Method:   method,
-		URL:      url.String(),
 		Response: err.Error(),
+		Code:     ErrorCode(err),
 	}
 
 	if url != nil {
-		url.Query().Set("token", "[hidden]")
 		e.URL = url.String()
 	}
 
@@ -1,11 +1,13 @@
 package slack_test
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/andrewslotin/michael/slack"
 	"github.com/stretchr/testify/assert"
@@ -18,9 +20,11 @@ func TestWebAPI_Call_WithParams(t *testing.T) {
 
 	var requestNum int
 	mux.HandleFunc("/methodName", func(w http.ResponseWriter, r *http.Request) {
-		assert.Equal(t, "value1", r.FormValue("key1"))
-		assert.Equal(t, "value2", r.FormValue("key2"))
-		assert.Equal(t, "xxxx-token-12345", r.FormValue("token"))
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Empty(t, r.URL.RawQuery)
+		assert.Equal(t, "value1", r.PostFormValue("key1"))
+		assert.Equal(t, "value2", r.PostFormValue("key2"))
+		assert.Equal(t, "Bearer xxxx-token-12345", r.Header.Get("Authorization"))
 
 		requestNum++
 		w.Write([]byte(`{"ok":true}`))
@@ -45,7 +49,7 @@ func TestWebAPI_Call_WithoutParams(t *testing.T) {
 
 	var requestNum int
 	mux.HandleFunc("/methodName", func(w http.ResponseWriter, r *http.Request) {
-		assert.Equal(t, "xxxx-token-12345", r.FormValue("token"))
+		assert.Equal(t, "Bearer xxxx-token-12345", r.Header.Get("Authorization"))
 
 		requestNum++
 		w.Write([]byte(`{"ok":true}`))
@@ -66,10 +70,10 @@ func TestWebAPI_Call_WebAPIError(t *testing.T) {
 
 	var requestNum int
 	mux.HandleFunc("/methodName", func(w http.ResponseWriter, r *http.Request) {
-		assert.Equal(t, "xxxx-token-12345", r.FormValue("token"))
+		assert.Equal(t, "Bearer xxxx-token-12345", r.Header.Get("Authorization"))
 
 		requestNum++
-		w.Write([]byte(`{"ok":false,"error":"an error occurred"}`))
+		w.Write([]byte(`{"ok":false,"error":"an_error_occurred"}`))
 	})
 
 	api := slack.NewWebAPI("xxxx-token-12345", nil)
@@ -83,7 +87,9 @@ func TestWebAPI_Call_WebAPIError(t *testing.T) {
 		if assert.IsType(t, slackErr, err) {
 			slackErr = err.(*slack.WebAPIError)
 			assert.Equal(t, "methodName", slackErr.Method)
+			assert.Equal(t, "an_error_occurred", slackErr.Code)
 			assert.NotEmpty(t, slackErr.URL)
+			assert.NotContains(t, slackErr.URL, "xxxx-token-12345")
 		}
 	}
 }
@@ -114,14 +120,133 @@ func TestWebAPI_Call_HTTPError(t *testing.T) {
 	}
 }
 
-func TestWebAPI_ChannelsSetTopic(t *testing.T) {
+func TestWebAPI_Call_RateLimited(t *testing.T) {
+	mux, baseURL, teardown := setup()
+	defer teardown()
+
+	var requestTimes []time.Time
+	mux.HandleFunc("/methodName", func(w http.ResponseWriter, r *http.Request) {
+		requestTimes = append(requestTimes, time.Now())
+
+		if len(requestTimes) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"ok":false,"error":"ratelimited"}`))
+
+			return
+		}
+
+		w.Write([]byte(`{"ok":true}`))
+	})
+
+	api := slack.NewWebAPI("xxxx-token-12345", nil)
+	api.BaseURL = baseURL
+
+	response, _, err := api.Call("methodName", nil)
+	require.NoError(t, err)
+	assert.Equal(t, `{"ok":true}`, string(response))
+
+	if assert.Len(t, requestTimes, 2) {
+		assert.True(t, requestTimes[1].Sub(requestTimes[0]) >= time.Second, "expected the call to be retried after 1s")
+	}
+}
+
+func TestWebAPI_Call_RateLimited_MaxRetries(t *testing.T) {
 	mux, baseURL, teardown := setup()
 	defer teardown()
 
 	var requestNum int
-	mux.HandleFunc("/channels.setTopic", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/methodName", func(w http.ResponseWriter, r *http.Request) {
+		requestNum++
+
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	api := slack.NewWebAPI("xxxx-token-12345", nil)
+	api.BaseURL = baseURL
+	api.MaxRetries = 2
+
+	_, _, err := api.Call("methodName", nil)
+	require.Error(t, err)
+	assert.Equal(t, 3, requestNum)
+	assert.Equal(t, slack.ErrorCodeRateLimited, slack.ErrorCode(err))
+}
+
+func TestWebAPI_CallContext_RateLimitedMethod(t *testing.T) {
+	mux, baseURL, teardown := setup()
+	defer teardown()
+
+	var requestNum struct{ Limited, Other int }
+	mux.HandleFunc("/limitedMethod", func(w http.ResponseWriter, r *http.Request) {
+		requestNum.Limited++
+
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	mux.HandleFunc("/otherMethod", func(w http.ResponseWriter, r *http.Request) {
+		requestNum.Other++
+		w.Write([]byte(`{"ok":true}`))
+	})
+
+	api := slack.NewWebAPI("xxxx-token-12345", nil)
+	api.BaseURL = baseURL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, _, err := api.CallContext(ctx, "limitedMethod", nil)
+	require.Error(t, err)
+	assert.Equal(t, slack.ErrorCodeRateLimited, slack.ErrorCode(err))
+	assert.Equal(t, 1, requestNum.Limited)
+
+	// further calls to the rate-limited method are not sent until the Retry-After period is over
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, _, err = api.CallContext(ctx, "limitedMethod", nil)
+	require.Error(t, err)
+	assert.Equal(t, slack.ErrorCodeRateLimited, slack.ErrorCode(err))
+	assert.Equal(t, 1, requestNum.Limited)
+
+	// while other methods can still be called
+	_, _, err = api.CallContext(context.Background(), "otherMethod", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requestNum.Other)
+}
+
+func TestWebAPI_Call_Timeout(t *testing.T) {
+	mux, baseURL, teardown := setup()
+	defer teardown()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	mux.HandleFunc("/methodName", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+		}
+
+		w.Write([]byte(`{"ok":true}`))
+	})
+
+	api := slack.NewWebAPI("xxxx-token-12345", nil)
+	api.BaseURL = baseURL
+	api.Timeout = 50 * time.Millisecond
+
+	_, _, err := api.Call("methodName", nil)
+	assert.Error(t, err)
+}
+
+func TestWebAPI_SetChannelTopic(t *testing.T) {
+	mux, baseURL, teardown := setup()
+	defer teardown()
+
+	var requestNum int
+	mux.HandleFunc("/conversations.setTopic", func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, "CHANNELID1", r.FormValue("channel"))
-		assert.Equal(t, "xxxx-token-12345", r.FormValue("token"))
+		assert.Equal(t, "Bearer xxxx-token-12345", r.Header.Get("Authorization"))
 		assert.Equal(t, "Example topic", r.FormValue("topic"))
 
 		requestNum++
@@ -135,14 +260,14 @@ func TestWebAPI_ChannelsSetTopic(t *testing.T) {
 	require.Equal(t, 1, requestNum)
 }
 
-func TestWebAPI_ChannelsSetTopic_ErrorHandling(t *testing.T) {
+func TestWebAPI_SetChannelTopic_ErrorHandling(t *testing.T) {
 	mux, baseURL, teardown := setup()
 	defer teardown()
 
 	var requestNum int
-	mux.HandleFunc("/channels.setTopic", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/conversations.setTopic", func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, "CHANNELID1", r.FormValue("channel"))
-		assert.Equal(t, "xxxx-token-12345", r.FormValue("token"))
+		assert.Equal(t, "Bearer xxxx-token-12345", r.Header.Get("Authorization"))
 		assert.Equal(t, "Example topic", r.FormValue("topic"))
 
 		requestNum++
@@ -157,14 +282,14 @@ func TestWebAPI_ChannelsSetTopic_ErrorHandling(t *testing.T) {
 	assert.Error(t, err)
 }
 
-func TestWebAPI_ChannelsGetTopic(t *testing.T) {
+func TestWebAPI_GetChannelTopic(t *testing.T) {
 	mux, baseURL, teardown := setup()
 	defer teardown()
 
 	var requestNum int
-	mux.HandleFunc("/channels.info", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/conversations.info", func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, "CHANNELID1", r.FormValue("channel"))
-		assert.Equal(t, "xxxx-token-12345", r.FormValue("token"))
+		assert.Equal(t, "Bearer xxxx-token-12345", r.Header.Get("Authorization"))
 
 		requestNum++
 		w.Write([]byte(`{"ok":true,"channel":{"topic":{"value":"Example topic"}}}`))
@@ -180,14 +305,14 @@ func TestWebAPI_ChannelsGetTopic(t *testing.T) {
 	assert.Equal(t, "Example topic", topic)
 }
 
-func TestWebAPI_ChannelsGetTopic_ErrorHandling(t *testing.T) {
+func TestWebAPI_GetChannelTopic_ErrorHandling(t *testing.T) {
 	mux, baseURL, teardown := setup()
 	defer teardown()
 
 	var requestNum int
-	mux.HandleFunc("/channels.info", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/conversations.info", func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, "CHANNELID1", r.FormValue("channel"))
-		assert.Equal(t, "xxxx-token-12345", r.FormValue("token"))
+		assert.Equal(t, "Bearer xxxx-token-12345", r.Header.Get("Authorization"))
 
 		requestNum++
 		w.Write([]byte(`{"ok":false,"error":"channel not found"}`))
@@ -207,7 +332,7 @@ func TestWebAPI_ListUsers(t *testing.T) {
 
 	var requestNum int
 	mux.HandleFunc("/users.list", func(w http.ResponseWriter, r *http.Request) {
-		assert.Equal(t, "xxxx-token-12345", r.FormValue("token"))
+		assert.Equal(t, "Bearer xxxx-token-12345", r.Header.Get("Authorization"))
 
 		requestNum++
 		w.Write([]byte(`{"ok":true,"members":[{"id":"U1","name":"user1"},{"id":"U2","name":"user2"}]}`))
@@ -232,7 +357,7 @@ func TestWebAPI_ListUsers_ErrorHandling(t *testing.T) {
 
 	var requestNum int
 	mux.HandleFunc("/users.list", func(w http.ResponseWriter, r *http.Request) {
-		assert.Equal(t, "xxxx-token-12345", r.FormValue("token"))
+		assert.Equal(t, "Bearer xxxx-token-12345", r.Header.Get("Authorization"))
 
 		requestNum++
 		w.Write([]byte(`{"ok":false,"error":"no users"`))
@@ -254,7 +379,7 @@ func TestWebAPI_PostMessage_WithoutAttachments(t *testing.T) {
 
 	var requestNum int
 	mux.HandleFunc("/chat.postMessage", func(w http.ResponseWriter, r *http.Request) {
-		assert.Equal(t, "xxxx-token-12345", r.FormValue("token"))
+		assert.Equal(t, "Bearer xxxx-token-12345", r.Header.Get("Authorization"))
 		assert.Equal(t, "channel1", r.FormValue("channel"))
 		assert.Equal(t, "1", r.FormValue("link_names"))
 		assert.Equal(t, "true", r.FormValue("as_user"))
@@ -285,7 +410,7 @@ func TestWebAPI_PostMessage_WithAttachments(t *testing.T) {
 
 	var requestNum int
 	mux.HandleFunc("/chat.postMessage", func(w http.ResponseWriter, r *http.Request) {
-		assert.Equal(t, "xxxx-token-12345", r.FormValue("token"))
+		assert.Equal(t, "Bearer xxxx-token-12345", r.Header.Get("Authorization"))
 		assert.Equal(t, "channel1", r.FormValue("channel"))
 		assert.Equal(t, "1", r.FormValue("link_names"))
 		assert.Equal(t, "true", r.FormValue("as_user"))
@@ -308,6 +433,75 @@ func TestWebAPI_PostMessage_WithAttachments(t *testing.T) {
 	assert.Equal(t, 1, requestNum)
 }
 
+func TestWebAPI_PostChannelMessage(t *testing.T) {
+	mux, baseURL, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/chat.postMessage", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "channel1", r.FormValue("channel"))
+		assert.Equal(t, "Test message", r.FormValue("text"))
+		assert.Equal(t, "1503435900.000100", r.FormValue("thread_ts"))
+
+		w.Write([]byte(`{"ok":true,"channel":"channel1","ts":"1503435956.000247"}`))
+	})
+
+	api := slack.NewWebAPI("xxxx-token-12345", nil)
+	api.BaseURL = baseURL
+
+	ts, err := api.PostChannelMessage("channel1", slack.Message{Text: "Test message", ThreadTS: "1503435900.000100"})
+	require.NoError(t, err)
+	assert.Equal(t, "1503435956.000247", ts)
+}
+
+func TestWebAPI_PostChannelMessage_ErrorCode(t *testing.T) {
+	mux, baseURL, teardown := setup()
+	defer teardown()
+
+	mux.HandleFunc("/chat.postMessage", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error":"not_in_channel"}`))
+	})
+
+	api := slack.NewWebAPI("xxxx-token-12345", nil)
+	api.BaseURL = baseURL
+
+	_, err := api.PostChannelMessage("channel1", slack.Message{Text: "Test message"})
+	require.Error(t, err)
+	assert.Equal(t, "not_in_channel", slack.ErrorCode(err))
+}
+
+func TestWebAPI_UpdateMessage(t *testing.T) {
+	mux, baseURL, teardown := setup()
+	defer teardown()
+
+	message := slack.Message{
+		Text:        "Updated message",
+		Attachments: []slack.Attachment{{Text: "attachment 1"}},
+	}
+
+	var requestNum int
+	mux.HandleFunc("/chat.update", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer xxxx-token-12345", r.Header.Get("Authorization"))
+		assert.Equal(t, "channel1", r.FormValue("channel"))
+		assert.Equal(t, "1503435956.000247", r.FormValue("ts"))
+		assert.Equal(t, message.Text, r.FormValue("text"))
+
+		if encodedAttachments := r.FormValue("attachments"); assert.NotEmpty(t, encodedAttachments) {
+			var attachments []slack.Attachment
+			require.NoError(t, json.Unmarshal([]byte(encodedAttachments), &attachments))
+			assert.Equal(t, message.Attachments, attachments)
+		}
+
+		requestNum++
+		w.Write([]byte(`{"ok":true}`))
+	})
+
+	api := slack.NewWebAPI("xxxx-token-12345", nil)
+	api.BaseURL = baseURL
+
+	require.NoError(t, api.UpdateMessage("channel1", "1503435956.000247", message))
+	assert.Equal(t, 1, requestNum)
+}
+
 func TestWebAPI_OpenIMChannel(t *testing.T) {
 	mux, baseURL, teardown := setup()
 	defer teardown()
@@ -315,9 +509,9 @@ func TestWebAPI_OpenIMChannel(t *testing.T) {
 	user := slack.User{ID: "123", Name: "user1"}
 
 	var requestNum int
-	mux.HandleFunc("/im.open", func(w http.ResponseWriter, r *http.Request) {
-		assert.Equal(t, "xxxx-token-12345", r.FormValue("token"))
-		assert.Equal(t, user.ID, r.FormValue("user"))
+	mux.HandleFunc("/conversations.open", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer xxxx-token-12345", r.Header.Get("Authorization"))
+		assert.Equal(t, user.ID, r.FormValue("users"))
 
 		requestNum++
 		w.Write([]byte(`{"ok":true,"channel":{"id":"channel1"}}`))
@@ -340,9 +534,9 @@ func TestWebAPI_OpenIMChannel_ErrorHandling(t *testing.T) {
 	user := slack.User{ID: "123", Name: "user1"}
 
 	var requestNum int
-	mux.HandleFunc("/im.open", func(w http.ResponseWriter, r *http.Request) {
-		assert.Equal(t, "xxxx-token-12345", r.FormValue("token"))
-		assert.Equal(t, user.ID, r.FormValue("user"))
+	mux.HandleFunc("/conversations.open", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer xxxx-token-12345", r.Header.Get("Authorization"))
+		assert.Equal(t, user.ID, r.FormValue("users"))
 
 		requestNum++
 		w.Write([]byte(`{"ok":false,"error":"user_not_found"`))
@@ -356,6 +550,120 @@ func TestWebAPI_OpenIMChannel_ErrorHandling(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestWebAPI_ListChannelMembers(t *testing.T) {
+	mux, baseURL, teardown := setup()
+	defer teardown()
+
+	var requestNum int
+	mux.HandleFunc("/conversations.members", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer xxxx-token-12345", r.Header.Get("Authorization"))
+		assert.Equal(t, "channel1", r.FormValue("channel"))
+
+		requestNum++
+		switch r.FormValue("cursor") {
+		case "":
+			w.Write([]byte(`{"ok":true,"members":["U1","U2"],"response_metadata":{"next_cursor":"cursor1"}}`))
+		case "cursor1":
+			w.Write([]byte(`{"ok":true,"members":["U3"],"response_metadata":{"next_cursor":""}}`))
+		default:
+			t.Errorf("unexpected cursor %q", r.FormValue("cursor"))
+		}
+	})
+
+	api := slack.NewWebAPI("xxxx-token-12345", nil)
+	api.BaseURL = baseURL
+
+	members, err := api.ListChannelMembers("channel1")
+	require.NoError(t, err)
+	require.Equal(t, 2, requestNum)
+
+	assert.Equal(t, []string{"U1", "U2", "U3"}, members)
+}
+
+func TestWebAPI_ListChannelMembers_ErrorHandling(t *testing.T) {
+	mux, baseURL, teardown := setup()
+	defer teardown()
+
+	var requestNum int
+	mux.HandleFunc("/conversations.members", func(w http.ResponseWriter, r *http.Request) {
+		requestNum++
+		w.Write([]byte(`{"ok":false,"error":"channel_not_found"}`))
+	})
+
+	api := slack.NewWebAPI("xxxx-token-12345", nil)
+	api.BaseURL = baseURL
+
+	_, err := api.ListChannelMembers("channel1")
+	require.Equal(t, 1, requestNum)
+	assert.Error(t, err)
+}
+
+func TestWebAPI_ExchangeOpenIDCode(t *testing.T) {
+	mux, baseURL, teardown := setup()
+	defer teardown()
+
+	var requestNum int
+	mux.HandleFunc("/openid.connect.token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "client1", r.FormValue("client_id"))
+		assert.Empty(t, r.Header.Get("Authorization"), "expected no WebAPI token to be sent")
+		assert.Equal(t, "secret1", r.FormValue("client_secret"))
+		assert.Equal(t, "code1", r.FormValue("code"))
+		assert.Equal(t, "https://example.com/auth/slack", r.FormValue("redirect_uri"))
+
+		requestNum++
+		w.Write([]byte(`{"ok":true,"access_token":"xoxp-1234","token_type":"Bearer","id_token":"abc"}`))
+	})
+
+	api := slack.NewWebAPI("xxxx-token-12345", nil)
+	api.BaseURL = baseURL
+
+	token, err := api.ExchangeOpenIDCode("client1", "secret1", "code1", "https://example.com/auth/slack")
+	require.NoError(t, err)
+	require.Equal(t, 1, requestNum)
+
+	assert.Equal(t, "xoxp-1234", token)
+}
+
+func TestWebAPI_ExchangeOpenIDCode_ErrorHandling(t *testing.T) {
+	mux, baseURL, teardown := setup()
+	defer teardown()
+
+	var requestNum int
+	mux.HandleFunc("/openid.connect.token", func(w http.ResponseWriter, r *http.Request) {
+		requestNum++
+		w.Write([]byte(`{"ok":false,"error":"invalid_code"}`))
+	})
+
+	api := slack.NewWebAPI("xxxx-token-12345", nil)
+	api.BaseURL = baseURL
+
+	_, err := api.ExchangeOpenIDCode("client1", "secret1", "code1", "https://example.com/auth/slack")
+	require.Equal(t, 1, requestNum)
+	assert.Error(t, err)
+}
+
+func TestWebAPI_OpenIDUserInfo(t *testing.T) {
+	mux, baseURL, teardown := setup()
+	defer teardown()
+
+	var requestNum int
+	mux.HandleFunc("/openid.connect.userInfo", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer xoxp-1234", r.Header.Get("Authorization"))
+
+		requestNum++
+		w.Write([]byte(`{"ok":true,"sub":"U1","https://slack.com/user_id":"U1","https://slack.com/team_id":"T1","name":"user1"}`))
+	})
+
+	api := slack.NewWebAPI("xxxx-token-12345", nil)
+	api.BaseURL = baseURL
+
+	identity, err := api.OpenIDUserInfo("xoxp-1234")
+	require.NoError(t, err)
+	require.Equal(t, 1, requestNum)
+
+	assert.Equal(t, slack.OpenIDIdentity{UserID: "U1", TeamID: "T1", Name: "user1"}, identity)
+}
+
 func setup() (mux *http.ServeMux, baseURL string, teardownFn func()) {
 	mux = http.NewServeMux()
 	ts := httptest.NewServer(mux)